@@ -1,14 +1,48 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tr1v3r/rcast/internal/dial"
+	"github.com/tr1v3r/rcast/internal/quirk"
+	"github.com/tr1v3r/rcast/internal/session"
+)
+
+const (
+	DefaultPort         = 8200
+	DefaultUUIDPath     = ".local/rcast/dmr_uuid.txt"
+	DefaultManufacturer = "GoDLNA"
+	DefaultModelName    = "GoDLNA-DMR"
+	// DefaultResumeMargin is how close to the start or end of a media a
+	// remembered position may be and still be skipped, in seconds.
+	DefaultResumeMargin = 30
+)
+
+// UPnP Device Architecture length limits for the description fields.
+const (
+	maxFriendlyName = 64
+	maxManufacturer = 64
+	maxModelName    = 32
 )
 
+// hostname is a var so tests can pin the default friendly name.
+var hostname = os.Hostname
+
+// Player backends selectable through DMR_PLAYER.
 const (
-	DefaultPort     = 8200
-	DefaultUUIDPath = ".local/rcast/dmr_uuid.txt"
+	PlayerIINA = "iina"
+	PlayerMPV  = "mpv"
 )
 
 type Config struct {
@@ -18,59 +52,350 @@ type Config struct {
 	HTTPPort               int
 	AdvertiseIP            string
 	IINAFullscreen         bool
+	// AudioDevice is the player's audio output, as mpv's --audio-device
+	// names it; empty keeps the player's default.
+	AudioDevice         string
+	Player              string
+	FriendlyName        string
+	Manufacturer        string
+	ModelName           string
+	IconDir             string
+	PersistState        bool
+	ResumePositions     bool
+	ResumeMarginSeconds int
+	History             bool
+	Debug               bool
+	// Quirks are controller workaround profiles tried before the built-in
+	// ones.
+	Quirks []quirk.Profile
+	// DIALApps are the DIAL apps served besides the built-in ones; an app
+	// named like a built-in one replaces it.
+	DIALApps []dial.App
+	// Session restricts which controllers may take or preempt the session.
+	Session session.Policy
+	// Devices are the renderers the host exposes when there are several;
+	// empty means a single renderer described by the other options.
+	Devices []Device
+	// Device is the ID of the renderer this configuration describes, set by
+	// Renderers when several share the host.
+	Device string
+
+	// Path is the config file the values were read from; empty when none
+	// was found.
+	Path string
 }
 
-func Load() Config {
+// file mirrors Config as it appears in the JSON config file. Pointer fields
+// tell an omitted key apart from a zero value, so the file only overrides
+// what it names.
+type file struct {
+	UUIDPath               *string         `json:"uuid_path"`
+	AllowSessionPreempt    *bool           `json:"allow_preempt"`
+	LinkSystemOutputVolume *bool           `json:"link_system_volume"`
+	HTTPPort               *int            `json:"http_port"`
+	AdvertiseIP            *string         `json:"advertise_ip"`
+	Fullscreen             *bool           `json:"fullscreen"`
+	AudioDevice            *string         `json:"audio_device"`
+	Player                 *string         `json:"player"`
+	FriendlyName           *string         `json:"friendly_name"`
+	Manufacturer           *string         `json:"manufacturer"`
+	ModelName              *string         `json:"model_name"`
+	IconDir                *string         `json:"icon_dir"`
+	PersistState           *bool           `json:"persist_state"`
+	ResumePositions        *bool           `json:"resume_positions"`
+	ResumeMarginSeconds    *int            `json:"resume_margin_seconds"`
+	History                *bool           `json:"history"`
+	Quirks                 []quirk.Profile `json:"quirks"`
+	DIALApps               []dial.App      `json:"dial_apps"`
+	Session                *session.Policy `json:"session"`
+	Devices                []Device        `json:"devices"`
+	Debug                  *bool           `json:"debug"`
+}
+
+// Load builds the configuration from defaults, then the config file at path,
+// then DMR_* environment variables. An empty path means DefaultPath, which
+// may be absent; a file named explicitly must exist. Values that do not parse
+// or validate are reported instead of replaced with defaults.
+func Load(path string) (Config, error) {
 	home, _ := os.UserHomeDir()
 	cfg := Config{
-		UUIDPath:               envVar("DMR_UUID_PATH", filepath.Join(home, DefaultUUIDPath)),
-		AllowSessionPreempt:    envVar("DMR_ALLOW_PREEMPT", true),
-		LinkSystemOutputVolume: envVar("DMR_LINK_SYSTEM_VOLUME", false),
-		HTTPPort:               envVar("DMR_HTTP_PORT", DefaultPort),
-		AdvertiseIP:            envVar("DMR_ADVERTISE_IP", ""),
-		IINAFullscreen:         envVar("DMR_IINA_FULLSCREEN", false),
+		UUIDPath:            filepath.Join(home, DefaultUUIDPath),
+		AllowSessionPreempt: true,
+		HTTPPort:            DefaultPort,
+		Player:              DefaultPlayer(),
+		Manufacturer:        DefaultManufacturer,
+		ModelName:           DefaultModelName,
+		ResumeMarginSeconds: DefaultResumeMargin,
 	}
 
-	// Validate configuration
-	cfg.validate()
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath()
+	}
+	if path != "" {
+		switch err := cfg.applyFile(path); {
+		case err == nil:
+			cfg.Path = path
+		case !explicit && errors.Is(err, fs.ErrNotExist):
+		default:
+			return Config{}, err
+		}
+	}
 
-	return cfg
+	if err := cfg.applyEnv(); err != nil {
+		return Config{}, err
+	}
+	cfg.Player = strings.ToLower(cfg.Player)
+	cfg.FriendlyName = strings.TrimSpace(cfg.FriendlyName)
+	if cfg.FriendlyName == "" {
+		cfg.FriendlyName = DefaultFriendlyName()
+	}
+
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
 }
 
-func envVar[T ~string | ~bool | ~int](key string, def T) T {
-	v := os.Getenv(key)
-	if v == "" {
-		return def
+// StatePath is where persisted renderer state lives: next to the UUID file,
+// so one installation's identity and state stay together.
+func (c Config) StatePath() string {
+	return filepath.Join(c.stateDir(), "state.json")
+}
+
+// PositionsPath is where the per-media resume positions are kept, next to
+// the state file.
+func (c Config) PositionsPath() string {
+	return filepath.Join(c.stateDir(), "positions.json")
+}
+
+// HistoryPath is the cast history log; rotated files get a numeric suffix.
+func (c Config) HistoryPath() string {
+	return filepath.Join(c.stateDir(), "history.jsonl")
+}
+
+// stateDir holds the state files: the UUID file's directory, or a
+// subdirectory of it per renderer when several share the host.
+func (c Config) stateDir() string {
+	if c.Device != "" {
+		return filepath.Join(filepath.Dir(c.UUIDPath), "devices", c.Device)
 	}
+	return filepath.Dir(c.UUIDPath)
+}
 
-	switch any(def).(type) {
-	case string:
-		return any(v).(T)
-	case bool:
-		if b, err := strconv.ParseBool(v); err == nil {
-			return any(b).(T)
+// DefaultPath returns $XDG_CONFIG_HOME/rcast/config.json, falling back to
+// ~/.config/rcast/config.json when XDG_CONFIG_HOME is unset.
+func DefaultPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "rcast", "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "rcast", "config.json")
+}
+
+// DefaultFriendlyName names the renderer after the host, so several rcast
+// boxes on one network can be told apart, e.g. "RCast (office-mini)".
+func DefaultFriendlyName() string {
+	host, err := hostname()
+	if err != nil {
+		return "RCast"
+	}
+	// Drop the domain, including macOS's ".local".
+	host, _, _ = strings.Cut(host, ".")
+	if host == "" {
+		return "RCast"
+	}
+	if limit := maxFriendlyName - len("RCast ()") - 1; utf8.RuneCountInString(host) > limit {
+		host = string([]rune(host)[:limit])
+	}
+	return "RCast (" + host + ")"
+}
+
+func (c *Config) applyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	var f file
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	if f.UUIDPath != nil {
+		c.UUIDPath = expandHome(*f.UUIDPath)
+	}
+	setFromFile(&c.AllowSessionPreempt, f.AllowSessionPreempt)
+	setFromFile(&c.LinkSystemOutputVolume, f.LinkSystemOutputVolume)
+	setFromFile(&c.HTTPPort, f.HTTPPort)
+	setFromFile(&c.AdvertiseIP, f.AdvertiseIP)
+	setFromFile(&c.IINAFullscreen, f.Fullscreen)
+	setFromFile(&c.AudioDevice, f.AudioDevice)
+	setFromFile(&c.Player, f.Player)
+	setFromFile(&c.FriendlyName, f.FriendlyName)
+	setFromFile(&c.Manufacturer, f.Manufacturer)
+	setFromFile(&c.ModelName, f.ModelName)
+	if f.IconDir != nil {
+		c.IconDir = expandHome(*f.IconDir)
+	}
+	setFromFile(&c.PersistState, f.PersistState)
+	setFromFile(&c.ResumePositions, f.ResumePositions)
+	setFromFile(&c.ResumeMarginSeconds, f.ResumeMarginSeconds)
+	setFromFile(&c.History, f.History)
+	setFromFile(&c.Debug, f.Debug)
+	if f.Quirks != nil {
+		c.Quirks = f.Quirks
+	}
+	if f.DIALApps != nil {
+		c.DIALApps = f.DIALApps
+	}
+	setFromFile(&c.Session, f.Session)
+	if f.Devices != nil {
+		c.Devices = f.Devices
+		for i := range c.Devices {
+			c.Devices[i].Name = strings.TrimSpace(c.Devices[i].Name)
+			if c.Devices[i].ID == "" {
+				c.Devices[i].ID = slug(c.Devices[i].Name)
+			}
 		}
-	case int:
-		if i, err := strconv.Atoi(v); err == nil {
-			return any(i).(T)
+	}
+	return nil
+}
+
+func setFromFile[T any](dst *T, v *T) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// expandHome resolves a leading "~/" so paths in the file can be written the
+// way they are typed in a shell.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
 		}
-	case int64:
-		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
-			return any(i).(T)
+	}
+	return path
+}
+
+func (c *Config) applyEnv() error {
+	return errors.Join(
+		envVar("DMR_UUID_PATH", &c.UUIDPath),
+		envVar("DMR_ALLOW_PREEMPT", &c.AllowSessionPreempt),
+		envVar("DMR_LINK_SYSTEM_VOLUME", &c.LinkSystemOutputVolume),
+		envVar("DMR_HTTP_PORT", &c.HTTPPort),
+		envVar("DMR_ADVERTISE_IP", &c.AdvertiseIP),
+		envVar("DMR_IINA_FULLSCREEN", &c.IINAFullscreen),
+		envVar("DMR_AUDIO_DEVICE", &c.AudioDevice),
+		envVar("DMR_PLAYER", &c.Player),
+		envVar("DMR_FRIENDLY_NAME", &c.FriendlyName),
+		envVar("DMR_MANUFACTURER", &c.Manufacturer),
+		envVar("DMR_MODEL_NAME", &c.ModelName),
+		envVar("DMR_ICON_DIR", &c.IconDir),
+		envVar("DMR_PERSIST_STATE", &c.PersistState),
+		envVar("DMR_RESUME_POSITIONS", &c.ResumePositions),
+		envVar("DMR_RESUME_MARGIN", &c.ResumeMarginSeconds),
+		envVar("DMR_HISTORY", &c.History),
+		envVar("DMR_DEBUG", &c.Debug),
+	)
+}
+
+// envVar overwrites *dst with the parsed value of key. Unset or empty
+// variables leave *dst alone.
+func envVar[T string | bool | int](key string, dst *T) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+
+	switch p := any(dst).(type) {
+	case *string:
+		*p = v
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s=%q is not a boolean", key, v)
 		}
-	case float64:
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			return any(f).(T)
+		*p = b
+	case *int:
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%s=%q is not an integer", key, v)
 		}
+		*p = i
 	}
-	return def
+	return nil
 }
 
-// validate performs validation on configuration values
-func (c *Config) validate() {
-	// Validate HTTP port range
+// validate reports every invalid value at once, named by its config file key.
+func (c *Config) validate() error {
+	var problems []string
+	if c.UUIDPath == "" {
+		problems = append(problems, "uuid_path is empty")
+	}
 	if c.HTTPPort < 1 || c.HTTPPort > 65535 {
-		c.HTTPPort = DefaultPort
+		problems = append(problems, fmt.Sprintf("http_port %d is outside 1-65535", c.HTTPPort))
+	}
+	if c.AdvertiseIP != "" {
+		if ip := net.ParseIP(c.AdvertiseIP); ip == nil || ip.To4() == nil {
+			problems = append(problems, fmt.Sprintf("advertise_ip %q is not an IPv4 address", c.AdvertiseIP))
+		}
+	}
+	if c.Player != PlayerIINA && c.Player != PlayerMPV {
+		problems = append(problems, fmt.Sprintf("player %q is not %q or %q", c.Player, PlayerIINA, PlayerMPV))
+	}
+	for _, field := range []struct {
+		key, value string
+		limit      int
+	}{
+		{"friendly_name", c.FriendlyName, maxFriendlyName},
+		{"manufacturer", c.Manufacturer, maxManufacturer},
+		{"model_name", c.ModelName, maxModelName},
+	} {
+		switch n := utf8.RuneCountInString(field.value); {
+		case n == 0:
+			problems = append(problems, field.key+" is empty")
+		case n >= field.limit:
+			problems = append(problems, fmt.Sprintf("%s must be shorter than %d characters", field.key, field.limit))
+		}
+	}
+	if c.IconDir != "" {
+		if info, err := os.Stat(c.IconDir); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("icon_dir %q is not a directory", c.IconDir))
+		}
 	}
+	for i, q := range c.Quirks {
+		if err := q.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("quirks[%d] %q: %v", i, q.Name, err))
+		}
+	}
+	for i, a := range c.DIALApps {
+		if err := a.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("dial_apps[%d] %q: %v", i, a.Name, err))
+		}
+	}
+	if c.ResumeMarginSeconds < 0 {
+		problems = append(problems, fmt.Sprintf("resume_margin_seconds %d is negative", c.ResumeMarginSeconds))
+	}
+	if err := c.Session.Validate(); err != nil {
+		problems = append(problems, "session: "+err.Error())
+	}
+	problems = append(problems, validateDevices(c.Devices)...)
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
 
+// DefaultPlayer returns IINA on macOS and mpv everywhere else.
+func DefaultPlayer() string {
+	if runtime.GOOS == "darwin" {
+		return PlayerIINA
+	}
+	return PlayerMPV
 }
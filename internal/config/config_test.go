@@ -1,22 +1,60 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/tr1v3r/rcast/internal/dial"
+	"github.com/tr1v3r/rcast/internal/quirk"
+	"github.com/tr1v3r/rcast/internal/session"
 )
 
-func TestLoadEnvironmentAndValidation(t *testing.T) {
-	t.Setenv("DMR_HTTP_PORT", "99999")
+// TestMain points the default config path at an empty directory so a real
+// ~/.config/rcast/config.json cannot leak into the tests.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "rcast-config")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	hostname = func() (string, error) { return "testbox.local", nil }
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// mustLoad loads with the default path and fails the test on error.
+func mustLoad(t *testing.T) Config {
+	t.Helper()
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return cfg
+}
+
+// assertLoadError expects Load to fail with a message containing want.
+func assertLoadError(t *testing.T, path, want string) {
+	t.Helper()
+	_, err := Load(path)
+	if err == nil {
+		t.Fatalf("Load(%q) succeeded, want error containing %q", path, want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("Load(%q) error = %q, want it to contain %q", path, err, want)
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
 	t.Setenv("DMR_ALLOW_PREEMPT", "false")
 	t.Setenv("DMR_ADVERTISE_IP", "192.0.2.5")
 	t.Setenv("DMR_UUID_PATH", filepath.Join(t.TempDir(), "uuid"))
 
-	cfg := Load()
-	if cfg.HTTPPort != DefaultPort {
-		t.Fatalf("invalid port=%d, want default %d", cfg.HTTPPort, DefaultPort)
-	}
+	cfg := mustLoad(t)
 	if cfg.AllowSessionPreempt {
 		t.Fatal("DMR_ALLOW_PREEMPT=false was ignored")
 	}
@@ -25,13 +63,11 @@ func TestLoadEnvironmentAndValidation(t *testing.T) {
 	}
 }
 
-func TestInvalidEnvironmentFallsBack(t *testing.T) {
+func TestInvalidEnvironmentIsAnError(t *testing.T) {
 	t.Setenv("DMR_HTTP_PORT", "not-a-number")
 	t.Setenv("DMR_LINK_SYSTEM_VOLUME", "not-a-bool")
-	cfg := Load()
-	if cfg.HTTPPort != DefaultPort || cfg.LinkSystemOutputVolume {
-		t.Fatalf("unexpected fallback config: %+v", cfg)
-	}
+	assertLoadError(t, "", `DMR_HTTP_PORT="not-a-number" is not an integer`)
+	assertLoadError(t, "", `DMR_LINK_SYSTEM_VOLUME="not-a-bool" is not a boolean`)
 }
 
 func TestLoadDefaultsWhenEnvUnset(t *testing.T) {
@@ -39,10 +75,12 @@ func TestLoadDefaultsWhenEnvUnset(t *testing.T) {
 	for _, k := range []string{
 		"DMR_UUID_PATH", "DMR_ALLOW_PREEMPT", "DMR_LINK_SYSTEM_VOLUME",
 		"DMR_HTTP_PORT", "DMR_ADVERTISE_IP", "DMR_IINA_FULLSCREEN",
+		"DMR_PLAYER", "DMR_FRIENDLY_NAME", "DMR_MANUFACTURER", "DMR_MODEL_NAME",
+		"DMR_ICON_DIR", "DMR_PERSIST_STATE", "DMR_RESUME_POSITIONS", "DMR_RESUME_MARGIN", "DMR_HISTORY", "DMR_DEBUG",
 	} {
 		t.Setenv(k, "")
 	}
-	cfg := Load()
+	cfg := mustLoad(t)
 	if cfg.HTTPPort != DefaultPort {
 		t.Errorf("HTTPPort = %d, want %d", cfg.HTTPPort, DefaultPort)
 	}
@@ -55,6 +93,9 @@ func TestLoadDefaultsWhenEnvUnset(t *testing.T) {
 	if cfg.IINAFullscreen {
 		t.Error("IINAFullscreen default = true, want false")
 	}
+	if cfg.PersistState || cfg.ResumePositions || cfg.ResumeMarginSeconds != DefaultResumeMargin || cfg.History {
+		t.Errorf("persistence defaults = %v, %v, %d, %v", cfg.PersistState, cfg.ResumePositions, cfg.ResumeMarginSeconds, cfg.History)
+	}
 	if cfg.AdvertiseIP != "" {
 		t.Errorf("AdvertiseIP = %q, want empty", cfg.AdvertiseIP)
 	}
@@ -66,11 +107,20 @@ func TestLoadDefaultsWhenEnvUnset(t *testing.T) {
 	if !strings.HasSuffix(cfg.UUIDPath, DefaultUUIDPath) {
 		t.Errorf("UUIDPath %q should end with %q", cfg.UUIDPath, DefaultUUIDPath)
 	}
+	if cfg.Path != "" {
+		t.Errorf("Path = %q, want empty without a config file", cfg.Path)
+	}
+	if cfg.FriendlyName != "RCast (testbox)" {
+		t.Errorf("FriendlyName = %q, want hostname-derived default", cfg.FriendlyName)
+	}
+	if cfg.Manufacturer != DefaultManufacturer || cfg.ModelName != DefaultModelName {
+		t.Errorf("Manufacturer/ModelName = %q/%q", cfg.Manufacturer, cfg.ModelName)
+	}
 }
 
 func TestCustomPortRoundTrip(t *testing.T) {
 	t.Setenv("DMR_HTTP_PORT", "9000")
-	cfg := Load()
+	cfg := mustLoad(t)
 	if cfg.HTTPPort != 9000 {
 		t.Fatalf("HTTPPort = %d, want 9000", cfg.HTTPPort)
 	}
@@ -88,21 +138,11 @@ func TestBoolVariants(t *testing.T) {
 		{"false", false},
 		{"FALSE", false},
 		{"0", false},
-		{"yes", false}, // not a valid bool → falls back to default
 	}
 	for _, c := range cases {
 		t.Run("AllowPreempt_"+c.env, func(t *testing.T) {
 			t.Setenv("DMR_ALLOW_PREEMPT", c.env)
-			// Default for AllowSessionPreempt is true; for non-bool input we
-			// expect the default to come back.
-			got := Load().AllowSessionPreempt
-			if c.env == "yes" {
-				if !got {
-					t.Fatalf("invalid bool %q → got false, want default true", c.env)
-				}
-				return
-			}
-			if got != c.want {
+			if got := mustLoad(t).AllowSessionPreempt; got != c.want {
 				t.Fatalf("DMR_ALLOW_PREEMPT=%q → %v, want %v", c.env, got, c.want)
 			}
 		})
@@ -111,29 +151,24 @@ func TestBoolVariants(t *testing.T) {
 	for _, c := range cases {
 		t.Run("LinkSystemVolume_"+c.env, func(t *testing.T) {
 			t.Setenv("DMR_LINK_SYSTEM_VOLUME", c.env)
-			// Default for LinkSystemOutputVolume is false; invalid → false.
-			got := Load().LinkSystemOutputVolume
-			if c.env == "yes" {
-				if got {
-					t.Fatalf("invalid bool %q → got true, want default false", c.env)
-				}
-				return
-			}
-			if got != c.want {
+			if got := mustLoad(t).LinkSystemOutputVolume; got != c.want {
 				t.Fatalf("DMR_LINK_SYSTEM_VOLUME=%q → %v, want %v", c.env, got, c.want)
 			}
 		})
 	}
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("DMR_ALLOW_PREEMPT", "yes")
+		assertLoadError(t, "", "DMR_ALLOW_PREEMPT")
+	})
 }
 
-func TestInvalidPortBoundariesFallBackToDefault(t *testing.T) {
-	cases := []string{"0", "-1", "65536", "99999", "abc"}
+func TestInvalidPortBoundariesAreRejected(t *testing.T) {
+	cases := []string{"0", "-1", "65536", "99999"}
 	for _, p := range cases {
 		t.Run("port_"+p, func(t *testing.T) {
 			t.Setenv("DMR_HTTP_PORT", p)
-			if got := Load().HTTPPort; got != DefaultPort {
-				t.Fatalf("port %q → %d, want default %d", p, got, DefaultPort)
-			}
+			assertLoadError(t, "", "http_port "+p+" is outside 1-65535")
 		})
 	}
 }
@@ -149,7 +184,7 @@ func TestValidPortBoundariesKept(t *testing.T) {
 	for _, c := range cases {
 		t.Run("port_"+c.env, func(t *testing.T) {
 			t.Setenv("DMR_HTTP_PORT", c.env)
-			if got := Load().HTTPPort; got != c.want {
+			if got := mustLoad(t).HTTPPort; got != c.want {
 				t.Fatalf("port %s → %d, want %d", c.env, got, c.want)
 			}
 		})
@@ -161,7 +196,7 @@ func TestEmptyStringFallsBackToDefault(t *testing.T) {
 	t.Setenv("DMR_HTTP_PORT", "")
 	t.Setenv("DMR_ADVERTISE_IP", "")
 	t.Setenv("DMR_ALLOW_PREEMPT", "")
-	cfg := Load()
+	cfg := mustLoad(t)
 	if cfg.HTTPPort != DefaultPort {
 		t.Errorf("empty HTTPPort = %d, want default %d", cfg.HTTPPort, DefaultPort)
 	}
@@ -176,25 +211,297 @@ func TestEmptyStringFallsBackToDefault(t *testing.T) {
 func TestUUIDPathCustom(t *testing.T) {
 	custom := filepath.Join(t.TempDir(), "my-uuid")
 	t.Setenv("DMR_UUID_PATH", custom)
-	if got := Load().UUIDPath; got != custom {
+	if got := mustLoad(t).UUIDPath; got != custom {
 		t.Fatalf("UUIDPath = %q, want %q", got, custom)
 	}
 }
 
 func TestIINAFullscreenEnv(t *testing.T) {
 	t.Setenv("DMR_IINA_FULLSCREEN", "true")
-	if !Load().IINAFullscreen {
+	if !mustLoad(t).IINAFullscreen {
 		t.Fatal("IINAFullscreen = false, want true")
 	}
 	t.Setenv("DMR_IINA_FULLSCREEN", "0")
-	if Load().IINAFullscreen {
+	if mustLoad(t).IINAFullscreen {
 		t.Fatal("IINAFullscreen = true, want false")
 	}
 }
 
-// NOTE: envVar's generic constraint is `~string | ~bool | ~int`, which excludes
-// int64 and float64 — so the int64/float64 type-switch branches inside envVar
-// are currently unreachable from generic instantiation. That is a latent dead-
-// code issue in config.go (not exercised here because the constraint forbids
-// those types), flagged but not fixed per the no-production-change rule for
-// this package.
+func TestPlayerEnv(t *testing.T) {
+	t.Setenv("DMR_PLAYER", "MPV")
+	if got := mustLoad(t).Player; got != PlayerMPV {
+		t.Fatalf("Player = %q, want %q", got, PlayerMPV)
+	}
+	t.Setenv("DMR_PLAYER", "iina")
+	if got := mustLoad(t).Player; got != PlayerIINA {
+		t.Fatalf("Player = %q, want %q", got, PlayerIINA)
+	}
+	t.Setenv("DMR_PLAYER", "vlc")
+	assertLoadError(t, "", `player "vlc" is not "iina" or "mpv"`)
+}
+
+// writeConfig writes body to a config.json in a fresh directory.
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileCoversEveryOption(t *testing.T) {
+	path := writeConfig(t, `{
+		"uuid_path": "/tmp/rcast-uuid",
+		"allow_preempt": false,
+		"link_system_volume": true,
+		"http_port": 9100,
+		"advertise_ip": "192.0.2.7",
+		"fullscreen": true,
+		"player": "IINA",
+		"friendly_name": " Living Room ",
+		"manufacturer": "Acme",
+		"model_name": "Box 3",
+		"icon_dir": "/",
+		"persist_state": true,
+		"resume_positions": true,
+		"resume_margin_seconds": 45,
+		"history": true,
+		"debug": true,
+		"quirks": [{"name": "den-tv", "user_agent": ["DenTV/"], "volume_scale": 2, "preempt": true}],
+		"dial_apps": [{"name": "Cast", "handler": "url"}],
+		"audio_device": "pulse/hdmi",
+		"devices": [{"name": " Living Room (HDMI) ", "fullscreen": true}, {"id": "office", "name": "Office", "audio_device": "alsa/usb"}],
+		"session": {"allow": ["192.168.1.0/24"], "deny": ["192.168.1.66"], "trusted": ["192.168.1.10"], "trusted_user_agents": ["DenTV/"], "low_priority": ["192.168.1.128/25"], "preempt_grace_seconds": 20}
+	}`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	yes := true
+	want := Config{
+		UUIDPath:               "/tmp/rcast-uuid",
+		AllowSessionPreempt:    false,
+		LinkSystemOutputVolume: true,
+		HTTPPort:               9100,
+		AdvertiseIP:            "192.0.2.7",
+		IINAFullscreen:         true,
+		Player:                 PlayerIINA,
+		FriendlyName:           "Living Room",
+		Manufacturer:           "Acme",
+		ModelName:              "Box 3",
+		IconDir:                "/",
+		PersistState:           true,
+		ResumePositions:        true,
+		ResumeMarginSeconds:    45,
+		History:                true,
+		Debug:                  true,
+		Quirks:                 []quirk.Profile{{Name: "den-tv", UserAgent: []string{"DenTV/"}, VolumeScale: 2, Preempt: &yes}},
+		DIALApps:               []dial.App{{Name: "Cast", Handler: dial.HandlerURL}},
+		AudioDevice:            "pulse/hdmi",
+		Devices: []Device{
+			{ID: "living-room-hdmi", Name: "Living Room (HDMI)", Fullscreen: &yes},
+			{ID: "office", Name: "Office", AudioDevice: "alsa/usb"},
+		},
+		Session: session.Policy{
+			Allow:             []string{"192.168.1.0/24"},
+			Deny:              []string{"192.168.1.66"},
+			Trusted:           []string{"192.168.1.10"},
+			TrustedUserAgents: []string{"DenTV/"},
+			LowPriority:       []string{"192.168.1.128/25"},
+			GraceSeconds:      20,
+		},
+		Path: path,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("config = %+v\nwant     %+v", cfg, want)
+	}
+}
+
+func TestStateFilesSitNextToUUIDFile(t *testing.T) {
+	cfg := Config{UUIDPath: "/var/lib/rcast/dmr_uuid.txt"}
+	if got := cfg.StatePath(); got != "/var/lib/rcast/state.json" {
+		t.Fatalf("StatePath = %q", got)
+	}
+	if got := cfg.PositionsPath(); got != "/var/lib/rcast/positions.json" {
+		t.Fatalf("PositionsPath = %q", got)
+	}
+	if got := cfg.HistoryPath(); got != "/var/lib/rcast/history.jsonl" {
+		t.Fatalf("HistoryPath = %q", got)
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	single := Config{UUIDPath: "/var/lib/rcast/dmr_uuid.txt", FriendlyName: "Den"}
+	if got := single.Renderers(); len(got) != 1 || !reflect.DeepEqual(got[0], single) {
+		t.Fatalf("single renderer = %+v", got)
+	}
+
+	no := false
+	cfg := single
+	cfg.IINAFullscreen = true
+	cfg.AudioDevice = "pulse/hdmi"
+	cfg.Devices = []Device{
+		{ID: "living-room", Name: "Living Room"},
+		{ID: "office", Name: "Office", AudioDevice: "alsa/usb", Fullscreen: &no},
+	}
+	got := cfg.Renderers()
+	if len(got) != 2 {
+		t.Fatalf("renderers = %d, want 2", len(got))
+	}
+	if r := got[0]; r.Device != "living-room" || r.FriendlyName != "Living Room" || r.AudioDevice != "pulse/hdmi" || !r.IINAFullscreen || r.Devices != nil {
+		t.Fatalf("living room = %+v", r)
+	}
+	if r := got[1]; r.FriendlyName != "Office" || r.AudioDevice != "alsa/usb" || r.IINAFullscreen {
+		t.Fatalf("office = %+v", r)
+	}
+	if p := got[1].StatePath(); p != "/var/lib/rcast/devices/office/state.json" {
+		t.Fatalf("office StatePath = %q", p)
+	}
+}
+
+func TestLoadFileKeepsDefaultsForOmittedKeys(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `{"http_port": 9101}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.HTTPPort != 9101 || !cfg.AllowSessionPreempt || cfg.Player != DefaultPlayer() {
+		t.Fatalf("config = %+v", cfg)
+	}
+}
+
+func TestEnvironmentOverridesFile(t *testing.T) {
+	t.Setenv("DMR_HTTP_PORT", "9300")
+	cfg, err := Load(writeConfig(t, `{"http_port": 9200, "allow_preempt": false}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.HTTPPort != 9300 {
+		t.Fatalf("HTTPPort = %d, want env value 9300", cfg.HTTPPort)
+	}
+	if cfg.AllowSessionPreempt {
+		t.Fatal("allow_preempt from the file was lost")
+	}
+}
+
+func TestLoadFileTildeUUIDPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	cfg, err := Load(writeConfig(t, `{"uuid_path": "~/rcast/uuid"}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if want := filepath.Join(home, "rcast", "uuid"); cfg.UUIDPath != want {
+		t.Fatalf("UUIDPath = %q, want %q", cfg.UUIDPath, want)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"syntax", `{"http_port": }`, "parse config"},
+		{"unknown key", `{"http_prot": 9000}`, `unknown field "http_prot"`},
+		{"wrong type", `{"http_port": "9000"}`, "http_port"},
+		{"port", `{"http_port": 70000}`, "http_port 70000 is outside 1-65535"},
+		{"player", `{"player": "vlc"}`, `player "vlc"`},
+		{"advertise ip", `{"advertise_ip": "::1"}`, `advertise_ip "::1" is not an IPv4 address`},
+		{"uuid path", `{"uuid_path": ""}`, "uuid_path is empty"},
+		{"friendly name", `{"friendly_name": "` + strings.Repeat("x", 64) + `"}`, "friendly_name must be shorter than 64 characters"},
+		{"model name", `{"model_name": "` + strings.Repeat("x", 32) + `"}`, "model_name must be shorter than 32 characters"},
+		{"manufacturer", `{"manufacturer": ""}`, "manufacturer is empty"},
+		{"quirk", `{"quirks": [{"name": "tv", "volume_scale": -1}]}`, `quirks[0] "tv": needs a user_agent_prefix, user_agent or headers condition, volume_scale -1 is negative`},
+		{"dial app", `{"dial_apps": [{"name": "Cast", "handler": "netflix"}]}`, `dial_apps[0] "Cast": handler "netflix" is not one of url, youtube`},
+		{"device name", `{"devices": [{"id": "tv", "name": ""}]}`, `devices[0] "": name is empty`},
+		{"device id", `{"devices": [{"name": "客厅"}]}`, `devices[0] "客厅": id is empty`},
+		{"device id chars", `{"devices": [{"id": "Living Room", "name": "TV"}]}`, `id "Living Room" may only contain a-z, 0-9 and '-'`},
+		{"device id twice", `{"devices": [{"name": "TV"}, {"id": "tv", "name": "Other"}]}`, `devices[1] "Other": id "tv" is used twice`},
+		{"resume margin", `{"resume_margin_seconds": -5}`, "resume_margin_seconds -5 is negative"},
+		{"session", `{"session": {"trusted": ["phone"]}}`, `session: trusted entry "phone" is not an IP address or CIDR`},
+		{"icon dir", `{"icon_dir": "/nonexistent/rcast-icons"}`, `icon_dir "/nonexistent/rcast-icons" is not a directory`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assertLoadError(t, writeConfig(t, c.body), c.want)
+		})
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	_, err := Load(writeConfig(t, `{"http_port": 0, "player": "vlc"}`))
+	if err == nil || !strings.Contains(err.Error(), "http_port") || !strings.Contains(err.Error(), "player") {
+		t.Fatalf("error = %v, want both problems", err)
+	}
+}
+
+func TestLoadExplicitMissingFileIsAnError(t *testing.T) {
+	assertLoadError(t, filepath.Join(t.TempDir(), "missing.json"), "read config")
+}
+
+func TestLoadDefaultPathFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "rcast"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "rcast", "config.json")
+	if err := os.WriteFile(path, []byte(`{"friendly_name": "Den"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := mustLoad(t)
+	if cfg.FriendlyName != "Den" || cfg.Path != path {
+		t.Fatalf("config = %+v, want friendly name from %s", cfg, path)
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got := DefaultPath(); got != filepath.Join("/xdg", "rcast", "config.json") {
+		t.Fatalf("DefaultPath = %q", got)
+	}
+	t.Setenv("XDG_CONFIG_HOME", "")
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	if got := DefaultPath(); got != filepath.Join(home, ".config", "rcast", "config.json") {
+		t.Fatalf("DefaultPath = %q", got)
+	}
+}
+
+func TestDefaultFriendlyName(t *testing.T) {
+	orig := hostname
+	t.Cleanup(func() { hostname = orig })
+
+	cases := []struct {
+		host string
+		err  error
+		want string
+	}{
+		{"office-mini.local", nil, "RCast (office-mini)"},
+		{"den", nil, "RCast (den)"},
+		{"", nil, "RCast"},
+		{"", errors.New("no hostname"), "RCast"},
+		{strings.Repeat("h", 80), nil, "RCast (" + strings.Repeat("h", 55) + ")"},
+	}
+	for _, c := range cases {
+		hostname = func() (string, error) { return c.host, c.err }
+		if got := DefaultFriendlyName(); got != c.want {
+			t.Errorf("host %q → %q, want %q", c.host, got, c.want)
+		}
+	}
+}
+
+func TestBlankFriendlyNameUsesDefault(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `{"friendly_name": "  "}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.FriendlyName != "RCast (testbox)" {
+		t.Fatalf("FriendlyName = %q", cfg.FriendlyName)
+	}
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Device is one of several renderers sharing the host. Each gets its own
+// player, UUID, state files and URL prefix /devices/<ID>.
+type Device struct {
+	// ID names the renderer in URLs and state paths; it defaults to Name
+	// lowercased with every run of other characters turned into '-'.
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	// AudioDevice and Fullscreen override audio_device and fullscreen for
+	// this renderer when set.
+	AudioDevice string `json:"audio_device,omitempty"`
+	Fullscreen  *bool  `json:"fullscreen,omitempty"`
+}
+
+// Renderers returns the configuration of every renderer the host exposes: c
+// itself when no devices are listed, otherwise a copy of c per device with
+// its ID, name, audio device and fullscreen setting.
+func (c Config) Renderers() []Config {
+	if len(c.Devices) == 0 {
+		return []Config{c}
+	}
+	renderers := make([]Config, 0, len(c.Devices))
+	for _, d := range c.Devices {
+		r := c
+		r.Devices = nil
+		r.Device = d.ID
+		r.FriendlyName = d.Name
+		if d.AudioDevice != "" {
+			r.AudioDevice = d.AudioDevice
+		}
+		if d.Fullscreen != nil {
+			r.IINAFullscreen = *d.Fullscreen
+		}
+		renderers = append(renderers, r)
+	}
+	return renderers
+}
+
+// slug lowercases name and joins its ASCII letters and digits with '-'.
+func slug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if validIDRune(r) && r != '-' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+func validIDRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-'
+}
+
+func validateDevices(devices []Device) []string {
+	var problems []string
+	seen := make(map[string]bool, len(devices))
+	for i, d := range devices {
+		prefix := fmt.Sprintf("devices[%d] %q", i, d.Name)
+		switch n := utf8.RuneCountInString(d.Name); {
+		case n == 0:
+			problems = append(problems, prefix+": name is empty")
+		case n >= maxFriendlyName:
+			problems = append(problems, fmt.Sprintf("%s: name must be shorter than %d characters", prefix, maxFriendlyName))
+		}
+		switch {
+		case d.ID == "":
+			problems = append(problems, prefix+": id is empty; set one made of a-z, 0-9 and '-'")
+		case strings.IndexFunc(d.ID, func(r rune) bool { return !validIDRune(r) }) >= 0:
+			problems = append(problems, fmt.Sprintf("%s: id %q may only contain a-z, 0-9 and '-'", prefix, d.ID))
+		case seen[d.ID]:
+			problems = append(problems, fmt.Sprintf("%s: id %q is used twice", prefix, d.ID))
+		}
+		seen[d.ID] = true
+	}
+	return problems
+}
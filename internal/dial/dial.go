@@ -0,0 +1,269 @@
+package dial
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/tr1v3r/pkg/log"
+)
+
+// ServiceType is the SSDP search target DIAL clients look for.
+const ServiceType = "urn:dial-multiscreen-org:service:dial:1"
+
+// AppsPath is where the application resources live; the device description
+// advertises baseURL+AppsPath in its Application-URL header.
+const AppsPath = "/apps/"
+
+// maxLaunchBytes bounds a launch payload; larger ones get 413.
+const maxLaunchBytes = 4096
+
+// Handlers turn an app's launch payload into the URL the renderer plays.
+const (
+	// HandlerURL plays the payload itself, or its url parameter when it is
+	// form encoded.
+	HandlerURL = "url"
+	// HandlerYouTube plays the video named by the v parameter.
+	HandlerYouTube = "youtube"
+)
+
+// Handlers lists the launch handlers an app may name.
+var Handlers = []string{HandlerURL, HandlerYouTube}
+
+// App is one application clients may launch through /apps/<Name>.
+type App struct {
+	Name    string `json:"name"`
+	Handler string `json:"handler"`
+}
+
+// Validate reports an app that cannot be addressed or launched.
+func (a *App) Validate() error {
+	var problems []string
+	if a.Name == "" {
+		problems = append(problems, "name is empty")
+	}
+	if strings.ContainsAny(a.Name, "/?#") {
+		problems = append(problems, fmt.Sprintf("name %q may not contain '/', '?' or '#'", a.Name))
+	}
+	if !validHandler(a.Handler) {
+		problems = append(problems, fmt.Sprintf("handler %q is not one of %s", a.Handler, strings.Join(Handlers, ", ")))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validHandler(handler string) bool {
+	for _, h := range Handlers {
+		if h == handler {
+			return true
+		}
+	}
+	return false
+}
+
+// Builtin returns the shipped apps: a generic URL launcher under the name
+// second-screen browsers use, and YouTube.
+func Builtin() []App {
+	return []App{
+		{Name: "Browser", Handler: HandlerURL},
+		{Name: "YouTube", Handler: HandlerYouTube},
+	}
+}
+
+// errNothingToPlay means a launch payload named no playable URL.
+var errNothingToPlay = errors.New("launch payload names nothing to play")
+
+// Resolve returns the URL a launch of a with payload should play.
+func (a *App) Resolve(payload string) (string, error) {
+	payload = strings.TrimSpace(payload)
+	switch a.Handler {
+	case HandlerURL:
+		if playable(payload) {
+			return payload, nil
+		}
+		params, err := url.ParseQuery(payload)
+		if err != nil || !playable(params.Get("url")) {
+			return "", errNothingToPlay
+		}
+		return params.Get("url"), nil
+	case HandlerYouTube:
+		params, err := url.ParseQuery(payload)
+		if err != nil || params.Get("v") == "" {
+			return "", errNothingToPlay
+		}
+		return "https://www.youtube.com/watch?v=" + url.QueryEscape(params.Get("v")), nil
+	}
+	return "", fmt.Errorf("unknown handler %q", a.Handler)
+}
+
+// playable reports whether s is an absolute http(s) URL.
+func playable(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Renderer is what launching and stopping apps needs of the device.
+type Renderer interface {
+	// Launch plays uri for the controller sending r.
+	Launch(r *http.Request, uri string) error
+	// Stop ends playback for the controller sending r.
+	Stop(r *http.Request) error
+	// Playing reports whether uri is still the renderer's current media.
+	Playing(uri string) bool
+}
+
+// Server serves the DIAL application resources: GET describes an app, POST
+// launches it and DELETE stops the running instance.
+type Server struct {
+	appsURL  string
+	apps     []App
+	renderer Renderer
+
+	mu       sync.Mutex
+	launched map[string]string // app → URL its last launch played
+}
+
+// NewServer serves custom followed by the built-in apps it does not
+// replace, at appsURL as advertised in Application-URL.
+func NewServer(appsURL string, custom []App, renderer Renderer) *Server {
+	apps := append([]App(nil), custom...)
+	for _, b := range Builtin() {
+		if _, ok := find(custom, b.Name); !ok {
+			apps = append(apps, b)
+		}
+	}
+	return &Server{appsURL: appsURL, apps: apps, renderer: renderer, launched: make(map[string]string)}
+}
+
+func find(apps []App, name string) (App, bool) {
+	for _, a := range apps {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return App{}, false
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, instance, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, AppsPath), "/")
+	app, ok := find(s.apps, name)
+	if !ok || (instance != "" && instance != "run") {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && instance == "":
+		s.describe(w, app)
+	case r.Method == http.MethodPost && instance == "":
+		s.launch(w, r, app)
+	case r.Method == http.MethodDelete:
+		s.stop(w, r, app)
+	default:
+		if instance == "" {
+			w.Header().Set("Allow", "GET, POST, DELETE")
+		} else {
+			w.Header().Set("Allow", http.MethodDelete)
+		}
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// running reports whether app's last launch is still what plays.
+func (s *Server) running(app App) bool {
+	s.mu.Lock()
+	uri, ok := s.launched[app.Name]
+	s.mu.Unlock()
+	return ok && s.renderer.Playing(uri)
+}
+
+// serviceXML is the DIAL application description.
+type serviceXML struct {
+	XMLName xml.Name `xml:"urn:dial-multiscreen-org:schemas:dial service"`
+	DialVer string   `xml:"dialVer,attr"`
+	Name    string   `xml:"name"`
+	Options struct {
+		AllowStop bool `xml:"allowStop,attr"`
+	} `xml:"options"`
+	State string   `xml:"state"`
+	Link  *linkXML `xml:"link"`
+}
+
+type linkXML struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}
+
+func (s *Server) describe(w http.ResponseWriter, app App) {
+	doc := serviceXML{DialVer: "1.7", Name: app.Name, State: "stopped"}
+	doc.Options.AllowStop = true
+	if s.running(app) {
+		doc.State = "running"
+		doc.Link = &linkXML{Rel: "run", Href: "run"}
+	}
+	body, err := xml.Marshal(doc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(body)
+}
+
+func (s *Server) launch(w http.ResponseWriter, r *http.Request, app App) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLaunchBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "launch payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	uri, err := app.Resolve(string(payload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wasRunning := s.running(app)
+	if err := s.renderer.Launch(r, uri); err != nil {
+		log.Warn("DIAL launch of %s for %s failed: %v", app.Name, r.RemoteAddr, err)
+		http.Error(w, "cannot launch "+app.Name, http.StatusServiceUnavailable)
+		return
+	}
+	s.mu.Lock()
+	s.launched[app.Name] = uri
+	s.mu.Unlock()
+	log.Info("DIAL app %s launched %s for %s", app.Name, uri, r.RemoteAddr)
+
+	w.Header().Set("Location", s.appsURL+url.PathEscape(app.Name)+"/run")
+	if wasRunning {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) stop(w http.ResponseWriter, r *http.Request, app App) {
+	if !s.running(app) {
+		http.NotFound(w, r)
+		return
+	}
+	if err := s.renderer.Stop(r); err != nil {
+		log.Warn("DIAL stop of %s for %s failed: %v", app.Name, r.RemoteAddr, err)
+		http.Error(w, "cannot stop "+app.Name, http.StatusServiceUnavailable)
+		return
+	}
+	s.mu.Lock()
+	delete(s.launched, app.Name)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,141 @@
+package dial
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeRenderer struct {
+	current   string
+	launchErr error
+	stops     int
+}
+
+func (f *fakeRenderer) Launch(_ *http.Request, uri string) error {
+	if f.launchErr != nil {
+		return f.launchErr
+	}
+	f.current = uri
+	return nil
+}
+
+func (f *fakeRenderer) Stop(*http.Request) error {
+	f.current = ""
+	f.stops++
+	return nil
+}
+
+func (f *fakeRenderer) Playing(uri string) bool { return f.current == uri }
+
+func serve(s *Server, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestResolve(t *testing.T) {
+	browser := App{Name: "Browser", Handler: HandlerURL}
+	youtube := App{Name: "YouTube", Handler: HandlerYouTube}
+	cases := []struct {
+		app     App
+		payload string
+		want    string
+	}{
+		{browser, "http://example.test/v.mp4\n", "http://example.test/v.mp4"},
+		{browser, "url=https%3A%2F%2Fexample.test%2Fa.m3u8", "https://example.test/a.m3u8"},
+		{browser, "ftp://example.test/v.mp4", ""},
+		{browser, "", ""},
+		{youtube, "v=dQw4w9WgXcQ&t=10", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{youtube, "pairingCode=abc", ""},
+	}
+	for _, c := range cases {
+		got, err := c.app.Resolve(c.payload)
+		if got != c.want || (err == nil) != (c.want != "") {
+			t.Errorf("%s.Resolve(%q) = %q, %v; want %q", c.app.Name, c.payload, got, err, c.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, a := range Builtin() {
+		if err := a.Validate(); err != nil {
+			t.Errorf("builtin %s: %v", a.Name, err)
+		}
+	}
+	bad := App{Name: "a/b", Handler: "netflix"}
+	err := bad.Validate()
+	if err == nil || !strings.Contains(err.Error(), "'/'") || !strings.Contains(err.Error(), "netflix") {
+		t.Fatalf("Validate = %v", err)
+	}
+}
+
+func TestLaunchDescribeAndStop(t *testing.T) {
+	renderer := &fakeRenderer{}
+	s := NewServer("http://192.168.1.2:8200/apps/", nil, renderer)
+
+	rec := serve(s, http.MethodGet, "/apps/Browser", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<state>stopped</state>") ||
+		!strings.Contains(rec.Body.String(), `xmlns="urn:dial-multiscreen-org:schemas:dial"`) {
+		t.Fatalf("GET stopped: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(s, http.MethodPost, "/apps/Browser", "http://example.test/v.mp4")
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "http://192.168.1.2:8200/apps/Browser/run" {
+		t.Fatalf("POST: %d location=%q", rec.Code, rec.Header().Get("Location"))
+	}
+	if renderer.current != "http://example.test/v.mp4" {
+		t.Fatalf("renderer plays %q", renderer.current)
+	}
+	rec = serve(s, http.MethodGet, "/apps/Browser", "")
+	if !strings.Contains(rec.Body.String(), "<state>running</state>") || !strings.Contains(rec.Body.String(), `<link rel="run" href="run"></link>`) {
+		t.Fatalf("GET running: %s", rec.Body.String())
+	}
+	if rec = serve(s, http.MethodPost, "/apps/Browser", "url=http://example.test/w.mp4"); rec.Code != http.StatusOK {
+		t.Fatalf("relaunch: %d", rec.Code)
+	}
+
+	if rec = serve(s, http.MethodDelete, "/apps/Browser/run", ""); rec.Code != http.StatusOK || renderer.stops != 1 {
+		t.Fatalf("DELETE: %d stops=%d", rec.Code, renderer.stops)
+	}
+	if rec = serve(s, http.MethodDelete, "/apps/Browser", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("DELETE when stopped: %d", rec.Code)
+	}
+
+	// Another app taking over the renderer stops this one.
+	serve(s, http.MethodPost, "/apps/YouTube", "v=abc")
+	renderer.current = "http://example.test/other.mp4"
+	if rec = serve(s, http.MethodGet, "/apps/YouTube", ""); !strings.Contains(rec.Body.String(), "<state>stopped</state>") {
+		t.Fatalf("GET after takeover: %s", rec.Body.String())
+	}
+}
+
+func TestLaunchErrors(t *testing.T) {
+	renderer := &fakeRenderer{}
+	s := NewServer("http://192.168.1.2:8200/apps/", []App{{Name: "Cast", Handler: HandlerURL}}, renderer)
+	cases := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/apps/Netflix", "", http.StatusNotFound},
+		{http.MethodGet, "/apps/Cast/other", "", http.StatusNotFound},
+		{http.MethodPut, "/apps/Cast", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/apps/Cast", "not a url", http.StatusBadRequest},
+		{http.MethodPost, "/apps/Cast", "http://example.test/" + strings.Repeat("a", maxLaunchBytes), http.StatusRequestEntityTooLarge},
+	}
+	for _, c := range cases {
+		if rec := serve(s, c.method, c.path, c.body); rec.Code != c.want {
+			t.Errorf("%s %s = %d, want %d", c.method, c.path, rec.Code, c.want)
+		}
+	}
+	if rec := serve(s, http.MethodGet, "/apps/YouTube", ""); rec.Code != http.StatusOK {
+		t.Fatalf("builtins are kept next to configured apps: %d", rec.Code)
+	}
+	renderer.launchErr = errors.New("session busy")
+	if rec := serve(s, http.MethodPost, "/apps/Cast", "http://example.test/v.mp4"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("failed launch: %d", rec.Code)
+	}
+}
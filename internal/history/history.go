@@ -0,0 +1,264 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tr1v3r/pkg/log"
+)
+
+// Events name what an entry records.
+const (
+	EventSetURI = "SetAVTransportURI"
+	EventPlay   = "Play"
+	EventStop   = "Stop"
+)
+
+// Rotation defaults: the live file is rotated past DefaultMaxBytes and the
+// DefaultKeep most recent rotated files are kept beside it.
+const (
+	DefaultMaxBytes = 1 << 20
+	DefaultKeep     = 3
+)
+
+// Entry is one line of the history file. Stop entries close a cast and carry
+// how long it was actually playing; the controller and user agent are only
+// known for actions a control point asked for.
+type Entry struct {
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	Controller string    `json:"controller,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	URI        string    `json:"uri"`
+	Title      string    `json:"title,omitempty"`
+	Class      string    `json:"class,omitempty"`
+	Metadata   string    `json:"metadata,omitempty"`
+	Played     float64   `json:"played_seconds,omitempty"`
+}
+
+// Log is an append-only JSON-lines history at path. Once the file would grow
+// past maxBytes it moves to path.1, shifting older files up to path.<keep>
+// and dropping the oldest. Entry IDs keep counting across rotations and
+// restarts. A nil *Log records nothing.
+type Log struct {
+	path     string
+	maxBytes int64
+	keep     int
+
+	mu     sync.Mutex
+	lastID int64
+	torn   bool // the live file ends mid-line, cut short by a crash
+}
+
+// Open prepares the history at path, continuing the IDs of entries already
+// there. The file itself is created on the first Append.
+func Open(path string, maxBytes int64, keep int) (*Log, error) {
+	l := &Log{path: path, maxBytes: maxBytes, keep: keep}
+	for i := 0; i <= keep; i++ {
+		entries, err := readFile(l.file(i))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			l.lastID = entries[len(entries)-1].ID
+			break
+		}
+	}
+	if b, err := os.ReadFile(path); err == nil && len(b) > 0 && b[len(b)-1] != '\n' {
+		l.torn = true
+	}
+	return l, nil
+}
+
+// file is the live file for 0 and the n-th rotated one otherwise.
+func (l *Log) file(n int) string {
+	if n == 0 {
+		return l.path
+	}
+	return l.path + "." + strconv.Itoa(n)
+}
+
+// Append numbers e, stamps it when Time is unset and writes it out.
+func (l *Log) Append(e Entry) (Entry, error) {
+	if l == nil {
+		return e, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.ID = l.lastID + 1
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	line = append(line, '\n')
+	if l.torn {
+		line = append([]byte{'\n'}, line...)
+	}
+
+	if info, err := os.Stat(l.path); err == nil && info.Size() > 0 && info.Size()+int64(len(line)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return e, fmt.Errorf("rotate history: %w", err)
+		}
+		if l.torn {
+			line = line[1:]
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return e, err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return e, err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return e, err
+	}
+	if err := f.Close(); err != nil {
+		return e, err
+	}
+	l.lastID, l.torn = e.ID, false
+	return e, nil
+}
+
+// rotate shifts path.<n> to path.<n+1>, dropping the last, and moves the
+// live file to path.1. Caller must hold l.mu.
+func (l *Log) rotate() error {
+	if err := os.Remove(l.file(l.keep)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for n := l.keep - 1; n >= 0; n-- {
+		if err := os.Rename(l.file(n), l.file(n+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Page returns up to limit entries, newest first, after skipping offset of
+// them, along with how many entries the history holds in total.
+func (l *Log) Page(offset, limit int) ([]Entry, int, error) {
+	all, err := l.entries()
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(all)
+	page := []Entry{}
+	for i := total - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, all[i])
+	}
+	return page, total, nil
+}
+
+// Get finds the entry with the given ID, if it has not been rotated away.
+func (l *Log) Get(id int64) (Entry, bool, error) {
+	all, err := l.entries()
+	if err != nil {
+		return Entry{}, false, err
+	}
+	for _, e := range all {
+		if e.ID == id {
+			return e, true, nil
+		}
+	}
+	return Entry{}, false, nil
+}
+
+// entries reads every kept file, oldest entry first.
+func (l *Log) entries() ([]Entry, error) {
+	if l == nil {
+		return nil, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var all []Entry
+	for n := l.keep; n >= 0; n-- {
+		entries, err := readFile(l.file(n))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+	}
+	return all, nil
+}
+
+// maxLineBytes bounds one history line; entries are far smaller, so a longer
+// line is corrupt.
+const maxLineBytes = 1 << 20
+
+// readFile parses one history file. Lines that do not parse, such as one
+// cut short by a crash, and lines past maxLineBytes are logged and skipped
+// rather than failing the whole history.
+func readFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	r := bufio.NewReaderSize(f, 64<<10)
+	for n := 1; ; n++ {
+		line, oversized, err := readLine(r)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		if oversized {
+			log.Warn("history %s:%d: skipping line longer than %d bytes", path, n, maxLineBytes)
+			continue
+		}
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil || e.ID <= 0 {
+			log.Warn("history %s:%d: skipping unreadable entry", path, n)
+			continue
+		}
+		entries = append(entries, e)
+	}
+}
+
+// readLine returns the next line without its newline, or only reports it
+// oversized once it passes maxLineBytes, having read past the rest of it.
+func readLine(r *bufio.Reader) (line []byte, oversized bool, err error) {
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, false, err
+		}
+		if !oversized {
+			line = append(line, chunk...)
+			oversized = len(line) > maxLineBytes
+		}
+		if !isPrefix {
+			if oversized {
+				return nil, true, nil
+			}
+			return line, false, nil
+		}
+	}
+}
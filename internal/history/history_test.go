@@ -0,0 +1,107 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogPagesNewestFirst(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "history.jsonl"), DefaultMaxBytes, DefaultKeep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uri := range []string{"a", "b", "c"} {
+		if _, err := l.Append(Entry{Event: EventSetURI, URI: uri}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page, total, err := l.Page(1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(page) != 2 || page[0].URI != "b" || page[0].ID != 2 || page[1].URI != "a" {
+		t.Fatalf("page = %+v, total %d", page, total)
+	}
+	if page, _, _ := l.Page(3, 5); len(page) != 0 {
+		t.Fatalf("page past the end = %+v", page)
+	}
+	if e, ok, err := l.Get(3); err != nil || !ok || e.URI != "c" || e.Time.IsZero() {
+		t.Fatalf("Get(3) = %+v, %v, %v", e, ok, err)
+	}
+}
+
+func TestLogRotatesAndContinuesIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	// Small enough that every entry starts a new file.
+	l, err := Open(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		if _, err := l.Append(Entry{Event: EventPlay, URI: "u"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("kept more rotated files than asked: %v", err)
+	}
+	page, total, err := l.Page(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || page[0].ID != 5 || page[2].ID != 3 {
+		t.Fatalf("page = %+v", page)
+	}
+
+	// A damaged line is skipped and a reopened log keeps counting.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id": 6, "ev`)
+	f.Close()
+	l, err = Open(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err := l.Append(Entry{Event: EventStop}); err != nil || e.ID != 6 {
+		t.Fatalf("Append after reopen = %+v, %v", e, err)
+	}
+	if e, ok, err := l.Get(6); err != nil || !ok || e.Event != EventStop {
+		t.Fatalf("entry after a torn line = %+v, %v, %v", e, ok, err)
+	}
+}
+
+func TestNilLogRecordsNothing(t *testing.T) {
+	var l *Log
+	if _, err := l.Append(Entry{URI: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	if page, total, err := l.Page(0, 10); err != nil || total != 0 || len(page) != 0 {
+		t.Fatalf("nil page = %v, %d, %v", page, total, err)
+	}
+}
+
+func TestLogSkipsCorruptAndOversizedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	body := `{"id":1,"event":"SetAVTransportURI","uri":"a"}` + "\n" +
+		`{"id":2,"uri":"` + strings.Repeat("x", maxLineBytes) + `"}` + "\n" +
+		`{"id":3,"event":"Play","ur` + "\n" +
+		`{"id":4,"event":"Play","uri":"a"}` + "\n"
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Open(path, DefaultMaxBytes, DefaultKeep)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	page, total, err := l.Page(0, 10)
+	if err != nil || total != 2 || len(page) != 2 || page[0].ID != 4 || page[1].ID != 1 {
+		t.Fatalf("Page = %+v, %d, %v; want entries 4 and 1", page, total, err)
+	}
+	if e, err := l.Append(Entry{Event: EventStop, URI: "a"}); err != nil || e.ID != 5 {
+		t.Fatalf("Append = %+v, %v; want ID 5", e, err)
+	}
+}
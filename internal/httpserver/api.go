@@ -0,0 +1,383 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/history"
+	"github.com/tr1v3r/rcast/internal/state"
+	"github.com/tr1v3r/rcast/internal/upnp"
+)
+
+const maxAPIBodyBytes = 64 << 10
+
+// History paging: the page size when none is asked for, and the largest.
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// Status is the JSON view of the renderer served by /api/v1/status and
+// returned after every successful control call.
+type Status struct {
+	TransportState string  `json:"transport_state"`
+	URI            string  `json:"uri"`
+	Title          string  `json:"title"`
+	Metadata       string  `json:"metadata"`
+	NextURI        string  `json:"next_uri"`
+	Volume         int     `json:"volume"`
+	Mute           bool    `json:"mute"`
+	SessionOwner   string  `json:"session_owner"`
+	Position       float64 `json:"position"`
+	Duration       float64 `json:"duration"`
+	LastCast       string  `json:"last_cast"`
+}
+
+// Queue is the JSON view of the playlist served by /api/v1/queue and
+// returned after every queue change.
+type Queue struct {
+	Tracks   []QueueTrack `json:"tracks"`
+	Current  uint32       `json:"current"` // track ID, 0 when none
+	Index    int          `json:"index"`   // of the current track, -1 when none
+	Repeat   state.Repeat `json:"repeat"`
+	Shuffle  bool         `json:"shuffle"`
+	PlayMode string       `json:"play_mode"`
+}
+
+// QueueTrack is a playlist track with the title from its metadata.
+type QueueTrack struct {
+	state.Track
+	Title string `json:"title"`
+}
+
+// HistoryPage is one page of /api/v1/history, newest entry first.
+type HistoryPage struct {
+	Total   int             `json:"total"`
+	Offset  int             `json:"offset"`
+	Limit   int             `json:"limit"`
+	Entries []history.Entry `json:"entries"`
+}
+
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// registerAPI exposes the transport and rendering actions as JSON for
+// scripts and remotes that do not speak SOAP. Requests go through the same
+// upnp.Actions as the SOAP handlers, so session ownership and preemption
+// apply unchanged, keyed by the caller's address.
+func registerAPI(mux *http.ServeMux, st *state.PlayerState, actions *upnp.Actions) {
+	mux.HandleFunc("/api/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeAPIError(w, http.StatusMethodNotAllowed, upnp.ErrInvalidAction.Code, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, currentStatus(st))
+	})
+
+	mux.HandleFunc("/api/v1/play", apiAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		// The body is optional; {"resume": false} starts from the beginning.
+		var req struct {
+			Resume *bool `json:"resume"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			return upnp.ErrInvalidArgs
+		}
+		return actions.Play(controller, 0, req.Resume)
+	}))
+	mux.HandleFunc("/api/v1/pause", apiAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		return actions.Pause(controller)
+	}))
+	mux.HandleFunc("/api/v1/stop", apiAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		return actions.Stop(controller)
+	}))
+	mux.HandleFunc("/api/v1/seek", apiAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		var req struct {
+			Position *float64 `json:"position"`
+		}
+		if !decodeAPIBody(r, &req) || req.Position == nil || *req.Position < 0 {
+			return upnp.ErrIllegalSeekTarget
+		}
+		return actions.Seek(controller, *req.Position)
+	}))
+	mux.HandleFunc("/api/v1/volume", apiAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		var req struct {
+			Volume *int `json:"volume"`
+		}
+		if !decodeAPIBody(r, &req) || req.Volume == nil {
+			return upnp.ErrInvalidArgs
+		}
+		return actions.SetVolume(controller, *req.Volume)
+	}))
+	mux.HandleFunc("/api/v1/mute", apiAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		var req struct {
+			Mute *bool `json:"mute"`
+		}
+		if !decodeAPIBody(r, &req) || req.Mute == nil {
+			return upnp.ErrInvalidArgs
+		}
+		return actions.SetMute(controller, *req.Mute)
+	}))
+	mux.HandleFunc("/api/v1/resume", apiAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		return actions.Resume(controller)
+	}))
+	mux.HandleFunc("/api/v1/cast", apiAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		var req struct {
+			URL    string `json:"url"`
+			Title  string `json:"title"`
+			Resume *bool  `json:"resume"`
+		}
+		if !decodeAPIBody(r, &req) || req.URL == "" {
+			return upnp.ErrInvalidArgs
+		}
+		return actions.Cast(controller, req.URL, req.Title, req.Resume)
+	}))
+
+	// 播放队列
+	mux.HandleFunc("/api/v1/queue", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeAPIError(w, http.StatusMethodNotAllowed, upnp.ErrInvalidAction.Code, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, currentQueue(st))
+	})
+	mux.HandleFunc("/api/v1/queue/add", queueAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		var req struct {
+			URL     string  `json:"url"`
+			Title   string  `json:"title"`
+			AfterID *uint32 `json:"after_id"`
+		}
+		if !decodeAPIBody(r, &req) || req.URL == "" {
+			return upnp.ErrInvalidArgs
+		}
+		_, err := actions.Enqueue(controller, req.URL, req.Title, req.AfterID)
+		return err
+	}))
+	mux.HandleFunc("/api/v1/queue/move", queueAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		var req struct {
+			ID      uint32 `json:"id"`
+			AfterID uint32 `json:"after_id"`
+		}
+		if !decodeAPIBody(r, &req) || req.ID == 0 {
+			return upnp.ErrInvalidArgs
+		}
+		return actions.MoveTrack(controller, req.ID, req.AfterID)
+	}))
+	mux.HandleFunc("/api/v1/queue/remove", queueAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		var req struct {
+			ID uint32 `json:"id"`
+		}
+		if !decodeAPIBody(r, &req) || req.ID == 0 {
+			return upnp.ErrInvalidArgs
+		}
+		return actions.DeleteTrack(controller, req.ID)
+	}))
+	mux.HandleFunc("/api/v1/queue/clear", queueAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		return actions.DeleteAllTracks(controller)
+	}))
+	mux.HandleFunc("/api/v1/queue/play", queueAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		// The body is optional; without an id or index the current track, or
+		// else the first, plays.
+		var req struct {
+			ID    *uint32 `json:"id"`
+			Index *int    `json:"index"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			return upnp.ErrInvalidArgs
+		}
+		switch {
+		case req.ID != nil:
+			return actions.PlayTrack(controller, *req.ID)
+		case req.Index != nil:
+			return actions.PlayIndex(controller, *req.Index)
+		}
+		return actions.PlayPlaylist(controller)
+	}))
+	mux.HandleFunc("/api/v1/queue/next", queueAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		return actions.StepTrack(controller, 1)
+	}))
+	mux.HandleFunc("/api/v1/queue/previous", queueAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		return actions.StepTrack(controller, -1)
+	}))
+	mux.HandleFunc("/api/v1/queue/mode", queueAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+		var req struct {
+			Repeat  *state.Repeat `json:"repeat"`
+			Shuffle *bool         `json:"shuffle"`
+		}
+		if !decodeAPIBody(r, &req) || (req.Repeat == nil && req.Shuffle == nil) {
+			return upnp.ErrInvalidArgs
+		}
+		if req.Repeat != nil {
+			if err := actions.SetRepeat(controller, *req.Repeat); err != nil {
+				return err
+			}
+		}
+		if req.Shuffle != nil {
+			return actions.SetShuffle(controller, *req.Shuffle)
+		}
+		return nil
+	}))
+
+	// 播放历史
+	if h := st.History(); h != nil {
+		mux.HandleFunc("/api/v1/history", historyHandler(h))
+		mux.HandleFunc("/api/v1/history/recast", apiAction(st, func(r *http.Request, controller upnp.Controller) *upnp.Error {
+			var req struct {
+				ID int64 `json:"id"`
+			}
+			if !decodeAPIBody(r, &req) || req.ID <= 0 {
+				return upnp.ErrInvalidArgs
+			}
+			return actions.Recast(controller, req.ID)
+		}))
+	}
+}
+
+// historyHandler serves the cast history a page at a time, paged with the
+// offset and limit query parameters.
+func historyHandler(h *history.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeAPIError(w, http.StatusMethodNotAllowed, upnp.ErrInvalidAction.Code, "method not allowed")
+			return
+		}
+		offset, okOffset := queryInt(r, "offset", 0)
+		limit, okLimit := queryInt(r, "limit", defaultHistoryLimit)
+		if !okOffset || !okLimit || offset < 0 || limit < 1 || limit > maxHistoryLimit {
+			writeAPIError(w, http.StatusBadRequest, upnp.ErrInvalidArgs.Code, "offset must be >= 0 and limit within 1-500")
+			return
+		}
+		entries, total, err := h.Page(offset, limit)
+		if err != nil {
+			log.Error("read cast history: %v", err)
+			writeAPIError(w, http.StatusInternalServerError, upnp.ErrActionFailed.Code, "cannot read history")
+			return
+		}
+		writeJSON(w, http.StatusOK, HistoryPage{Total: total, Offset: offset, Limit: limit, Entries: entries})
+	}
+}
+
+// queryInt parses the named query parameter, returning def when it is
+// absent.
+func queryInt(r *http.Request, name string, def int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil
+}
+
+// apiAction adapts a control call to a POST endpoint that answers with the
+// resulting status or a JSON error. API callers speak plain JSON rather than
+// a vendor's DLNA dialect, so no controller quirks apply.
+func apiAction(st *state.PlayerState, fn func(r *http.Request, controller upnp.Controller) *upnp.Error) http.HandlerFunc {
+	return apiCall(fn, func() any { return currentStatus(st) })
+}
+
+// queueAction is apiAction for queue edits, answering with the queue.
+func queueAction(st *state.PlayerState, fn func(r *http.Request, controller upnp.Controller) *upnp.Error) http.HandlerFunc {
+	return apiCall(fn, func() any { return currentQueue(st) })
+}
+
+// apiCall runs fn for a POST and answers with view on success.
+func apiCall(fn func(r *http.Request, controller upnp.Controller) *upnp.Error, view func() any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAPIError(w, http.StatusMethodNotAllowed, upnp.ErrInvalidAction.Code, "method not allowed")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodyBytes)
+		if err := fn(r, upnp.Controller{ID: upnp.ControllerID(r), UserAgent: r.UserAgent()}); err != nil {
+			writeAPIError(w, apiStatusCode(err.Code), err.Code, err.Description)
+			return
+		}
+		writeJSON(w, http.StatusOK, view())
+	}
+}
+
+func decodeAPIBody(r *http.Request, v any) bool {
+	return json.NewDecoder(r.Body).Decode(v) == nil
+}
+
+// apiStatusCode maps a UPnP error code onto the closest HTTP status.
+func apiStatusCode(code int) int {
+	switch code {
+	case upnp.ErrInvalidArgs.Code, upnp.ErrIllegalSeekTarget.Code:
+		return http.StatusBadRequest
+	case upnp.ErrTransitionNotAllowed.Code, upnp.ErrSessionInUse.Code, upnp.ErrNoContent.Code, upnp.ErrPlaylistFull.Code:
+		return http.StatusConflict
+	case upnp.ErrTrackNotFound.Code, upnp.ErrIndexNotFound.Code:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func currentStatus(st *state.PlayerState) Status {
+	snap := st.Snapshot()
+	status := Status{
+		TransportState: snap.TransportState,
+		URI:            snap.URI,
+		Title:          upnp.XMLText([]byte(snap.Meta), "title"),
+		Metadata:       snap.Meta,
+		NextURI:        snap.NextURI,
+		Volume:         snap.Volume,
+		Mute:           snap.Mute,
+		SessionOwner:   snap.SessionOwner,
+		Position:       snap.Position,
+	}
+	status.LastCast, _, _ = st.LastCast()
+	if p := st.GetActivePlayer(); p != nil {
+		ctx, cancel := context.WithTimeout(st.Context(), 2*time.Second)
+		defer cancel()
+		if pos, err := p.GetPosition(ctx); err == nil {
+			status.Position = pos
+		}
+		if d, err := p.GetDuration(ctx); err == nil {
+			status.Duration = d
+		}
+	}
+	return status
+}
+
+func currentQueue(st *state.PlayerState) Queue {
+	pl := st.Snapshot().Playlist
+	queue := Queue{
+		Tracks:   []QueueTrack{},
+		Current:  pl.Current,
+		Index:    pl.Index,
+		Repeat:   pl.Repeat,
+		Shuffle:  pl.Shuffle,
+		PlayMode: pl.PlayMode(),
+	}
+	for _, t := range st.PlaylistTracks() {
+		queue.Tracks = append(queue.Tracks, QueueTrack{Track: t, Title: upnp.XMLText([]byte(t.Meta), "title")})
+	}
+	return queue
+}
+
+func writeAPIError(w http.ResponseWriter, status, code int, message string) {
+	var body apiError
+	body.Error.Code = code
+	body.Error.Message = message
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
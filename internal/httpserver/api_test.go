@@ -0,0 +1,367 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/history"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/state"
+	"github.com/tr1v3r/rcast/internal/upnp"
+)
+
+// apiFakePlayer records what the REST API asks of the player.
+type apiFakePlayer struct {
+	mu      sync.Mutex
+	played  []string
+	titles  []string
+	seeks   []float64
+	volumes []int
+	paused  int
+}
+
+func (p *apiFakePlayer) Play(_ context.Context, uri string, _ int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.played = append(p.played, uri)
+	return nil
+}
+
+func (p *apiFakePlayer) Pause(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused++
+	return nil
+}
+
+func (p *apiFakePlayer) StopPlayback(context.Context) error { return nil }
+
+func (p *apiFakePlayer) Stop(context.Context) error { return nil }
+
+func (p *apiFakePlayer) SetVolume(_ context.Context, v int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.volumes = append(p.volumes, v)
+	return nil
+}
+
+func (p *apiFakePlayer) SetMute(context.Context, bool) error { return nil }
+
+func (p *apiFakePlayer) SetFullscreen(context.Context, bool) error { return nil }
+
+func (p *apiFakePlayer) SetTitle(_ context.Context, title string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.titles = append(p.titles, title)
+	return nil
+}
+
+func (p *apiFakePlayer) Screenshot(context.Context, string) error { return nil }
+
+func (p *apiFakePlayer) SetSpeed(context.Context, float64) error { return nil }
+
+func (p *apiFakePlayer) Seek(_ context.Context, seconds float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seeks = append(p.seeks, seconds)
+	return nil
+}
+
+func (p *apiFakePlayer) SeekPercent(context.Context, float64) error { return nil }
+
+func (p *apiFakePlayer) GetPosition(context.Context) (float64, error) { return 12, nil }
+
+func (p *apiFakePlayer) GetDuration(context.Context) (float64, error) { return 300, nil }
+
+func (p *apiFakePlayer) GetMediaInfo(context.Context) (player.MediaInfo, error) {
+	return player.MediaInfo{}, nil
+}
+
+func (p *apiFakePlayer) GetFileSize(context.Context) (int64, error) { return 0, nil }
+
+func (p *apiFakePlayer) SetNext(context.Context, string) error { return nil }
+
+func (p *apiFakePlayer) GetPath(context.Context) (string, error) { return "", nil }
+
+func (p *apiFakePlayer) AddSubtitles(context.Context, []string) error { return nil }
+
+func (p *apiFakePlayer) Events() <-chan player.Event { return nil }
+
+func newAPITestMux(t *testing.T) (*http.ServeMux, *state.PlayerState, *apiFakePlayer) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	fake := &apiFakePlayer{}
+	st := state.NewWithPlayerFactory(ctx, config.Config{}, func() player.Player { return fake })
+	t.Cleanup(st.Stop)
+	mux := NewMux()
+	RegisterHTTP(mux, "http://127.0.0.1:8200", "uuid:test", st, config.Config{})
+	return mux, st, fake
+}
+
+func apiRequest(mux http.Handler, method, path, body, remote string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = remote
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeStatus(t *testing.T, rec *httptest.ResponseRecorder) Status {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("Content-Type=%q", ct)
+	}
+	var s Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatalf("decode status: %v body=%s", err, rec.Body.String())
+	}
+	return s
+}
+
+func assertAPIError(t *testing.T, rec *httptest.ResponseRecorder, httpStatus, code int) {
+	t.Helper()
+	if rec.Code != httpStatus {
+		t.Fatalf("status=%d, want %d body=%s", rec.Code, httpStatus, rec.Body.String())
+	}
+	var body apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error body: %v body=%s", err, rec.Body.String())
+	}
+	if body.Error.Code != code || body.Error.Message == "" {
+		t.Fatalf("error=%+v, want code %d", body.Error, code)
+	}
+}
+
+func TestAPICastPlaysURLWithTitle(t *testing.T) {
+	mux, _, fake := newAPITestMux(t)
+	const remote = "10.0.0.5:1234"
+
+	rec := apiRequest(mux, http.MethodPost, "/api/v1/cast", `{"url":"https://example.test/v.mp4","title":"Fish & Chips"}`, remote)
+	s := decodeStatus(t, rec)
+	if s.TransportState != "PLAYING" || s.URI != "https://example.test/v.mp4" || s.Title != "Fish & Chips" {
+		t.Fatalf("status after cast = %+v", s)
+	}
+	if s.SessionOwner != "10.0.0.5" || s.Position != 12 || s.Duration != 300 {
+		t.Fatalf("status after cast = %+v", s)
+	}
+	if len(fake.played) != 1 || len(fake.titles) != 1 || fake.titles[0] != "Fish & Chips" {
+		t.Fatalf("played=%v titles=%v", fake.played, fake.titles)
+	}
+
+	s = decodeStatus(t, apiRequest(mux, http.MethodGet, "/api/v1/status", "", remote))
+	if s.TransportState != "PLAYING" || s.Volume != 50 {
+		t.Fatalf("status = %+v", s)
+	}
+}
+
+func TestAPIResumeReplaysLastCast(t *testing.T) {
+	mux, st, fake := newAPITestMux(t)
+	const remote = "10.0.0.5:1234"
+
+	assertAPIError(t, apiRequest(mux, http.MethodPost, "/api/v1/resume", "", remote), http.StatusConflict, 714)
+
+	st.Restore(state.Saved{Volume: 25, URI: "https://example.test/old.mp4"})
+	if s := decodeStatus(t, apiRequest(mux, http.MethodGet, "/api/v1/status", "", remote)); s.LastCast != "https://example.test/old.mp4" || s.URI != "" || s.Volume != 25 {
+		t.Fatalf("status before resume = %+v", s)
+	}
+	s := decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/resume", "", remote))
+	if s.TransportState != "PLAYING" || s.URI != "https://example.test/old.mp4" {
+		t.Fatalf("status after resume = %+v", s)
+	}
+	if len(fake.played) != 1 || fake.played[0] != "https://example.test/old.mp4" {
+		t.Fatalf("played=%v", fake.played)
+	}
+}
+
+func TestAPIPlayAcceptsOptionalResumeBody(t *testing.T) {
+	mux, _, fake := newAPITestMux(t)
+	const remote = "10.0.0.5:1234"
+
+	decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/cast", `{"url":"https://example.test/v.mp4","resume":false}`, remote))
+	decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/stop", "", remote))
+	decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/play", `{"resume":false}`, remote))
+	assertAPIError(t, apiRequest(mux, http.MethodPost, "/api/v1/play", `{"resume":`, remote), http.StatusBadRequest, 402)
+	if len(fake.played) != 2 {
+		t.Fatalf("played=%v", fake.played)
+	}
+}
+
+func TestAPIHistoryPagesAndRecasts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	fake := &apiFakePlayer{}
+	st := state.NewWithPlayerFactory(ctx, config.Config{}, func() player.Player { return fake })
+	t.Cleanup(st.Stop)
+	h, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"), history.DefaultMaxBytes, history.DefaultKeep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.SetHistory(h)
+	mux := NewMux()
+	RegisterHTTP(mux, "http://127.0.0.1:8200", "uuid:test", st, config.Config{})
+	const remote = "10.0.0.5:1234"
+
+	decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/cast", `{"url":"https://example.test/a.mp4"}`, remote))
+	decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/cast", `{"url":"https://example.test/b.mp4"}`, remote))
+
+	rec := apiRequest(mux, http.MethodGet, "/api/v1/history?offset=1&limit=2", "", remote)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("history: %d %s", rec.Code, rec.Body.String())
+	}
+	var page HistoryPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	// a: SetAVTransportURI, Play; Stop of a; b: SetAVTransportURI, Play.
+	if page.Total != 5 || page.Offset != 1 || page.Limit != 2 || len(page.Entries) != 2 {
+		t.Fatalf("page = %+v", page)
+	}
+	if e := page.Entries[0]; e.Event != history.EventSetURI || e.URI != "https://example.test/b.mp4" || e.Controller != "10.0.0.5" {
+		t.Fatalf("newest-but-one entry = %+v", e)
+	}
+	assertAPIError(t, apiRequest(mux, http.MethodGet, "/api/v1/history?limit=0", "", remote), http.StatusBadRequest, 402)
+	assertAPIError(t, apiRequest(mux, http.MethodPost, "/api/v1/history/recast", `{"id": 42}`, remote), http.StatusBadRequest, 402)
+
+	s := decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/history/recast", `{"id": 1}`, remote))
+	if s.TransportState != "PLAYING" || s.URI != "https://example.test/a.mp4" {
+		t.Fatalf("status after recast = %+v", s)
+	}
+}
+
+func TestAPIHistoryAbsentWhenOff(t *testing.T) {
+	mux, _, _ := newAPITestMux(t)
+	if rec := apiRequest(mux, http.MethodGet, "/api/v1/history", "", "10.0.0.5:1"); rec.Code != http.StatusNotFound {
+		t.Fatalf("history with the log off: %d", rec.Code)
+	}
+}
+
+func TestAPIControlsShareSessionAndErrors(t *testing.T) {
+	mux, st, fake := newAPITestMux(t)
+	const owner = "10.0.0.5:1"
+
+	assertAPIError(t, apiRequest(mux, http.MethodPost, "/api/v1/play", "", owner), http.StatusConflict, 701)
+	assertAPIError(t, apiRequest(mux, http.MethodPost, "/api/v1/pause", "", owner), http.StatusConflict, 701)
+
+	decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/cast", `{"url":"https://example.test/v.mp4"}`, owner))
+	assertAPIError(t, apiRequest(mux, http.MethodPost, "/api/v1/pause", "", "10.0.0.9:1"), http.StatusConflict, 712)
+
+	if s := decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/pause", "", owner)); s.TransportState != "PAUSED_PLAYBACK" {
+		t.Fatalf("after pause: %+v", s)
+	}
+	decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/seek", `{"position":93.5}`, owner))
+	if s := decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/volume", `{"volume":140}`, owner)); s.Volume != 100 {
+		t.Fatalf("volume not clamped: %+v", s)
+	}
+	if s := decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/mute", `{"mute":true}`, owner)); !s.Mute {
+		t.Fatalf("mute not applied: %+v", s)
+	}
+	if fake.paused != 1 || len(fake.seeks) != 1 || fake.seeks[0] != 93.5 || len(fake.volumes) != 1 {
+		t.Fatalf("paused=%d seeks=%v volumes=%v", fake.paused, fake.seeks, fake.volumes)
+	}
+
+	if s := decodeStatus(t, apiRequest(mux, http.MethodPost, "/api/v1/stop", "", owner)); s.TransportState != "STOPPED" || s.SessionOwner != "" {
+		t.Fatalf("after stop: %+v", s)
+	}
+	if st.GetActivePlayer() != nil {
+		t.Fatal("stop should close the player")
+	}
+}
+
+func decodeQueue(t *testing.T, rec *httptest.ResponseRecorder) Queue {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var q Queue
+	if err := json.Unmarshal(rec.Body.Bytes(), &q); err != nil {
+		t.Fatalf("decode queue: %v body=%s", err, rec.Body.String())
+	}
+	return q
+}
+
+func TestAPIQueue(t *testing.T) {
+	mux, st, fake := newAPITestMux(t)
+	const remote = "10.0.0.5:1"
+
+	if q := decodeQueue(t, apiRequest(mux, http.MethodGet, "/api/v1/queue", "", remote)); len(q.Tracks) != 0 || q.Index != -1 || q.PlayMode != "NORMAL" {
+		t.Fatalf("empty queue = %+v", q)
+	}
+	decodeQueue(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/add", `{"url":"https://example.test/1.mp3","title":"One"}`, remote))
+	decodeQueue(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/add", `{"url":"https://example.test/3.mp3"}`, remote))
+	q := decodeQueue(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/add", `{"url":"https://example.test/2.mp3","after_id":1}`, remote))
+	if len(q.Tracks) != 3 || q.Tracks[0].Title != "One" || q.Tracks[1].URI != "https://example.test/2.mp3" {
+		t.Fatalf("queue after adds = %+v", q)
+	}
+
+	q = decodeQueue(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/play", `{"index":1}`, remote))
+	if q.Current != q.Tracks[1].ID || q.Index != 1 || st.GetTransportState() != state.Playing {
+		t.Fatalf("queue after play = %+v, state %s", q, st.GetTransportState())
+	}
+	q = decodeQueue(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/next", "", remote))
+	if q.Index != 2 {
+		t.Fatalf("queue after next = %+v", q)
+	}
+	q = decodeQueue(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/move", `{"id":2,"after_id":3}`, remote))
+	if q.Tracks[2].ID != 2 || q.Index != 2 {
+		t.Fatalf("queue after move = %+v", q)
+	}
+	q = decodeQueue(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/mode", `{"repeat":"all","shuffle":false}`, remote))
+	if q.Repeat != state.RepeatAll || q.PlayMode != "REPEAT_ALL" {
+		t.Fatalf("queue after mode = %+v", q)
+	}
+	if next, _ := st.GetNextURI(); next != "https://example.test/1.mp3" {
+		t.Fatalf("next with repeat = %q", next)
+	}
+	q = decodeQueue(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/remove", `{"id":1}`, remote))
+	if len(q.Tracks) != 2 {
+		t.Fatalf("queue after remove = %+v", q)
+	}
+	assertAPIError(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/remove", `{"id":1}`, remote), http.StatusNotFound, upnp.ErrTrackNotFound.Code)
+	assertAPIError(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/play", `{"index":5}`, remote), http.StatusNotFound, upnp.ErrIndexNotFound.Code)
+	assertAPIError(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/mode", `{"repeat":"sometimes"}`, remote), http.StatusBadRequest, upnp.ErrInvalidArgs.Code)
+	assertAPIError(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/clear", "", "10.0.0.9:1"), http.StatusConflict, upnp.ErrSessionInUse.Code)
+
+	q = decodeQueue(t, apiRequest(mux, http.MethodPost, "/api/v1/queue/clear", "", remote))
+	if len(q.Tracks) != 0 || q.Current != 0 || st.GetTransportState() != "NO_MEDIA_PRESENT" {
+		t.Fatalf("queue after clear = %+v, state %s", q, st.GetTransportState())
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.played) != 2 {
+		t.Fatalf("played=%v", fake.played)
+	}
+}
+
+func TestAPIRejectsBadRequests(t *testing.T) {
+	mux, _, _ := newAPITestMux(t)
+	const remote = "10.0.0.5:1"
+
+	cases := []struct {
+		name, method, path, body string
+		status, code             int
+	}{
+		{"cast without url", http.MethodPost, "/api/v1/cast", `{"title":"x"}`, http.StatusBadRequest, upnp.ErrInvalidArgs.Code},
+		{"cast malformed json", http.MethodPost, "/api/v1/cast", `{`, http.StatusBadRequest, upnp.ErrInvalidArgs.Code},
+		{"volume missing", http.MethodPost, "/api/v1/volume", `{}`, http.StatusBadRequest, upnp.ErrInvalidArgs.Code},
+		{"mute wrong type", http.MethodPost, "/api/v1/mute", `{"mute":"yes"}`, http.StatusBadRequest, upnp.ErrInvalidArgs.Code},
+		{"negative seek", http.MethodPost, "/api/v1/seek", `{"position":-1}`, http.StatusBadRequest, upnp.ErrIllegalSeekTarget.Code},
+		{"GET on action", http.MethodGet, "/api/v1/play", ``, http.StatusMethodNotAllowed, upnp.ErrInvalidAction.Code},
+		{"POST on status", http.MethodPost, "/api/v1/status", ``, http.StatusMethodNotAllowed, upnp.ErrInvalidAction.Code},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertAPIError(t, apiRequest(mux, tc.method, tc.path, tc.body, remote), tc.status, tc.code)
+		})
+	}
+}
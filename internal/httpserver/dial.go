@@ -0,0 +1,45 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"github.com/tr1v3r/rcast/internal/state"
+	"github.com/tr1v3r/rcast/internal/upnp"
+)
+
+// dialRenderer launches DIAL apps through the same actions as the REST API,
+// so launches respect the session and end in Player.Play.
+type dialRenderer struct {
+	st      *state.PlayerState
+	actions *upnp.Actions
+}
+
+func (d dialRenderer) Launch(r *http.Request, uri string) error {
+	if err := d.actions.Cast(dialController(r), uri, "", nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d dialRenderer) Stop(r *http.Request) error {
+	if err := d.actions.Stop(dialController(r)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d dialRenderer) Playing(uri string) bool {
+	snap := d.st.Snapshot()
+	if snap.URI != uri {
+		return false
+	}
+	switch snap.TransportState {
+	case state.Playing, state.PausedPlayback, state.Transitioning:
+		return true
+	}
+	return false
+}
+
+func dialController(r *http.Request) upnp.Controller {
+	return upnp.Controller{ID: upnp.ControllerID(r), UserAgent: r.UserAgent()}
+}
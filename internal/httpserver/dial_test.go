@@ -0,0 +1,50 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tr1v3r/rcast/internal/state"
+)
+
+func TestDIALLaunchPlaysThroughTheSession(t *testing.T) {
+	mux, st, fake := newAPITestMux(t)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/device.xml", nil))
+	if got := rec.Header().Get("Application-URL"); got != "http://127.0.0.1:8200/apps/" {
+		t.Fatalf("Application-URL = %q", got)
+	}
+
+	rec = apiRequest(mux, http.MethodPost, "/apps/YouTube", "v=dQw4w9WgXcQ", "10.0.0.1:1")
+	if rec.Code != http.StatusCreated || !strings.HasSuffix(rec.Header().Get("Location"), "/apps/YouTube/run") {
+		t.Fatalf("launch: %d location=%q", rec.Code, rec.Header().Get("Location"))
+	}
+	fake.mu.Lock()
+	played := append([]string(nil), fake.played...)
+	fake.mu.Unlock()
+	if len(played) != 1 || played[0] != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Fatalf("player played %v", played)
+	}
+	if rec = apiRequest(mux, http.MethodGet, "/apps/YouTube", "", "10.0.0.1:1"); !strings.Contains(rec.Body.String(), "<state>running</state>") {
+		t.Fatalf("GET running: %s", rec.Body.String())
+	}
+
+	// Another phone may not take over the session.
+	rec = apiRequest(mux, http.MethodPost, "/apps/Browser", "http://example.test/v.mp4", "10.0.0.2:1")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("launch from another controller: %d", rec.Code)
+	}
+
+	if rec = apiRequest(mux, http.MethodDelete, "/apps/YouTube/run", "", "10.0.0.1:1"); rec.Code != http.StatusOK {
+		t.Fatalf("stop: %d", rec.Code)
+	}
+	if st.GetTransportState() != state.Stopped {
+		t.Fatalf("after stop: %s", st.GetTransportState())
+	}
+	if rec = apiRequest(mux, http.MethodGet, "/apps/YouTube", "", "10.0.0.1:1"); !strings.Contains(rec.Body.String(), "<state>stopped</state>") {
+		t.Fatalf("GET stopped: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,88 @@
+package httpserver
+
+import (
+	"bytes"
+	"embed"
+	"image"
+	_ "image/jpeg" // register decoders for custom icon checks
+	_ "image/png"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/upnp"
+)
+
+// embeddedIcons holds the default artwork for every upnp.DeviceIcons entry,
+// named after the last element of its URL.
+//
+//go:embed web/icons
+var embeddedIcons embed.FS
+
+// iconMaxAge lets control points cache icons for a day; they are only
+// replaced on restart.
+const iconMaxAge = 24 * 60 * 60
+
+// registerIcons serves the advertised device icons. A file in dir with the
+// same name as an icon (icon-120.png, icon-48.jpg, ...) replaces the embedded
+// one, provided it decodes as the advertised format.
+func registerIcons(mux *http.ServeMux, dir string) {
+	for _, icon := range upnp.DeviceIcons() {
+		name := path.Base(icon.URL)
+		data, err := embeddedIcons.ReadFile("web/icons/" + name)
+		if err != nil {
+			log.Error("embedded icon %s missing: %v", name, err)
+			continue
+		}
+		if dir != "" {
+			if custom, ok := loadCustomIcon(filepath.Join(dir, name), icon); ok {
+				data = custom
+			}
+		}
+		mux.HandleFunc(icon.URL, serveIcon(icon.MimeType, data))
+	}
+}
+
+// loadCustomIcon reads a replacement icon, rejecting files that are not in
+// the advertised format. A size mismatch is only warned about: control
+// points scale icons, but may pick a poor one.
+func loadCustomIcon(file string, icon upnp.Icon) ([]byte, bool) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, false
+	}
+	if err != nil {
+		log.Warn("read custom icon %s: %v", file, err)
+		return nil, false
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || "image/"+format != icon.MimeType {
+		log.Warn("custom icon %s is not a valid %s; using the built-in icon", file, icon.MimeType)
+		return nil, false
+	}
+	if cfg.Width != icon.Width || cfg.Height != icon.Height {
+		log.Warn("custom icon %s is %dx%d, advertised as %dx%d", file, cfg.Width, cfg.Height, icon.Width, icon.Height)
+	}
+	log.Info("using custom icon %s", file)
+	return data, true
+}
+
+func serveIcon(mimeType string, data []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", mimeType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(iconMaxAge))
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(data)
+		}
+	}
+}
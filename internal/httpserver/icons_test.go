@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tr1v3r/rcast/internal/upnp"
+)
+
+func TestEmbeddedIconsMatchDescription(t *testing.T) {
+	mux, _ := newTestMux(t)
+	for _, icon := range upnp.DeviceIcons() {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, icon.URL, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s status=%d", icon.URL, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != icon.MimeType {
+			t.Errorf("%s Content-Type=%q, want %q", icon.URL, ct, icon.MimeType)
+		}
+		cfg, format, err := image.DecodeConfig(rec.Body)
+		if err != nil {
+			t.Fatalf("%s does not decode: %v", icon.URL, err)
+		}
+		if "image/"+format != icon.MimeType || cfg.Width != icon.Width || cfg.Height != icon.Height {
+			t.Errorf("%s is %s %dx%d, advertised %s %dx%d",
+				icon.URL, format, cfg.Width, cfg.Height, icon.MimeType, icon.Width, icon.Height)
+		}
+	}
+}
+
+func TestIconRouteMethods(t *testing.T) {
+	mux, _ := newTestMux(t)
+	url := upnp.DeviceIcons()[0].URL
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, url, nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 || rec.Header().Get("Content-Length") == "" {
+		t.Fatalf("HEAD status=%d body=%d headers=%v", rec.Code, rec.Body.Len(), rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, url, nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Fatalf("POST status=%d allow=%q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func testPNG(t *testing.T, size int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, size, size))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCustomIconDir(t *testing.T) {
+	dir := t.TempDir()
+	custom := testPNG(t, 120)
+	if err := os.WriteFile(filepath.Join(dir, "icon-120.png"), custom, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A PNG where a JPEG is advertised is ignored.
+	if err := os.WriteFile(filepath.Join(dir, "icon-48.jpg"), testPNG(t, 48), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := NewMux()
+	registerIcons(mux, dir)
+
+	get := func(url string) []byte {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s status=%d", url, rec.Code)
+		}
+		return rec.Body.Bytes()
+	}
+	if got := get("/icons/icon-120.png"); !bytes.Equal(got, custom) {
+		t.Fatal("custom icon-120.png not served")
+	}
+	embedded, _ := embeddedIcons.ReadFile("web/icons/icon-48.jpg")
+	if got := get("/icons/icon-48.jpg"); !bytes.Equal(got, embedded) {
+		t.Fatal("mismatched custom icon-48.jpg replaced the built-in icon")
+	}
+	embedded, _ = embeddedIcons.ReadFile("web/icons/icon-256.png")
+	if got := get("/icons/icon-256.png"); !bytes.Equal(got, embedded) {
+		t.Fatal("icon without a custom file should fall back to the built-in one")
+	}
+}
@@ -1,63 +1,119 @@
 package httpserver
 
 import (
+	_ "embed"
 	"net/http"
 	"time"
 
 	"github.com/tr1v3r/pkg/log"
 
 	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/dial"
 	"github.com/tr1v3r/rcast/internal/monitoring"
 	"github.com/tr1v3r/rcast/internal/state"
 	"github.com/tr1v3r/rcast/internal/upnp"
 )
 
+// indexHTML is the web remote served at the root and advertised to control
+// points as the device presentationURL.
+//
+//go:embed web/index.html
+var indexHTML []byte
+
 func NewMux() *http.ServeMux {
 	return http.NewServeMux()
 }
 
+// RegisterHTTP serves the renderer described by st on mux. When baseURL has
+// a path, as each of several renderers sharing the host does, every route
+// sits under that path.
 func RegisterHTTP(mux *http.ServeMux, baseURL, deviceUUID string, st *state.PlayerState, cfg config.Config) {
-	mux.HandleFunc("/device.xml", staticXML(func() string { return upnp.DeviceDescriptionXML(baseURL, deviceUUID) }))
+	if prefix := upnp.URLPrefix(baseURL); prefix != "" {
+		device := NewMux()
+		registerDevice(device, baseURL, deviceUUID, st, cfg)
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, device))
+		return
+	}
+	registerDevice(mux, baseURL, deviceUUID, st, cfg)
+}
+
+func registerDevice(mux *http.ServeMux, baseURL, deviceUUID string, st *state.PlayerState, cfg config.Config) {
+	description := staticXML(func() string { return upnp.DeviceDescriptionXML(baseURL, deviceUUID, upnp.DeviceInfoFrom(st)) })
+	mux.HandleFunc("/device.xml", func(w http.ResponseWriter, r *http.Request) {
+		// DIAL clients find the app resources through this header.
+		w.Header().Set("Application-URL", baseURL+dial.AppsPath)
+		w.Header().Set("Access-Control-Expose-Headers", "Application-URL")
+		description(w, r)
+	})
 	mux.HandleFunc("/upnp/service/avtransport.xml", staticXML(upnp.SCPDAVTransportXML))
 	mux.HandleFunc("/upnp/service/renderingcontrol.xml", staticXML(upnp.SCPDRenderingXML))
 	mux.HandleFunc("/upnp/service/connectionmanager.xml", staticXML(upnp.SCPDConnectionManagerXML))
+	mux.HandleFunc("/upnp/service/product.xml", staticXML(upnp.SCPDProductXML))
+	mux.HandleFunc("/upnp/service/playlist.xml", staticXML(upnp.SCPDPlaylistXML))
+	mux.HandleFunc("/upnp/service/volume.xml", staticXML(upnp.SCPDVolumeXML))
+	mux.HandleFunc("/upnp/service/time.xml", staticXML(upnp.SCPDTimeXML))
+	mux.HandleFunc("/upnp/service/info.xml", staticXML(upnp.SCPDInfoXML))
+
+	// 图标
+	registerIcons(mux, cfg.IconDir)
 
 	mux.HandleFunc("/upnp/control/avtransport", upnp.AVTransportHandler(st, cfg))
 	mux.HandleFunc("/upnp/control/renderingcontrol", upnp.RenderingControlHandler(st, cfg))
 	mux.HandleFunc("/upnp/control/connectionmanager", upnp.ConnectionManagerHandler(st, cfg))
+	mux.HandleFunc("/upnp/control/product", upnp.ProductHandler(st, cfg))
+	mux.HandleFunc("/upnp/control/playlist", upnp.PlaylistHandler(st, cfg))
+	mux.HandleFunc("/upnp/control/volume", upnp.VolumeHandler(st, cfg))
+	mux.HandleFunc("/upnp/control/time", upnp.TimeHandler(st, cfg))
+	mux.HandleFunc("/upnp/control/info", upnp.InfoHandler(st, cfg))
+
+	// REST API
+	actions := upnp.NewActions(st)
+	registerAPI(mux, st, actions)
+	mux.Handle("/api/v1/events", newStatusHub(st))
 
 	// 事件端点
-	mux.HandleFunc("/upnp/event/avtransport", upnp.EventHandler)
-	mux.HandleFunc("/upnp/event/renderingcontrol", upnp.EventHandler)
-	mux.HandleFunc("/upnp/event/connectionmanager", upnp.EventHandler)
+	events := upnp.NewEventManager(st)
+	mux.HandleFunc("/upnp/event/avtransport", events.Handler(upnp.AVTransportType))
+	mux.HandleFunc("/upnp/event/renderingcontrol", events.Handler(upnp.RenderingType))
+	mux.HandleFunc("/upnp/event/connectionmanager", events.Handler(upnp.ConnectionManagerType))
+	for _, service := range upnp.OpenHomeTypes {
+		mux.HandleFunc("/upnp/event/"+upnp.OpenHomeServiceName(service), events.Handler(service))
+	}
 
-	// 指标
-	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+	// DIAL
+	mux.Handle(dial.AppsPath, dial.NewServer(baseURL+dial.AppsPath, cfg.DIALApps, dialRenderer{st: st, actions: actions}))
+
+	// 根: web remote
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
 		if r.Method != http.MethodGet && r.Method != http.MethodHead {
 			w.Header().Set("Allow", "GET, HEAD")
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
 		if r.Method != http.MethodHead {
-			_, _ = w.Write([]byte(monitoring.GetMetrics().RenderText()))
+			_, _ = w.Write(indexHTML)
 		}
 	})
+}
 
-	// 根
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
-			return
-		}
+// RegisterMetrics serves the Prometheus metrics, shared by every renderer on
+// the host.
+func RegisterMetrics(mux *http.ServeMux) {
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet && r.Method != http.MethodHead {
 			w.Header().Set("Allow", "GET, HEAD")
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
 		if r.Method != http.MethodHead {
-			_, _ = w.Write([]byte("RCast DMR running\n"))
+			_, _ = w.Write([]byte(monitoring.GetMetrics().RenderText()))
 		}
 	})
 }
@@ -23,6 +23,7 @@ func newTestMux(t *testing.T) (*http.ServeMux, *state.PlayerState) {
 	t.Cleanup(st.Stop)
 	mux := NewMux()
 	RegisterHTTP(mux, "http://127.0.0.1:8200", "uuid:test", st, config.Config{})
+	RegisterMetrics(mux)
 	return mux, st
 }
 
@@ -54,6 +55,55 @@ func TestStaticRoutesAndFallback(t *testing.T) {
 	})
 }
 
+func TestDeviceDescriptionFollowsRename(t *testing.T) {
+	mux, st := newTestMux(t)
+	set := st.Settings()
+	set.FriendlyName = "Office"
+	st.ApplySettings(set)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/device.xml", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "<friendlyName>Office</friendlyName>") || !strings.Contains(body, `configId="2"`) {
+		t.Fatalf("device.xml not refreshed after rename:\n%s", body)
+	}
+}
+
+func TestRenderersUnderPrefixes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	mux := NewMux()
+	for _, name := range []string{"living-room", "office"} {
+		st := state.New(ctx, config.Config{FriendlyName: name})
+		t.Cleanup(st.Stop)
+		RegisterHTTP(mux, "http://127.0.0.1:8200/devices/"+name, "uuid:"+name, st, config.Config{})
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/devices/office/device.xml", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "<friendlyName>office</friendlyName>") ||
+		!strings.Contains(body, "<controlURL>/devices/office/upnp/control/avtransport</controlURL>") {
+		t.Fatalf("office device.xml: %d\n%s", rec.Code, body)
+	}
+	if got := rec.Header().Get("Application-URL"); got != "http://127.0.0.1:8200/devices/office/apps/" {
+		t.Fatalf("Application-URL = %q", got)
+	}
+	for path, want := range map[string]int{
+		"/devices/living-room/":              http.StatusOK,
+		"/devices/living-room/api/v1/status": http.StatusOK,
+		"/devices/office/apps/Browser":       http.StatusOK,
+		"/devices/office/missing":            http.StatusNotFound,
+		"/device.xml":                        http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
 func TestRootRouteMatrix(t *testing.T) {
 	mux, _ := newTestMux(t)
 
@@ -68,6 +118,22 @@ func TestRootRouteMatrix(t *testing.T) {
 		}
 	})
 
+	t.Run("GET serves the embedded web remote", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Fatalf("Content-Type=%q, want text/html", ct)
+		}
+		body := rec.Body.String()
+		// The page drives the renderer through the REST API with relative
+		// paths, so it keeps working behind any base URL.
+		for _, want := range []string{`"api/v1/" + path`, `id="cast"`, `id="seek"`, `id="volume"`} {
+			if !strings.Contains(body, want) {
+				t.Fatalf("web remote missing %q", want)
+			}
+		}
+	})
+
 	t.Run("HEAD returns 200 with empty body", func(t *testing.T) {
 		rec := httptest.NewRecorder()
 		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/", nil))
@@ -224,14 +290,14 @@ func TestControlEndpointsRoute(t *testing.T) {
 func TestEventEndpointRoutes(t *testing.T) {
 	mux, _ := newTestMux(t)
 
-	// Event endpoints exist and route to EventHandler: a GET must produce the
-	// handler's 405 (Allow: SUBSCRIBE, UNSUBSCRIBE), proving the route exists
+	// Event endpoints exist and route to the event manager: a GET must produce
+	// the handler's 405 (Allow: SUBSCRIBE, UNSUBSCRIBE), proving the route exists
 	// and the handler (not the mux) answered.
 	t.Run("GET /upnp/event/avtransport -> handler 405", func(t *testing.T) {
 		rec := httptest.NewRecorder()
 		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upnp/event/avtransport", nil))
 		if rec.Code != http.StatusMethodNotAllowed {
-			t.Fatalf("status=%d, want 405 from EventHandler", rec.Code)
+			t.Fatalf("status=%d, want 405 from event handler", rec.Code)
 		}
 		if got := rec.Header().Get("Allow"); got != "SUBSCRIBE, UNSUBSCRIBE" {
 			t.Fatalf("Allow=%q, want SUBSCRIBE, UNSUBSCRIBE", got)
@@ -0,0 +1,180 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/state"
+)
+
+// streamClientBuffer bounds the snapshots queued for one client. A client
+// that falls this far behind is dropped instead of delaying everyone else.
+const streamClientBuffer = 8
+
+// streamWriteTimeout bounds each event write, replacing the server-wide
+// WriteTimeout that would otherwise cut every stream after a few seconds.
+const streamWriteTimeout = 10 * time.Second
+
+// streamKeepAlive spaces comment lines that keep idle streams open through
+// proxies while nothing changes.
+const streamKeepAlive = 15 * time.Second
+
+// statusTick is how often a position update is pushed while media plays. It
+// is a var (not a const) so tests can shrink it.
+var statusTick = time.Second
+
+// statusHub fans PlayerState changes out to server-sent-event clients. It
+// only ever reads state through Watch and Snapshot, so a stalled dashboard
+// can never hold up Serialize.
+type statusHub struct {
+	st *state.PlayerState
+
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+	closed  bool
+}
+
+func newStatusHub(st *state.PlayerState) *statusHub {
+	h := &statusHub{st: st, clients: make(map[chan []byte]struct{})}
+	go h.run()
+	return h
+}
+
+func (h *statusHub) run() {
+	changes, stop := h.st.Watch()
+	defer stop()
+	ticker := time.NewTicker(statusTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.st.Context().Done():
+			h.closeAll()
+			return
+		case <-changes:
+			h.broadcast()
+		case <-ticker.C:
+			if h.st.GetTransportState() == state.Playing {
+				h.broadcast()
+			}
+		}
+	}
+}
+
+// subscribe registers a client. The channel is closed when the client is
+// dropped for falling behind or the renderer shuts down.
+func (h *statusHub) subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, streamClientBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.clients[ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.clients[ch]; ok {
+			delete(h.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *statusHub) broadcast() {
+	h.mu.Lock()
+	idle := len(h.clients) == 0
+	h.mu.Unlock()
+	if idle {
+		return // spare the player an IPC round trip nobody will see
+	}
+
+	data, err := json.Marshal(currentStatus(h.st))
+	if err != nil {
+		log.Warn("marshal status: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- data:
+		default:
+			log.Warn("status stream client fell behind; dropping it")
+			delete(h.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *statusHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.clients {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// ServeHTTP streams a status snapshot as a server-sent event on connect and
+// after every change, plus a position tick while playing.
+func (h *statusHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	updates, unsubscribe := h.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(chunk string) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := io.WriteString(w, chunk); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	initial, _ := json.Marshal(currentStatus(h.st))
+	if !send(statusEvent(initial)) {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if !send(": keep-alive\n\n") {
+				return
+			}
+		case data, ok := <-updates:
+			if !ok {
+				return
+			}
+			if !send(statusEvent(data)) {
+				return
+			}
+		}
+	}
+}
+
+func statusEvent(data []byte) string {
+	return "event: status\ndata: " + string(data) + "\n\n"
+}
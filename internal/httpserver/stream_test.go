@@ -0,0 +1,159 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/state"
+)
+
+// readStatusEvent returns the next status event on an SSE stream.
+func readStatusEvent(t *testing.T, r *bufio.Reader) Status {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event stream: %v", err)
+		}
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok {
+			continue
+		}
+		var s Status
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			t.Fatalf("decode event %q: %v", data, err)
+		}
+		return s
+	}
+}
+
+func TestStatusStreamPushesChanges(t *testing.T) {
+	mux, st, _ := newAPITestMux(t)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type=%q", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+
+	if s := readStatusEvent(t, r); s.TransportState != "NO_MEDIA_PRESENT" || s.Volume != 50 {
+		t.Fatalf("initial snapshot = %+v", s)
+	}
+
+	st.SetVolume(30)
+	if s := readStatusEvent(t, r); s.Volume != 30 {
+		t.Fatalf("after SetVolume: %+v", s)
+	}
+	st.SetURI("https://example.test/v.mp4", "")
+	if s := readStatusEvent(t, r); s.URI != "https://example.test/v.mp4" {
+		t.Fatalf("after SetURI: %+v", s)
+	}
+}
+
+func TestStatusStreamPositionTicksWhilePlaying(t *testing.T) {
+	orig := statusTick
+	statusTick = 5 * time.Millisecond
+	t.Cleanup(func() { statusTick = orig })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st := state.NewWithPlayerFactory(ctx, config.Config{}, func() player.Player { return &apiFakePlayer{} })
+	st.EnsurePlayer()
+	st.SetTransportState("PLAYING")
+	h := newStatusHub(st)
+	updates, unsubscribe := h.subscribe()
+	defer unsubscribe()
+
+	for range 3 {
+		select {
+		case data := <-updates:
+			var s Status
+			if err := json.Unmarshal(data, &s); err != nil || s.Position != 12 {
+				t.Fatalf("tick = %s (%v)", data, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no position tick while playing")
+		}
+	}
+}
+
+func TestStatusHubDropsSlowClients(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st := state.NewWithPlayerFactory(ctx, config.Config{}, func() player.Player { return &apiFakePlayer{} })
+	h := &statusHub{st: st, clients: make(map[chan []byte]struct{})}
+
+	slow, _ := h.subscribe()
+	fast, unsubscribeFast := h.subscribe()
+	defer unsubscribeFast()
+
+	for range streamClientBuffer + 1 {
+		h.broadcast()
+		<-fast
+	}
+
+	for range streamClientBuffer {
+		if _, ok := <-slow; !ok {
+			t.Fatal("slow client closed before its buffer drained")
+		}
+	}
+	if _, ok := <-slow; ok {
+		t.Fatal("slow client still subscribed after overflowing its buffer")
+	}
+
+	h.broadcast()
+	if _, ok := <-fast; !ok {
+		t.Fatal("fast client dropped along with the slow one")
+	}
+}
+
+func TestStatusHubClosesClientsOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	st := state.NewWithPlayerFactory(ctx, config.Config{}, func() player.Player { return &apiFakePlayer{} })
+	h := newStatusHub(st)
+	updates, unsubscribe := h.subscribe()
+	defer unsubscribe()
+
+	cancel()
+	select {
+	case _, ok := <-updates:
+		if ok {
+			// A change notification may still be in flight; the close follows.
+			if _, ok := <-updates; ok {
+				t.Fatal("client channel still open after shutdown")
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("client channel not closed on shutdown")
+	}
+	if late, _ := h.subscribe(); late != nil {
+		if _, ok := <-late; ok {
+			t.Fatal("subscribing after shutdown returned an open channel")
+		}
+	}
+}
+
+func TestStatusStreamRejectsNonGET(t *testing.T) {
+	mux, _, _ := newAPITestMux(t)
+	rec := apiRequest(mux, http.MethodPost, "/api/v1/events", "", "10.0.0.1:1")
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodGet {
+		t.Fatalf("status=%d Allow=%q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
@@ -26,9 +26,19 @@ type Metrics struct {
 	UPnPActionsTotal int64
 	UPnPErrorsTotal  int64
 
+	// Session metrics
+	SessionDecisions map[SessionDecision]int64
+
 	startTime time.Time
 }
 
+// SessionDecision is the outcome of a session request and the policy rule
+// that decided it.
+type SessionDecision struct {
+	Rule    string
+	Granted bool
+}
+
 var (
 	globalMetrics *Metrics
 	metricsOnce   sync.Once
@@ -39,6 +49,7 @@ func GetMetrics() *Metrics {
 	metricsOnce.Do(func() {
 		globalMetrics = &Metrics{
 			HTTPRequestsByMethod: make(map[string]int64),
+			SessionDecisions:     make(map[SessionDecision]int64),
 			startTime:            time.Now(),
 		}
 	})
@@ -87,6 +98,14 @@ func (m *Metrics) RecordUPnPError() {
 	m.UPnPErrorsTotal++
 }
 
+// RecordSessionDecision records a session request granted or rejected by rule
+func (m *Metrics) RecordSessionDecision(rule string, granted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.SessionDecisions[SessionDecision{Rule: rule, Granted: granted}]++
+}
+
 // GetUptime returns the application uptime
 func (m *Metrics) GetUptime() time.Duration {
 	m.mu.RLock()
@@ -131,7 +150,16 @@ func (m *Metrics) RenderText() string {
 	fmt.Fprintf(&b, "# HELP rcast_player_sessions_total Total player sessions created\n# TYPE rcast_player_sessions_total counter\nrcast_player_sessions_total %d\n\n", m.PlayerSessionsTotal)
 	fmt.Fprintf(&b, "# HELP rcast_player_errors_total Total player errors\n# TYPE rcast_player_errors_total counter\nrcast_player_errors_total %d\n\n", m.PlayerErrorsTotal)
 	fmt.Fprintf(&b, "# HELP rcast_upnp_actions_total Total UPnP actions handled\n# TYPE rcast_upnp_actions_total counter\nrcast_upnp_actions_total %d\n\n", m.UPnPActionsTotal)
-	fmt.Fprintf(&b, "# HELP rcast_upnp_errors_total Total UPnP errors returned\n# TYPE rcast_upnp_errors_total counter\nrcast_upnp_errors_total %d\n", m.UPnPErrorsTotal)
+	fmt.Fprintf(&b, "# HELP rcast_upnp_errors_total Total UPnP errors returned\n# TYPE rcast_upnp_errors_total counter\nrcast_upnp_errors_total %d\n\n", m.UPnPErrorsTotal)
+
+	b.WriteString("# HELP rcast_session_decisions_total Session requests by deciding policy rule and outcome\n# TYPE rcast_session_decisions_total counter\n")
+	for decision, count := range m.SessionDecisions {
+		outcome := "rejected"
+		if decision.Granted {
+			outcome = "granted"
+		}
+		fmt.Fprintf(&b, "rcast_session_decisions_total{rule=%q,outcome=%q} %d\n", decision.Rule, outcome, count)
+	}
 
 	return b.String()
 }
@@ -10,6 +10,7 @@ import (
 func newTestMetrics() *Metrics {
 	return &Metrics{
 		HTTPRequestsByMethod: make(map[string]int64),
+		SessionDecisions:     make(map[SessionDecision]int64),
 		startTime:            time.Now(),
 	}
 }
@@ -22,6 +23,9 @@ func TestMetricsRender(t *testing.T) {
 	m.RecordPlayerError()
 	m.RecordUPnPAction()
 	m.RecordUPnPError()
+	m.RecordSessionDecision("deny", false)
+	m.RecordSessionDecision("deny", false)
+	m.RecordSessionDecision("trusted", true)
 
 	text := m.RenderText()
 	for _, want := range []string{
@@ -33,6 +37,8 @@ func TestMetricsRender(t *testing.T) {
 		"rcast_player_errors_total 1",
 		"rcast_upnp_actions_total 1",
 		"rcast_upnp_errors_total 1",
+		`rcast_session_decisions_total{rule="deny",outcome="rejected"} 2`,
+		`rcast_session_decisions_total{rule="trusted",outcome="granted"} 1`,
 	} {
 		if !strings.Contains(text, want) {
 			t.Errorf("metrics output missing %q:\n%s", want, text)
@@ -1,16 +1,10 @@
 package player
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"net"
-	"os"
 	"os/exec"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -23,107 +17,35 @@ const sockPathPrefix = "/tmp/rcast_iina-ipc-sock_"
 
 const iinaAppBinary = "/Applications/IINA.app/Contents/MacOS/iina"
 
-// ipcTimeout caps how long a single IPC write/read may block. Without it, a
-// hung IINA would hold the player lock forever and stall every later command.
-// It is a var (not a const) so tests can shrink it.
-var ipcTimeout = 3 * time.Second
-
-// command is the small surface of an OS process that IINAPlayer uses, so
-// launch/Stop can be exercised without spawning a real IINA.
-type command interface {
-	Start() error
-	Wait() error
-	Kill() error
-}
-
-// osCommand adapts exec.Cmd to command. Kill mirrors the prior Stop logic:
-// tolerate a nil process and treat an already-exited process as success.
-type osCommand struct{ cmd *exec.Cmd }
-
-func (c *osCommand) Start() error { return c.cmd.Start() }
-
-func (c *osCommand) Wait() error { return c.cmd.Wait() }
-
-func (c *osCommand) Kill() error {
-	if c.cmd.Process == nil {
-		return nil
-	}
-	if err := c.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
-		return err
-	}
-	return nil
-}
-
-func NewIINAPlayer(fullscreen bool) *IINAPlayer {
+// NewIINAPlayer returns a player that launches IINA on first use; an empty
+// audioDevice keeps IINA's default output.
+func NewIINAPlayer(fullscreen bool, audioDevice string) *IINAPlayer {
 	return &IINAPlayer{
-		fullscreen: fullscreen,
-		activate:   activateIINA,
-		find:       findIINA,
+		mpvInstance: newMPVInstance(),
+		fullscreen:  fullscreen,
+		audioDevice: audioDevice,
+		activate:    activateIINA,
+		find:        findIINA,
 		commandFactory: func(ctx context.Context, exe string, args []string) command {
 			return &osCommand{iinaLaunchCommand(ctx, exe, args)}
 		},
-		dial:       net.Dial,
 		retryDelay: 150 * time.Millisecond,
-		ipcPoll:    25 * time.Millisecond,
 	}
 }
 
+// IINAPlayer drives the mpv core embedded in IINA.app through its JSON IPC
+// socket.
 type IINAPlayer struct {
-	mu             sync.Mutex
-	conn           net.Conn
-	reader         *bufio.Reader
-	sockPath       string
-	requestIDCount int
+	mpvInstance
 
-	command    command // was *exec.Cmd
-	fullscreen bool
+	fullscreen  bool
+	audioDevice string
 
 	// runtime hooks (unexported; production defaults above)
 	find           func() (string, error)
 	commandFactory func(ctx context.Context, exe string, args []string) command
-	dial           func(network, addr string) (net.Conn, error)
 	activate       func(context.Context) error
 	retryDelay     time.Duration
-	ipcPoll        time.Duration
-}
-
-func (p *IINAPlayer) Close(_ context.Context) error {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	return p.closeLocked()
-}
-
-// closeLocked tears down the IPC connection and removes the socket file.
-// Caller must hold p.mu.
-func (p *IINAPlayer) closeLocked() error {
-	var closeErr error
-	if p.conn != nil {
-		if err := p.conn.Close(); err != nil {
-			closeErr = fmt.Errorf("closing iina ipc socket fail: %w", err)
-		}
-		p.conn = nil
-		p.reader = nil
-	}
-	if p.sockPath != "" {
-		if err := os.Remove(p.sockPath); err != nil && !os.IsNotExist(err) {
-			if closeErr != nil {
-				return fmt.Errorf("multiple errors: %w, socket removal: %v", closeErr, err)
-			}
-			return fmt.Errorf("removing socket file: %w", err)
-		}
-		p.sockPath = ""
-	}
-	return closeErr
-}
-
-// resetConnLocked drops the current connection so the next send reconnects.
-// Caller must hold p.mu.
-func (p *IINAPlayer) resetConnLocked() {
-	if p.conn != nil {
-		_ = p.conn.Close()
-		p.conn = nil
-		p.reader = nil
-	}
 }
 
 func (p *IINAPlayer) Play(ctx context.Context, uri string, volume int) error {
@@ -140,6 +62,7 @@ func (p *IINAPlayer) Play(ctx context.Context, uri string, volume int) error {
 		if val, err := p.getProperty(ctx, "path"); err == nil {
 			if currentPath, ok := val.(string); ok && currentPath == uri {
 				_ = p.SetVolume(ctx, volume)
+				p.rewindIfEnded(ctx)
 				if err := p.Resume(ctx); err != nil {
 					return err
 				}
@@ -219,6 +142,9 @@ func (p *IINAPlayer) launch(ctx context.Context, exe, uri string, volume int) er
 	if p.fullscreen {
 		args = append(args, "--mpv-fs=yes")
 	}
+	if p.audioDevice != "" {
+		args = append(args, "--mpv-audio-device="+p.audioDevice)
+	}
 	args = append(args, uri)
 
 	cmd := p.commandFactory(ctx, exe, args)
@@ -266,263 +192,6 @@ func (p *IINAPlayer) bringToFront(ctx context.Context) {
 	}
 }
 
-func (p *IINAPlayer) wait(cmd command) {
-	_ = cmd.Wait()
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	if p.command == cmd {
-		p.command = nil
-	}
-}
-
-func (p *IINAPlayer) waitForIPC(ctx context.Context, sockPath string) error {
-	deadline := ipcDeadline(ctx)
-	var lastErr error
-	for {
-		conn, err := p.connect(sockPath)
-		if err == nil {
-			p.mu.Lock()
-			if p.sockPath != sockPath {
-				p.mu.Unlock()
-				_ = conn.Close()
-				return fmt.Errorf("IINA IPC endpoint changed while starting")
-			}
-			if p.conn == nil {
-				p.conn = conn
-				p.reader = bufio.NewReader(conn)
-			} else {
-				_ = conn.Close()
-			}
-			p.mu.Unlock()
-			return nil
-		}
-		lastErr = err
-		if time.Now().After(deadline) {
-			return lastErr
-		}
-		timer := time.NewTimer(p.ipcPoll)
-		select {
-		case <-ctx.Done():
-			timer.Stop()
-			return ctx.Err()
-		case <-timer.C:
-		}
-	}
-}
-
-func (p *IINAPlayer) connect(sockPath string) (net.Conn, error) {
-	if sockPath == "" {
-		return nil, fmt.Errorf("iina ipc socket path is empty")
-	}
-	conn, err := p.dial("unix", sockPath)
-	if err != nil {
-		return nil, fmt.Errorf("connect to iina ipc socket fail: %w", err)
-	}
-	return conn, nil
-}
-
-func (p *IINAPlayer) hasLiveConnection() bool {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	return p.conn != nil
-}
-
-func (p *IINAPlayer) Pause(ctx context.Context) error {
-	return p.sendOK(ctx, []any{"set_property", "pause", true}, "pause")
-}
-
-func (p *IINAPlayer) StopPlayback(ctx context.Context) error {
-	return p.sendOK(ctx, []any{"stop"}, "stop playback")
-}
-
-func (p *IINAPlayer) Resume(ctx context.Context) error {
-	return p.sendOK(ctx, []any{"set_property", "pause", false}, "resume")
-}
-
-func (p *IINAPlayer) Stop(ctx context.Context) error {
-	p.mu.Lock()
-	hasEndpoint := p.sockPath != ""
-	p.mu.Unlock()
-	if hasEndpoint {
-		quitCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
-		_, _ = p.send(quitCtx, []any{"quit"})
-		cancel()
-	}
-
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	// Close IPC + remove socket, then kill the process. wait() owns cmd.Wait so
-	// every child is reaped exactly once.
-	stopErr := p.closeLocked()
-
-	if p.command != nil {
-		if err := p.command.Kill(); err != nil {
-			if stopErr != nil {
-				return fmt.Errorf("multiple errors: %w, killing process: %v", stopErr, err)
-			}
-			return fmt.Errorf("killing process: %w", err)
-		}
-		p.command = nil
-	}
-	return stopErr
-}
-
-func (p *IINAPlayer) SetVolume(ctx context.Context, v int) error {
-	return p.sendOK(ctx, []any{"set_property", "volume", v}, "set volume")
-}
-
-func (p *IINAPlayer) SetMute(ctx context.Context, m bool) error {
-	return p.sendOK(ctx, []any{"set_property", "mute", m}, "set mute")
-}
-
-func (p *IINAPlayer) SetFullscreen(ctx context.Context, f bool) error {
-	return p.sendOK(ctx, []any{"set_property", "fullscreen", f}, "set fullscreen")
-}
-
-func (p *IINAPlayer) SetTitle(ctx context.Context, title string) error {
-	return p.sendOK(ctx, []any{"set_property", "force-media-title", title}, "set title")
-}
-
-func (p *IINAPlayer) Screenshot(ctx context.Context, _ string) error {
-	return p.sendOK(ctx, []any{"screenshot"}, "screenshot")
-}
-
-func (p *IINAPlayer) SetSpeed(ctx context.Context, speed float64) error {
-	return p.sendOK(ctx, []any{"set_property", "speed", speed}, "set speed")
-}
-
-func (p *IINAPlayer) Seek(ctx context.Context, seconds float64) error {
-	return p.sendOK(ctx, []any{"seek", seconds, "absolute"}, "seek")
-}
-
-func (p *IINAPlayer) GetPosition(ctx context.Context) (float64, error) {
-	return p.getPropertyNum(ctx, "time-pos")
-}
-
-func (p *IINAPlayer) GetDuration(ctx context.Context) (float64, error) {
-	return p.getPropertyNum(ctx, "duration")
-}
-
-func (p *IINAPlayer) getProperty(ctx context.Context, name string) (any, error) {
-	return p.send(ctx, []any{"get_property", name})
-}
-
-func (p *IINAPlayer) getPropertyNum(ctx context.Context, name string) (float64, error) {
-	val, err := p.send(ctx, []any{"get_property", name})
-	if err != nil {
-		return 0, err
-	}
-	if v, ok := val.(float64); ok {
-		return v, nil
-	}
-	return 0, fmt.Errorf("unexpected type for %s: %T", name, val)
-}
-
-// sendOK issues a command and wraps any error with the action name.
-func (p *IINAPlayer) sendOK(ctx context.Context, command []any, action string) error {
-	if _, err := p.send(ctx, command); err != nil {
-		return fmt.Errorf("calling iina %s failed: %w", action, err)
-	}
-	return nil
-}
-
-// send allocates a request id under the lock, writes the command, and reads
-// back the matching response. Each read/write is capped by ipcTimeout and the
-// context deadline, so a stalled IINA cannot hold the lock indefinitely.
-func (p *IINAPlayer) send(ctx context.Context, command []any) (any, error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	if p.sockPath == "" {
-		return nil, fmt.Errorf("iina ipc socket path is empty")
-	}
-
-	// Allocate the request id inside the critical section: concurrent callers
-	// (every transport handler dispatches its own goroutine) can no longer race
-	// on requestIDCount or collide ids.
-	p.requestIDCount++
-	requestID := p.requestIDCount
-
-	data, _ := json.Marshal(MPVJSONIPCRequest{
-		RequestID: requestID,
-		Command:   command,
-	})
-	data = append(data, '\n')
-
-	var lastErr error
-	for range 2 { // 1 initial attempt + 1 reconnect retry
-		if err := ctx.Err(); err != nil {
-			return nil, err
-		}
-
-		if p.conn == nil {
-			conn, err := p.connect(p.sockPath)
-			if err != nil {
-				lastErr = err
-				continue
-			}
-			p.conn = conn
-			p.reader = bufio.NewReader(conn)
-		}
-
-		if err := p.conn.SetDeadline(ipcDeadline(ctx)); err != nil {
-			lastErr = fmt.Errorf("set write deadline fail: %w", err)
-			p.resetConnLocked()
-			continue
-		}
-		if _, err := p.conn.Write(data); err != nil {
-			lastErr = fmt.Errorf("writing to iina ipc socket fail: %w", err)
-			p.resetConnLocked()
-			continue
-		}
-
-		// Read until we find the response matching our request id.
-		for {
-			if err := p.conn.SetDeadline(ipcDeadline(ctx)); err != nil {
-				lastErr = fmt.Errorf("set read deadline fail: %w", err)
-				p.resetConnLocked()
-				break
-			}
-			respBytes, err := p.reader.ReadBytes('\n')
-			if err != nil {
-				lastErr = fmt.Errorf("reading from iina ipc socket fail: %w", err)
-				p.resetConnLocked()
-				break
-			}
-
-			var resp MPVJSONIPCResponse
-			if err := json.Unmarshal(respBytes, &resp); err != nil {
-				// Unparseable line (noise/partial) — skip and keep reading.
-				log.Warn("unmarshal iina ipc response fail: %v data=%s", err, string(respBytes))
-				continue
-			}
-			if resp.Event != "" {
-				continue // asynchronous mpv event, not our reply
-			}
-			if resp.RequestID != requestID {
-				continue // stale or out-of-order reply for another request
-			}
-			if resp.Error != "success" {
-				return nil, fmt.Errorf("iina ipc response error: %s %s", resp.Error, string(respBytes))
-			}
-			return resp.Data, nil
-		}
-		// Reached only after the read loop broke on error → retry the outer loop.
-	}
-
-	return nil, lastErr
-}
-
-// ipcDeadline returns the earlier of ipcTimeout-from-now and the context deadline.
-func ipcDeadline(ctx context.Context) time.Time {
-	dl := time.Now().Add(ipcTimeout)
-	if ctxDL, ok := ctx.Deadline(); ok && ctxDL.Before(dl) {
-		return ctxDL
-	}
-	return dl
-}
-
 // findIINA locates an executable, IPC-controllable IINA binary: it prefers
 // iina-cli, then the IINA.app internal binary. It returns a real error when
 // nothing is installed, so callers surface "IINA not found" instead of failing
@@ -541,8 +210,3 @@ func findIINA() (string, error) {
 	}
 	return "", fmt.Errorf("IINA not installed (looked for iina-cli and %s)", iinaAppBinary)
 }
-
-func fileExists(p string) bool {
-	_, err := os.Stat(p)
-	return err == nil
-}
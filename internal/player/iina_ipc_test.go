@@ -19,9 +19,15 @@ type fakeMPVServer struct {
 	listener *net.UnixListener
 	sockPath string
 
-	mu    sync.Mutex
-	noop  bool // when true, swallow commands and never reply (forces timeout)
-	props map[string]any
+	mu       sync.Mutex
+	noop     bool // when true, swallow commands and never reply (forces timeout)
+	props    map[string]any
+	playlist []string // entries queued after the current path
+
+	observers map[string][]*net.UnixConn // observe_property subscribers by name
+	seeks     []float64
+	seekModes []string
+	subAdds   [][]any // arguments of each sub-add
 }
 
 func newFakeMPVServer(t *testing.T) *fakeMPVServer {
@@ -39,7 +45,7 @@ func newFakeMPVServer(t *testing.T) *fakeMPVServer {
 		t.Fatalf("listen unix: %v", err)
 	}
 	t.Cleanup(func() { _ = os.Remove(sockPath) })
-	s := &fakeMPVServer{listener: l, sockPath: sockPath, props: map[string]any{}}
+	s := &fakeMPVServer{listener: l, sockPath: sockPath, props: map[string]any{}, observers: map[string][]*net.UnixConn{}}
 	go s.serve()
 	return s
 }
@@ -81,6 +87,7 @@ func (s *fakeMPVServer) handle(conn *net.UnixConn) {
 		}
 
 		resp := MPVJSONIPCResponse{RequestID: req.RequestID, Error: "success"}
+		observed := ""
 		if len(req.Command) > 0 {
 			switch req.Command[0] {
 			case "get_property":
@@ -100,7 +107,13 @@ func (s *fakeMPVServer) handle(conn *net.UnixConn) {
 				if len(req.Command) >= 2 {
 					if uri, ok := req.Command[1].(string); ok {
 						s.mu.Lock()
-						s.props["path"] = uri
+						if len(req.Command) >= 3 && req.Command[2] == "append" {
+							s.playlist = append(s.playlist, uri)
+						} else {
+							s.props["path"] = uri
+							s.playlist = nil
+							s.notifyLocked("path", uri)
+						}
 						s.mu.Unlock()
 					}
 				}
@@ -108,27 +121,87 @@ func (s *fakeMPVServer) handle(conn *net.UnixConn) {
 				if len(req.Command) >= 3 {
 					if name, ok := req.Command[1].(string); ok {
 						s.mu.Lock()
+						// Like mpv, only report values that change.
+						if old, ok := s.props[name]; !ok || old != req.Command[2] {
+							s.notifyLocked(name, req.Command[2])
+						}
 						s.props[name] = req.Command[2]
 						s.mu.Unlock()
 					}
 				}
+			case "seek":
+				if len(req.Command) >= 2 {
+					if target, ok := req.Command[1].(float64); ok {
+						s.mu.Lock()
+						s.seeks = append(s.seeks, target)
+						if len(req.Command) >= 3 {
+							mode, _ := req.Command[2].(string)
+							s.seekModes = append(s.seekModes, mode)
+						}
+						s.mu.Unlock()
+					}
+				}
+			case "sub-add":
+				s.mu.Lock()
+				s.subAdds = append(s.subAdds, req.Command[1:])
+				s.mu.Unlock()
+			case "playlist-clear":
+				s.mu.Lock()
+				s.playlist = nil
+				s.mu.Unlock()
 			case "stop":
 				s.mu.Lock()
 				delete(s.props, "path")
+				s.playlist = nil
+				s.notifyLocked("idle-active", true)
 				s.mu.Unlock()
+			case "observe_property":
+				if len(req.Command) >= 3 {
+					if name, ok := req.Command[2].(string); ok {
+						observed = name
+					}
+				}
 			}
 		}
 		out, _ := json.Marshal(resp)
 		if _, err := conn.Write(append(out, '\n')); err != nil {
 			return
 		}
+		if observed != "" {
+			// Like mpv, answer a new observation with the current value.
+			s.mu.Lock()
+			s.observers[observed] = append(s.observers[observed], conn)
+			value := s.props[observed]
+			s.mu.Unlock()
+			writePropertyChange(conn, observed, value)
+		}
+	}
+}
+
+// notifyLocked sends a property-change event to every observer of name.
+// Caller must hold s.mu.
+func (s *fakeMPVServer) notifyLocked(name string, value any) {
+	for _, conn := range s.observers[name] {
+		writePropertyChange(conn, name, value)
 	}
 }
 
+func writePropertyChange(conn *net.UnixConn, name string, value any) {
+	out, _ := json.Marshal(MPVJSONIPCResponse{Event: "property-change", Name: name, Data: value})
+	_, _ = conn.Write(append(out, '\n'))
+}
+
 func (s *fakeMPVServer) setProp(name string, val any) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.props[name] = val
+	s.notifyLocked(name, val)
+}
+
+func (s *fakeMPVServer) queued() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.playlist...)
 }
 
 func (s *fakeMPVServer) setNoop(v bool) {
@@ -143,7 +216,7 @@ func (s *fakeMPVServer) close() { _ = s.listener.Close() }
 // socket, bypassing the real IINA launch entirely.
 func playerOnSocket(t *testing.T, s *fakeMPVServer) *IINAPlayer {
 	t.Helper()
-	p := NewIINAPlayer(false)
+	p := NewIINAPlayer(false, "")
 	p.sockPath = s.sockPath
 	return p
 }
@@ -171,6 +244,88 @@ func TestIINAPlayer_CommandAndGetProperty(t *testing.T) {
 	}
 }
 
+func TestIINAPlayer_FileSizeAndSeekPercent(t *testing.T) {
+	s := newFakeMPVServer(t)
+	defer s.close()
+	p := playerOnSocket(t, s)
+	ctx := context.Background()
+
+	s.setProp("file-size", float64(1<<30))
+	if size, err := p.GetFileSize(ctx); err != nil || size != 1<<30 {
+		t.Fatalf("GetFileSize = %d, %v", size, err)
+	}
+	if err := p.SeekPercent(ctx, 25); err != nil {
+		t.Fatalf("SeekPercent: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.seeks) != 1 || s.seeks[0] != 25 || s.seekModes[0] != "absolute-percent" {
+		t.Fatalf("seeks = %v %v, want 25 absolute-percent", s.seeks, s.seekModes)
+	}
+}
+
+func TestIINAPlayer_MediaInfo(t *testing.T) {
+	s := newFakeMPVServer(t)
+	defer s.close()
+	p := playerOnSocket(t, s)
+	ctx := context.Background()
+
+	s.setProp("media-title", "Song")
+	if info, err := p.GetMediaInfo(ctx); err != nil || info != (MediaInfo{Title: "Song"}) {
+		t.Fatalf("audio GetMediaInfo = %+v, %v", info, err)
+	}
+	s.setProp("width", float64(1920))
+	s.setProp("height", float64(1080))
+	if info, err := p.GetMediaInfo(ctx); err != nil || info != (MediaInfo{Title: "Song", Width: 1920, Height: 1080}) {
+		t.Fatalf("video GetMediaInfo = %+v, %v", info, err)
+	}
+}
+
+func TestIINAPlayer_SetNextReplacesQueuedEntry(t *testing.T) {
+	s := newFakeMPVServer(t)
+	defer s.close()
+	s.setProp("path", "http://example.com/1.flac")
+	p := playerOnSocket(t, s)
+	ctx := context.Background()
+
+	if err := p.SetNext(ctx, "http://example.com/2.flac"); err != nil {
+		t.Fatalf("SetNext: %v", err)
+	}
+	if err := p.SetNext(ctx, "http://example.com/3.flac"); err != nil {
+		t.Fatalf("SetNext again: %v", err)
+	}
+	if got := s.queued(); len(got) != 1 || got[0] != "http://example.com/3.flac" {
+		t.Fatalf("queued = %v, want only the latest next entry", got)
+	}
+	if path, err := p.GetPath(ctx); err != nil || path != "http://example.com/1.flac" {
+		t.Fatalf("GetPath = %q, %v; want the current entry untouched", path, err)
+	}
+
+	if err := p.SetNext(ctx, ""); err != nil {
+		t.Fatalf("SetNext(empty): %v", err)
+	}
+	if got := s.queued(); len(got) != 0 {
+		t.Fatalf("queued = %v, want empty after clearing", got)
+	}
+}
+
+func TestIINAPlayer_AddSubtitlesSelectsFirst(t *testing.T) {
+	s := newFakeMPVServer(t)
+	defer s.close()
+	p := playerOnSocket(t, s)
+
+	if err := p.AddSubtitles(context.Background(), []string{"http://example.com/en.srt", "http://example.com/de.srt"}); err != nil {
+		t.Fatalf("AddSubtitles: %v", err)
+	}
+	s.mu.Lock()
+	got := s.subAdds
+	s.mu.Unlock()
+	if len(got) != 2 || got[0][0] != "http://example.com/en.srt" || got[0][1] != "select" ||
+		got[1][0] != "http://example.com/de.srt" || got[1][1] != "auto" {
+		t.Fatalf("sub-add calls = %v", got)
+	}
+}
+
 func TestIINAPlayer_StopPlaybackKeepsIPCReusable(t *testing.T) {
 	s := newFakeMPVServer(t)
 	defer s.close()
@@ -308,14 +463,14 @@ func TestIINAPlayer_SendTimeout(t *testing.T) {
 }
 
 func TestIINAPlayer_SendWithoutSocket(t *testing.T) {
-	p := NewIINAPlayer(false)
+	p := NewIINAPlayer(false, "")
 	if err := p.SetVolume(context.Background(), 50); err == nil {
 		t.Fatal("expected error when no socket path is set")
 	}
 }
 
 func TestIINAPlayer_StopIdempotent(t *testing.T) {
-	p := NewIINAPlayer(false)
+	p := NewIINAPlayer(false, "")
 	// Stop on a fresh player (no conn, no process) must not panic or deadlock.
 	if err := p.Stop(context.Background()); err != nil {
 		t.Fatalf("Stop on fresh player: %v", err)
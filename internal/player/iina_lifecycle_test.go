@@ -92,12 +92,15 @@ func withSmallIPCTimeout(t *testing.T, d time.Duration) {
 // exercised only when the test wires a counting activate closure.
 func newTestPlayer(t *testing.T) *IINAPlayer {
 	t.Helper()
-	p := NewIINAPlayer(false)
+	p := NewIINAPlayer(false, "")
 	p.retryDelay = 1 * time.Millisecond
 	p.ipcPoll = 1 * time.Millisecond
 	p.dial = func(network, addr string) (net.Conn, error) {
 		return nil, errors.New("dial disabled")
 	}
+	p.dialEvents = func(network, addr string) (net.Conn, error) {
+		return nil, errors.New("event dial disabled")
+	}
 	p.find = func() (string, error) { return "/opt/homebrew/bin/iina-cli", nil }
 	p.activate = func(context.Context) error { return nil }
 	return p
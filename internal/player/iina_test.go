@@ -30,7 +30,7 @@ func TestIINAPlayer_Integration(t *testing.T) {
 		t.Fatalf("stat %s: %v", media, err)
 	}
 
-	p := NewIINAPlayer(false)
+	p := NewIINAPlayer(false, "")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -0,0 +1,611 @@
+package player
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/tr1v3r/pkg/log"
+)
+
+// docs: https://mpv.io/manual/stable/#json-ipc
+
+type MPVJSONIPCRequest struct {
+	Command []any `json:"command"` // https://mpv.io/manual/stable/#properties
+
+	RequestID int  `json:"request_id,omitempty"`
+	Async     bool `json:"async,omitempty"`
+}
+
+type MPVJSONIPCResponse struct {
+	RequestID int    `json:"request_id,omitempty"`
+	Error     string `json:"error"`
+
+	Data  any    `json:"data,omitempty"`
+	Event string `json:"event,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// ipcTimeout caps how long a single IPC write/read may block. Without it, a
+// hung player would hold the player lock forever and stall every later command.
+// It is a var (not a const) so tests can shrink it.
+var ipcTimeout = 3 * time.Second
+
+// command is the small surface of an OS process that the players use, so
+// launch/Stop can be exercised without spawning a real IINA or mpv.
+type command interface {
+	Start() error
+	Wait() error
+	Kill() error
+}
+
+// osCommand adapts exec.Cmd to command. Kill mirrors the prior Stop logic:
+// tolerate a nil process and treat an already-exited process as success.
+type osCommand struct{ cmd *exec.Cmd }
+
+func (c *osCommand) Start() error { return c.cmd.Start() }
+
+func (c *osCommand) Wait() error { return c.cmd.Wait() }
+
+func (c *osCommand) Kill() error {
+	if c.cmd.Process == nil {
+		return nil
+	}
+	if err := c.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
+
+// mpvInstance is an mpv process — standalone or embedded in IINA — together
+// with its JSON IPC connection. Both backends embed it, so connection
+// handling, request-id matching and the property commands exist once.
+type mpvInstance struct {
+	mu             sync.Mutex
+	conn           net.Conn
+	reader         *bufio.Reader
+	sockPath       string
+	requestIDCount int
+
+	command command // was *exec.Cmd
+
+	// eventConn is a second IPC client dedicated to observe_property
+	// notifications, so the request/response path in send never has to
+	// demultiplex them.
+	eventConn net.Conn
+	events    chan Event
+
+	// runtime hooks (unexported; production defaults set by constructors)
+	dial       func(network, addr string) (net.Conn, error)
+	dialEvents func(network, addr string) (net.Conn, error)
+	ipcPoll    time.Duration
+}
+
+// eventBuffer bounds undelivered events; when the consumer falls behind, new
+// events are dropped rather than stalling the IPC reader.
+const eventBuffer = 32
+
+// observedProperties are watched on the event connection. Each is observed
+// with its index+1 as the observe id.
+var observedProperties = []string{"pause", "eof-reached", "idle-active", "time-pos", "path", "duration"}
+
+func newMPVInstance() mpvInstance {
+	return mpvInstance{
+		events:     make(chan Event, eventBuffer),
+		dial:       net.Dial,
+		dialEvents: net.Dial,
+		ipcPoll:    25 * time.Millisecond,
+	}
+}
+
+func (p *mpvInstance) Events() <-chan Event { return p.events }
+
+func (p *mpvInstance) Close(_ context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closeLocked()
+}
+
+// closeLocked tears down the IPC and event connections and removes the
+// socket file.
+// Caller must hold p.mu.
+func (p *mpvInstance) closeLocked() error {
+	var closeErr error
+	if p.conn != nil {
+		if err := p.conn.Close(); err != nil {
+			closeErr = fmt.Errorf("closing mpv ipc socket fail: %w", err)
+		}
+		p.conn = nil
+		p.reader = nil
+	}
+	if p.eventConn != nil {
+		// Ends watchEvents, so the next launch can observe its own instance.
+		_ = p.eventConn.Close()
+		p.eventConn = nil
+	}
+	if p.sockPath != "" {
+		if err := os.Remove(p.sockPath); err != nil && !os.IsNotExist(err) {
+			if closeErr != nil {
+				return fmt.Errorf("multiple errors: %w, socket removal: %v", closeErr, err)
+			}
+			return fmt.Errorf("removing socket file: %w", err)
+		}
+		p.sockPath = ""
+	}
+	return closeErr
+}
+
+// resetConnLocked drops the current connection so the next send reconnects.
+// Caller must hold p.mu.
+func (p *mpvInstance) resetConnLocked() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+		p.reader = nil
+	}
+}
+
+func (p *mpvInstance) wait(cmd command) {
+	_ = cmd.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.command == cmd {
+		p.command = nil
+	}
+}
+
+func (p *mpvInstance) waitForIPC(ctx context.Context, sockPath string) error {
+	deadline := ipcDeadline(ctx)
+	var lastErr error
+	for {
+		conn, err := p.connect(sockPath)
+		if err == nil {
+			p.mu.Lock()
+			if p.sockPath != sockPath {
+				p.mu.Unlock()
+				_ = conn.Close()
+				return fmt.Errorf("mpv IPC endpoint changed while starting")
+			}
+			if p.conn == nil {
+				p.conn = conn
+				p.reader = bufio.NewReader(conn)
+			} else {
+				_ = conn.Close()
+			}
+			p.mu.Unlock()
+			go p.watchEvents(sockPath)
+			return nil
+		}
+		lastErr = err
+		if time.Now().After(deadline) {
+			return lastErr
+		}
+		timer := time.NewTimer(p.ipcPoll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// watchEvents observes the player's properties on its own connection and
+// forwards the changes to the events channel. It returns once the connection
+// closes, which closeLocked forces on Stop.
+func (p *mpvInstance) watchEvents(sockPath string) {
+	conn, err := p.dialEvents("unix", sockPath)
+	if err != nil {
+		log.Warn("connect to mpv event socket fail: %v", err)
+		return
+	}
+	p.mu.Lock()
+	if p.sockPath != sockPath || p.eventConn != nil {
+		p.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	p.eventConn = conn
+	p.mu.Unlock()
+	defer func() {
+		_ = conn.Close()
+		p.mu.Lock()
+		if p.eventConn == conn {
+			p.eventConn = nil
+		}
+		p.mu.Unlock()
+	}()
+
+	_ = conn.SetWriteDeadline(time.Now().Add(ipcTimeout))
+	for i, name := range observedProperties {
+		data, _ := json.Marshal(MPVJSONIPCRequest{Command: []any{"observe_property", i + 1, name}})
+		if _, err := conn.Write(append(data, '\n')); err != nil {
+			log.Warn("observe mpv property %s fail: %v", name, err)
+			return
+		}
+	}
+
+	var tr eventTranslator
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var resp MPVJSONIPCResponse
+		if err := json.Unmarshal(line, &resp); err != nil || resp.Event != "property-change" {
+			continue
+		}
+		if ev, ok := tr.translate(resp.Name, resp.Data); ok {
+			select {
+			case p.events <- ev:
+			default:
+				log.Debug("mpv event buffer full, dropping %s", ev.Type)
+			}
+		}
+	}
+}
+
+// eventTranslator turns property-change notifications into Events. mpv
+// answers every observe_property with the current value first; those initial
+// values predate the command that is loading media, so they are swallowed
+// rather than allowed to overwrite the transport state a handler just set.
+type eventTranslator struct {
+	seen       map[string]bool
+	lastSecond int
+}
+
+func (t *eventTranslator) translate(name string, data any) (Event, bool) {
+	if t.seen == nil {
+		t.seen = make(map[string]bool)
+	}
+	initial := !t.seen[name]
+	t.seen[name] = true
+
+	if name == "time-pos" {
+		pos, ok := data.(float64)
+		if !ok {
+			return Event{}, false
+		}
+		// time-pos changes every frame; one update per second is plenty.
+		if sec := int(pos); initial || sec != t.lastSecond {
+			t.lastSecond = sec
+			return Event{Type: EventPosition, Position: pos}, true
+		}
+		return Event{}, false
+	}
+	if name == "duration" {
+		// Like time-pos, the current value is news rather than stale state.
+		if d, ok := data.(float64); ok && d > 0 {
+			return Event{Type: EventDuration, Duration: d}, true
+		}
+		return Event{}, false
+	}
+	if initial {
+		return Event{}, false
+	}
+
+	switch name {
+	case "pause":
+		if paused, ok := data.(bool); ok {
+			if paused {
+				return Event{Type: EventPaused}, true
+			}
+			return Event{Type: EventResumed}, true
+		}
+	case "eof-reached":
+		if eof, _ := data.(bool); eof {
+			return Event{Type: EventEndOfFile}, true
+		}
+	case "idle-active":
+		if idle, _ := data.(bool); idle {
+			return Event{Type: EventIdle}, true
+		}
+	case "path":
+		if path, _ := data.(string); path != "" {
+			return Event{Type: EventTrackChanged, Path: path}, true
+		}
+	}
+	return Event{}, false
+}
+
+func (p *mpvInstance) connect(sockPath string) (net.Conn, error) {
+	if sockPath == "" {
+		return nil, fmt.Errorf("mpv ipc socket path is empty")
+	}
+	conn, err := p.dial("unix", sockPath)
+	if err != nil {
+		return nil, fmt.Errorf("connect to mpv ipc socket fail: %w", err)
+	}
+	return conn, nil
+}
+
+func (p *mpvInstance) hasLiveConnection() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn != nil
+}
+
+// Stop quits the player, closes the IPC endpoint and kills the process.
+func (p *mpvInstance) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	hasEndpoint := p.sockPath != ""
+	p.mu.Unlock()
+	if hasEndpoint {
+		quitCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		_, _ = p.send(quitCtx, []any{"quit"})
+		cancel()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Close IPC + remove socket, then kill the process. wait() owns cmd.Wait so
+	// every child is reaped exactly once.
+	stopErr := p.closeLocked()
+
+	if p.command != nil {
+		if err := p.command.Kill(); err != nil {
+			if stopErr != nil {
+				return fmt.Errorf("multiple errors: %w, killing process: %v", stopErr, err)
+			}
+			return fmt.Errorf("killing process: %w", err)
+		}
+		p.command = nil
+	}
+	return stopErr
+}
+
+func (p *mpvInstance) Pause(ctx context.Context) error {
+	return p.sendOK(ctx, []any{"set_property", "pause", true}, "pause")
+}
+
+func (p *mpvInstance) StopPlayback(ctx context.Context) error {
+	return p.sendOK(ctx, []any{"stop"}, "stop playback")
+}
+
+func (p *mpvInstance) Resume(ctx context.Context) error {
+	return p.sendOK(ctx, []any{"set_property", "pause", false}, "resume")
+}
+
+// rewindIfEnded seeks back to the start when keep-open left the player parked
+// on the final frame, so playing the same URI again starts over.
+func (p *mpvInstance) rewindIfEnded(ctx context.Context) {
+	if eof, err := p.getProperty(ctx, "eof-reached"); err == nil && eof == true {
+		if err := p.sendOK(ctx, []any{"seek", 0, "absolute"}, "rewind"); err != nil {
+			log.CtxWarn(ctx, "rewind finished media: %v", err)
+		}
+	}
+}
+
+func (p *mpvInstance) SetVolume(ctx context.Context, v int) error {
+	return p.sendOK(ctx, []any{"set_property", "volume", v}, "set volume")
+}
+
+func (p *mpvInstance) SetMute(ctx context.Context, m bool) error {
+	return p.sendOK(ctx, []any{"set_property", "mute", m}, "set mute")
+}
+
+func (p *mpvInstance) SetFullscreen(ctx context.Context, f bool) error {
+	return p.sendOK(ctx, []any{"set_property", "fullscreen", f}, "set fullscreen")
+}
+
+func (p *mpvInstance) SetTitle(ctx context.Context, title string) error {
+	return p.sendOK(ctx, []any{"set_property", "force-media-title", title}, "set title")
+}
+
+func (p *mpvInstance) Screenshot(ctx context.Context, _ string) error {
+	return p.sendOK(ctx, []any{"screenshot"}, "screenshot")
+}
+
+func (p *mpvInstance) SetSpeed(ctx context.Context, speed float64) error {
+	return p.sendOK(ctx, []any{"set_property", "speed", speed}, "set speed")
+}
+
+func (p *mpvInstance) Seek(ctx context.Context, seconds float64) error {
+	return p.sendOK(ctx, []any{"seek", seconds, "absolute"}, "seek")
+}
+
+func (p *mpvInstance) SeekPercent(ctx context.Context, percent float64) error {
+	return p.sendOK(ctx, []any{"seek", percent, "absolute-percent"}, "seek")
+}
+
+// AddSubtitles runs sub-add for each uri; only the first is selected, the
+// rest are listed for the user to switch to.
+func (p *mpvInstance) AddSubtitles(ctx context.Context, uris []string) error {
+	for i, uri := range uris {
+		flag := "auto"
+		if i == 0 {
+			flag = "select"
+		}
+		if err := p.sendOK(ctx, []any{"sub-add", uri, flag}, "sub-add"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetNext keeps the current entry, drops anything queued after it and appends
+// uri, so mpv advances to it gaplessly when the current file ends.
+func (p *mpvInstance) SetNext(ctx context.Context, uri string) error {
+	if err := p.sendOK(ctx, []any{"playlist-clear"}, "playlist-clear"); err != nil {
+		return err
+	}
+	if uri == "" {
+		return nil
+	}
+	return p.sendOK(ctx, []any{"loadfile", uri, "append"}, "loadfile append")
+}
+
+func (p *mpvInstance) GetPath(ctx context.Context) (string, error) {
+	val, err := p.getProperty(ctx, "path")
+	if err != nil {
+		return "", err
+	}
+	if v, ok := val.(string); ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("unexpected type for path: %T", val)
+}
+
+func (p *mpvInstance) GetPosition(ctx context.Context) (float64, error) {
+	return p.getPropertyNum(ctx, "time-pos")
+}
+
+func (p *mpvInstance) GetDuration(ctx context.Context) (float64, error) {
+	return p.getPropertyNum(ctx, "duration")
+}
+
+// GetMediaInfo reads media-title and the video size; files without video
+// have no width or height, which leaves them 0.
+func (p *mpvInstance) GetMediaInfo(ctx context.Context) (MediaInfo, error) {
+	val, err := p.getProperty(ctx, "media-title")
+	if err != nil {
+		return MediaInfo{}, err
+	}
+	info := MediaInfo{}
+	info.Title, _ = val.(string)
+	if w, err := p.getPropertyNum(ctx, "width"); err == nil {
+		info.Width = int(w)
+	}
+	if h, err := p.getPropertyNum(ctx, "height"); err == nil {
+		info.Height = int(h)
+	}
+	return info, nil
+}
+
+func (p *mpvInstance) GetFileSize(ctx context.Context) (int64, error) {
+	size, err := p.getPropertyNum(ctx, "file-size")
+	return int64(size), err
+}
+
+func (p *mpvInstance) getProperty(ctx context.Context, name string) (any, error) {
+	return p.send(ctx, []any{"get_property", name})
+}
+
+func (p *mpvInstance) getPropertyNum(ctx context.Context, name string) (float64, error) {
+	val, err := p.send(ctx, []any{"get_property", name})
+	if err != nil {
+		return 0, err
+	}
+	if v, ok := val.(float64); ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("unexpected type for %s: %T", name, val)
+}
+
+// sendOK issues a command and wraps any error with the action name.
+func (p *mpvInstance) sendOK(ctx context.Context, command []any, action string) error {
+	if _, err := p.send(ctx, command); err != nil {
+		return fmt.Errorf("calling mpv %s failed: %w", action, err)
+	}
+	return nil
+}
+
+// send allocates a request id under the lock, writes the command, and reads
+// back the matching response. Each read/write is capped by ipcTimeout and the
+// context deadline, so a stalled player cannot hold the lock indefinitely.
+func (p *mpvInstance) send(ctx context.Context, command []any) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sockPath == "" {
+		return nil, fmt.Errorf("mpv ipc socket path is empty")
+	}
+
+	// Allocate the request id inside the critical section: concurrent callers
+	// (every transport handler dispatches its own goroutine) can no longer race
+	// on requestIDCount or collide ids.
+	p.requestIDCount++
+	requestID := p.requestIDCount
+
+	data, _ := json.Marshal(MPVJSONIPCRequest{
+		RequestID: requestID,
+		Command:   command,
+	})
+	data = append(data, '\n')
+
+	var lastErr error
+	for range 2 { // 1 initial attempt + 1 reconnect retry
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if p.conn == nil {
+			conn, err := p.connect(p.sockPath)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			p.conn = conn
+			p.reader = bufio.NewReader(conn)
+		}
+
+		if err := p.conn.SetDeadline(ipcDeadline(ctx)); err != nil {
+			lastErr = fmt.Errorf("set write deadline fail: %w", err)
+			p.resetConnLocked()
+			continue
+		}
+		if _, err := p.conn.Write(data); err != nil {
+			lastErr = fmt.Errorf("writing to mpv ipc socket fail: %w", err)
+			p.resetConnLocked()
+			continue
+		}
+
+		// Read until we find the response matching our request id.
+		for {
+			if err := p.conn.SetDeadline(ipcDeadline(ctx)); err != nil {
+				lastErr = fmt.Errorf("set read deadline fail: %w", err)
+				p.resetConnLocked()
+				break
+			}
+			respBytes, err := p.reader.ReadBytes('\n')
+			if err != nil {
+				lastErr = fmt.Errorf("reading from mpv ipc socket fail: %w", err)
+				p.resetConnLocked()
+				break
+			}
+
+			var resp MPVJSONIPCResponse
+			if err := json.Unmarshal(respBytes, &resp); err != nil {
+				// Unparseable line (noise/partial) — skip and keep reading.
+				log.Warn("unmarshal mpv ipc response fail: %v data=%s", err, string(respBytes))
+				continue
+			}
+			if resp.Event != "" {
+				continue // asynchronous mpv event, not our reply
+			}
+			if resp.RequestID != requestID {
+				continue // stale or out-of-order reply for another request
+			}
+			if resp.Error != "success" {
+				return nil, fmt.Errorf("mpv ipc response error: %s %s", resp.Error, string(respBytes))
+			}
+			return resp.Data, nil
+		}
+		// Reached only after the read loop broke on error → retry the outer loop.
+	}
+
+	return nil, lastErr
+}
+
+// ipcDeadline returns the earlier of ipcTimeout-from-now and the context deadline.
+func ipcDeadline(ctx context.Context) time.Time {
+	dl := time.Now().Add(ipcTimeout)
+	if ctxDL, ok := ctx.Deadline(); ok && ctxDL.Before(dl) {
+		return ctxDL
+	}
+	return dl
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
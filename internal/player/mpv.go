@@ -1,19 +1,121 @@
 package player
 
-// docs: https://mpv.io/manual/stable/#json-ipc
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
 
-type MPVJSONIPCRequest struct {
-	Command []any `json:"command"` // https://mpv.io/manual/stable/#properties
+	"github.com/google/uuid"
+	"github.com/tr1v3r/pkg/log"
+)
 
-	RequestID int  `json:"request_id,omitempty"`
-	Async     bool `json:"async,omitempty"`
+const mpvSockPathPrefix = "/tmp/rcast_mpv-ipc-sock_"
+
+// NewMPVPlayer returns a player that launches mpv on first use; an empty
+// audioDevice keeps mpv's default output.
+func NewMPVPlayer(fullscreen bool, audioDevice string) *MPVPlayer {
+	return &MPVPlayer{
+		mpvInstance: newMPVInstance(),
+		fullscreen:  fullscreen,
+		audioDevice: audioDevice,
+		find:        findMPV,
+		commandFactory: func(ctx context.Context, exe string, args []string) command {
+			return &osCommand{exec.CommandContext(ctx, exe, args...)}
+		},
+	}
+}
+
+// MPVPlayer runs a standalone mpv with --input-ipc-server, for hosts without
+// IINA such as Linux media boxes. mpv is started idle and kept running, so
+// later casts load into the same window over IPC.
+type MPVPlayer struct {
+	mpvInstance
+
+	fullscreen  bool
+	audioDevice string
+
+	// runtime hooks (unexported; production defaults above)
+	find           func() (string, error)
+	commandFactory func(ctx context.Context, exe string, args []string) command
+}
+
+func (p *MPVPlayer) Play(ctx context.Context, uri string, volume int) error {
+	log.CtxDebug(ctx, "MPVPlayer Play: uri=%s volume=%d", uri, volume)
+
+	p.mu.Lock()
+	hasEndpoint := p.sockPath != ""
+	p.mu.Unlock()
+
+	if !hasEndpoint {
+		exe, err := p.find()
+		if err != nil {
+			return fmt.Errorf("mpv not found: %w", err)
+		}
+		if err := p.launch(ctx, exe, volume); err != nil {
+			_ = p.Stop(ctx)
+			return err
+		}
+	} else if val, err := p.getProperty(ctx, "path"); err == nil {
+		if currentPath, ok := val.(string); ok && currentPath == uri {
+			_ = p.SetVolume(ctx, volume)
+			p.rewindIfEnded(ctx)
+			return p.Resume(ctx)
+		}
+	}
+
+	if err := p.sendOK(ctx, []any{"loadfile", uri, "replace"}, "loadfile"); err != nil {
+		return err
+	}
+	_ = p.SetVolume(ctx, volume)
+	// A previous Pause leaves the pause property set across loadfile.
+	return p.Resume(ctx)
 }
 
-type MPVJSONIPCResponse struct {
-	RequestID int    `json:"request_id,omitempty"`
-	Error     string `json:"error"`
+// launch starts an idle mpv and waits for its IPC socket. The media is loaded
+// afterwards over IPC so a fresh and a reused instance follow the same path.
+func (p *MPVPlayer) launch(ctx context.Context, exe string, volume int) error {
+	p.mu.Lock()
+	p.sockPath = mpvSockPathPrefix + uuid.NewString()
+	sockPath := p.sockPath
+	p.mu.Unlock()
+
+	args := []string{
+		"--idle=yes",
+		"--force-window=yes",
+		"--keep-open=yes",
+		"--no-terminal",
+		"--input-ipc-server=" + sockPath,
+		"--volume=" + strconv.Itoa(volume),
+	}
+	if p.fullscreen {
+		args = append(args, "--fs")
+	}
+	if p.audioDevice != "" {
+		args = append(args, "--audio-device="+p.audioDevice)
+	}
+
+	cmd := p.commandFactory(ctx, exe, args)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting mpv process: %w", err)
+	}
+
+	p.mu.Lock()
+	p.conn = nil
+	p.command = cmd
+	p.mu.Unlock()
+	go p.wait(cmd)
+	if err := p.waitForIPC(ctx, sockPath); err != nil {
+		return fmt.Errorf("waiting for mpv IPC: %w", err)
+	}
+	return nil
+}
 
-	Data  any    `json:"data,omitempty"`
-	Event string `json:"event,omitempty"`
-	Name  string `json:"name,omitempty"`
+// findMPV locates the mpv binary on PATH.
+func findMPV() (string, error) {
+	exe, err := exec.LookPath("mpv")
+	if err != nil {
+		return "", fmt.Errorf("mpv not installed: %w", err)
+	}
+	return exe, nil
 }
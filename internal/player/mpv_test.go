@@ -0,0 +1,305 @@
+package player
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestMPVPlayer returns an MPVPlayer whose launch hooks record the command
+// line and dial the fake server instead of spawning mpv.
+func newTestMPVPlayer(t *testing.T, s *fakeMPVServer) (*MPVPlayer, *[]string, *fakeCommand) {
+	t.Helper()
+	p := NewMPVPlayer(true, "coreaudio/BuiltInSpeakerDevice")
+	p.ipcPoll = time.Millisecond
+	p.find = func() (string, error) { return "/usr/bin/mpv", nil }
+	var args []string
+	fc := newFakeCommand()
+	p.commandFactory = func(_ context.Context, exe string, a []string) command {
+		args = append([]string{exe}, a...)
+		return fc
+	}
+	p.dial = func(network, _ string) (net.Conn, error) {
+		return net.Dial(network, s.sockPath)
+	}
+	p.dialEvents = p.dial
+	return p, &args, fc
+}
+
+func TestMPVPlayer_PlayLaunchesIdleMPVAndLoadsOverIPC(t *testing.T) {
+	s := newFakeMPVServer(t)
+	defer s.close()
+	p, args, fc := newTestMPVPlayer(t, s)
+	ctx := context.Background()
+
+	const uri = "https://example.test/video.mp4"
+	if err := p.Play(ctx, uri, 35); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer func() { _ = p.Stop(ctx) }()
+
+	if fc.startedCount() != 1 {
+		t.Fatalf("started=%d, want 1", fc.startedCount())
+	}
+	for _, want := range []string{"/usr/bin/mpv", "--idle=yes", "--keep-open=yes", "--volume=35", "--fs", "--audio-device=coreaudio/BuiltInSpeakerDevice"} {
+		if !slices.Contains(*args, want) {
+			t.Fatalf("launch args %q missing %q", *args, want)
+		}
+	}
+	if !slices.ContainsFunc(*args, func(a string) bool { return len(a) > 19 && a[:19] == "--input-ipc-server=" }) {
+		t.Fatalf("launch args %q missing --input-ipc-server", *args)
+	}
+	s.mu.Lock()
+	path, volume, pause := s.props["path"], s.props["volume"], s.props["pause"]
+	s.mu.Unlock()
+	if path != uri || volume != float64(35) || pause != false {
+		t.Fatalf("props path=%v volume=%v pause=%v", path, volume, pause)
+	}
+}
+
+func TestMPVPlayer_PlayReusesRunningInstance(t *testing.T) {
+	s := newFakeMPVServer(t)
+	defer s.close()
+	p, _, fc := newTestMPVPlayer(t, s)
+	ctx := context.Background()
+
+	if err := p.Play(ctx, "https://example.test/one.mp4", 50); err != nil {
+		t.Fatalf("first Play: %v", err)
+	}
+	defer func() { _ = p.Stop(ctx) }()
+	if err := p.Pause(ctx); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	const next = "https://example.test/two.mp4"
+	if err := p.Play(ctx, next, 50); err != nil {
+		t.Fatalf("second Play: %v", err)
+	}
+	if fc.startedCount() != 1 {
+		t.Fatalf("mpv relaunched: started=%d, want 1", fc.startedCount())
+	}
+	s.mu.Lock()
+	path, pause := s.props["path"], s.props["pause"]
+	s.mu.Unlock()
+	if path != next || pause != false {
+		t.Fatalf("path=%v pause=%v, want %s and unpaused", path, pause, next)
+	}
+}
+
+func TestMPVPlayer_PlayNotFound(t *testing.T) {
+	p := NewMPVPlayer(false, "")
+	p.find = func() (string, error) { return "", errors.New("no mpv") }
+	err := p.Play(context.Background(), "x", 50)
+	if err == nil || !contains(err.Error(), "mpv not found") {
+		t.Fatalf("Play err=%v, want mpv not found", err)
+	}
+}
+
+func TestMPVPlayer_LaunchFailureCleansUp(t *testing.T) {
+	p := NewMPVPlayer(false, "")
+	p.find = func() (string, error) { return "/usr/bin/mpv", nil }
+	fc := newFakeCommand()
+	fc.startErr = errors.New("exec failed")
+	p.commandFactory = func(context.Context, string, []string) command { return fc }
+
+	err := p.Play(context.Background(), "x", 50)
+	if err == nil || !contains(err.Error(), "starting mpv process") {
+		t.Fatalf("Play err=%v, want starting mpv process", err)
+	}
+	p.mu.Lock()
+	sock := p.sockPath
+	p.mu.Unlock()
+	if sock != "" {
+		t.Fatalf("sockPath=%q after failed launch, want empty", sock)
+	}
+}
+
+// Compile-time guard: both backends satisfy the Player interface.
+var (
+	_ Player = (*MPVPlayer)(nil)
+	_ Player = (*IINAPlayer)(nil)
+)
+
+// nextEvent waits for the next non-position event, failing after a second.
+func nextEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-ch:
+			if ev.Type != EventPosition {
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for player event")
+			return Event{}
+		}
+	}
+}
+
+// waitObserved waits until every property has n subscriptions so no change
+// can race the watcher's observe_property commands.
+func waitObserved(t *testing.T, s *fakeMPVServer, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		done := len(s.observers) == len(observedProperties)
+		for _, name := range observedProperties {
+			done = done && len(s.observers[name]) == n
+		}
+		s.mu.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("properties not observed %d times", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMPVPlayer_EventsFollowObservedProperties(t *testing.T) {
+	s := newFakeMPVServer(t)
+	defer s.close()
+	p, _, _ := newTestMPVPlayer(t, s)
+	ctx := context.Background()
+	// Start unpaused so Play's resume changes nothing the watcher could
+	// report before the test's own changes.
+	s.setProp("pause", false)
+
+	if err := p.Play(ctx, "https://example.test/a.mp4", 50); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer func() { _ = p.Stop(ctx) }()
+
+	waitObserved(t, s, 1)
+	s.setProp("pause", true)
+	if ev := nextEvent(t, p.Events()); ev.Type != EventPaused {
+		t.Fatalf("event = %v, want paused", ev.Type)
+	}
+	s.setProp("pause", false)
+	if ev := nextEvent(t, p.Events()); ev.Type != EventResumed {
+		t.Fatalf("event = %v, want resumed", ev.Type)
+	}
+	s.setProp("path", "https://example.test/b.mp4")
+	if ev := nextEvent(t, p.Events()); ev.Type != EventTrackChanged || ev.Path != "https://example.test/b.mp4" {
+		t.Fatalf("event = %+v, want track change to b.mp4", ev)
+	}
+	s.setProp("eof-reached", true)
+	if ev := nextEvent(t, p.Events()); ev.Type != EventEndOfFile {
+		t.Fatalf("event = %v, want end-of-file", ev.Type)
+	}
+	s.setProp("idle-active", true)
+	if ev := nextEvent(t, p.Events()); ev.Type != EventIdle {
+		t.Fatalf("event = %v, want idle", ev.Type)
+	}
+}
+
+func TestEventTranslator(t *testing.T) {
+	var tr eventTranslator
+
+	// Initial values answer the observation itself and describe the state
+	// before any command; they must not surface as events.
+	for _, c := range []struct {
+		name string
+		data any
+	}{{"pause", false}, {"eof-reached", nil}, {"idle-active", true}, {"path", nil}} {
+		if ev, ok := tr.translate(c.name, c.data); ok {
+			t.Fatalf("initial %s produced %+v", c.name, ev)
+		}
+	}
+
+	if _, ok := tr.translate("eof-reached", false); ok {
+		t.Fatal("eof-reached=false produced an event")
+	}
+	if _, ok := tr.translate("idle-active", false); ok {
+		t.Fatal("idle-active=false produced an event")
+	}
+
+	// Positions are throttled to whole-second changes.
+	if ev, ok := tr.translate("time-pos", 1.2); !ok || ev.Position != 1.2 {
+		t.Fatalf("first time-pos = %+v, %v", ev, ok)
+	}
+	if _, ok := tr.translate("time-pos", 1.7); ok {
+		t.Fatal("time-pos within the same second produced an event")
+	}
+	if ev, ok := tr.translate("time-pos", 2.1); !ok || ev.Type != EventPosition {
+		t.Fatalf("time-pos next second = %+v, %v", ev, ok)
+	}
+	if _, ok := tr.translate("time-pos", nil); ok {
+		t.Fatal("unavailable time-pos produced an event")
+	}
+
+	// A known duration is reported even as the initial value.
+	if ev, ok := tr.translate("duration", 93.5); !ok || ev.Type != EventDuration || ev.Duration != 93.5 {
+		t.Fatalf("duration = %+v, %v", ev, ok)
+	}
+	if _, ok := tr.translate("duration", nil); ok {
+		t.Fatal("unavailable duration produced an event")
+	}
+}
+
+func TestMPVPlayer_PlaySameURIRewindsFinishedMedia(t *testing.T) {
+	s := newFakeMPVServer(t)
+	defer s.close()
+	p, _, _ := newTestMPVPlayer(t, s)
+	ctx := context.Background()
+
+	const uri = "https://example.test/a.mp4"
+	if err := p.Play(ctx, uri, 50); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer func() { _ = p.Stop(ctx) }()
+	s.setProp("eof-reached", true)
+	s.setProp("time-pos", 600.0)
+
+	if err := p.Play(ctx, uri, 50); err != nil {
+		t.Fatalf("Play again: %v", err)
+	}
+	s.mu.Lock()
+	seeked := s.seeks
+	s.mu.Unlock()
+	if len(seeked) != 1 || seeked[0] != 0 {
+		t.Fatalf("seeks = %v, want a single rewind to 0", seeked)
+	}
+}
+
+func TestMPVPlayer_EventsSurviveRelaunch(t *testing.T) {
+	s := newFakeMPVServer(t)
+	defer s.close()
+	p, _, fc := newTestMPVPlayer(t, s)
+	ctx := context.Background()
+	s.setProp("pause", false)
+
+	if err := p.Play(ctx, "https://example.test/a.mp4", 50); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	waitObserved(t, s, 1)
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	p.mu.Lock()
+	eventConn := p.eventConn
+	p.mu.Unlock()
+	if eventConn != nil {
+		t.Fatal("event connection still open after Stop")
+	}
+
+	if err := p.Play(ctx, "https://example.test/b.mp4", 50); err != nil {
+		t.Fatalf("Play after Stop: %v", err)
+	}
+	defer func() { _ = p.Stop(ctx) }()
+	if fc.startedCount() != 2 {
+		t.Fatalf("started=%d, want a relaunch", fc.startedCount())
+	}
+	// The relaunched instance subscribes on a connection of its own.
+	waitObserved(t, s, 2)
+
+	s.setProp("pause", true)
+	if ev := nextEvent(t, p.Events()); ev.Type != EventPaused {
+		t.Fatalf("event = %v, want paused", ev.Type)
+	}
+}
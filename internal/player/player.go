@@ -14,6 +14,83 @@ type Player interface {
 	Screenshot(ctx context.Context, path string) error
 	SetSpeed(ctx context.Context, speed float64) error
 	Seek(ctx context.Context, seconds float64) error
+	// SeekPercent moves to percent (0-100) of the current entry, for seeks
+	// that are not expressed in time.
+	SeekPercent(ctx context.Context, percent float64) error
 	GetPosition(ctx context.Context) (float64, error)
 	GetDuration(ctx context.Context) (float64, error)
+	// GetMediaInfo reports what the player learnt about the current entry
+	// once it opened it.
+	GetMediaInfo(ctx context.Context) (MediaInfo, error)
+	// GetFileSize reports the size in bytes of the current entry, when the
+	// player knows it.
+	GetFileSize(ctx context.Context) (int64, error)
+
+	// SetNext preloads uri as the entry that plays once the current one ends,
+	// replacing any previously queued entry. An empty uri clears the queue.
+	SetNext(ctx context.Context, uri string) error
+	// GetPath reports the URI the player is currently playing.
+	GetPath(ctx context.Context) (string, error)
+	// AddSubtitles loads external subtitle tracks for the current entry and
+	// selects the first. The entry must have finished loading.
+	AddSubtitles(ctx context.Context, uris []string) error
+
+	// Events streams what the player does on its own: the user pausing in
+	// its window, a file ending, the playlist advancing. The channel stays
+	// open for the player's lifetime; a nil channel means no events.
+	Events() <-chan Event
+}
+
+// MediaInfo describes the current entry as the player sees it.
+type MediaInfo struct {
+	// Title is mpv's media-title: the file's own title tag, or else its name.
+	Title string
+	// Width and Height are the video size in pixels, 0 for audio.
+	Width, Height int
+}
+
+type EventType int
+
+const (
+	EventPaused EventType = iota + 1
+	EventResumed
+	// EventEndOfFile fires when the last entry finishes and the player holds
+	// its final frame.
+	EventEndOfFile
+	// EventIdle fires when nothing is loaded any more.
+	EventIdle
+	// EventPosition reports playback progress, at most once per second.
+	EventPosition
+	// EventTrackChanged fires when a new entry starts, e.g. after a gapless
+	// advance to the queued next URI.
+	EventTrackChanged
+	// EventDuration reports the length of the entry once the player knows it.
+	EventDuration
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPaused:
+		return "paused"
+	case EventResumed:
+		return "resumed"
+	case EventEndOfFile:
+		return "end-of-file"
+	case EventIdle:
+		return "idle"
+	case EventPosition:
+		return "position"
+	case EventTrackChanged:
+		return "track-changed"
+	case EventDuration:
+		return "duration"
+	}
+	return "unknown"
+}
+
+type Event struct {
+	Type     EventType
+	Position float64 // seconds, for EventPosition
+	Duration float64 // seconds, for EventDuration
+	Path     string  // for EventTrackChanged
 }
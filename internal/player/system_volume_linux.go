@@ -0,0 +1,66 @@
+//go:build linux
+
+package player
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// runAudio executes one mixer command. It is a package-level variable so tests
+// can inject a recorder that captures the command line and controls the
+// returned error without touching real audio hardware.
+var runAudio = func(name string, args ...string) error {
+	return exec.Command(name, args...).Run()
+}
+
+// mixerCommand is one way of applying a setting; the first mixer that is
+// installed and succeeds wins.
+type mixerCommand struct {
+	name string
+	args []string
+}
+
+func SetSystemOutputVolume(v int) error {
+	pct := strconv.Itoa(v) + "%"
+	return runMixer([]mixerCommand{
+		{"pactl", []string{"set-sink-volume", "@DEFAULT_SINK@", pct}},
+		{"wpctl", []string{"set-volume", "@DEFAULT_AUDIO_SINK@", pct}},
+		{"amixer", []string{"-q", "sset", "Master", pct}},
+	})
+}
+
+func SetSystemMute(m bool) error {
+	flag, alsa := "0", "unmute"
+	if m {
+		flag, alsa = "1", "mute"
+	}
+	return runMixer([]mixerCommand{
+		{"pactl", []string{"set-sink-mute", "@DEFAULT_SINK@", flag}},
+		{"wpctl", []string{"set-mute", "@DEFAULT_AUDIO_SINK@", flag}},
+		{"amixer", []string{"-q", "sset", "Master", alsa}},
+	})
+}
+
+// runMixer tries PulseAudio (also served by pipewire-pulse), then native
+// PipeWire, then ALSA. Missing binaries are skipped silently; a failing one
+// falls through to the next so a half-configured desktop still works.
+func runMixer(cmds []mixerCommand) error {
+	var lastErr error
+	for _, c := range cmds {
+		err := runAudio(c.name, c.args...)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			continue
+		}
+		lastErr = fmt.Errorf("%s: %w", c.name, err)
+	}
+	if lastErr == nil {
+		return fmt.Errorf("no audio mixer found (looked for pactl, wpctl and amixer)")
+	}
+	return lastErr
+}
@@ -0,0 +1,130 @@
+//go:build linux
+
+package player
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// swapAudio replaces the package-level runAudio for the duration of the test
+// and restores the real runner on cleanup. Tests MUST call this so no real
+// mixer is ever executed.
+func swapAudio(t *testing.T, fn func(string, ...string) error) {
+	t.Helper()
+	orig := runAudio
+	runAudio = fn
+	t.Cleanup(func() { runAudio = orig })
+}
+
+// mixerRecorder returns a runner that records every command line and answers
+// with errs[name] (nil when absent).
+func mixerRecorder(errs map[string]error) (func(string, ...string) error, *[]string) {
+	var got []string
+	return func(name string, args ...string) error {
+		got = append(got, strings.Join(append([]string{name}, args...), " "))
+		return errs[name]
+	}, &got
+}
+
+func TestSetSystemOutputVolume_PrefersPactl(t *testing.T) {
+	run, got := mixerRecorder(nil)
+	swapAudio(t, run)
+
+	if err := SetSystemOutputVolume(40); err != nil {
+		t.Fatalf("SetSystemOutputVolume(40) returned unexpected error: %v", err)
+	}
+	want := []string{"pactl set-sink-volume @DEFAULT_SINK@ 40%"}
+	if strings.Join(*got, "|") != strings.Join(want, "|") {
+		t.Fatalf("commands = %q, want %q", *got, want)
+	}
+}
+
+func TestSetSystemOutputVolume_FallsBackToWpctlAndAmixer(t *testing.T) {
+	t.Run("wpctl", func(t *testing.T) {
+		run, got := mixerRecorder(map[string]error{"pactl": exec.ErrNotFound})
+		swapAudio(t, run)
+
+		if err := SetSystemOutputVolume(70); err != nil {
+			t.Fatalf("SetSystemOutputVolume(70) returned unexpected error: %v", err)
+		}
+		if last := (*got)[len(*got)-1]; last != "wpctl set-volume @DEFAULT_AUDIO_SINK@ 70%" {
+			t.Fatalf("last command = %q", last)
+		}
+	})
+
+	t.Run("amixer", func(t *testing.T) {
+		run, got := mixerRecorder(map[string]error{
+			"pactl": errors.New("connection refused"),
+			"wpctl": exec.ErrNotFound,
+		})
+		swapAudio(t, run)
+
+		if err := SetSystemOutputVolume(0); err != nil {
+			t.Fatalf("SetSystemOutputVolume(0) returned unexpected error: %v", err)
+		}
+		if len(*got) != 3 || (*got)[2] != "amixer -q sset Master 0%" {
+			t.Fatalf("commands = %q, want amixer as third attempt", *got)
+		}
+	})
+}
+
+func TestSetSystemMute_CommandConstruction(t *testing.T) {
+	cases := []struct {
+		name  string
+		mute  bool
+		errs  map[string]error
+		wantC string
+	}{
+		{"pactl mute", true, nil, "pactl set-sink-mute @DEFAULT_SINK@ 1"},
+		{"pactl unmute", false, nil, "pactl set-sink-mute @DEFAULT_SINK@ 0"},
+		{"wpctl mute", true, map[string]error{"pactl": exec.ErrNotFound}, "wpctl set-mute @DEFAULT_AUDIO_SINK@ 1"},
+		{"amixer unmute", false, map[string]error{"pactl": exec.ErrNotFound, "wpctl": exec.ErrNotFound}, "amixer -q sset Master unmute"},
+		{"amixer mute", true, map[string]error{"pactl": exec.ErrNotFound, "wpctl": exec.ErrNotFound}, "amixer -q sset Master mute"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			run, got := mixerRecorder(tc.errs)
+			swapAudio(t, run)
+
+			if err := SetSystemMute(tc.mute); err != nil {
+				t.Fatalf("SetSystemMute(%v) returned unexpected error: %v", tc.mute, err)
+			}
+			if last := (*got)[len(*got)-1]; last != tc.wantC {
+				t.Fatalf("last command = %q, want %q", last, tc.wantC)
+			}
+		})
+	}
+}
+
+func TestSetSystemOutputVolume_ErrorPropagation(t *testing.T) {
+	t.Run("no mixer installed", func(t *testing.T) {
+		run, _ := mixerRecorder(map[string]error{
+			"pactl":  exec.ErrNotFound,
+			"wpctl":  exec.ErrNotFound,
+			"amixer": exec.ErrNotFound,
+		})
+		swapAudio(t, run)
+
+		err := SetSystemOutputVolume(50)
+		if err == nil || !strings.Contains(err.Error(), "no audio mixer found") {
+			t.Fatalf("SetSystemOutputVolume error = %v, want no audio mixer found", err)
+		}
+	})
+
+	t.Run("every mixer fails", func(t *testing.T) {
+		sentinel := errors.New("amixer boom")
+		run, _ := mixerRecorder(map[string]error{
+			"pactl":  errors.New("pactl boom"),
+			"wpctl":  errors.New("wpctl boom"),
+			"amixer": sentinel,
+		})
+		swapAudio(t, run)
+
+		if err := SetSystemOutputVolume(50); !errors.Is(err, sentinel) {
+			t.Fatalf("SetSystemOutputVolume error = %v, want %v", err, sentinel)
+		}
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !linux
+
+package player
+
+// System volume linkage has no implementation on this platform; the setting
+// only affects the player.
+
+func SetSystemOutputVolume(int) error { return nil }
+
+func SetSystemMute(bool) error { return nil }
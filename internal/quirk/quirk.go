@@ -0,0 +1,194 @@
+package quirk
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/tr1v3r/pkg/log"
+)
+
+// Profile describes the workarounds for one family of control points. A
+// request matches when its User-Agent starts with UserAgentPrefix and
+// contains every UserAgent substring, and every Headers entry names a header
+// containing that value; all comparisons ignore case, and an empty header
+// value only requires the header to be set.
+type Profile struct {
+	Name            string            `json:"name"`
+	UserAgentPrefix string            `json:"user_agent_prefix,omitempty"`
+	UserAgent       []string          `json:"user_agent,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+
+	// VolumeScale expands a controller whose volume steps cover only part of
+	// the 0-100 range; 0 means 1.
+	VolumeScale float64 `json:"volume_scale,omitempty"`
+	// StripMetadata drops CurrentURIMetaData/NextURIMetaData the controller
+	// sends, for apps whose DIDL-Lite trips up the player or other
+	// controllers.
+	StripMetadata bool `json:"strip_metadata,omitempty"`
+	// SeekUnit reinterprets every Seek target in this unit, whatever Unit
+	// the controller claims. Seek validates it, as only it knows the units
+	// it implements.
+	SeekUnit string `json:"seek_unit,omitempty"`
+	// FakePosition answers GetPositionInfo with the last known position and
+	// duration while the player is loading or unreachable, instead of zeros
+	// that some apps take as the end of playback.
+	FakePosition bool `json:"fake_position,omitempty"`
+	// Preempt overrides the configured preemption policy for this
+	// controller when set.
+	Preempt *bool `json:"preempt,omitempty"`
+}
+
+// Matches reports whether r comes from a controller this profile describes.
+func (p *Profile) Matches(r *http.Request) bool {
+	ua := strings.ToLower(r.UserAgent())
+	if !strings.HasPrefix(ua, strings.ToLower(p.UserAgentPrefix)) {
+		return false
+	}
+	for _, want := range p.UserAgent {
+		if !strings.Contains(ua, strings.ToLower(want)) {
+			return false
+		}
+	}
+	for name, want := range p.Headers {
+		values, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return false
+		}
+		if !strings.Contains(strings.ToLower(strings.Join(values, ",")), strings.ToLower(want)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate reports a profile that could never match or asks for something
+// the renderer cannot do.
+func (p *Profile) Validate() error {
+	var problems []string
+	if p.Name == "" {
+		problems = append(problems, "name is empty")
+	}
+	if p.UserAgentPrefix == "" && len(p.UserAgent) == 0 && len(p.Headers) == 0 {
+		problems = append(problems, "needs a user_agent_prefix, user_agent or headers condition")
+	}
+	if p.VolumeScale < 0 {
+		problems = append(problems, fmt.Sprintf("volume_scale %g is negative", p.VolumeScale))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// The accessors below are safe on a nil *Profile, which stands for a
+// controller without quirks.
+
+func (p *Profile) Scale() float64 {
+	if p == nil || p.VolumeScale == 0 {
+		return 1
+	}
+	return p.VolumeScale
+}
+
+func (p *Profile) StripsMetadata() bool { return p != nil && p.StripMetadata }
+
+func (p *Profile) FakesPosition() bool { return p != nil && p.FakePosition }
+
+// ForcedSeekUnit returns the unit to use instead of unit.
+func (p *Profile) ForcedSeekUnit(unit string) string {
+	if p == nil || p.SeekUnit == "" {
+		return unit
+	}
+	return p.SeekUnit
+}
+
+// AllowPreempt applies the profile's preemption preference to the
+// configured policy.
+func (p *Profile) AllowPreempt(configured bool) bool {
+	if p == nil || p.Preempt == nil {
+		return configured
+	}
+	return *p.Preempt
+}
+
+func (p *Profile) String() string {
+	if p == nil {
+		return "none"
+	}
+	return p.Name
+}
+
+// Registry picks the profile for each request: configured profiles first, in
+// order, then the built-in ones. A configured profile named like a built-in
+// one replaces it.
+type Registry struct {
+	profiles []Profile
+
+	mu   sync.Mutex
+	seen map[string]string // controller → last matched profile, to log changes once
+}
+
+func NewRegistry(custom []Profile) *Registry {
+	profiles := append([]Profile(nil), custom...)
+	for _, b := range Builtin() {
+		if !hasProfile(custom, b.Name) {
+			profiles = append(profiles, b)
+		}
+	}
+	return &Registry{profiles: profiles, seen: make(map[string]string)}
+}
+
+func hasProfile(profiles []Profile, name string) bool {
+	for _, p := range profiles {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the first profile matching r, or nil. Every match is logged
+// at debug level, and at info level the first time a controller matches a
+// given profile.
+func (reg *Registry) Match(r *http.Request, controller string) *Profile {
+	var matched *Profile
+	for i := range reg.profiles {
+		if reg.profiles[i].Matches(r) {
+			matched = &reg.profiles[i]
+			break
+		}
+	}
+
+	name := matched.String()
+	log.Debug("controller %s matched quirk profile %s", controller, name)
+	reg.mu.Lock()
+	changed := reg.seen[controller] != name
+	if changed {
+		reg.seen[controller] = name
+	}
+	reg.mu.Unlock()
+	if changed && matched != nil {
+		log.Info("controller %s uses quirk profile %s (user agent %q)", controller, name, r.UserAgent())
+	}
+	return matched
+}
+
+// Builtin returns the shipped profiles. Only quirks confirmed against an
+// app's own user agent token are built in; everything else, including
+// generic Android or iOS clients, is left to configured profiles.
+func Builtin() []Profile {
+	return []Profile{
+		{
+			// Aweme on iOS exposes eight system volume steps but changes the
+			// UPnP value by five points per step. 100 / (8 * 5) expands that
+			// 40-point logical range to the player's full 0-100 range.
+			Name:            "aweme-ios",
+			UserAgentPrefix: "aweme/",
+			UserAgent:       []string{"cfnetwork/", "darwin/"},
+			VolumeScale:     2.5,
+		},
+	}
+}
@@ -0,0 +1,120 @@
+package quirk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newRequest(userAgent string, headers ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/upnp/control/avtransport", nil)
+	r.Header.Set("User-Agent", userAgent)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Add(headers[i], headers[i+1])
+	}
+	return r
+}
+
+func TestBuiltinProfiles(t *testing.T) {
+	reg := NewRegistry(nil)
+	cases := []struct {
+		userAgent string
+		want      string
+	}{
+		{"Aweme/390012 CFNetwork/3860.300.31 Darwin/25.2.0", "aweme-ios"},
+		{"aweme/1 cfnetwork/1 darwin/1", "aweme-ios"},
+		{"Aweme/390012 okhttp/4.9", "none"},
+		{"Lite Aweme/1 CFNetwork/1 Darwin/1", "none"},
+		// Other controllers on the same platforms get no quirks.
+		{"Bilibili Freedoooooom/MarkII", "none"},
+		{"QQLive/8.9 (iPhone; iOS 17.0)", "none"},
+		{"Dalvik/2.1.0 (Linux; U; Android 14; Pixel 8)", "none"},
+		{"BubbleUPnP/3.7 (Android 14)", "none"},
+		{"Mozilla/5.0 (Macintosh)", "none"},
+		{"", "none"},
+	}
+	for _, c := range cases {
+		if got := reg.Match(newRequest(c.userAgent), "10.0.0.1").String(); got != c.want {
+			t.Errorf("Match(%q) = %s, want %s", c.userAgent, got, c.want)
+		}
+	}
+}
+
+func TestBuiltinProfilesAreValid(t *testing.T) {
+	for _, p := range Builtin() {
+		if err := p.Validate(); err != nil {
+			t.Errorf("builtin %s: %v", p.Name, err)
+		}
+	}
+}
+
+func TestHeaderConditions(t *testing.T) {
+	p := Profile{Name: "hdr", Headers: map[string]string{"x-app": "tv", "x-dlna": ""}}
+	if !p.Matches(newRequest("", "X-App", "SmartTV/1", "X-DLNA", "1")) {
+		t.Fatal("profile should match a request with both headers")
+	}
+	if p.Matches(newRequest("", "X-App", "SmartTV/1")) {
+		t.Fatal("profile matched without the presence-only header")
+	}
+	if p.Matches(newRequest("", "X-App", "phone", "X-DLNA", "1")) {
+		t.Fatal("profile matched a header without the wanted value")
+	}
+}
+
+func TestConfiguredProfilesComeFirstAndReplaceBuiltins(t *testing.T) {
+	yes := true
+	reg := NewRegistry([]Profile{
+		{Name: "aweme-ios", UserAgent: []string{"aweme/"}, VolumeScale: 4},
+		{Name: "living-room-tv", Headers: map[string]string{"X-Remote": "den"}, Preempt: &yes},
+	})
+
+	p := reg.Match(newRequest("Aweme/1 CFNetwork/1 Darwin/1"), "10.0.0.1")
+	if p.String() != "aweme-ios" || p.Scale() != 4 {
+		t.Fatalf("Match = %s scale %v, want configured aweme-ios with scale 4", p, p.Scale())
+	}
+	// Configured profiles win over built-ins matching the same request.
+	p = reg.Match(newRequest("Dalvik/2.1.0 (Linux; U; Android 14)", "X-Remote", "den"), "10.0.0.2")
+	if p.String() != "living-room-tv" || !p.AllowPreempt(false) {
+		t.Fatalf("Match = %s, want living-room-tv preferring preemption", p)
+	}
+	count := 0
+	for _, p := range reg.profiles {
+		if p.Name == "aweme-ios" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Fatalf("aweme-ios profiles = %d, want the built-in replaced", count)
+	}
+}
+
+func TestNilProfileAccessors(t *testing.T) {
+	var p *Profile
+	if p.Scale() != 1 || p.StripsMetadata() || p.FakesPosition() ||
+		p.ForcedSeekUnit("ABS_TIME") != "ABS_TIME" || !p.AllowPreempt(true) || p.AllowPreempt(false) {
+		t.Fatal("nil profile must not change behavior")
+	}
+	no := false
+	q := &Profile{SeekUnit: "REL_TIME", Preempt: &no, StripMetadata: true, FakePosition: true}
+	if q.ForcedSeekUnit("ABS_TIME") != "REL_TIME" || q.AllowPreempt(true) || !q.StripsMetadata() || !q.FakesPosition() {
+		t.Fatal("profile settings not applied")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		p    Profile
+		want string
+	}{
+		{Profile{UserAgent: []string{"x"}}, "name is empty"},
+		{Profile{Name: "x"}, "needs a user_agent_prefix, user_agent or headers condition"},
+		{Profile{Name: "x", UserAgent: []string{"x"}, VolumeScale: -1}, "volume_scale -1 is negative"},
+	}
+	for _, c := range cases {
+		err := c.p.Validate()
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Validate(%+v) = %v, want %q", c.p, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Rules name what decided a session request, for logs and metrics.
+const (
+	RuleDeny        = "deny"
+	RuleAllowlist   = "allowlist"
+	RuleFree        = "free"
+	RuleOwner       = "owner"
+	RuleTrusted     = "trusted"
+	RuleLowPriority = "low_priority"
+	RuleGrace       = "grace"
+	RulePreempt     = "preempt"
+	RuleNoPreempt   = "no_preempt"
+)
+
+// Policy decides which controllers may take the session. Every list but
+// TrustedUserAgents holds IPv4/IPv6 addresses or CIDR prefixes matched
+// against the controller's address.
+//
+//   - Deny always rejects; a non-empty Allow rejects everyone it leaves out.
+//   - Trusted controllers may always preempt the current owner, as may
+//     controllers named by a TrustedUserAgents entry: a User-Agent
+//     substring, compared ignoring case, for apps on changing addresses.
+//     Any client can send any User-Agent, so the name is not a credential.
+//   - LowPriority controllers never preempt, whatever else applies.
+//   - Others preempt when preemption is enabled and the owner has been idle
+//     for at least GraceSeconds.
+type Policy struct {
+	Allow             []string `json:"allow,omitempty"`
+	Deny              []string `json:"deny,omitempty"`
+	Trusted           []string `json:"trusted,omitempty"`
+	TrustedUserAgents []string `json:"trusted_user_agents,omitempty"`
+	LowPriority       []string `json:"low_priority,omitempty"`
+	GraceSeconds      int      `json:"preempt_grace_seconds,omitempty"`
+}
+
+// Grace is how long an owner keeps the session after its last action before
+// an ordinary controller may preempt it.
+func (p Policy) Grace() time.Duration {
+	return time.Duration(p.GraceSeconds) * time.Second
+}
+
+// Admit reports whether controller may hold a session at all, and the rule
+// that decided it.
+func (p Policy) Admit(controller string) (bool, string) {
+	if matchAny(p.Deny, controller) {
+		return false, RuleDeny
+	}
+	if len(p.Allow) > 0 && !matchAny(p.Allow, controller) {
+		return false, RuleAllowlist
+	}
+	return true, ""
+}
+
+// Preempt reports whether controller, sending userAgent, may take the
+// session from an owner that last acted idle ago, and the rule that decided
+// it. allowPreempt is the general preemption setting after any quirk
+// override.
+func (p Policy) Preempt(controller, userAgent string, idle time.Duration, allowPreempt bool) (bool, string) {
+	switch {
+	case matchAny(p.Trusted, controller), matchUserAgent(p.TrustedUserAgents, userAgent):
+		return true, RuleTrusted
+	case matchAny(p.LowPriority, controller):
+		return false, RuleLowPriority
+	case !allowPreempt:
+		return false, RuleNoPreempt
+	case idle < p.Grace():
+		return false, RuleGrace
+	}
+	return true, RulePreempt
+}
+
+// Validate reports entries that are neither an address nor a CIDR prefix,
+// and empty user agent names, which would trust everyone.
+func (p Policy) Validate() error {
+	var problems []string
+	for _, list := range []struct {
+		key     string
+		entries []string
+	}{
+		{"allow", p.Allow},
+		{"deny", p.Deny},
+		{"trusted", p.Trusted},
+		{"low_priority", p.LowPriority},
+	} {
+		for _, entry := range list.entries {
+			if _, err := parsePrefix(entry); err != nil {
+				problems = append(problems, fmt.Sprintf("%s entry %q is not an IP address or CIDR", list.key, entry))
+			}
+		}
+	}
+	for _, name := range p.TrustedUserAgents {
+		if strings.TrimSpace(name) == "" {
+			problems = append(problems, "trusted_user_agents entry is empty")
+		}
+	}
+	if p.GraceSeconds < 0 {
+		problems = append(problems, fmt.Sprintf("preempt_grace_seconds %d is negative", p.GraceSeconds))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// matchAny reports whether the controller address falls in any entry.
+// Controllers identified by something other than an address never match.
+func matchAny(entries []string, controller string) bool {
+	if len(entries) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(controller)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, entry := range entries {
+		prefix, err := parsePrefix(entry)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchUserAgent reports whether userAgent contains any of names, ignoring
+// case.
+func matchUserAgent(names []string, userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" && strings.Contains(userAgent, strings.ToLower(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefix accepts a CIDR prefix or a bare address, which matches only
+// itself.
+func parsePrefix(entry string) (netip.Prefix, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdmit(t *testing.T) {
+	p := Policy{
+		Allow: []string{"192.168.1.0/24", "fd00::/8"},
+		Deny:  []string{"192.168.1.66"},
+	}
+	tests := []struct {
+		controller string
+		want       bool
+		rule       string
+	}{
+		{"192.168.1.20", true, ""},
+		{"fd00::1", true, ""},
+		{"192.168.1.66", false, RuleDeny},
+		{"10.0.0.5", false, RuleAllowlist},
+		{"::ffff:192.168.1.20", true, ""},
+		{"not-an-address", false, RuleAllowlist},
+	}
+	for _, tt := range tests {
+		ok, rule := p.Admit(tt.controller)
+		if ok != tt.want || rule != tt.rule {
+			t.Errorf("Admit(%q) = %v, %q; want %v, %q", tt.controller, ok, rule, tt.want, tt.rule)
+		}
+	}
+	if ok, _ := (Policy{}).Admit("10.0.0.5"); !ok {
+		t.Fatal("empty policy rejected a controller")
+	}
+}
+
+func TestPreempt(t *testing.T) {
+	p := Policy{
+		Trusted:           []string{"10.0.0.1"},
+		TrustedUserAgents: []string{"BubbleUPnP/"},
+		LowPriority:       []string{"10.0.1.0/24"},
+		GraceSeconds:      30,
+	}
+	tests := []struct {
+		name       string
+		controller string
+		userAgent  string
+		idle       time.Duration
+		allow      bool
+		want       bool
+		rule       string
+	}{
+		{"trusted ignores setting and grace", "10.0.0.1", "", 0, false, true, RuleTrusted},
+		{"trusted by name", "10.0.2.1", "bubbleupnp/3.7 (Android 14)", 0, false, true, RuleTrusted},
+		{"low priority never preempts", "10.0.1.7", "", time.Hour, true, false, RuleLowPriority},
+		{"disabled", "10.0.2.1", "Aweme/1", time.Hour, false, false, RuleNoPreempt},
+		{"owner within grace", "10.0.2.1", "", 10 * time.Second, true, false, RuleGrace},
+		{"owner past grace", "10.0.2.1", "", 30 * time.Second, true, true, RulePreempt},
+	}
+	for _, tt := range tests {
+		ok, rule := p.Preempt(tt.controller, tt.userAgent, tt.idle, tt.allow)
+		if ok != tt.want || rule != tt.rule {
+			t.Errorf("%s: Preempt = %v, %q; want %v, %q", tt.name, ok, rule, tt.want, tt.rule)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Policy{Allow: []string{"10.0.0.0/8", "::1"}, Trusted: []string{" 10.0.0.1 "}}).Validate(); err != nil {
+		t.Fatalf("valid policy: %v", err)
+	}
+	err := Policy{Deny: []string{"10.0.0.300"}, LowPriority: []string{"phone"}, TrustedUserAgents: []string{" "}, GraceSeconds: -1}.Validate()
+	if err == nil {
+		t.Fatal("invalid policy accepted")
+	}
+	for _, want := range []string{`deny entry "10.0.0.300"`, `low_priority entry "phone"`, "trusted_user_agents entry is empty", "preempt_grace_seconds -1 is negative"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/tr1v3r/pkg/log"
 
+	"github.com/tr1v3r/rcast/internal/dial"
 	"github.com/tr1v3r/rcast/internal/upnp"
 )
 
@@ -52,28 +53,42 @@ var (
 	onDroppedSearch = func() {}
 )
 
+// ConfigSource supplies CONFIGID.UPNP.ORG and signals when the device
+// description changes; *state.PlayerState implements it.
+type ConfigSource interface {
+	ConfigID() int
+	WatchConfig() (<-chan struct{}, func())
+}
+
 // aliveTarget is one of the device's ST/USN pairs sent in Announce loops.
 type aliveTarget struct{ st, usn string }
 
-// aliveTargets returns the six Announce entries in the existing order
-// (DeviceType, AVTransport, Rendering, ConnectionManager, rootdevice, uuid).
-// The order differs from responseTargets and must not be reused.
+// aliveTargets returns the Announce entries in the existing order
+// (DeviceType, AVTransport, Rendering, ConnectionManager, the OpenHome
+// services, DIAL, rootdevice, uuid). The order differs from responseTargets and
+// must not be reused.
 func aliveTargets(deviceUUID string) []aliveTarget {
-	return []aliveTarget{
+	targets := []aliveTarget{
 		{upnp.DeviceType, deviceUUID + "::" + upnp.DeviceType},
 		{upnp.AVTransportType, deviceUUID + "::" + upnp.AVTransportType},
 		{upnp.RenderingType, deviceUUID + "::" + upnp.RenderingType},
 		{upnp.ConnectionManagerType, deviceUUID + "::" + upnp.ConnectionManagerType},
-		{"upnp:rootdevice", deviceUUID + "::upnp:rootdevice"},
-		{deviceUUID, deviceUUID},
 	}
+	for _, service := range upnp.OpenHomeTypes {
+		targets = append(targets, aliveTarget{service, deviceUUID + "::" + service})
+	}
+	return append(targets,
+		aliveTarget{dial.ServiceType, deviceUUID + "::" + dial.ServiceType},
+		aliveTarget{"upnp:rootdevice", deviceUUID + "::upnp:rootdevice"},
+		aliveTarget{deviceUUID, deviceUUID},
+	)
 }
 
 // buildAliveMessage formats an ssdp:alive NOTIFY (verbatim).
-func buildAliveMessage(ssdpAddr, baseURL, serverName, st, usn string) string {
+func buildAliveMessage(ssdpAddr, baseURL, serverName, st, usn string, configID int) string {
 	return fmt.Sprintf(
-		"NOTIFY * HTTP/1.1\r\nHOST: %s\r\nCACHE-CONTROL: max-age=1800\r\nLOCATION: %s/device.xml\r\nNT: %s\r\nNTS: ssdp:alive\r\nSERVER: %s\r\nUSN: %s\r\nBOOTID.UPNP.ORG: 1\r\nCONFIGID.UPNP.ORG: 1\r\n\r\n",
-		ssdpAddr, baseURL, st, serverName, usn)
+		"NOTIFY * HTTP/1.1\r\nHOST: %s\r\nCACHE-CONTROL: max-age=1800\r\nLOCATION: %s/device.xml\r\nNT: %s\r\nNTS: ssdp:alive\r\nSERVER: %s\r\nUSN: %s\r\nBOOTID.UPNP.ORG: 1\r\nCONFIGID.UPNP.ORG: %d\r\n\r\n",
+		ssdpAddr, baseURL, st, serverName, usn, configID)
 }
 
 // buildByebyeMessage formats an ssdp:byebye NOTIFY (verbatim).
@@ -85,10 +100,10 @@ func buildByebyeMessage(ssdpAddr, st, usn string) string {
 
 // buildSearchResponse formats a 200 OK M-SEARCH response (verbatim), using now
 // formatted as RFC1123 GMT for the DATE header.
-func buildSearchResponse(baseURL, serverName string, target responseTarget, now time.Time) string {
+func buildSearchResponse(baseURL, serverName string, target responseTarget, now time.Time, configID int) string {
 	return fmt.Sprintf(
-		"HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\nDATE: %s\r\nEXT:\r\nLOCATION: %s/device.xml\r\nSERVER: %s\r\nST: %s\r\nUSN: %s\r\nBOOTID.UPNP.ORG: 1\r\nCONFIGID.UPNP.ORG: 1\r\n\r\n",
-		now.Format(http.TimeFormat), baseURL, serverName, target.st, target.usn)
+		"HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\nDATE: %s\r\nEXT:\r\nLOCATION: %s/device.xml\r\nSERVER: %s\r\nST: %s\r\nUSN: %s\r\nBOOTID.UPNP.ORG: 1\r\nCONFIGID.UPNP.ORG: %d\r\n\r\n",
+		now.Format(http.TimeFormat), baseURL, serverName, target.st, target.usn, configID)
 }
 
 // parseMSearch validates an M-SEARCH packet and extracts the ST and clamped MX.
@@ -104,10 +119,7 @@ func parseMSearch(raw, deviceUUID string) (st string, mx int, ok bool) {
 	if st == "" {
 		return "", 0, false
 	}
-	valid := st == "ssdp:all" || st == "upnp:rootdevice" || st == upnp.DeviceType ||
-		st == upnp.AVTransportType || st == upnp.RenderingType ||
-		st == upnp.ConnectionManagerType || st == deviceUUID
-	if !valid {
+	if len(responseTargets(st, deviceUUID)) == 0 {
 		return "", 0, false
 	}
 	mx = 1
@@ -117,7 +129,9 @@ func parseMSearch(raw, deviceUUID string) (st string, mx int, ok bool) {
 	return st, mx, true
 }
 
-func Announce(ctx context.Context, baseURL, deviceUUID, serverName string) {
+// Announce multicasts ssdp:alive every announceInterval, and at once when
+// the description changes so control points refresh their cached copy.
+func Announce(ctx context.Context, baseURL, deviceUUID, serverName string, config ConfigSource) {
 	conn, err := dialAnnounce(advertisedLocalAddr(baseURL))
 	if err != nil {
 		log.CtxError(ctx, "SSDP announce socket: %v", err)
@@ -126,13 +140,16 @@ func Announce(ctx context.Context, baseURL, deviceUUID, serverName string) {
 	defer func() { _ = conn.Close() }()
 
 	usns := aliveTargets(deviceUUID)
+	changes, stopWatch := config.WatchConfig()
+	defer stopWatch()
 
 	ticker := time.NewTicker(announceInterval)
 	defer ticker.Stop()
 
 	for {
+		configID := config.ConfigID()
 		for _, x := range usns {
-			msg := buildAliveMessage(ssdpAddr, baseURL, serverName, x.st, x.usn)
+			msg := buildAliveMessage(ssdpAddr, baseURL, serverName, x.st, x.usn, configID)
 			if _, err := conn.Write([]byte(msg)); err != nil {
 				// Log write errors but continue with other announcements
 				continue
@@ -149,6 +166,8 @@ func Announce(ctx context.Context, baseURL, deviceUUID, serverName string) {
 			}
 			return
 		case <-ticker.C:
+		case <-changes:
+			log.CtxInfo(ctx, "SSDP re-announcing with CONFIGID %d", config.ConfigID())
 		}
 	}
 }
@@ -165,7 +184,7 @@ func advertisedLocalAddr(baseURL string) *net.UDPAddr {
 	return &net.UDPAddr{IP: ip.To4()}
 }
 
-func SearchResponder(ctx context.Context, baseURL, deviceUUID, serverName string) {
+func SearchResponder(ctx context.Context, baseURL, deviceUUID, serverName string, config ConfigSource) {
 	conn, err := listenMulticast()
 	if err != nil {
 		log.CtxError(ctx, "listen SSDP multicast: %v", err)
@@ -210,7 +229,7 @@ func SearchResponder(ctx context.Context, baseURL, deviceUUID, serverName string
 				case <-timer.C:
 				}
 				for _, target := range responseTargets(st, deviceUUID) {
-					resp := buildSearchResponse(baseURL, serverName, target, time.Now().UTC())
+					resp := buildSearchResponse(baseURL, serverName, target, time.Now().UTC(), config.ConfigID())
 					if _, err := conn.WriteToUDP([]byte(resp), &srcCopy); err != nil && ctx.Err() == nil {
 						log.CtxWarn(ctx, "write SSDP response: %v", err)
 					}
@@ -237,6 +256,10 @@ func responseTargets(requested, deviceUUID string) []responseTarget {
 		{upnp.RenderingType, deviceUUID + "::" + upnp.RenderingType},
 		{upnp.ConnectionManagerType, deviceUUID + "::" + upnp.ConnectionManagerType},
 	}
+	for _, service := range upnp.OpenHomeTypes {
+		all = append(all, responseTarget{service, deviceUUID + "::" + service})
+	}
+	all = append(all, responseTarget{dial.ServiceType, deviceUUID + "::" + dial.ServiceType})
 	if requested == "ssdp:all" {
 		return all
 	}
@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tr1v3r/rcast/internal/dial"
 	"github.com/tr1v3r/rcast/internal/upnp"
 )
 
@@ -19,13 +20,16 @@ import (
 func TestResponseTargets(t *testing.T) {
 	const id = "uuid:test"
 	all := responseTargets("ssdp:all", id)
-	if len(all) != 6 {
-		t.Fatalf("ssdp:all targets = %d, want 6", len(all))
+	if len(all) != 12 {
+		t.Fatalf("ssdp:all targets = %d, want 12", len(all))
 	}
 	cm := responseTargets(upnp.ConnectionManagerType, id)
 	if len(cm) != 1 || cm[0].usn != id+"::"+upnp.ConnectionManagerType {
 		t.Fatalf("connection manager response = %#v", cm)
 	}
+	if pl := responseTargets(upnp.PlaylistType, id); len(pl) != 1 || pl[0].usn != id+"::"+upnp.PlaylistType {
+		t.Fatalf("playlist response = %#v", pl)
+	}
 	if got := responseTargets("urn:unsupported", id); got != nil {
 		t.Fatalf("unsupported target = %#v, want nil", got)
 	}
@@ -109,6 +113,32 @@ func (f *fakeUDPConn) SetReadBuffer(int) error { return nil }
 
 func (f *fakeUDPConn) Close() error { return nil }
 
+// fakeConfig is a ConfigSource whose CONFIGID tests bump by hand.
+type fakeConfig struct {
+	mu      sync.Mutex
+	id      int
+	changes chan struct{}
+}
+
+func newFakeConfig() *fakeConfig {
+	return &fakeConfig{id: 1, changes: make(chan struct{}, 1)}
+}
+
+func (c *fakeConfig) ConfigID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id
+}
+
+func (c *fakeConfig) WatchConfig() (<-chan struct{}, func()) { return c.changes, func() {} }
+
+func (c *fakeConfig) bump() {
+	c.mu.Lock()
+	c.id++
+	c.mu.Unlock()
+	c.changes <- struct{}{}
+}
+
 // snapshot returns copies safe for assertions.
 func (f *fakeUDPConn) snapshot() (writes []string, toUDP []udpWrite) {
 	f.mu.Lock()
@@ -163,6 +193,12 @@ func TestAliveTargets(t *testing.T) {
 		{upnp.AVTransportType, id + "::" + upnp.AVTransportType},
 		{upnp.RenderingType, id + "::" + upnp.RenderingType},
 		{upnp.ConnectionManagerType, id + "::" + upnp.ConnectionManagerType},
+		{upnp.ProductType, id + "::" + upnp.ProductType},
+		{upnp.PlaylistType, id + "::" + upnp.PlaylistType},
+		{upnp.VolumeType, id + "::" + upnp.VolumeType},
+		{upnp.TimeType, id + "::" + upnp.TimeType},
+		{upnp.InfoType, id + "::" + upnp.InfoType},
+		{dial.ServiceType, id + "::" + dial.ServiceType},
 		{"upnp:rootdevice", id + "::upnp:rootdevice"},
 		{id, id},
 	}
@@ -180,7 +216,7 @@ func TestBuildAliveMessage(t *testing.T) {
 	const base = "http://192.0.2.5:8200"
 	const server = "rcast/1.0 macOS/14"
 	for _, x := range aliveTargets("uuid:z") {
-		msg := buildAliveMessage(ssdpAddr, base, server, x.st, x.usn)
+		msg := buildAliveMessage(ssdpAddr, base, server, x.st, x.usn, 3)
 		for _, want := range []string{
 			"NOTIFY * HTTP/1.1",
 			"HOST: " + ssdpAddr,
@@ -191,7 +227,7 @@ func TestBuildAliveMessage(t *testing.T) {
 			"SERVER: " + server,
 			"USN: " + x.usn,
 			"BOOTID.UPNP.ORG: 1",
-			"CONFIGID.UPNP.ORG: 1",
+			"CONFIGID.UPNP.ORG: 3",
 			"\r\n\r\n",
 		} {
 			if !strings.Contains(msg, want) {
@@ -227,7 +263,7 @@ func TestBuildByebyeMessage(t *testing.T) {
 func TestBuildSearchResponse(t *testing.T) {
 	now := time.Date(2026, 6, 28, 12, 0, 0, 0, time.UTC)
 	target := responseTarget{st: "ssdp:all", usn: "uuid:r"}
-	msg := buildSearchResponse("http://192.0.2.1:8200", "rcast/1.0", target, now)
+	msg := buildSearchResponse("http://192.0.2.1:8200", "rcast/1.0", target, now, 1)
 	for _, want := range []string{
 		"HTTP/1.1 200 OK",
 		"CACHE-CONTROL: max-age=1800",
@@ -293,6 +329,8 @@ func TestParseMSearch(t *testing.T) {
 		{"avtransport", mkPacket(upnp.AVTransportType, ""), true, upnp.AVTransportType, 1},
 		{"rendering", mkPacket(upnp.RenderingType, ""), true, upnp.RenderingType, 1},
 		{"connection mgr", mkPacket(upnp.ConnectionManagerType, ""), true, upnp.ConnectionManagerType, 1},
+		{"openhome", mkPacket(upnp.PlaylistType, ""), true, upnp.PlaylistType, 1},
+		{"dial", mkPacket(dial.ServiceType, ""), true, dial.ServiceType, 1},
 		{"device uuid", mkPacket(id, ""), true, id, 1},
 		{"mx clamp low", mkPacket("ssdp:all", "0"), true, "ssdp:all", 1},
 		{"mx clamp high", mkPacket("ssdp:all", "9"), true, "ssdp:all", 5},
@@ -350,27 +388,29 @@ func withRandomDelay(t *testing.T, fn func(mx int) time.Duration) {
 func TestAnnounceHappy(t *testing.T) {
 	conn := newFakeUDPConn()
 	// Use a long interval so the alive-burst ticker never fires between the
-	// initial 6 writes and cancel(); otherwise an extra batch would make the
-	// final "exactly 12" assertion racy under load.
+	// initial 12 writes and cancel(); otherwise an extra batch would make the
+	// final "exactly 24" assertion racy under load.
 	withFakeDial(t, conn, time.Hour)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 	go func() {
-		Announce(ctx, "http://192.0.2.1:8200", "uuid:happy", "rcast/1.0")
+		Announce(ctx, "http://192.0.2.1:8200", "uuid:happy", "rcast/1.0", newFakeConfig())
 		close(done)
 	}()
 
-	// Initial burst: 6 alive messages, one per ST.
-	conn.waitForWrites(t, 6, "writes")
+	// Initial burst: 12 alive messages, one per ST.
+	conn.waitForWrites(t, 12, "writes")
 	writes, _ := conn.snapshot()
 	aliveNTs := collectNTs(t, writes, "ssdp:alive")
-	if len(aliveNTs) != 6 {
-		t.Fatalf("alive NT count = %d, want 6: %v", len(aliveNTs), aliveNTs)
+	if len(aliveNTs) != 12 {
+		t.Fatalf("alive NT count = %d, want 12: %v", len(aliveNTs), aliveNTs)
 	}
 	wantAlive := map[string]bool{
 		upnp.DeviceType: true, upnp.AVTransportType: true, upnp.RenderingType: true,
 		upnp.ConnectionManagerType: true, "upnp:rootdevice": true, "uuid:happy": true,
+		upnp.ProductType: true, upnp.PlaylistType: true, upnp.VolumeType: true,
+		upnp.TimeType: true, upnp.InfoType: true, dial.ServiceType: true,
 	}
 	for nt := range aliveNTs {
 		if !wantAlive[nt] {
@@ -378,9 +418,9 @@ func TestAnnounceHappy(t *testing.T) {
 		}
 	}
 
-	// Cancel -> 6 byebye messages, then the goroutine returns.
+	// Cancel -> 12 byebye messages, then the goroutine returns.
 	cancel()
-	conn.waitForWrites(t, 12, "writes")
+	conn.waitForWrites(t, 24, "writes")
 	select {
 	case <-done:
 	case <-time.After(time.Second):
@@ -388,12 +428,12 @@ func TestAnnounceHappy(t *testing.T) {
 	}
 
 	writes, _ = conn.snapshot()
-	if len(writes) != 12 {
-		t.Fatalf("total writes = %d, want 12", len(writes))
+	if len(writes) != 24 {
+		t.Fatalf("total writes = %d, want 24", len(writes))
 	}
-	byebyeNTs := collectNTs(t, writes[6:], "ssdp:byebye")
-	if len(byebyeNTs) != 6 {
-		t.Fatalf("byebye NT count = %d, want 6: %v", len(byebyeNTs), byebyeNTs)
+	byebyeNTs := collectNTs(t, writes[12:], "ssdp:byebye")
+	if len(byebyeNTs) != 12 {
+		t.Fatalf("byebye NT count = %d, want 12: %v", len(byebyeNTs), byebyeNTs)
 	}
 	for nt := range byebyeNTs {
 		if !wantAlive[nt] {
@@ -402,6 +442,35 @@ func TestAnnounceHappy(t *testing.T) {
 	}
 }
 
+func TestAnnounceResendsAliveOnConfigChange(t *testing.T) {
+	conn := newFakeUDPConn()
+	withFakeDial(t, conn, time.Hour)
+	config := newFakeConfig()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Announce(ctx, "http://192.0.2.1:8200", "uuid:cfg", "rcast/1.0", config)
+
+	conn.waitForWrites(t, 12, "writes")
+	config.bump()
+	conn.waitForWrites(t, 24, "writes")
+
+	writes, _ := conn.snapshot()
+	for _, m := range writes[:12] {
+		if headerValue(m, "CONFIGID.UPNP.ORG") != "1" {
+			t.Errorf("initial alive CONFIGID = %q, want 1", headerValue(m, "CONFIGID.UPNP.ORG"))
+		}
+	}
+	if got := collectNTs(t, writes[12:24], "ssdp:alive"); len(got) != 12 {
+		t.Fatalf("re-announce alive NTs = %v, want 12", got)
+	}
+	for _, m := range writes[12:24] {
+		if headerValue(m, "CONFIGID.UPNP.ORG") != "2" {
+			t.Errorf("re-announce CONFIGID = %q, want 2", headerValue(m, "CONFIGID.UPNP.ORG"))
+		}
+	}
+}
+
 func collectNTs(t *testing.T, msgs []string, nts string) map[string]bool {
 	t.Helper()
 	out := map[string]bool{}
@@ -443,16 +512,16 @@ func TestAnnounceWriteErrorContinues(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 	go func() {
-		Announce(ctx, "http://192.0.2.1:8200", "uuid:werr", "rcast/1.0")
+		Announce(ctx, "http://192.0.2.1:8200", "uuid:werr", "rcast/1.0", newFakeConfig())
 		close(done)
 	}()
 
-	// All 6 alive writes are attempted even though each errors.
-	waitForAttempts(t, conn, 6)
+	// All 12 alive writes are attempted even though each errors.
+	waitForAttempts(t, conn, 12)
 
 	cancel()
-	// 6 more byebye attempts land before the goroutine returns.
-	waitForAttempts(t, conn, 12)
+	// 12 more byebye attempts land before the goroutine returns.
+	waitForAttempts(t, conn, 24)
 	select {
 	case <-done:
 	case <-time.After(time.Second):
@@ -485,7 +554,7 @@ func TestAnnounceDialFails(t *testing.T) {
 
 	done := make(chan struct{})
 	go func() {
-		Announce(context.Background(), "http://192.0.2.1:8200", "uuid:df", "rcast/1.0")
+		Announce(context.Background(), "http://192.0.2.1:8200", "uuid:df", "rcast/1.0", newFakeConfig())
 		close(done)
 	}()
 	select {
@@ -503,7 +572,7 @@ func TestSearchResponderHappyAll(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 	go func() {
-		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:happy", "rcast/1.0")
+		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:happy", "rcast/1.0", newFakeConfig())
 		close(done)
 	}()
 
@@ -513,8 +582,8 @@ func TestSearchResponderHappyAll(t *testing.T) {
 			"\r\nMAN: \"ssdp:discover\"\r\nST: ssdp:all\r\nMX: 1\r\n\r\n"),
 		src: src,
 	}
-	// ssdp:all produces 6 responses.
-	conn.waitForWrites(t, 6, "toUDP")
+	// ssdp:all produces 12 responses.
+	conn.waitForWrites(t, 12, "toUDP")
 
 	// Drive a timeout to verify the loop survives, then cancel.
 	conn.readCh <- readResult{err: fakeTimeoutErr{}}
@@ -528,11 +597,14 @@ func TestSearchResponderHappyAll(t *testing.T) {
 	}
 
 	_, toUDP := conn.snapshot()
-	if len(toUDP) != 6 {
-		t.Fatalf("responses = %d, want 6", len(toUDP))
+	if len(toUDP) != 12 {
+		t.Fatalf("responses = %d, want 12", len(toUDP))
 	}
 	seenST := map[string]bool{}
 	for _, w := range toUDP {
+		if headerValue(w.data, "CONFIGID.UPNP.ORG") != "1" {
+			t.Errorf("response CONFIGID = %q, want 1", headerValue(w.data, "CONFIGID.UPNP.ORG"))
+		}
 		if w.addr.String() != src.String() {
 			t.Errorf("response addr = %s, want %s", w.addr, src)
 		}
@@ -541,8 +613,8 @@ func TestSearchResponderHappyAll(t *testing.T) {
 		}
 		seenST[headerValue(w.data, "ST")] = true
 	}
-	if len(seenST) != 6 {
-		t.Errorf("distinct response STs = %d, want 6: %v", len(seenST), seenST)
+	if len(seenST) != 12 {
+		t.Errorf("distinct response STs = %d, want 12: %v", len(seenST), seenST)
 	}
 }
 
@@ -554,7 +626,7 @@ func TestSearchResponderSingleST(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 	go func() {
-		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:single", "rcast/1.0")
+		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:single", "rcast/1.0", newFakeConfig())
 		close(done)
 	}()
 
@@ -590,7 +662,7 @@ func TestSearchResponderIgnoresBadPackets(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 	go func() {
-		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:ign", "rcast/1.0")
+		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:ign", "rcast/1.0", newFakeConfig())
 		close(done)
 	}()
 
@@ -614,7 +686,7 @@ func TestSearchResponderIgnoresBadPackets(t *testing.T) {
 		data: []byte("M-SEARCH * HTTP/1.1\r\nMAN: \"ssdp:discover\"\r\nST: ssdp:all\r\nMX: 1\r\n\r\n"),
 		src:  src,
 	}
-	conn.waitForWrites(t, 6, "toUDP")
+	conn.waitForWrites(t, 12, "toUDP")
 
 	cancel()
 	close(conn.readCh)
@@ -633,7 +705,7 @@ func TestSearchResponderReadTimeoutContinues(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 	go func() {
-		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:to", "rcast/1.0")
+		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:to", "rcast/1.0", newFakeConfig())
 		close(done)
 	}()
 
@@ -644,7 +716,7 @@ func TestSearchResponderReadTimeoutContinues(t *testing.T) {
 		data: []byte("M-SEARCH * HTTP/1.1\r\nMAN: \"ssdp:discover\"\r\nST: ssdp:all\r\nMX: 1\r\n\r\n"),
 		src:  &net.UDPAddr{IP: net.IPv4(10, 0, 0, 4), Port: 1900},
 	}
-	conn.waitForWrites(t, 6, "toUDP")
+	conn.waitForWrites(t, 12, "toUDP")
 
 	cancel()
 	close(conn.readCh)
@@ -663,7 +735,7 @@ func TestSearchResponderNonTimeoutReadErrorContinues(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 	go func() {
-		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:nte", "rcast/1.0")
+		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:nte", "rcast/1.0", newFakeConfig())
 		close(done)
 	}()
 
@@ -674,7 +746,7 @@ func TestSearchResponderNonTimeoutReadErrorContinues(t *testing.T) {
 		data: []byte("M-SEARCH * HTTP/1.1\r\nMAN: \"ssdp:discover\"\r\nST: ssdp:all\r\nMX: 1\r\n\r\n"),
 		src:  &net.UDPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 1900},
 	}
-	conn.waitForWrites(t, 6, "toUDP")
+	conn.waitForWrites(t, 12, "toUDP")
 
 	cancel()
 	close(conn.readCh)
@@ -722,7 +794,7 @@ func TestSearchResponderCapDrop(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 	go func() {
-		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:cap", "rcast/1.0")
+		SearchResponder(ctx, "http://192.0.2.1:8200", "uuid:cap", "rcast/1.0", newFakeConfig())
 		close(done)
 	}()
 
@@ -745,11 +817,11 @@ func TestSearchResponderCapDrop(t *testing.T) {
 		t.Fatalf("expected 0 responses while responder parked, got %d", len(toUDP))
 	}
 
-	// Release the parked responder: exactly one batch of 6 responses lands.
+	// Release the parked responder: exactly one batch of 12 responses lands.
 	close(release)
-	conn.waitForWrites(t, 6, "toUDP")
-	if _, toUDP := conn.snapshot(); len(toUDP) != 6 {
-		t.Fatalf("expected exactly 6 responses after release, got %d (drop branch not honored)", len(toUDP))
+	conn.waitForWrites(t, 12, "toUDP")
+	if _, toUDP := conn.snapshot(); len(toUDP) != 12 {
+		t.Fatalf("expected exactly 12 responses after release, got %d (drop branch not honored)", len(toUDP))
 	}
 
 	cancel()
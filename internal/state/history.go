@@ -0,0 +1,83 @@
+package state
+
+import (
+	"time"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/history"
+)
+
+// playClock measures how long the current media has actually been PLAYING,
+// pauses excluded, for the Stop entry of the cast history.
+type playClock struct {
+	running bool
+	since   time.Time
+	played  time.Duration
+}
+
+// SetHistory attaches the cast history; nil, the default, records nothing.
+func (s *PlayerState) SetHistory(h *history.Log) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = h
+}
+
+// History is the attached cast history, nil when it is off.
+func (s *PlayerState) History() *history.Log {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.history
+}
+
+// setTransportStateLocked moves to next, running the play clock while
+// PLAYING. Reaching STOPPED or NO_MEDIA_PRESENT ends the cast; the returned
+// entry, if any, goes to record once s.mu is released. Caller must hold s.mu.
+func (s *PlayerState) setTransportStateLocked(next string) *history.Entry {
+	prev := s.transportState
+	s.transportState = next
+	switch {
+	case prev != Playing && next == Playing:
+		s.clock.running, s.clock.since = true, time.Now()
+	case prev == Playing && next != Playing:
+		s.clock.running = false
+		s.clock.played += time.Since(s.clock.since)
+	}
+	if next == Stopped || next == NoMediaPresent {
+		return s.endPlayLocked()
+	}
+	return nil
+}
+
+// endPlayLocked closes the play clock of the current media and describes
+// how long it played, or returns nil when it never did. Caller must hold
+// s.mu.
+func (s *PlayerState) endPlayLocked() *history.Entry {
+	clock := s.clock
+	s.clock = playClock{}
+	if clock.running {
+		clock.played += time.Since(clock.since)
+	}
+	if clock.played <= 0 || s.transportURI == "" {
+		return nil
+	}
+	return &history.Entry{
+		Event:      history.EventStop,
+		Controller: s.sessionOwner,
+		URI:        s.transportURI,
+		Title:      didlText(s.transportMeta, "title"),
+		Class:      didlText(s.transportMeta, "class"),
+		Metadata:   s.transportMeta,
+		Played:     clock.played.Seconds(),
+	}
+}
+
+// record appends e to the cast history. Must not be called with s.mu held.
+func (s *PlayerState) record(e *history.Entry) {
+	if e == nil {
+		return
+	}
+	if _, err := s.History().Append(*e); err != nil {
+		log.CtxWarn(s.ctx, "record cast history: %v", err)
+	}
+}
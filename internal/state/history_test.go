@@ -0,0 +1,76 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tr1v3r/rcast/internal/history"
+	"github.com/tr1v3r/rcast/internal/player"
+)
+
+func newHistoryLog(t *testing.T) *history.Log {
+	t.Helper()
+	h, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"), history.DefaultMaxBytes, history.DefaultKeep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestStopRecordsPlayedTimeWithoutPauses(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	h := newHistoryLog(t)
+	st.SetHistory(h)
+	const meta = `<DIDL-Lite xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/"><item><dc:title>Clip</dc:title><upnp:class>object.item.videoItem</upnp:class></item></DIDL-Lite>`
+	st.SetURI("http://example/1.mp4", meta)
+	st.AcquireSession("10.0.0.1", false)
+
+	start := time.Now()
+	st.SetTransportState("PLAYING")
+	time.Sleep(20 * time.Millisecond)
+	st.SetTransportState("PAUSED_PLAYBACK")
+	time.Sleep(50 * time.Millisecond)
+	st.SetTransportState("PLAYING")
+	time.Sleep(20 * time.Millisecond)
+	st.SetTransportState("STOPPED")
+	elapsed := time.Since(start)
+	// Already stopped: nothing more to record.
+	st.SetTransportState("STOPPED")
+
+	page, total, err := h.Page(0, 10)
+	if err != nil || total != 1 {
+		t.Fatalf("history = %+v, %v", page, err)
+	}
+	e := page[0]
+	if e.Event != history.EventStop || e.URI != "http://example/1.mp4" || e.Title != "Clip" || e.Class != "object.item.videoItem" || e.Controller != "10.0.0.1" {
+		t.Fatalf("stop entry = %+v", e)
+	}
+	if e.Played < 0.04 || e.Played > (elapsed-50*time.Millisecond).Seconds() {
+		t.Fatalf("played %.3fs of %s, want the 50ms pause left out", e.Played, elapsed)
+	}
+}
+
+func TestMediaChangesEndTheCastInHistory(t *testing.T) {
+	st, fp := newEventState(t)
+	h := newHistoryLog(t)
+	st.SetHistory(h)
+
+	// Never played: replacing it records nothing.
+	st.SetURI("http://example/0.mp4", "")
+	st.SetURI("http://example/1.mp4", "")
+	st.SetNextURI("http://example/2.mp4", "")
+	st.SetTransportState("PLAYING")
+	fp.events <- player.Event{Type: player.EventTrackChanged, Path: "http://example/2.mp4"}
+	waitFor(t, "advance", func() bool { uri, _ := st.GetURI(); return uri == "http://example/2.mp4" })
+	fp.events <- player.Event{Type: player.EventEndOfFile}
+	waitFor(t, "stop", func() bool { return st.GetTransportState() == "STOPPED" })
+
+	page, _, err := h.Page(0, 10)
+	if err != nil || len(page) != 2 {
+		t.Fatalf("history = %+v, %v", page, err)
+	}
+	if page[0].URI != "http://example/2.mp4" || page[1].URI != "http://example/1.mp4" {
+		t.Fatalf("stop entries = %+v", page)
+	}
+}
@@ -0,0 +1,139 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/fileutil"
+)
+
+// Saved is the renderer state kept across restarts: the output level and the
+// last cast, so it can be resumed.
+type Saved struct {
+	Volume   int     `json:"volume"`
+	Mute     bool    `json:"mute"`
+	URI      string  `json:"uri,omitempty"`
+	Meta     string  `json:"metadata,omitempty"`
+	Position float64 `json:"position,omitempty"`
+}
+
+// LoadSaved reads state written by Persist. A missing file is reported as
+// an error wrapping os.ErrNotExist.
+func LoadSaved(path string) (Saved, error) {
+	var saved Saved
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return saved, err
+	}
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return Saved{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if saved.Volume < 0 || saved.Volume > 100 {
+		return Saved{}, fmt.Errorf("parse %s: volume %d is outside 0-100", path, saved.Volume)
+	}
+	return saved, nil
+}
+
+// Restore applies saved state at startup: volume and mute take effect, and
+// the last cast is remembered for LastCast without being loaded.
+func (s *PlayerState) Restore(saved Saved) {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.volume = saved.Volume
+	s.mute = saved.Mute
+	s.resume = Saved{URI: saved.URI, Meta: saved.Meta, Position: saved.Position}
+}
+
+// LastCast is the media a "resume last cast" request replays: the current
+// URI when one is set, otherwise the one restored at startup, with the last
+// known position.
+func (s *PlayerState) LastCast() (uri, meta string, position float64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.transportURI != "" {
+		return s.transportURI, s.transportMeta, s.position
+	}
+	return s.resume.URI, s.resume.Meta, s.resume.Position
+}
+
+// saved collects what Persist writes.
+func (s *PlayerState) saved() Saved {
+	uri, meta, position := s.LastCast()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Saved{Volume: s.volume, Mute: s.mute, URI: uri, Meta: meta, Position: position}
+}
+
+// positionWriteInterval bounds how often a position that advances during
+// playback reaches the disk; flash storage wears out under a write every
+// debounce interval.
+var positionWriteInterval = time.Minute
+
+// Persist writes the state to path after changes, at most once per debounce
+// interval, until ctx ends; pending changes are written before it returns.
+// Positions advance every second while playing, so a change of position
+// alone is only written once per positionWriteInterval then, and as soon as
+// playback pauses or stops.
+func (s *PlayerState) Persist(ctx context.Context, path string, debounce time.Duration) {
+	last, lastWrite := s.saved(), time.Now()
+	s.persistOnChange(ctx, debounce, func(final bool) {
+		next := s.saved()
+		if next == last {
+			return
+		}
+		moved, prev := next, last
+		moved.Position, prev.Position = 0, 0
+		if moved == prev && !final && s.deferPositionWrite(lastWrite) {
+			return
+		}
+		if err := writeSaved(path, next); err != nil {
+			log.CtxWarn(s.ctx, "persist renderer state: %v", err)
+			return
+		}
+		last, lastWrite = next, time.Now()
+	})
+}
+
+// deferPositionWrite reports whether a new position can wait for a later
+// write: playback goes on and the last write is recent.
+func (s *PlayerState) deferPositionWrite(lastWrite time.Time) bool {
+	return s.GetTransportState() == Playing && time.Since(lastWrite) < positionWriteInterval
+}
+
+// persistOnChange calls write no sooner than debounce after a state change,
+// and once more, final, when ctx ends. write decides itself whether anything
+// needs saving.
+func (s *PlayerState) persistOnChange(ctx context.Context, debounce time.Duration, write func(final bool)) {
+	changes, unwatch := s.Watch()
+	defer unwatch()
+
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			write(true)
+			return
+		case <-changes:
+			if flush == nil {
+				flush = time.After(debounce)
+			}
+		case <-flush:
+			flush = nil
+			write(false)
+		}
+	}
+}
+
+func writeSaved(path string, saved Saved) error {
+	b, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(path, append(b, '\n'), 0o644)
+}
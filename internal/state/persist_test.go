@@ -0,0 +1,151 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tr1v3r/rcast/internal/player"
+)
+
+func TestLoadSaved(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadSaved(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing file error = %v, want ErrNotExist", err)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"volume": 300}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSaved(bad); err == nil {
+		t.Fatal("out-of-range volume accepted")
+	}
+
+	good := filepath.Join(dir, "state.json")
+	if err := writeSaved(good, Saved{Volume: 35, Mute: true, URI: "https://example.test/v.mp4", Position: 12.5}); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := LoadSaved(good)
+	if err != nil {
+		t.Fatalf("LoadSaved: %v", err)
+	}
+	if saved.Volume != 35 || !saved.Mute || saved.URI != "https://example.test/v.mp4" || saved.Position != 12.5 {
+		t.Fatalf("saved = %+v", saved)
+	}
+}
+
+func TestRestoreSetsVolumeAndRemembersLastCast(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	st.Restore(Saved{Volume: 20, Mute: true, URI: "https://example.test/old.mp4", Meta: "<DIDL-Lite/>", Position: 42})
+
+	if st.GetVolume() != 20 || !st.GetMute() {
+		t.Fatalf("volume=%d mute=%v", st.GetVolume(), st.GetMute())
+	}
+	if uri, _ := st.GetURI(); uri != "" {
+		t.Fatalf("restored cast loaded as current URI %q", uri)
+	}
+	if uri, meta, pos := st.LastCast(); uri != "https://example.test/old.mp4" || meta != "<DIDL-Lite/>" || pos != 42 {
+		t.Fatalf("LastCast = %q, %q, %v", uri, meta, pos)
+	}
+
+	// A newer cast takes over.
+	st.SetURI("https://example.test/new.mp4", "")
+	if uri, _, _ := st.LastCast(); uri != "https://example.test/new.mp4" {
+		t.Fatalf("LastCast after new cast = %q", uri)
+	}
+}
+
+func TestPersistWritesDebouncedAndOnShutdown(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	path := filepath.Join(t.TempDir(), "state.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		st.Persist(ctx, path, 20*time.Millisecond)
+	}()
+
+	waitWatching(t, st)
+
+	st.SetVolume(30)
+	deadline := time.Now().Add(2 * time.Second)
+	st.SetURI("https://example.test/v.mp4", "")
+	for {
+		if saved, err := LoadSaved(path); err == nil && saved.Volume == 30 && saved.URI == "https://example.test/v.mp4" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("state was not written after the debounce interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	st.SetMute(true)
+	cancel()
+	<-done
+	saved, err := LoadSaved(path)
+	if err != nil || !saved.Mute {
+		t.Fatalf("state after shutdown = %+v, %v; want mute flushed", saved, err)
+	}
+}
+
+func TestPersistDefersPositionsWhilePlaying(t *testing.T) {
+	defer func(d time.Duration) { positionWriteInterval = d }(positionWriteInterval)
+	positionWriteInterval = time.Hour
+	st, fp := newEventState(t)
+	path := filepath.Join(t.TempDir(), "state.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		st.Persist(ctx, path, time.Millisecond)
+	}()
+	waitWatching(t, st)
+
+	st.SetURI("https://example.test/v.mp4", "")
+	st.SetTransportState(Playing)
+	waitFor(t, "cast written", func() bool {
+		saved, err := LoadSaved(path)
+		return err == nil && saved.URI == "https://example.test/v.mp4"
+	})
+
+	// Playback moving on is not worth a write of its own.
+	fp.events <- player.Event{Type: player.EventPosition, Position: 75}
+	waitFor(t, "position", func() bool { return st.Snapshot().Position == 75 })
+	time.Sleep(20 * time.Millisecond)
+	if saved, _ := LoadSaved(path); saved.Position != 0 {
+		t.Fatalf("position written during playback: %+v", saved)
+	}
+
+	// Pausing writes it at once.
+	fp.events <- player.Event{Type: player.EventPaused}
+	waitFor(t, "position written on pause", func() bool {
+		saved, err := LoadSaved(path)
+		return err == nil && saved.Position == 75
+	})
+
+	// So does shutting down.
+	st.SetTransportState(Playing)
+	fp.events <- player.Event{Type: player.EventPosition, Position: 90}
+	waitFor(t, "position", func() bool { return st.Snapshot().Position == 90 })
+	cancel()
+	<-done
+	if saved, err := LoadSaved(path); err != nil || saved.Position != 90 {
+		t.Fatalf("state after shutdown = %+v, %v; want position 90", saved, err)
+	}
+}
+
+// waitWatching waits for a persister to register its watcher, so the changes
+// a test makes next are not folded into its starting point.
+func waitWatching(t *testing.T, st *PlayerState) {
+	t.Helper()
+	waitFor(t, "persister watching", func() bool {
+		st.watchMu.Lock()
+		defer st.watchMu.Unlock()
+		return len(st.watchers) > 0
+	})
+}
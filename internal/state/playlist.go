@@ -0,0 +1,458 @@
+package state
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/tr1v3r/rcast/internal/history"
+)
+
+// TracksMax is how many tracks the playlist holds.
+const TracksMax = 1000
+
+var (
+	ErrNoSuchTrack  = errors.New("no such track")
+	ErrPlaylistFull = errors.New("playlist full")
+)
+
+// Repeat is what happens once playback reaches the end of a track.
+type Repeat int
+
+const (
+	// RepeatOff stops after the last track.
+	RepeatOff Repeat = iota
+	// RepeatAll wraps round from the last track to the first.
+	RepeatAll
+	// RepeatOne plays the current track again.
+	RepeatOne
+)
+
+var repeatNames = []string{"off", "all", "one"}
+
+func (r Repeat) String() string {
+	if r < 0 || int(r) >= len(repeatNames) {
+		return "unknown"
+	}
+	return repeatNames[r]
+}
+
+func (r Repeat) MarshalText() ([]byte, error) { return []byte(r.String()), nil }
+
+func (r *Repeat) UnmarshalText(b []byte) error {
+	i := slices.Index(repeatNames, string(b))
+	if i < 0 {
+		return errors.New("repeat must be off, all or one")
+	}
+	*r = Repeat(i)
+	return nil
+}
+
+// Track is an entry of the renderer-owned playlist. IDs are never reused
+// while the renderer runs, so a control point holding an old ID cannot
+// address a different track by accident.
+type Track struct {
+	ID   uint32 `json:"id"`
+	URI  string `json:"uri"`
+	Meta string `json:"metadata,omitempty"`
+}
+
+// PlaylistSnapshot is the observable part of the playlist.
+type PlaylistSnapshot struct {
+	IDs     []uint32
+	Token   uint32 // changes whenever IDs does
+	Current uint32 // ID of the selected track, 0 when none
+	Index   int    // position of Current in IDs, -1 when none
+	Repeat  Repeat
+	Shuffle bool
+	// HasNext and HasPrevious report whether stepping from the selected
+	// track finds another one.
+	HasNext, HasPrevious bool
+}
+
+// PlayMode is the AVTransport play mode the playlist modes amount to.
+// Shuffle wins over repeat, which AVTransport cannot combine with it.
+func (p PlaylistSnapshot) PlayMode() string {
+	switch {
+	case p.Shuffle:
+		return PlayModeShuffle
+	case p.Repeat == RepeatOne:
+		return PlayModeRepeatOne
+	case p.Repeat == RepeatAll:
+		return PlayModeRepeatAll
+	}
+	return PlayModeNormal
+}
+
+// playlist is the track list control points edit. current is the selected
+// track and queued the one preloaded as the next URI, by ID, 0 for none.
+// token counts edits of the track list. While shuffling, order is the
+// order tracks play in.
+type playlist struct {
+	tracks  []Track
+	order   []uint32
+	lastID  uint32
+	token   uint32
+	current uint32
+	queued  uint32
+	repeat  Repeat
+	shuffle bool
+}
+
+func (pl *playlist) index(id uint32) int {
+	for i, t := range pl.tracks {
+		if t.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (pl *playlist) track(id uint32) (Track, bool) {
+	if i := pl.index(id); i >= 0 {
+		return pl.tracks[i], true
+	}
+	return Track{}, false
+}
+
+// sequence lists the track IDs in the order they play: as listed, or
+// shuffled while shuffle is on.
+func (pl *playlist) sequence() []uint32 {
+	if pl.shuffle {
+		return pl.order
+	}
+	ids := make([]uint32, len(pl.tracks))
+	for i, t := range pl.tracks {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+// step finds the track delta places from the one with id in play order,
+// wrapping round unless repeat is off. Without such a track, stepping
+// forward starts at the first track and stepping back at the last.
+func (pl *playlist) step(id uint32, delta int) (Track, bool) {
+	seq := pl.sequence()
+	n := len(seq)
+	i := slices.Index(seq, id)
+	if i < 0 && delta < 0 {
+		i = n
+	}
+	j := i + delta
+	if pl.repeat != RepeatOff && n > 0 {
+		j = (j%n + n) % n
+	}
+	if j < 0 || j >= n {
+		return Track{}, false
+	}
+	return pl.track(seq[j])
+}
+
+// following is the track that plays once the one with id ends.
+func (pl *playlist) following(id uint32) (Track, bool) {
+	if pl.repeat == RepeatOne {
+		return pl.track(id)
+	}
+	return pl.step(id, 1)
+}
+
+// shuffleOrder deals a fresh play order, starting with the selected track
+// so that turning shuffle on does not interrupt it.
+func (pl *playlist) shuffleOrder() {
+	pl.order = pl.order[:0]
+	for _, t := range pl.tracks {
+		if t.ID != pl.current {
+			pl.order = append(pl.order, t.ID)
+		}
+	}
+	rand.Shuffle(len(pl.order), func(i, j int) { pl.order[i], pl.order[j] = pl.order[j], pl.order[i] })
+	if pl.current != 0 {
+		pl.order = slices.Insert(pl.order, 0, pl.current)
+	}
+}
+
+// requeueLocked makes the track following the selected one the next URI, so
+// the player moves on to it gaplessly like to any other next URI. Repeating
+// one track queues nothing; the track restarts at its end instead. Caller
+// must hold s.mu.
+func (s *PlayerState) requeueLocked() {
+	pl := &s.playlist
+	if pl.current == 0 {
+		return
+	}
+	if t, ok := pl.following(pl.current); ok && pl.repeat != RepeatOne {
+		pl.queued, s.nextURI, s.nextMeta = t.ID, t.URI, t.Meta
+		return
+	}
+	pl.queued, s.nextURI, s.nextMeta = 0, "", ""
+}
+
+// PlaylistTracks returns a copy of the playlist in order.
+func (s *PlayerState) PlaylistTracks() []Track {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Track(nil), s.playlist.tracks...)
+}
+
+// PlaylistTrack looks a track up by ID.
+func (s *PlayerState) PlaylistTrack(id uint32) (Track, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.playlist.track(id)
+}
+
+// PlaylistCurrent is the ID of the selected track, 0 when the current media
+// did not come from the playlist.
+func (s *PlayerState) PlaylistCurrent() uint32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.playlist.current
+}
+
+// PlaylistInsert adds a track after the one with afterID, or first when
+// afterID is 0, and returns the new track's ID.
+func (s *PlayerState) PlaylistInsert(afterID uint32, uri, meta string) (uint32, error) {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at := 0
+	if afterID != 0 {
+		i := s.playlist.index(afterID)
+		if i < 0 {
+			return 0, ErrNoSuchTrack
+		}
+		at = i + 1
+	}
+	return s.insertLocked(at, uri, meta)
+}
+
+// PlaylistAppend adds a track at the end of the playlist and returns its
+// ID.
+func (s *PlayerState) PlaylistAppend(uri, meta string) (uint32, error) {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertLocked(len(s.playlist.tracks), uri, meta)
+}
+
+// insertLocked puts a new track at index at. While shuffling, the track gets
+// a random place among those still to play. Caller must hold s.mu.
+func (s *PlayerState) insertLocked(at int, uri, meta string) (uint32, error) {
+	pl := &s.playlist
+	if len(pl.tracks) >= TracksMax {
+		return 0, ErrPlaylistFull
+	}
+	pl.lastID++
+	t := Track{ID: pl.lastID, URI: uri, Meta: meta}
+	pl.tracks = slices.Insert(pl.tracks, at, t)
+	if pl.shuffle {
+		from := slices.Index(pl.order, pl.current) + 1
+		pl.order = slices.Insert(pl.order, from+rand.IntN(len(pl.order)-from+1), t.ID)
+	}
+	pl.token++
+	s.requeueLocked()
+	return t.ID, nil
+}
+
+// PlaylistMove puts the track with id after the one with afterID, or first
+// when afterID is 0. The shuffled play order stays as it was.
+func (s *PlayerState) PlaylistMove(id, afterID uint32) error {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pl := &s.playlist
+	i := pl.index(id)
+	if i < 0 || (afterID != 0 && pl.index(afterID) < 0) {
+		return ErrNoSuchTrack
+	}
+	if id == afterID {
+		return nil
+	}
+	t := pl.tracks[i]
+	pl.tracks = slices.Delete(pl.tracks, i, i+1)
+	at := 0
+	if afterID != 0 {
+		at = pl.index(afterID) + 1
+	}
+	pl.tracks = slices.Insert(pl.tracks, at, t)
+	pl.token++
+	s.requeueLocked()
+	return nil
+}
+
+// PlaylistDelete removes a track. Deleting the selected track leaves the
+// current media in place but no longer part of the playlist.
+func (s *PlayerState) PlaylistDelete(id uint32) error {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pl := &s.playlist
+	i := pl.index(id)
+	if i < 0 {
+		return ErrNoSuchTrack
+	}
+	pl.tracks = slices.Delete(pl.tracks, i, i+1)
+	if j := slices.Index(pl.order, id); j >= 0 {
+		pl.order = slices.Delete(pl.order, j, j+1)
+	}
+	pl.token++
+	if pl.current == id {
+		pl.current, pl.queued = 0, 0
+		s.nextURI, s.nextMeta = "", ""
+	}
+	s.requeueLocked()
+	return nil
+}
+
+// PlaylistClear empties the playlist.
+func (s *PlayerState) PlaylistClear() {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.playlist.queued != 0 {
+		s.nextURI, s.nextMeta = "", ""
+	}
+	s.playlist.tracks = nil
+	s.playlist.order = nil
+	s.playlist.token++
+	s.playlist.current, s.playlist.queued = 0, 0
+}
+
+// SelectTrack makes the track with id the current media, stopped, with the
+// track after it queued as the next URI.
+func (s *PlayerState) SelectTrack(id uint32) error {
+	defer s.notify()
+	s.mu.Lock()
+	t, ok := s.playlist.track(id)
+	if !ok {
+		s.mu.Unlock()
+		return ErrNoSuchTrack
+	}
+	ended := s.selectTrackLocked(t)
+	s.mu.Unlock()
+	s.record(ended)
+	return nil
+}
+
+// selectTrackLocked loads t as the current media and returns the history
+// entry ending the previous one. Caller must hold s.mu.
+func (s *PlayerState) selectTrackLocked(t Track) *history.Entry {
+	ended := s.setURILocked(t.URI, t.Meta)
+	s.playlist.current = t.ID
+	s.requeueLocked()
+	return ended
+}
+
+// PlaylistStep finds the track delta places from the selected one in play
+// order, wrapping round unless repeat is off; a control point skipping
+// tracks leaves the one being repeated. Without a selected track, stepping
+// forward starts at the first track and stepping back at the last.
+func (s *PlayerState) PlaylistStep(delta int) (Track, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.playlist.step(s.playlist.current, delta)
+}
+
+func (s *PlayerState) Repeat() Repeat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.playlist.repeat
+}
+
+// SetRepeat changes what happens at the end of a track.
+func (s *PlayerState) SetRepeat(mode Repeat) {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playlist.repeat = mode
+	s.requeueLocked()
+}
+
+func (s *PlayerState) Shuffle() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.playlist.shuffle
+}
+
+// SetShuffle turns shuffled play on or off. Turning it on deals a new play
+// order.
+func (s *PlayerState) SetShuffle(on bool) {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setShuffleLocked(on)
+	s.requeueLocked()
+}
+
+func (s *PlayerState) setShuffleLocked(on bool) {
+	pl := &s.playlist
+	switch {
+	case on && !pl.shuffle:
+		pl.shuffleOrder()
+	case !on:
+		pl.order = nil
+	}
+	pl.shuffle = on
+}
+
+// PlayMode reports the playlist modes as an AVTransport play mode.
+func (s *PlayerState) PlayMode() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.playlistSnapshotLocked().PlayMode()
+}
+
+// SetPlayMode sets the playlist modes from an AVTransport play mode and
+// reports whether mode is one of PlayModes.
+func (s *PlayerState) SetPlayMode(mode string) bool {
+	repeat := map[string]Repeat{
+		PlayModeNormal:    RepeatOff,
+		PlayModeShuffle:   RepeatOff,
+		PlayModeRepeatOne: RepeatOne,
+		PlayModeRepeatAll: RepeatAll,
+	}
+	r, ok := repeat[mode]
+	if !ok {
+		return false
+	}
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playlist.repeat = r
+	s.setShuffleLocked(mode == PlayModeShuffle)
+	s.requeueLocked()
+	return true
+}
+
+// upcomingLocked is the playlist track to start when the current one reached
+// its end without the player moving on by itself. Caller must hold s.mu.
+func (s *PlayerState) upcomingLocked() (Track, bool) {
+	if s.playlist.current == 0 {
+		return Track{}, false
+	}
+	return s.playlist.following(s.playlist.current)
+}
+
+// playlistSnapshotLocked copies the observable playlist. Caller must hold
+// s.mu.
+func (s *PlayerState) playlistSnapshotLocked() PlaylistSnapshot {
+	pl := &s.playlist
+	ids := make([]uint32, len(pl.tracks))
+	for i, t := range pl.tracks {
+		ids[i] = t.ID
+	}
+	snap := PlaylistSnapshot{
+		IDs:     ids,
+		Token:   pl.token,
+		Current: pl.current,
+		Index:   -1,
+		Repeat:  pl.repeat,
+		Shuffle: pl.shuffle,
+	}
+	if pl.current != 0 {
+		snap.Index = slices.Index(ids, pl.current)
+		_, snap.HasNext = pl.step(pl.current, 1)
+		_, snap.HasPrevious = pl.step(pl.current, -1)
+	}
+	return snap
+}
@@ -0,0 +1,322 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/tr1v3r/rcast/internal/player"
+)
+
+func insertTracks(t *testing.T, st *PlayerState, uris ...string) []uint32 {
+	t.Helper()
+	var ids []uint32
+	after := uint32(0)
+	for _, uri := range uris {
+		id, err := st.PlaylistInsert(after, uri, "")
+		if err != nil {
+			t.Fatalf("insert %s: %v", uri, err)
+		}
+		ids = append(ids, id)
+		after = id
+	}
+	return ids
+}
+
+func TestPlaylistInsertDeleteAndIDs(t *testing.T) {
+	st := newState(t, nil)
+	ids := insertTracks(t, st, "http://example/1.flac", "http://example/3.flac")
+	mid, err := st.PlaylistInsert(ids[0], "http://example/2.flac", "")
+	if err != nil {
+		t.Fatalf("insert after first: %v", err)
+	}
+	first, err := st.PlaylistInsert(0, "http://example/0.flac", "")
+	if err != nil {
+		t.Fatalf("insert first: %v", err)
+	}
+	if _, err := st.PlaylistInsert(99, "http://example/x.flac", ""); !errors.Is(err, ErrNoSuchTrack) {
+		t.Fatalf("insert after unknown id: err=%v, want ErrNoSuchTrack", err)
+	}
+
+	pl := st.Snapshot().Playlist
+	want := []uint32{first, ids[0], mid, ids[1]}
+	if len(pl.IDs) != len(want) {
+		t.Fatalf("ids=%v, want %v", pl.IDs, want)
+	}
+	for i := range want {
+		if pl.IDs[i] != want[i] {
+			t.Fatalf("ids=%v, want %v", pl.IDs, want)
+		}
+	}
+
+	token := pl.Token
+	if err := st.PlaylistDelete(mid); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok := st.PlaylistTrack(mid); ok {
+		t.Fatal("deleted track still present")
+	}
+	if st.Snapshot().Playlist.Token == token {
+		t.Fatal("token unchanged after delete")
+	}
+	// IDs are not reused.
+	if id, _ := st.PlaylistInsert(0, "http://example/y.flac", ""); id <= ids[1] || id <= first {
+		t.Fatalf("new id %d reuses an old one", id)
+	}
+	st.PlaylistClear()
+	if len(st.PlaylistTracks()) != 0 {
+		t.Fatal("playlist not cleared")
+	}
+}
+
+func TestPlaylistFull(t *testing.T) {
+	st := newState(t, nil)
+	for range TracksMax {
+		if _, err := st.PlaylistInsert(0, "http://example/a.flac", ""); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	if _, err := st.PlaylistInsert(0, "http://example/b.flac", ""); !errors.Is(err, ErrPlaylistFull) {
+		t.Fatalf("err=%v, want ErrPlaylistFull", err)
+	}
+}
+
+func TestSelectTrackQueuesTheFollowingOne(t *testing.T) {
+	st := newState(t, nil)
+	ids := insertTracks(t, st, "http://example/1.flac", "http://example/2.flac")
+
+	if err := st.SelectTrack(ids[0]); err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	snap := st.Snapshot()
+	if snap.URI != "http://example/1.flac" || snap.NextURI != "http://example/2.flac" || snap.Playlist.Current != ids[0] {
+		t.Fatalf("after select: uri=%q next=%q current=%d", snap.URI, snap.NextURI, snap.Playlist.Current)
+	}
+	if snap.TransportState != Stopped {
+		t.Fatalf("state=%q, want STOPPED", snap.TransportState)
+	}
+
+	// The last track has nothing after it until repeat wraps round.
+	if err := st.SelectTrack(ids[1]); err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if next, _ := st.GetNextURI(); next != "" {
+		t.Fatalf("next=%q at the end, want none", next)
+	}
+	st.SetRepeat(RepeatAll)
+	if next, _ := st.GetNextURI(); next != "http://example/1.flac" {
+		t.Fatalf("next=%q with repeat, want the first track", next)
+	}
+
+	// A track inserted after the current one becomes the next.
+	id, _ := st.PlaylistInsert(ids[1], "http://example/3.flac", "")
+	if next, _ := st.GetNextURI(); next != "http://example/3.flac" {
+		t.Fatalf("next=%q after insert, want the new track %d", next, id)
+	}
+
+	// AVTransport media leaves the playlist.
+	st.SetURI("http://example/other.mp4", "")
+	if cur := st.PlaylistCurrent(); cur != 0 {
+		t.Fatalf("current=%d after SetURI, want 0", cur)
+	}
+	if err := st.SelectTrack(99); !errors.Is(err, ErrNoSuchTrack) {
+		t.Fatalf("select unknown: err=%v", err)
+	}
+}
+
+func TestPlaylistStep(t *testing.T) {
+	st := newState(t, nil)
+	ids := insertTracks(t, st, "a", "b", "c")
+
+	if tr, ok := st.PlaylistStep(1); !ok || tr.ID != ids[0] {
+		t.Fatalf("step forward without a current track = %v, %v", tr, ok)
+	}
+	if tr, ok := st.PlaylistStep(-1); !ok || tr.ID != ids[2] {
+		t.Fatalf("step back without a current track = %v, %v", tr, ok)
+	}
+	_ = st.SelectTrack(ids[2])
+	if _, ok := st.PlaylistStep(1); ok {
+		t.Fatal("stepped past the end without repeat")
+	}
+	st.SetRepeat(RepeatAll)
+	if tr, ok := st.PlaylistStep(1); !ok || tr.ID != ids[0] {
+		t.Fatalf("step past the end with repeat = %v, %v", tr, ok)
+	}
+	_ = st.SelectTrack(ids[0])
+	if tr, ok := st.PlaylistStep(-1); !ok || tr.ID != ids[2] {
+		t.Fatalf("step before the start with repeat = %v, %v", tr, ok)
+	}
+}
+
+func TestTrackChangedAdvancesThroughThePlaylist(t *testing.T) {
+	st, fp := newEventState(t)
+	ids := insertTracks(t, st, "http://example/1.flac", "http://example/2.flac", "http://example/3.flac")
+	if err := st.SelectTrack(ids[0]); err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	st.SetTransportState(Playing)
+	count := st.Snapshot().TrackCount
+
+	fp.events <- player.Event{Type: player.EventDuration, Duration: 180}
+	waitFor(t, "duration", func() bool { return st.Snapshot().Duration == 180 })
+
+	fp.events <- player.Event{Type: player.EventTrackChanged, Path: "http://example/2.flac"}
+	waitFor(t, "advance", func() bool {
+		fp.mu.Lock()
+		defer fp.mu.Unlock()
+		return len(fp.nexts) == 1
+	})
+	snap := st.Snapshot()
+	if snap.Playlist.Current != ids[1] || snap.NextURI != "http://example/3.flac" {
+		t.Fatalf("after advance: current=%d next=%q", snap.Playlist.Current, snap.NextURI)
+	}
+	if snap.Duration != 0 || snap.TrackCount != count+1 {
+		t.Fatalf("after advance: duration=%v trackCount=%d, want 0 and %d", snap.Duration, snap.TrackCount, count+1)
+	}
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if fp.nexts[0] != "http://example/3.flac" {
+		t.Fatalf("player queued %q, want the third track", fp.nexts[0])
+	}
+}
+
+func TestPlaylistAppendMoveAndIndex(t *testing.T) {
+	st := newState(t, nil)
+	a, _ := st.PlaylistAppend("http://example/a.flac", "")
+	b, _ := st.PlaylistAppend("http://example/b.flac", "")
+	c, _ := st.PlaylistAppend("http://example/c.flac", "")
+	if pl := st.Snapshot().Playlist; !slices.Equal(pl.IDs, []uint32{a, b, c}) || pl.Index != -1 {
+		t.Fatalf("after append: ids=%v index=%d", pl.IDs, pl.Index)
+	}
+
+	_ = st.SelectTrack(a)
+	if next, _ := st.GetNextURI(); next != "http://example/b.flac" {
+		t.Fatalf("next=%q", next)
+	}
+	if err := st.PlaylistMove(c, a); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	pl := st.Snapshot().Playlist
+	if !slices.Equal(pl.IDs, []uint32{a, c, b}) || pl.Index != 0 {
+		t.Fatalf("after move: ids=%v index=%d", pl.IDs, pl.Index)
+	}
+	if next, _ := st.GetNextURI(); next != "http://example/c.flac" {
+		t.Fatalf("next=%q after moving c behind the current track", next)
+	}
+	if err := st.PlaylistMove(a, 0); err != nil || st.Snapshot().Playlist.Index != 0 {
+		t.Fatalf("move to the front: err=%v", err)
+	}
+	_ = st.PlaylistMove(a, b)
+	if pl := st.Snapshot().Playlist; !slices.Equal(pl.IDs, []uint32{c, b, a}) || pl.Index != 2 {
+		t.Fatalf("after moving the current track last: ids=%v index=%d", pl.IDs, pl.Index)
+	}
+	if err := st.PlaylistMove(a, 99); !errors.Is(err, ErrNoSuchTrack) {
+		t.Fatalf("move after unknown id: err=%v", err)
+	}
+}
+
+func TestShufflePlaysEveryTrackOnce(t *testing.T) {
+	st := newState(t, nil)
+	var uris []string
+	for i := range 20 {
+		uris = append(uris, fmt.Sprintf("http://example/%d.flac", i))
+	}
+	ids := insertTracks(t, st, uris...)
+	_ = st.SelectTrack(ids[5])
+	st.SetShuffle(true)
+	extra, _ := st.PlaylistAppend("http://example/extra.flac", "")
+
+	seen := map[uint32]bool{ids[5]: true}
+	for range ids {
+		tr, ok := st.PlaylistStep(1)
+		if !ok {
+			break
+		}
+		if seen[tr.ID] {
+			t.Fatalf("track %d played twice", tr.ID)
+		}
+		seen[tr.ID] = true
+		_ = st.SelectTrack(tr.ID)
+	}
+	if len(seen) != len(ids)+1 || !seen[extra] {
+		t.Fatalf("shuffle played %d of %d tracks", len(seen), len(ids)+1)
+	}
+	if _, ok := st.PlaylistStep(1); ok {
+		t.Fatal("shuffle without repeat went on past the last track")
+	}
+
+	st.SetShuffle(false)
+	_ = st.SelectTrack(ids[0])
+	if tr, _ := st.PlaylistStep(1); tr.ID != ids[1] {
+		t.Fatalf("after shuffle off, next = %d, want %d", tr.ID, ids[1])
+	}
+}
+
+func TestPlayModes(t *testing.T) {
+	st := newState(t, nil)
+	ids := insertTracks(t, st, "http://example/1.flac", "http://example/2.flac")
+	_ = st.SelectTrack(ids[1])
+
+	for _, c := range []struct {
+		mode    string
+		repeat  Repeat
+		shuffle bool
+		next    string
+	}{
+		{PlayModeRepeatAll, RepeatAll, false, "http://example/1.flac"},
+		{PlayModeRepeatOne, RepeatOne, false, ""},
+		{PlayModeShuffle, RepeatOff, true, "http://example/1.flac"},
+		{PlayModeNormal, RepeatOff, false, ""},
+	} {
+		if !st.SetPlayMode(c.mode) {
+			t.Fatalf("SetPlayMode(%s) refused", c.mode)
+		}
+		if st.Repeat() != c.repeat || st.Shuffle() != c.shuffle || st.PlayMode() != c.mode {
+			t.Fatalf("%s: repeat=%v shuffle=%v mode=%s", c.mode, st.Repeat(), st.Shuffle(), st.PlayMode())
+		}
+		if next, _ := st.GetNextURI(); next != c.next {
+			t.Fatalf("%s: next=%q, want %q", c.mode, next, c.next)
+		}
+	}
+	if st.SetPlayMode("RANDOM") {
+		t.Fatal("SetPlayMode accepted RANDOM")
+	}
+}
+
+func TestEndOfFileStartsTheFollowingTrack(t *testing.T) {
+	st, fp := newEventState(t)
+	ids := insertTracks(t, st, "http://example/1.flac", "http://example/2.flac")
+	_ = st.SelectTrack(ids[0])
+	st.SetTransportState(Playing)
+
+	// The player reached the end without advancing to the preloaded track.
+	fp.events <- player.Event{Type: player.EventEndOfFile}
+	waitFor(t, "advance", func() bool {
+		return st.PlaylistCurrent() == ids[1] && st.GetTransportState() == Playing
+	})
+	fp.mu.Lock()
+	plays := slices.Clone(fp.plays)
+	fp.mu.Unlock()
+	if !slices.Equal(plays, []string{"http://example/2.flac"}) {
+		t.Fatalf("plays=%v", plays)
+	}
+
+	// Repeating one track restarts it at its end.
+	st.SetRepeat(RepeatOne)
+	fp.events <- player.Event{Type: player.EventEndOfFile}
+	waitFor(t, "replay", func() bool {
+		fp.mu.Lock()
+		defer fp.mu.Unlock()
+		return len(fp.plays) == 2
+	})
+	waitFor(t, "playing", func() bool { return st.GetTransportState() == Playing })
+	if uri, _ := st.GetURI(); uri != "http://example/2.flac" || fp.plays[1] != uri {
+		t.Fatalf("repeat one played %v, current %q", fp.plays, uri)
+	}
+
+	// Without repeat the last track stops at its end.
+	st.SetRepeat(RepeatOff)
+	fp.events <- player.Event{Type: player.EventEndOfFile}
+	waitFor(t, "stop", func() bool { return st.GetTransportState() == Stopped })
+}
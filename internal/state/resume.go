@@ -0,0 +1,202 @@
+package state
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/fileutil"
+)
+
+// maxResumePositions bounds how many media the resume memory keeps; the
+// least recently played are forgotten first.
+const maxResumePositions = 200
+
+// SavedPosition is one resume-memory entry as written to disk.
+type SavedPosition struct {
+	Key      string  `json:"key"`
+	Position float64 `json:"position"`
+}
+
+// positionMemory is an LRU of playback positions keyed by resumeKey.
+// version counts changes so the persister can skip unchanged writes.
+type positionMemory struct {
+	order   *list.List // of *SavedPosition, most recent at the front
+	items   map[string]*list.Element
+	version int
+}
+
+func newPositionMemory() *positionMemory {
+	return &positionMemory{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (m *positionMemory) get(key string) float64 {
+	if e, ok := m.items[key]; ok {
+		return e.Value.(*SavedPosition).Position
+	}
+	return 0
+}
+
+func (m *positionMemory) put(key string, position float64) {
+	if e, ok := m.items[key]; ok {
+		e.Value.(*SavedPosition).Position = position
+		m.order.MoveToFront(e)
+	} else {
+		m.items[key] = m.order.PushFront(&SavedPosition{Key: key, Position: position})
+		for m.order.Len() > maxResumePositions {
+			oldest := m.order.Back()
+			m.order.Remove(oldest)
+			delete(m.items, oldest.Value.(*SavedPosition).Key)
+		}
+	}
+	m.version++
+}
+
+func (m *positionMemory) forget(key string) {
+	if e, ok := m.items[key]; ok {
+		m.order.Remove(e)
+		delete(m.items, key)
+		m.version++
+	}
+}
+
+// entries lists the memory oldest first, the order that rebuilds it.
+func (m *positionMemory) entries() []SavedPosition {
+	out := make([]SavedPosition, 0, m.order.Len())
+	for e := m.order.Back(); e != nil; e = e.Prev() {
+		out = append(out, *e.Value.(*SavedPosition))
+	}
+	return out
+}
+
+// signingParams are query parameters CDNs add to sign a URL or limit its
+// lifetime; they change between casts of the same media. Names are
+// lowercase.
+var signingParams = map[string]bool{
+	"sig": true, "sign": true, "signature": true, "token": true, "auth_key": true,
+	"expires": true, "expire": true, "deadline": true, "policy": true, "key-pair-id": true,
+	"hdnts": true, "hdnea": true, "wssecret": true, "wstime": true, "txsecret": true, "txtime": true,
+	"upsig": true, "uparams": true,
+}
+
+// signingPrefixes mark the cloud storage presigning parameters.
+var signingPrefixes = []string{"x-amz-", "x-goog-", "x-oss-"}
+
+func signingParam(name string) bool {
+	name = strings.ToLower(name)
+	if signingParams[name] {
+		return true
+	}
+	for _, p := range signingPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeKey identifies media across casts: the URI, whose query often names
+// the media, without its fragment and the signingParams that differ each
+// time a phone app re-signs the same episode. Titles such as "Episode 1"
+// repeat across shows, so the DIDL title only tells apart media behind the
+// same address, taking the place of the fragment.
+func resumeKey(uri, meta string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	u.Scheme, u.Host = strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	query := u.Query()
+	for name := range query {
+		if signingParam(name) {
+			delete(query, name)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.Fragment, u.RawFragment = didlText(meta, "title"), ""
+	return u.String()
+}
+
+// ResumePosition is the remembered position of the given media, 0 when none.
+func (s *PlayerState) ResumePosition(uri, meta string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.positions.get(resumeKey(uri, meta))
+}
+
+// rememberPositionLocked records the current media's position. Positions
+// are remembered, and persisted, even with ResumePositions off, so a
+// per-request override can still use them. Caller must hold s.mu.
+func (s *PlayerState) rememberPositionLocked(position float64) {
+	if s.transportURI == "" {
+		return
+	}
+	s.positions.put(resumeKey(s.transportURI, s.transportMeta), position)
+}
+
+// forgetPositionLocked drops the current media from resume memory once it
+// played to the end. Caller must hold s.mu.
+func (s *PlayerState) forgetPositionLocked() {
+	if s.transportURI != "" {
+		s.positions.forget(resumeKey(s.transportURI, s.transportMeta))
+	}
+}
+
+// LoadPositions reads resume memory written by PersistPositions.
+func LoadPositions(path string) ([]SavedPosition, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var saved []SavedPosition
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return saved, nil
+}
+
+// RestorePositions refills resume memory at startup, oldest entry first.
+func (s *PlayerState) RestorePositions(saved []SavedPosition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range saved {
+		if p.Key != "" && p.Position > 0 {
+			s.positions.put(p.Key, p.Position)
+		}
+	}
+}
+
+// PersistPositions writes resume memory to path like Persist writes the
+// renderer state: debounced, during playback at most once per
+// positionWriteInterval, and once more when ctx ends. It writes whether or
+// not ResumePositions is on, which only picks the default for Play.
+func (s *PlayerState) PersistPositions(ctx context.Context, path string, debounce time.Duration) {
+	s.mu.RLock()
+	last := s.positions.version
+	s.mu.RUnlock()
+	lastWrite := time.Now()
+	s.persistOnChange(ctx, debounce, func(final bool) {
+		s.mu.RLock()
+		version, entries := s.positions.version, s.positions.entries()
+		s.mu.RUnlock()
+		if version == last || (!final && s.deferPositionWrite(lastWrite)) {
+			return
+		}
+		b, err := json.Marshal(entries)
+		if err == nil {
+			err = fileutil.WriteAtomic(path, append(b, '\n'), 0o644)
+		}
+		if err != nil {
+			log.CtxWarn(s.ctx, "persist resume positions: %v", err)
+			return
+		}
+		last, lastWrite = version, time.Now()
+	})
+}
@@ -0,0 +1,148 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tr1v3r/rcast/internal/player"
+)
+
+func TestResumeKeyDropsSigningAndAddsTitle(t *testing.T) {
+	a := resumeKey("https://cdn.test/a.mp4?sig=1&Expires=10#t=3", "")
+	b := resumeKey("HTTPS://CDN.test/a.mp4?X-Amz-Signature=ab&sig=2", "")
+	if a != b || a != "https://cdn.test/a.mp4" {
+		t.Fatalf("untitled keys = %q, %q", a, b)
+	}
+	// Other parameters stay, in a stable order.
+	if a, b := resumeKey("https://cdn.test/stream?q=hd&id=1&token=x", ""), resumeKey("https://cdn.test/stream?id=1&q=hd", ""); a != b || a != "https://cdn.test/stream?id=1&q=hd" {
+		t.Fatalf("keys = %q, %q", a, b)
+	}
+
+	didl := func(title string) string {
+		return `<DIDL-Lite xmlns:dc="http://purl.org/dc/elements/1.1/"><item><dc:title>` + title + `</dc:title></item></DIDL-Lite>`
+	}
+	// A re-signed URL of the same episode keeps its key.
+	if a, b := resumeKey("https://cdn.test/a.mp4?sig=1", didl("Episode 1")), resumeKey("https://cdn.test/a.mp4?sig=2", didl("Episode 1")); a != b {
+		t.Fatalf("re-signed keys = %q, %q", a, b)
+	}
+	// Generic titles of different media do not collide, nor do different
+	// titles behind one address.
+	for _, pair := range [][2]string{
+		{resumeKey("https://cdn.test/show-a/1.mp4", didl("Episode 1")), resumeKey("https://cdn.test/show-b/1.mp4", didl("Episode 1"))},
+		{resumeKey("https://cdn.test/play?id=1", didl("第1集")), resumeKey("https://cdn.test/play?id=2", didl("第2集"))},
+	} {
+		if pair[0] == pair[1] {
+			t.Fatalf("distinct media share key %q", pair[0])
+		}
+	}
+}
+
+func TestMediaDifferingByQueryKeepSeparatePositions(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	for uri, position := range map[string]float64{"https://cdn.test/stream?id=1": 120, "https://cdn.test/stream?id=2": 45} {
+		st.SetURI(uri, "")
+		st.mu.Lock()
+		st.rememberPositionLocked(position)
+		st.mu.Unlock()
+	}
+	if a, b := st.ResumePosition("https://cdn.test/stream?id=1", ""), st.ResumePosition("https://cdn.test/stream?id=2", ""); a != 120 || b != 45 {
+		t.Fatalf("positions = %v, %v; want 120 and 45", a, b)
+	}
+	if got := st.ResumePosition("https://cdn.test/stream?id=3", ""); got != 0 {
+		t.Fatalf("unplayed id=3 resumes at %v", got)
+	}
+}
+
+func TestPositionMemoryEvictsLeastRecentlyPlayed(t *testing.T) {
+	m := newPositionMemory()
+	for i := range maxResumePositions + 1 {
+		m.put(fmt.Sprintf("k%d", i), float64(i+1))
+	}
+	if m.get("k0") != 0 {
+		t.Fatal("oldest entry survived past the bound")
+	}
+	// Touching k1 makes k2 the oldest.
+	m.put("k1", 99)
+	m.put("extra", 1)
+	if m.get("k1") != 99 || m.get("k2") != 0 {
+		t.Fatalf("k1=%v k2=%v", m.get("k1"), m.get("k2"))
+	}
+	entries := m.entries()
+	if len(entries) != maxResumePositions || entries[len(entries)-1].Key != "extra" {
+		t.Fatalf("entries: %d, newest %q", len(entries), entries[len(entries)-1].Key)
+	}
+}
+
+func TestPositionEventsFeedResumeMemory(t *testing.T) {
+	st, fp := newEventState(t)
+	const uri = "http://example/1.mp4?token=a"
+	st.SetURI(uri, "")
+	st.SetTransportState("PLAYING")
+
+	fp.events <- player.Event{Type: player.EventPosition, Position: 75}
+	waitFor(t, "position", func() bool { return st.ResumePosition("http://example/1.mp4?token=b", "") == 75 })
+
+	// Watching to the end forgets the entry.
+	fp.events <- player.Event{Type: player.EventEndOfFile}
+	waitFor(t, "forget", func() bool { return st.ResumePosition(uri, "") == 0 })
+}
+
+func TestPersistPositionsRoundTrip(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	st.ApplySettings(Settings{ResumePositions: true})
+	path := filepath.Join(t.TempDir(), "positions.json")
+
+	st.SetURI("http://example/1.mp4", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		st.PersistPositions(ctx, path, time.Hour)
+	}()
+	waitWatching(t, st)
+	st.mu.Lock()
+	st.rememberPositionLocked(120)
+	st.mu.Unlock()
+	cancel()
+	<-done
+
+	saved, err := LoadPositions(path)
+	if err != nil {
+		t.Fatalf("LoadPositions: %v", err)
+	}
+	next := newState(t, func() player.Player { return &fakePlayer{} })
+	next.RestorePositions(saved)
+	if got := next.ResumePosition("http://example/1.mp4", ""); got != 120 {
+		t.Fatalf("restored position = %v, want 120", got)
+	}
+}
+
+func TestPersistPositionsWritesWhenDisabled(t *testing.T) {
+	// A per-request override can resume even with the toggle off, so the
+	// memory is kept on disk either way.
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	path := filepath.Join(t.TempDir(), "positions.json")
+	st.SetURI("http://example/1.mp4", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		st.PersistPositions(ctx, path, time.Hour)
+	}()
+	waitWatching(t, st)
+	st.mu.Lock()
+	st.rememberPositionLocked(120)
+	st.mu.Unlock()
+	cancel()
+	<-done
+
+	saved, err := LoadPositions(path)
+	if err != nil || len(saved) != 1 || saved[0].Position != 120 {
+		t.Fatalf("LoadPositions = %+v, %v; want the position written with resume memory off", saved, err)
+	}
+}
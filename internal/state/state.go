@@ -2,15 +2,19 @@ package state
 
 import (
 	"context"
+	"encoding/xml"
 	"math"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/tr1v3r/pkg/log"
 
 	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/history"
 	"github.com/tr1v3r/rcast/internal/monitoring"
 	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/session"
 )
 
 const playerMaxIdle = 10 * time.Minute
@@ -26,17 +30,99 @@ type PlayerState struct {
 	player         player.Player
 	playerLastUsed time.Time
 	playerFactory  PlayerFactory
+	playerDone     chan struct{} // closed when player is taken; ends its event loop
 
 	transportURI   string
 	transportMeta  string
+	nextURI        string
+	nextMeta       string
 	transportState string
+	position       float64
+	duration       float64
+	trackCount     uint32 // tracks loaded so far, for OpenHome Time
+	speed          float64
 	volume         int
 	volumeMapping  volumeMapping
 	mute           bool
+	standby        bool
+	playlist       playlist
+	resume         Saved // last cast restored at startup, see LastCast
+	positions      *positionMemory
+	clock          playClock
+	history        *history.Log
 
 	sessionOwner string
 	sessionSince time.Time
 	sessionUsed  time.Time
+
+	watchMu  sync.Mutex
+	watchers map[chan struct{}]struct{}
+
+	// settingsMu is separate from mu because the player factory reads the
+	// settings while EnsurePlayer holds mu.
+	settingsMu     sync.RWMutex
+	settings       Settings
+	configID       int
+	configWatchers map[chan struct{}]struct{}
+}
+
+// Settings are the options a configuration reload can change while the
+// renderer runs. Actions read them on every request, so a reload takes effect
+// with the next one.
+type Settings struct {
+	AllowSessionPreempt    bool
+	LinkSystemOutputVolume bool
+	Fullscreen             bool
+	FriendlyName           string
+	Manufacturer           string
+	ModelName              string
+	Session                session.Policy
+	// ResumePositions seeks a fresh play to where the same media stopped,
+	// unless that is within ResumeMargin of its start or end.
+	ResumePositions bool
+	ResumeMargin    time.Duration
+}
+
+// describesDevice reports whether next changes what the device description
+// tells control points.
+func (set Settings) describesDevice(next Settings) bool {
+	return set.FriendlyName != next.FriendlyName ||
+		set.Manufacturer != next.Manufacturer ||
+		set.ModelName != next.ModelName
+}
+
+// SettingsFrom picks the runtime-reloadable options out of cfg.
+func SettingsFrom(cfg config.Config) Settings {
+	return Settings{
+		AllowSessionPreempt:    cfg.AllowSessionPreempt,
+		LinkSystemOutputVolume: cfg.LinkSystemOutputVolume,
+		Fullscreen:             cfg.IINAFullscreen,
+		FriendlyName:           cfg.FriendlyName,
+		Manufacturer:           cfg.Manufacturer,
+		ModelName:              cfg.ModelName,
+		Session:                cfg.Session,
+		ResumePositions:        cfg.ResumePositions,
+		ResumeMargin:           time.Duration(cfg.ResumeMarginSeconds) * time.Second,
+	}
+}
+
+// Snapshot is a consistent copy of the observable renderer state, taken under
+// a single read lock so observers never mix values from different updates.
+type Snapshot struct {
+	TransportState string
+	URI            string
+	Meta           string
+	NextURI        string
+	NextMeta       string
+	Position       float64
+	Duration       float64
+	TrackCount     uint32
+	Speed          float64
+	Volume         int
+	Mute           bool
+	Standby        bool
+	SessionOwner   string
+	Playlist       PlaylistSnapshot
 }
 
 type volumeMapping struct {
@@ -47,17 +133,29 @@ type volumeMapping struct {
 }
 
 func New(ctx context.Context, cfg config.Config) *PlayerState {
-	return NewWithPlayerFactory(ctx, cfg, func() player.Player {
-		return player.NewIINAPlayer(cfg.IINAFullscreen)
+	var s *PlayerState
+	s = NewWithPlayerFactory(ctx, cfg, func() player.Player {
+		fullscreen := s.Settings().Fullscreen
+		if cfg.Player == config.PlayerMPV {
+			return player.NewMPVPlayer(fullscreen, cfg.AudioDevice)
+		}
+		return player.NewIINAPlayer(fullscreen, cfg.AudioDevice)
 	})
+	return s
 }
 
-func NewWithPlayerFactory(ctx context.Context, _ config.Config, factory PlayerFactory) *PlayerState {
+func NewWithPlayerFactory(ctx context.Context, cfg config.Config, factory PlayerFactory) *PlayerState {
 	s := &PlayerState{
 		ctx:            ctx,
 		playerFactory:  factory,
-		transportState: "STOPPED",
+		transportState: NoMediaPresent,
+		speed:          1,
 		volume:         50,
+		positions:      newPositionMemory(),
+		watchers:       make(map[chan struct{}]struct{}),
+		settings:       SettingsFrom(cfg),
+		configID:       1,
+		configWatchers: make(map[chan struct{}]struct{}),
 	}
 	go s.reaper()
 	return s
@@ -65,6 +163,129 @@ func NewWithPlayerFactory(ctx context.Context, _ config.Config, factory PlayerFa
 
 func (s *PlayerState) Context() context.Context { return s.ctx }
 
+func (s *PlayerState) Settings() Settings {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.settings
+}
+
+// ApplySettings swaps in reloaded settings between actions. A fullscreen
+// change is pushed to the running player rather than waiting for the next
+// launch; a new name, manufacturer or model bumps ConfigID.
+func (s *PlayerState) ApplySettings(next Settings) {
+	s.Serialize(func() {
+		s.settingsMu.Lock()
+		prev := s.settings
+		s.settings = next
+		renamed := prev.describesDevice(next)
+		if renamed {
+			s.configID = s.configID%maxConfigID + 1
+		}
+		s.settingsMu.Unlock()
+
+		if renamed {
+			log.CtxInfo(s.ctx, "device description changed (friendly name %q); CONFIGID now %d", next.FriendlyName, s.ConfigID())
+			s.notifyConfig()
+		}
+		if prev.Fullscreen == next.Fullscreen {
+			return
+		}
+		if p := s.GetActivePlayer(); p != nil {
+			if err := p.SetFullscreen(s.ctx, next.Fullscreen); err != nil {
+				log.CtxWarn(s.ctx, "apply fullscreen setting: %v", err)
+			}
+		}
+	})
+}
+
+// maxConfigID is the largest CONFIGID.UPNP.ORG value UPnP 1.1 allows; the
+// counter wraps back to 1 past it.
+const maxConfigID = 1<<24 - 1
+
+// ConfigID is the CONFIGID.UPNP.ORG value for the device description. It
+// starts at 1 and changes whenever the description does, telling control
+// points to fetch it again.
+func (s *PlayerState) ConfigID() int {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.configID
+}
+
+// WatchConfig registers a listener signalled after every ConfigID change.
+// Signals coalesce like Watch's. The returned func unregisters the listener.
+func (s *PlayerState) WatchConfig() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	s.settingsMu.Lock()
+	s.configWatchers[ch] = struct{}{}
+	s.settingsMu.Unlock()
+	return ch, func() {
+		s.settingsMu.Lock()
+		delete(s.configWatchers, ch)
+		s.settingsMu.Unlock()
+	}
+}
+
+func (s *PlayerState) notifyConfig() {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	for ch := range s.configWatchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Snapshot returns the current observable state.
+func (s *PlayerState) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Snapshot{
+		TransportState: s.transportState,
+		URI:            s.transportURI,
+		Meta:           s.transportMeta,
+		NextURI:        s.nextURI,
+		NextMeta:       s.nextMeta,
+		Position:       s.position,
+		Duration:       s.duration,
+		TrackCount:     s.trackCount,
+		Speed:          s.speed,
+		Volume:         s.volume,
+		Mute:           s.mute,
+		Standby:        s.standby,
+		SessionOwner:   s.sessionOwner,
+		Playlist:       s.playlistSnapshotLocked(),
+	}
+}
+
+// Watch registers a change listener. The channel receives a signal after
+// every state mutation; signals coalesce, so a slow reader finds at most one
+// pending wake-up and must read Snapshot for the latest values. Mutators never
+// block on listeners. The returned func unregisters the listener.
+func (s *PlayerState) Watch() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	s.watchMu.Lock()
+	s.watchers[ch] = struct{}{}
+	s.watchMu.Unlock()
+	return ch, func() {
+		s.watchMu.Lock()
+		delete(s.watchers, ch)
+		s.watchMu.Unlock()
+	}
+}
+
+// notify wakes every listener registered through Watch.
+func (s *PlayerState) notify() {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	for ch := range s.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
 // Serialize ensures mutating UPnP actions execute in arrival order instead of
 // racing independent player goroutines.
 func (s *PlayerState) Serialize(fn func()) {
@@ -79,6 +300,8 @@ func (s *PlayerState) EnsurePlayer() player.Player {
 	s.playerLastUsed = time.Now()
 	if s.player == nil {
 		s.player = s.playerFactory()
+		s.playerDone = make(chan struct{})
+		go s.consumeEvents(s.player, s.playerDone)
 		monitoring.GetMetrics().RecordPlayerSession()
 	}
 	return s.player
@@ -106,6 +329,11 @@ func (s *PlayerState) takePlayer() player.Player {
 	p := s.player
 	s.player = nil
 	s.playerLastUsed = time.Time{}
+	s.speed = 1 // the next player starts at normal speed
+	if s.playerDone != nil {
+		close(s.playerDone)
+		s.playerDone = nil
+	}
 	s.mu.Unlock()
 	return p
 }
@@ -125,11 +353,14 @@ func (s *PlayerState) Stop() {
 		cancel()
 	}
 	s.mu.Lock()
+	ended := s.endPlayLocked()
 	s.sessionOwner = ""
 	s.sessionSince = time.Time{}
 	s.sessionUsed = time.Time{}
 	s.volumeMapping = volumeMapping{}
 	s.mu.Unlock()
+	s.record(ended)
+	s.notify()
 }
 
 func (s *PlayerState) reaper() {
@@ -162,7 +393,151 @@ func (s *PlayerState) reapExpiredPlayer() {
 	s.mu.Unlock()
 	if expired {
 		_ = s.StopPlayer()
+		s.notify()
+	}
+}
+
+// consumeEvents applies what the player reports on its own to the transport
+// state until the player is replaced or the renderer shuts down.
+func (s *PlayerState) consumeEvents(p player.Player, done <-chan struct{}) {
+	events := p.Events()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-done:
+			return
+		case ev := <-events:
+			s.applyEvent(p, ev)
+		}
+	}
+}
+
+func (s *PlayerState) applyEvent(p player.Player, ev player.Event) {
+	log.CtxDebug(s.ctx, "player event: %s", ev.Type)
+
+	s.mu.Lock()
+	if s.player != p {
+		s.mu.Unlock()
+		return
+	}
+	// TRANSITIONING belongs to the handler that is loading media; it sets
+	// the outcome itself once the player answers.
+	transitioning := s.transportState == Transitioning
+	active := s.transportState == Playing || s.transportState == PausedPlayback
+	changed := false
+	var ended *history.Entry
+	switch ev.Type {
+	case player.EventPaused:
+		if s.transportState == Playing {
+			s.setTransportStateLocked(PausedPlayback)
+			changed = true
+		}
+	case player.EventResumed:
+		if s.transportState == PausedPlayback {
+			s.setTransportStateLocked(Playing)
+			changed = true
+		}
+	case player.EventEndOfFile, player.EventIdle:
+		if ev.Type == player.EventEndOfFile {
+			s.forgetPositionLocked()
+			// The player ran out of entries, but the playlist goes on.
+			if t, ok := s.upcomingLocked(); ok && active {
+				ended = s.selectTrackLocked(t)
+				s.transportState = Transitioning
+				s.mu.Unlock()
+				s.record(ended)
+				s.notify()
+				go s.playUpcoming(p, t)
+				return
+			}
+		}
+		if active {
+			ended, changed = s.setTransportStateLocked(Stopped), true
+		}
+	case player.EventPosition:
+		if s.position != ev.Position {
+			s.position, changed = ev.Position, true
+			s.rememberPositionLocked(ev.Position)
+		}
+	case player.EventDuration:
+		if s.duration != ev.Duration {
+			s.duration, changed = ev.Duration, true
+		}
+	case player.EventTrackChanged:
+		if !transitioning && ev.Path == s.nextURI && ev.Path != "" {
+			ended = s.advanceToNextLocked()
+			s.mu.Unlock()
+			s.record(ended)
+			s.onTrackAdvanced(p, ev.Path)
+			return
+		}
+	}
+	s.mu.Unlock()
+	s.record(ended)
+	if changed {
+		s.notify()
+	}
+}
+
+// advanceToNextLocked promotes the queued next URI after the player moved on
+// to it, which mpv does by itself when the current playlist entry ends. A
+// playlist track queues the one after it in turn. It returns the history
+// entry ending the previous media. Caller must hold s.mu.
+func (s *PlayerState) advanceToNextLocked() *history.Entry {
+	ended := s.endPlayLocked()
+	s.transportURI, s.transportMeta = s.nextURI, s.nextMeta
+	s.nextURI, s.nextMeta = "", ""
+	s.transportState = Playing
+	s.clock = playClock{running: true, since: time.Now()}
+	s.position, s.duration = 0, 0
+	s.trackCount++
+	s.playlist.current, s.playlist.queued = s.playlist.queued, 0
+	s.requeueLocked()
+	return ended
+}
+
+// playUpcoming starts the playlist track the state moved on to when the
+// previous one reached its end, which is how a repeated track restarts and
+// how playback goes on when the player had nothing preloaded. It gives way
+// to any action that replaced the track in the meantime.
+func (s *PlayerState) playUpcoming(p player.Player, t Track) {
+	s.Serialize(func() {
+		s.mu.RLock()
+		current := s.player == p && s.transportState == Transitioning && s.playlist.current == t.ID
+		volume := s.volume
+		s.mu.RUnlock()
+		if !current {
+			return
+		}
+		if err := p.Play(s.ctx, t.URI, volume); err != nil {
+			log.CtxError(s.ctx, "play next playlist track: %v", err)
+			monitoring.GetMetrics().RecordPlayerError()
+			s.SetTransportState(Stopped)
+			return
+		}
+		s.SetTransportState(Playing)
+		s.onTrackAdvanced(p, t.URI)
+	})
+}
+
+func (s *PlayerState) onTrackAdvanced(p player.Player, path string) {
+	log.CtxInfo(s.ctx, "advanced to next track: %s", path)
+	_, meta := s.GetURI()
+	next, _ := s.GetNextURI()
+	// force-media-title outlives the entry it was set for; an empty title
+	// hands naming back to mpv.
+	ctx, cancel := context.WithTimeout(s.ctx, 2*time.Second)
+	defer cancel()
+	if err := p.SetTitle(ctx, didlText(meta, "title")); err != nil {
+		log.CtxWarn(s.ctx, "set media title for next track: %v", err)
+	}
+	if next != "" {
+		if err := p.SetNext(ctx, next); err != nil {
+			log.CtxWarn(s.ctx, "queue next playlist track: %v", err)
+		}
 	}
+	s.notify()
 }
 
 func (s *PlayerState) GetURI() (string, string) {
@@ -171,18 +546,59 @@ func (s *PlayerState) GetURI() (string, string) {
 	return s.transportURI, s.transportMeta
 }
 
+// SetURI replaces the current media, stopped, with nothing queued after it.
+// Media set this way is not part of the playlist.
 func (s *PlayerState) SetURI(uri, meta string) {
+	defer s.notify()
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	ended := s.setURILocked(uri, meta)
+	s.playlist.current, s.playlist.queued = 0, 0
+	s.mu.Unlock()
+	s.record(ended)
+}
+
+// setURILocked loads uri as the current media and returns the history entry
+// ending the previous one. Caller must hold s.mu.
+func (s *PlayerState) setURILocked(uri, meta string) *history.Entry {
+	ended := s.endPlayLocked()
 	s.transportURI = uri
 	s.transportMeta = meta
-	s.transportState = "STOPPED"
+	s.nextURI = ""
+	s.nextMeta = ""
+	s.transportState = Stopped
+	if uri == "" {
+		s.transportState = NoMediaPresent
+	} else {
+		s.trackCount++
+	}
+	s.position, s.duration = 0, 0
+	return ended
 }
 
-func (s *PlayerState) SetTransportState(st string) {
+func (s *PlayerState) GetNextURI() (string, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nextURI, s.nextMeta
+}
+
+// SetNextURI records the entry to play after the current one; an empty uri
+// clears it. It takes the place of any queued playlist track, and playback
+// leaves the playlist once it gets there.
+func (s *PlayerState) SetNextURI(uri, meta string) {
+	defer s.notify()
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.transportState = st
+	s.nextURI = uri
+	s.nextMeta = meta
+	s.playlist.queued = 0
+}
+
+func (s *PlayerState) SetTransportState(st string) {
+	defer s.notify()
+	s.mu.Lock()
+	ended := s.setTransportStateLocked(st)
+	s.mu.Unlock()
+	s.record(ended)
 }
 
 func (s *PlayerState) GetTransportState() string {
@@ -191,6 +607,20 @@ func (s *PlayerState) GetTransportState() string {
 	return s.transportState
 }
 
+// GetSpeed is the playback speed the player was last set to, 1 for normal.
+func (s *PlayerState) GetSpeed() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.speed
+}
+
+func (s *PlayerState) SetSpeed(speed float64) {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.speed = speed
+}
+
 func (s *PlayerState) GetVolume() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -198,6 +628,7 @@ func (s *PlayerState) GetVolume() int {
 }
 
 func (s *PlayerState) SetVolume(v int) {
+	defer s.notify()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.volume = v
@@ -214,6 +645,7 @@ func (s *PlayerState) PreviewVolumeRequest(controller string, requested int, sca
 }
 
 func (s *PlayerState) CommitVolumeRequest(controller string, requested int, scale float64) int {
+	defer s.notify()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	applied, mapping := mapVolumeRequest(s.volume, s.volumeMapping, controller, requested, scale)
@@ -256,11 +688,27 @@ func (s *PlayerState) GetMute() bool {
 }
 
 func (s *PlayerState) SetMute(m bool) {
+	defer s.notify()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.mute = m
 }
 
+// Standby reports whether a control point put the renderer in standby
+// through the OpenHome Product service.
+func (s *PlayerState) Standby() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.standby
+}
+
+func (s *PlayerState) SetStandby(on bool) {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.standby = on
+}
+
 func (s *PlayerState) HasSession(controller string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -271,6 +719,20 @@ func (s *PlayerState) HasSession(controller string) bool {
 // an existing controller was displaced. The caller must stop the old player
 // when preempted before executing the new action.
 func (s *PlayerState) AcquireSession(controller string, allowPreempt bool) (acquired, preempted bool) {
+	return s.AcquireSessionFunc(controller, func(string, time.Duration) bool { return allowPreempt })
+}
+
+// PreemptFunc decides whether a controller may displace owner, which last
+// acted idle ago.
+type PreemptFunc func(owner string, idle time.Duration) bool
+
+// AcquireSessionFunc is AcquireSession with the preemption decision made by
+// mayPreempt, under the same lock that checks the owner. mayPreempt is only
+// called when another controller holds the session.
+func (s *PlayerState) AcquireSessionFunc(controller string, mayPreempt PreemptFunc) (acquired, preempted bool) {
+	defer s.notify()
+	var ended *history.Entry
+	defer func() { s.record(ended) }()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.sessionOwner == "" {
@@ -285,19 +747,23 @@ func (s *PlayerState) AcquireSession(controller string, allowPreempt bool) (acqu
 		s.sessionUsed = time.Now()
 		return true, false
 	}
-	if !allowPreempt {
+	if !mayPreempt(s.sessionOwner, time.Since(s.sessionUsed)) {
 		return false, false
 	}
+	// The displaced owner's cast ends under its name.
+	if s.transportState != NoMediaPresent {
+		ended = s.setTransportStateLocked(Stopped)
+	}
 	now := time.Now()
 	s.sessionOwner = controller
 	s.sessionSince = now
 	s.sessionUsed = now
-	s.transportState = "STOPPED"
 	s.volumeMapping = volumeMapping{}
 	return true, true
 }
 
 func (s *PlayerState) ReleaseSession(controller string) {
+	defer s.notify()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.sessionOwner != controller {
@@ -314,3 +780,23 @@ func (s *PlayerState) GetSessionOwner() string {
 	defer s.mu.RUnlock()
 	return s.sessionOwner
 }
+
+// didlText returns the text of the first element with the given local name
+// in a DIDL-Lite document, such as "title" or "class", or "" when the
+// metadata is empty or malformed.
+func didlText(meta, name string) string {
+	dec := xml.NewDecoder(strings.NewReader(meta))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == name {
+			var text string
+			if err := dec.DecodeElement(&text, &se); err != nil {
+				return ""
+			}
+			return strings.TrimSpace(text)
+		}
+	}
+}
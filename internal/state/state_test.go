@@ -3,6 +3,7 @@ package state
 import (
 	"context"
 	"errors"
+	"reflect"
 	"runtime"
 	"sync"
 	"testing"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/tr1v3r/rcast/internal/config"
 	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/session"
 )
 
 type fakePlayer struct {
@@ -17,9 +19,20 @@ type fakePlayer struct {
 	stopped        int
 	stopErr        error
 	stopContextErr error
+	path           string
+	titles         []string
+	fullscreen     []bool
+	nexts          []string
+	plays          []string
+	events         chan player.Event
 }
 
-func (p *fakePlayer) Play(context.Context, string, int) error { return nil }
+func (p *fakePlayer) Play(_ context.Context, uri string, _ int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.plays = append(p.plays, uri)
+	return nil
+}
 
 func (p *fakePlayer) Pause(context.Context) error { return nil }
 
@@ -29,9 +42,19 @@ func (p *fakePlayer) SetVolume(context.Context, int) error { return nil }
 
 func (p *fakePlayer) SetMute(context.Context, bool) error { return nil }
 
-func (p *fakePlayer) SetFullscreen(context.Context, bool) error { return nil }
+func (p *fakePlayer) SetFullscreen(_ context.Context, f bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fullscreen = append(p.fullscreen, f)
+	return nil
+}
 
-func (p *fakePlayer) SetTitle(context.Context, string) error { return nil }
+func (p *fakePlayer) SetTitle(_ context.Context, title string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.titles = append(p.titles, title)
+	return nil
+}
 
 func (p *fakePlayer) Screenshot(context.Context, string) error { return nil }
 
@@ -39,10 +62,35 @@ func (p *fakePlayer) SetSpeed(context.Context, float64) error { return nil }
 
 func (p *fakePlayer) Seek(context.Context, float64) error { return nil }
 
+func (p *fakePlayer) SeekPercent(context.Context, float64) error { return nil }
+
 func (p *fakePlayer) GetPosition(context.Context) (float64, error) { return 0, nil }
 
 func (p *fakePlayer) GetDuration(context.Context) (float64, error) { return 0, nil }
 
+func (p *fakePlayer) GetMediaInfo(context.Context) (player.MediaInfo, error) {
+	return player.MediaInfo{}, nil
+}
+
+func (p *fakePlayer) GetFileSize(context.Context) (int64, error) { return 0, nil }
+
+func (p *fakePlayer) SetNext(_ context.Context, uri string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nexts = append(p.nexts, uri)
+	return nil
+}
+
+func (p *fakePlayer) GetPath(context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.path, nil
+}
+
+func (p *fakePlayer) AddSubtitles(context.Context, []string) error { return nil }
+
+func (p *fakePlayer) Events() <-chan player.Event { return p.events }
+
 func (p *fakePlayer) Stop(ctx context.Context) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -146,6 +194,20 @@ func TestStopUsesLiveCleanupContextAfterAppCancellation(t *testing.T) {
 
 // --- Player creation / idempotence ---
 
+func TestNewBuildsConfiguredBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mpv := New(ctx, config.Config{Player: config.PlayerMPV})
+	if _, ok := mpv.playerFactory().(*player.MPVPlayer); !ok {
+		t.Fatalf("Player=mpv built %T", mpv.playerFactory())
+	}
+	iina := New(ctx, config.Config{Player: config.PlayerIINA})
+	if _, ok := iina.playerFactory().(*player.IINAPlayer); !ok {
+		t.Fatalf("Player=iina built %T", iina.playerFactory())
+	}
+}
+
 func TestEnsurePlayerIdempotent(t *testing.T) {
 	created := 0
 	st := newState(t, func() player.Player {
@@ -476,7 +538,9 @@ func TestAcquireSessionPreemptDisabledRejects(t *testing.T) {
 
 func TestAcquireSessionPreemptEnabledDisplaces(t *testing.T) {
 	st := newState(t, func() player.Player { return &fakePlayer{} })
+	st.SetURI("http://example/foo.mp4", "")
 	st.AcquireSession("alpha", false)
+	st.SetTransportState(Playing)
 	acquired, preempted := st.AcquireSession("beta", true)
 	if !acquired || !preempted {
 		t.Fatalf("preempt-enabled other controller = (%v, %v), want (true,true)", acquired, preempted)
@@ -490,6 +554,31 @@ func TestAcquireSessionPreemptEnabledDisplaces(t *testing.T) {
 	}
 }
 
+func TestAcquireSessionFuncSeesOwnerIdleTime(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	called := false
+	st.AcquireSessionFunc("alpha", func(string, time.Duration) bool {
+		called = true
+		return true
+	})
+	if called {
+		t.Fatal("preempt decision consulted for a free session")
+	}
+
+	var gotOwner string
+	var gotIdle time.Duration
+	acquired, preempted := st.AcquireSessionFunc("beta", func(owner string, idle time.Duration) bool {
+		gotOwner, gotIdle = owner, idle
+		return false
+	})
+	if acquired || preempted {
+		t.Fatalf("refused preempt = (%v, %v), want (false,false)", acquired, preempted)
+	}
+	if gotOwner != "alpha" || gotIdle < 0 || gotIdle > time.Minute {
+		t.Fatalf("decision saw owner=%q idle=%v", gotOwner, gotIdle)
+	}
+}
+
 func TestReleaseSessionNonOwnerNoop(t *testing.T) {
 	st := newState(t, func() player.Player { return &fakePlayer{} })
 	st.AcquireSession("alpha", false)
@@ -521,8 +610,8 @@ func TestURIAndTransportState(t *testing.T) {
 	if u, m := st.GetURI(); u != "" || m != "" {
 		t.Fatalf("initial URI = (%q,%q), want empty", u, m)
 	}
-	if ts := st.GetTransportState(); ts != "STOPPED" {
-		t.Fatalf("initial transport state = %q, want STOPPED", ts)
+	if ts := st.GetTransportState(); ts != NoMediaPresent {
+		t.Fatalf("initial transport state = %q, want NO_MEDIA_PRESENT", ts)
 	}
 	st.SetURI("http://example/foo.mp4", "<meta/>")
 	if u, m := st.GetURI(); u != "http://example/foo.mp4" || m != "<meta/>" {
@@ -537,6 +626,132 @@ func TestURIAndTransportState(t *testing.T) {
 	}
 }
 
+func TestSetURIClearsNextURI(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	st.SetURI("http://example/1.flac", "")
+	st.SetNextURI("http://example/2.flac", "<meta/>")
+	if u, m := st.GetNextURI(); u != "http://example/2.flac" || m != "<meta/>" {
+		t.Fatalf("GetNextURI = (%q,%q)", u, m)
+	}
+	st.SetURI("http://example/3.flac", "")
+	if u, m := st.GetNextURI(); u != "" || m != "" {
+		t.Fatalf("SetURI should drop the queued next URI; got (%q,%q)", u, m)
+	}
+}
+
+// waitFor polls cond until it holds, failing after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newEventState returns a state with a live context, so the player event
+// loop keeps running, and a player whose events the test injects.
+func newEventState(t *testing.T) (*PlayerState, *fakePlayer) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	fp := &fakePlayer{events: make(chan player.Event)}
+	st := NewWithPlayerFactory(ctx, config.Config{}, func() player.Player { return fp })
+	st.EnsurePlayer()
+	return st, fp
+}
+
+func TestPlayerEventsDriveTransportState(t *testing.T) {
+	st, fp := newEventState(t)
+	st.SetURI("http://example/1.mp4", "")
+
+	// The handler loading media owns TRANSITIONING.
+	st.SetTransportState("TRANSITIONING")
+	fp.events <- player.Event{Type: player.EventIdle}
+	fp.events <- player.Event{Type: player.EventPaused}
+	fp.events <- player.Event{Type: player.EventPosition, Position: 3}
+	waitFor(t, "position", func() bool { return st.Snapshot().Position == 3 })
+	if got := st.GetTransportState(); got != "TRANSITIONING" {
+		t.Fatalf("transport state = %q, want TRANSITIONING untouched", got)
+	}
+
+	st.SetTransportState("PLAYING")
+	steps := []struct {
+		ev   player.EventType
+		want string
+	}{
+		{player.EventPaused, "PAUSED_PLAYBACK"},
+		{player.EventResumed, "PLAYING"},
+		{player.EventEndOfFile, "STOPPED"},
+		{player.EventResumed, "STOPPED"},
+	}
+	for _, step := range steps {
+		fp.events <- player.Event{Type: step.ev}
+		waitFor(t, step.want, func() bool { return st.GetTransportState() == step.want })
+	}
+
+	st.SetTransportState("PLAYING")
+	fp.events <- player.Event{Type: player.EventIdle}
+	waitFor(t, "idle to stop", func() bool { return st.GetTransportState() == "STOPPED" })
+}
+
+func TestTrackChangedEventPromotesNextURI(t *testing.T) {
+	st, fp := newEventState(t)
+	st.SetURI("http://example/1.flac", "")
+	st.SetNextURI("http://example/2.flac", `<DIDL-Lite xmlns:dc="http://purl.org/dc/elements/1.1/"><item><dc:title>Track Two</dc:title></item></DIDL-Lite>`)
+	st.SetTransportState("PLAYING")
+
+	// A path that is not the queued entry leaves everything alone.
+	fp.events <- player.Event{Type: player.EventTrackChanged, Path: "http://example/other.flac"}
+	fp.events <- player.Event{Type: player.EventPosition, Position: 42}
+	waitFor(t, "position", func() bool { return st.Snapshot().Position == 42 })
+	if u, _ := st.GetURI(); u != "http://example/1.flac" {
+		t.Fatalf("URI = %q, want unchanged", u)
+	}
+
+	fp.events <- player.Event{Type: player.EventTrackChanged, Path: "http://example/2.flac"}
+	waitFor(t, "promotion", func() bool {
+		fp.mu.Lock()
+		defer fp.mu.Unlock()
+		return len(fp.titles) == 1
+	})
+	snap := st.Snapshot()
+	if snap.URI != "http://example/2.flac" || snap.NextURI != "" || snap.NextMeta != "" {
+		t.Fatalf("after advance: URI=%q next=(%q,%q)", snap.URI, snap.NextURI, snap.NextMeta)
+	}
+	if snap.TransportState != "PLAYING" || snap.Position != 0 {
+		t.Fatalf("after advance: state=%q position=%v", snap.TransportState, snap.Position)
+	}
+	fp.mu.Lock()
+	title := fp.titles[0]
+	fp.mu.Unlock()
+	if title != "Track Two" {
+		t.Fatalf("title = %q, want Track Two", title)
+	}
+}
+
+func TestEventLoopEndsWhenPlayerIsTaken(t *testing.T) {
+	st, fp := newEventState(t)
+	st.SetTransportState("PLAYING")
+	if err := st.StopPlayer(); err != nil {
+		t.Fatalf("StopPlayer: %v", err)
+	}
+	// The loop may still pick up an event it raced with; it must be ignored,
+	// and the loop must then stop receiving.
+	for exited := false; !exited; {
+		select {
+		case fp.events <- player.Event{Type: player.EventPaused}:
+		case <-time.After(20 * time.Millisecond):
+			exited = true
+		}
+	}
+	if got := st.GetTransportState(); got != "PLAYING" {
+		t.Fatalf("transport state = %q, want PLAYING", got)
+	}
+}
+
 func TestVolumeGetSet(t *testing.T) {
 	st := newState(t, func() player.Player { return &fakePlayer{} })
 	if v := st.GetVolume(); v != 50 {
@@ -583,3 +798,123 @@ func TestSerializeRunsMutatorsInOrder(t *testing.T) {
 		runtime.Gosched()
 	}
 }
+
+// --- Change notification ---
+
+func TestWatchSignalsMutationsAndCoalesces(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	changes, unwatch := st.Watch()
+
+	st.SetURI("https://example.test/a.mp4", "meta")
+	st.SetVolume(30)
+	st.SetMute(true)
+	select {
+	case <-changes:
+	default:
+		t.Fatal("no change signal after mutations")
+	}
+	select {
+	case <-changes:
+		t.Fatal("signals did not coalesce into one pending wake-up")
+	default:
+	}
+
+	snap := st.Snapshot()
+	if snap.URI != "https://example.test/a.mp4" || snap.Meta != "meta" || snap.Volume != 30 || !snap.Mute || snap.TransportState != "STOPPED" {
+		t.Fatalf("snapshot=%+v", snap)
+	}
+
+	unwatch()
+	st.SetTransportState("PLAYING")
+	select {
+	case <-changes:
+		t.Fatal("signal delivered after unwatch")
+	default:
+	}
+}
+
+func TestSettingsSeededFromConfig(t *testing.T) {
+	st := NewWithPlayerFactory(context.Background(), config.Config{
+		AllowSessionPreempt: true,
+		IINAFullscreen:      true,
+		FriendlyName:        "Den",
+		Session:             session.Policy{Trusted: []string{"10.0.0.9"}},
+	}, func() player.Player { return &fakePlayer{} })
+	got := st.Settings()
+	want := Settings{AllowSessionPreempt: true, Fullscreen: true, FriendlyName: "Den", Session: session.Policy{Trusted: []string{"10.0.0.9"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("settings = %+v, want %+v", got, want)
+	}
+}
+
+func TestApplySettingsPushesFullscreenToActivePlayer(t *testing.T) {
+	fake := &fakePlayer{}
+	st := newState(t, func() player.Player { return fake })
+	st.EnsurePlayer()
+
+	st.ApplySettings(Settings{AllowSessionPreempt: true})
+	if len(fake.fullscreen) != 0 {
+		t.Fatalf("fullscreen calls = %v, want none when fullscreen is unchanged", fake.fullscreen)
+	}
+	st.ApplySettings(Settings{AllowSessionPreempt: true, Fullscreen: true})
+	if len(fake.fullscreen) != 1 || !fake.fullscreen[0] {
+		t.Fatalf("fullscreen calls = %v, want [true]", fake.fullscreen)
+	}
+	if !st.Settings().AllowSessionPreempt || !st.Settings().Fullscreen {
+		t.Fatalf("settings = %+v", st.Settings())
+	}
+}
+
+func TestApplySettingsWithoutPlayer(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	st.ApplySettings(Settings{Fullscreen: true})
+	if st.GetActivePlayer() != nil {
+		t.Fatal("ApplySettings launched a player")
+	}
+	if !st.Settings().Fullscreen {
+		t.Fatal("fullscreen setting not stored")
+	}
+}
+
+func TestApplySettingsBumpsConfigIDOnRename(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	changes, stop := st.WatchConfig()
+	defer stop()
+	if st.ConfigID() != 1 {
+		t.Fatalf("initial ConfigID = %d, want 1", st.ConfigID())
+	}
+
+	st.ApplySettings(Settings{AllowSessionPreempt: true})
+	if st.ConfigID() != 1 {
+		t.Fatalf("ConfigID = %d after a non-description change, want 1", st.ConfigID())
+	}
+	select {
+	case <-changes:
+		t.Fatal("config watcher signalled without a description change")
+	default:
+	}
+
+	st.ApplySettings(Settings{AllowSessionPreempt: true, FriendlyName: "Den"})
+	if st.ConfigID() != 2 {
+		t.Fatalf("ConfigID = %d after rename, want 2", st.ConfigID())
+	}
+	select {
+	case <-changes:
+	default:
+		t.Fatal("config watcher not signalled after rename")
+	}
+
+	st.ApplySettings(Settings{AllowSessionPreempt: true, FriendlyName: "Den", ModelName: "Box"})
+	if st.ConfigID() != 3 {
+		t.Fatalf("ConfigID = %d after model change, want 3", st.ConfigID())
+	}
+}
+
+func TestConfigIDWraps(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	st.configID = maxConfigID
+	st.ApplySettings(Settings{FriendlyName: "Den"})
+	if st.ConfigID() != 1 {
+		t.Fatalf("ConfigID = %d, want wrap to 1", st.ConfigID())
+	}
+}
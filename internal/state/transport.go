@@ -0,0 +1,89 @@
+package state
+
+import "slices"
+
+// AVTransport transport states.
+const (
+	NoMediaPresent = "NO_MEDIA_PRESENT"
+	Stopped        = "STOPPED"
+	Playing        = "PLAYING"
+	PausedPlayback = "PAUSED_PLAYBACK"
+	Transitioning  = "TRANSITIONING"
+)
+
+// TransportStates are the states the renderer moves through, as listed in
+// the AVTransport SCPD.
+var TransportStates = []string{Stopped, Playing, PausedPlayback, Transitioning, NoMediaPresent}
+
+// AVTransport actions whose availability depends on the transport state, as
+// GetCurrentTransportActions names them. SetAVTransportURI and the queries
+// are legal in every state.
+const (
+	ActionPlay  = "Play"
+	ActionStop  = "Stop"
+	ActionPause = "Pause"
+	ActionSeek  = "Seek"
+	// Next and Previous step through the playlist; they are available while
+	// a playlist track is selected and has a neighbour in that direction.
+	ActionNext     = "Next"
+	ActionPrevious = "Previous"
+)
+
+// AVTransport play modes, which map onto the playlist's repeat and shuffle
+// modes.
+const (
+	PlayModeNormal    = "NORMAL"
+	PlayModeShuffle   = "SHUFFLE"
+	PlayModeRepeatOne = "REPEAT_ONE"
+	PlayModeRepeatAll = "REPEAT_ALL"
+)
+
+// PlayModes are the play modes SetPlayMode accepts, as listed in the
+// AVTransport SCPD.
+var PlayModes = []string{PlayModeNormal, PlayModeShuffle, PlayModeRepeatOne, PlayModeRepeatAll}
+
+// transportActions lists the actions each transport state allows. Play stays
+// legal while PLAYING to change the speed, and Stop while STOPPED, where it
+// only hands the session back. Without media there is nothing to act on, and
+// TRANSITIONING can only be abandoned.
+var transportActions = map[string][]string{
+	NoMediaPresent: nil,
+	Stopped:        {ActionPlay, ActionStop},
+	Playing:        {ActionPlay, ActionPause, ActionStop, ActionSeek},
+	PausedPlayback: {ActionPlay, ActionStop, ActionSeek},
+	Transitioning:  {ActionStop},
+}
+
+// actionsIn reports the actions transportState allows, in
+// CurrentTransportActions order.
+func actionsIn(transportState string) []string {
+	return append([]string(nil), transportActions[transportState]...)
+}
+
+// TransportActions reports the actions snap allows: those of its transport
+// state, plus stepping through the playlist while there is media that is
+// not still loading.
+func (snap Snapshot) TransportActions() []string {
+	actions := actionsIn(snap.TransportState)
+	if len(actions) == 0 || snap.TransportState == Transitioning {
+		return actions
+	}
+	if snap.Playlist.HasNext {
+		actions = append(actions, ActionNext)
+	}
+	if snap.Playlist.HasPrevious {
+		actions = append(actions, ActionPrevious)
+	}
+	return actions
+}
+
+// TransportActions reports the actions the current state allows.
+func (s *PlayerState) TransportActions() []string {
+	return s.Snapshot().TransportActions()
+}
+
+// Allows reports whether action is legal in the current state. Illegal
+// actions are answered with 701 Transition not available.
+func (s *PlayerState) Allows(action string) bool {
+	return slices.Contains(s.TransportActions(), action)
+}
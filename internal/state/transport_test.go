@@ -0,0 +1,69 @@
+package state
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/tr1v3r/rcast/internal/player"
+)
+
+func TestTransportActionsFollowTheState(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	for _, c := range []struct {
+		set     func()
+		want    string
+		actions []string
+	}{
+		{func() {}, NoMediaPresent, nil},
+		{func() { st.SetURI("http://example/1.mp4", "") }, Stopped, []string{ActionPlay, ActionStop}},
+		{func() { st.SetTransportState(Transitioning) }, Transitioning, []string{ActionStop}},
+		{func() { st.SetTransportState(Playing) }, Playing, []string{ActionPlay, ActionPause, ActionStop, ActionSeek}},
+		{func() { st.SetTransportState(PausedPlayback) }, PausedPlayback, []string{ActionPlay, ActionStop, ActionSeek}},
+		{func() { st.SetURI("", "") }, NoMediaPresent, nil},
+	} {
+		c.set()
+		if got := st.GetTransportState(); got != c.want {
+			t.Fatalf("state = %s, want %s", got, c.want)
+		}
+		if got := st.TransportActions(); !slices.Equal(got, c.actions) {
+			t.Errorf("%s actions = %v, want %v", c.want, got, c.actions)
+		}
+		for _, a := range []string{ActionPlay, ActionStop, ActionPause, ActionSeek} {
+			if st.Allows(a) != slices.Contains(c.actions, a) {
+				t.Errorf("%s: Allows(%s) = %v", c.want, a, st.Allows(a))
+			}
+		}
+	}
+}
+
+func TestNextAndPreviousFollowThePlaylist(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	ids := insertTracks(t, st, "http://example/1.flac", "http://example/2.flac")
+	if st.Allows(ActionNext) {
+		t.Fatal("Next allowed without a selected track")
+	}
+	_ = st.SelectTrack(ids[0])
+	if got := st.TransportActions(); !slices.Equal(got, []string{ActionPlay, ActionStop, ActionNext}) {
+		t.Fatalf("first track actions = %v", got)
+	}
+	_ = st.SelectTrack(ids[1])
+	st.SetTransportState(Transitioning)
+	if st.Allows(ActionPrevious) {
+		t.Fatal("Previous allowed while TRANSITIONING")
+	}
+	st.SetTransportState(Playing)
+	if !st.Allows(ActionPrevious) || st.Allows(ActionNext) {
+		t.Fatalf("last track actions = %v", st.TransportActions())
+	}
+}
+
+func TestPreemptWithoutMediaKeepsNoMediaPresent(t *testing.T) {
+	st := newState(t, func() player.Player { return &fakePlayer{} })
+	st.AcquireSession("alpha", false)
+	if _, preempted := st.AcquireSession("beta", true); !preempted {
+		t.Fatal("beta did not preempt")
+	}
+	if got := st.GetTransportState(); got != NoMediaPresent {
+		t.Fatalf("state = %s, want NO_MEDIA_PRESENT", got)
+	}
+}
@@ -0,0 +1,554 @@
+package upnp
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/history"
+	"github.com/tr1v3r/rcast/internal/monitoring"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/quirk"
+	"github.com/tr1v3r/rcast/internal/session"
+	"github.com/tr1v3r/rcast/internal/state"
+)
+
+// Error is a failed action carrying its UPnP error code. SOAP handlers render
+// it as a UPnPError fault; the REST API reports the same code in JSON.
+type Error struct {
+	Code        int
+	Description string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("UPnP error %d: %s", e.Code, e.Description) }
+
+var (
+	ErrInvalidAction         = &Error{401, "Invalid Action"}
+	ErrInvalidArgs           = &Error{402, "Invalid Args"}
+	ErrActionFailed          = &Error{501, "Action Failed"}
+	ErrTransitionNotAllowed  = &Error{701, "Transition not available"}
+	ErrSeekModeNotSupported  = &Error{710, "Seek mode not supported"}
+	ErrIllegalSeekTarget     = &Error{711, "Illegal seek target"}
+	ErrSessionInUse          = &Error{712, "Session in use"}
+	ErrNoContent             = &Error{714, "No content selected"}
+	ErrPlaySpeedNotSupported = &Error{717, "Play speed not supported"}
+)
+
+// Controller is the control point behind a request: the ID that owns the
+// session, its User-Agent for the cast history, and the quirk profile it
+// matched, nil when none.
+type Controller struct {
+	ID        string
+	UserAgent string
+	Quirk     *quirk.Profile
+}
+
+// NewController identifies the sender of r and looks up its quirks.
+func NewController(r *http.Request, quirks *quirk.Registry) Controller {
+	id := ControllerID(r)
+	return Controller{ID: id, UserAgent: r.UserAgent(), Quirk: quirks.Match(r, id)}
+}
+
+// Actions carries out mutating transport and rendering actions for a
+// controller. Each action runs inside PlayerState.Serialize and acquires the
+// session first, so SOAP and REST requests obey the same ordering and
+// ownership rules.
+//
+// Preemption and volume linkage come from st.Settings on every call, so a
+// configuration reload applies without rebuilding the handlers.
+type Actions struct {
+	st *state.PlayerState
+}
+
+func NewActions(st *state.PlayerState) *Actions {
+	return &Actions{st: st}
+}
+
+func (a *Actions) serialize(fn func() *Error) *Error {
+	var err *Error
+	a.st.Serialize(func() { err = fn() })
+	return err
+}
+
+// acquireSession takes (or, when policy allows, preempts) the session for a
+// mutating action. The session policy decides first; a quirk profile may
+// override the general preemption setting. Each decision is logged and
+// counted under the rule that made it.
+func (a *Actions) acquireSession(c Controller) *Error {
+	ctx := a.st.Context()
+	settings := a.st.Settings()
+	policy := settings.Session
+	if ok, rule := policy.Admit(c.ID); !ok {
+		log.CtxInfo(ctx, "session refused to %s by rule %s", c.ID, rule)
+		monitoring.GetMetrics().RecordSessionDecision(rule, false)
+		monitoring.GetMetrics().RecordUPnPError()
+		return ErrSessionInUse
+	}
+
+	allow := c.Quirk.AllowPreempt(settings.AllowSessionPreempt)
+	rule := session.RuleOwner
+	if a.st.GetSessionOwner() == "" {
+		rule = session.RuleFree
+	}
+	var owner string
+	acquired, preempted := a.st.AcquireSessionFunc(c.ID, func(current string, idle time.Duration) bool {
+		ok, decided := policy.Preempt(c.ID, c.UserAgent, idle, allow)
+		owner, rule = current, decided
+		return ok
+	})
+	monitoring.GetMetrics().RecordSessionDecision(rule, acquired)
+	if !acquired {
+		log.CtxInfo(ctx, "session held by %s refused to %s by rule %s", owner, c.ID, rule)
+		monitoring.GetMetrics().RecordUPnPError()
+		return ErrSessionInUse
+	}
+	if preempted {
+		log.CtxInfo(ctx, "session preempted from %s by %s under rule %s", owner, c.ID, rule)
+		if err := a.st.StopPlayer(); err != nil {
+			log.CtxError(ctx, "stop preempted player: %v", err)
+			monitoring.GetMetrics().RecordPlayerError()
+			return ErrActionFailed
+		}
+	}
+	return nil
+}
+
+// allow answers 701 when the transport state machine does not let action
+// happen now.
+func (a *Actions) allow(action string) *Error {
+	if a.st.Allows(action) {
+		return nil
+	}
+	log.CtxInfo(a.st.Context(), "%s not allowed in %s", action, a.st.GetTransportState())
+	monitoring.GetMetrics().RecordUPnPError()
+	return ErrTransitionNotAllowed
+}
+
+// SetURI selects new media, stopping whatever is playing.
+func (a *Actions) SetURI(c Controller, uri, meta string) *Error {
+	if c.Quirk.StripsMetadata() {
+		meta = ""
+	}
+	return a.serialize(func() *Error { return a.setURI(c, uri, meta) })
+}
+
+func (a *Actions) setURI(c Controller, uri, meta string) *Error {
+	if uri == "" {
+		return ErrInvalidArgs
+	}
+	if err := a.acquireSession(c); err != nil {
+		return err
+	}
+	if err := a.stopPlayback(); err != nil {
+		return err
+	}
+	a.st.SetURI(uri, meta)
+	a.record(c, history.EventSetURI, uri, meta)
+	return nil
+}
+
+// stopPlayback halts the current media before other media replaces it,
+// closing the player when it will not stop.
+func (a *Actions) stopPlayback() *Error {
+	ctx := a.st.Context()
+	if p := a.st.GetActivePlayer(); p != nil {
+		if err := p.StopPlayback(ctx); err != nil {
+			log.CtxWarn(ctx, "stop current playback before URI change: %v", err)
+			if err := a.st.StopPlayer(); err != nil {
+				monitoring.GetMetrics().RecordPlayerError()
+				return ErrActionFailed
+			}
+		}
+	}
+	return nil
+}
+
+// SetNextURI queues the media to play after the current one. An empty uri
+// clears the queued entry.
+func (a *Actions) SetNextURI(c Controller, uri, meta string) *Error {
+	if c.Quirk.StripsMetadata() {
+		meta = ""
+	}
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		ctx := a.st.Context()
+		if p := a.st.GetActivePlayer(); p != nil {
+			if err := p.SetNext(ctx, uri); err != nil {
+				log.CtxError(ctx, "preload next uri error: %v", err)
+				monitoring.GetMetrics().RecordPlayerError()
+				return ErrActionFailed
+			}
+		}
+		a.st.SetNextURI(uri, meta)
+		return nil
+	})
+}
+
+// Play starts or resumes the selected media at speed, or at the current
+// speed when speed is 0. A fresh start may jump to the media's remembered
+// position; resume overrides the configured choice when set.
+func (a *Actions) Play(c Controller, speed float64, resume *bool) *Error {
+	return a.serialize(func() *Error {
+		if err := a.play(c, a.resumePoint(resume)); err != nil {
+			return err
+		}
+		return a.setSpeed(speed)
+	})
+}
+
+// setSpeed changes the playback speed of the running player; 0 or the
+// current speed leave it alone.
+func (a *Actions) setSpeed(speed float64) *Error {
+	if speed <= 0 || speed == a.st.GetSpeed() {
+		return nil
+	}
+	p := a.st.GetActivePlayer()
+	if p == nil {
+		return ErrTransitionNotAllowed
+	}
+	ctx := a.st.Context()
+	if err := p.SetSpeed(ctx, speed); err != nil {
+		log.CtxError(ctx, "player set speed error: %v", err)
+		monitoring.GetMetrics().RecordPlayerError()
+		return ErrActionFailed
+	}
+	a.st.SetSpeed(speed)
+	return nil
+}
+
+// resumePoint is where playing the current media starts: its remembered
+// position when resume memory is on, or 0 when that lies within the margin
+// of the start or the player only leaves a pause.
+func (a *Actions) resumePoint(override *bool) float64 {
+	settings := a.st.Settings()
+	enabled := settings.ResumePositions
+	if override != nil {
+		enabled = *override
+	}
+	if !enabled {
+		return 0
+	}
+	switch a.st.GetTransportState() {
+	case state.Playing, state.PausedPlayback:
+		return 0
+	}
+	uri, meta := a.st.GetURI()
+	return a.st.ResumePosition(uri, meta)
+}
+
+// play starts the current media, then seeks to start once it has loaded
+// when start is past the resume margin.
+func (a *Actions) play(c Controller, start float64) *Error {
+	if err := a.acquireSession(c); err != nil {
+		return err
+	}
+	if err := a.allow(state.ActionPlay); err != nil {
+		return err
+	}
+	ctx := a.st.Context()
+	uri, meta := a.st.GetURI()
+	a.st.SetTransportState(state.Transitioning)
+	p := a.st.EnsurePlayer()
+	if err := p.Play(ctx, uri, a.st.GetVolume()); err != nil {
+		log.CtxError(ctx, "iina play error: %v", err)
+		monitoring.GetMetrics().RecordPlayerError()
+		a.st.SetTransportState(state.Stopped)
+		return ErrActionFailed
+	}
+	if title := XMLText([]byte(meta), "title"); title != "" {
+		if err := p.SetTitle(ctx, title); err != nil {
+			log.CtxWarn(ctx, "set media title: %v", err)
+		}
+	}
+	if a.st.GetMute() {
+		if err := p.SetMute(ctx, true); err != nil {
+			log.CtxError(ctx, "apply initial mute: %v", err)
+			monitoring.GetMetrics().RecordPlayerError()
+			_ = a.st.StopPlayer()
+			a.st.SetTransportState(state.Stopped)
+			return ErrActionFailed
+		}
+	}
+	// Loading the current URI drops mpv's playlist, so re-queue the next
+	// entry every time playback starts.
+	if next, _ := a.st.GetNextURI(); next != "" {
+		if err := p.SetNext(ctx, next); err != nil {
+			log.CtxWarn(ctx, "preload next uri: %v", err)
+		}
+	}
+	a.st.SetTransportState(state.Playing)
+	if a.st.Standby() {
+		a.st.SetStandby(false)
+	}
+	a.record(c, history.EventPlay, uri, meta)
+	go a.loadSubtitles(uri, meta)
+	if start > 0 && start > a.st.Settings().ResumeMargin.Seconds() {
+		go a.seekWhenLoaded(uri, start)
+	}
+	return nil
+}
+
+// Cast selects uri and starts it in one step, titled title when non-empty.
+// resume overrides the configured resume-memory choice when set.
+func (a *Actions) Cast(c Controller, uri, title string, resume *bool) *Error {
+	return a.serialize(func() *Error {
+		if err := a.setURI(c, uri, castMetadata(uri, title)); err != nil {
+			return err
+		}
+		return a.play(c, a.resumePoint(resume))
+	})
+}
+
+// Recast selects and plays the media of a cast history entry again, with its
+// original metadata.
+func (a *Actions) Recast(c Controller, id int64) *Error {
+	e, ok, err := a.st.History().Get(id)
+	if err != nil {
+		log.CtxError(a.st.Context(), "read cast history: %v", err)
+		return ErrActionFailed
+	}
+	if !ok || e.URI == "" {
+		return ErrInvalidArgs
+	}
+	return a.serialize(func() *Error {
+		if err := a.setURI(c, e.URI, e.Metadata); err != nil {
+			return err
+		}
+		return a.play(c, a.resumePoint(nil))
+	})
+}
+
+// record notes an action of c in the cast history, when one is kept.
+func (a *Actions) record(c Controller, event, uri, meta string) {
+	_, err := a.st.History().Append(history.Entry{
+		Event:      event,
+		Controller: c.ID,
+		UserAgent:  c.UserAgent,
+		URI:        uri,
+		Title:      XMLText([]byte(meta), "title"),
+		Class:      XMLText([]byte(meta), "class"),
+		Metadata:   meta,
+	})
+	if err != nil {
+		log.CtxWarn(a.st.Context(), "record cast history: %v", err)
+	}
+}
+
+// Resume replays the last cast (see PlayerState.LastCast) and returns to
+// where it left off once the player has opened it.
+func (a *Actions) Resume(c Controller) *Error {
+	return a.serialize(func() *Error {
+		uri, meta, position := a.st.LastCast()
+		if uri == "" {
+			monitoring.GetMetrics().RecordUPnPError()
+			return ErrNoContent
+		}
+		if err := a.setURI(c, uri, meta); err != nil {
+			return err
+		}
+		return a.play(c, position)
+	})
+}
+
+// loadPoll and loadWait bound how whenLoaded waits for the player; vars so
+// tests need not wait on a real load.
+var (
+	loadPoll = 200 * time.Millisecond
+	loadWait = 15 * time.Second
+)
+
+// whenLoaded calls fn, inside Serialize, once the player reports a duration
+// for uri. mpv refuses seeks and subtitle tracks while a file is still
+// opening, so they cannot follow Play straight away on slow streams. It gives
+// up when the media changes; what names the pending step in the log.
+func (a *Actions) whenLoaded(uri, what string, fn func(p player.Player, duration float64)) {
+	ctx := a.st.Context()
+	deadline := time.Now().Add(loadWait)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(loadPoll):
+		}
+		done := false
+		a.st.Serialize(func() {
+			p := a.st.GetActivePlayer()
+			if cur, _ := a.st.GetURI(); cur != uri || p == nil {
+				done = true
+				return
+			}
+			d, err := p.GetDuration(ctx)
+			if err != nil || d <= 0 {
+				return
+			}
+			done = true
+			fn(p, d)
+		})
+		if done {
+			return
+		}
+	}
+	log.CtxWarn(ctx, "gave up %s: %s did not load within %s", what, uri, loadWait)
+}
+
+// seekWhenLoaded seeks to position once uri has loaded, unless position lies
+// within the resume margin of the end.
+func (a *Actions) seekWhenLoaded(uri string, position float64) {
+	a.whenLoaded(uri, "seeking to resume position", func(p player.Player, d float64) {
+		ctx := a.st.Context()
+		if position >= d-a.st.Settings().ResumeMargin.Seconds() {
+			return
+		}
+		if err := p.Seek(ctx, position); err != nil {
+			log.CtxWarn(ctx, "seek to resume position %.1fs: %v", position, err)
+			return
+		}
+		log.CtxInfo(ctx, "resumed %s at %.1fs", uri, position)
+	})
+}
+
+// castMetadata describes a bare URL as a DIDL-Lite item so the title reaches
+// the player and control points like any other cast.
+func castMetadata(uri, title string) string {
+	if title == "" {
+		return ""
+	}
+	return WriteDIDL(Item{
+		ID: "0", ParentID: "-1", Restricted: 1,
+		Title:     title,
+		Class:     "object.item.videoItem",
+		Resources: []Res{{ProtocolInfo: "http-get:*:*:*", URL: uri}},
+	})
+}
+
+func (a *Actions) Pause(c Controller) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		if err := a.allow(state.ActionPause); err != nil {
+			return err
+		}
+		p := a.st.GetActivePlayer()
+		if p == nil {
+			return ErrTransitionNotAllowed
+		}
+		if err := p.Pause(a.st.Context()); err != nil {
+			monitoring.GetMetrics().RecordPlayerError()
+			return ErrActionFailed
+		}
+		a.st.SetTransportState(state.PausedPlayback)
+		return nil
+	})
+}
+
+// Stop closes the player and hands the session back.
+func (a *Actions) Stop(c Controller) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		if err := a.allow(state.ActionStop); err != nil {
+			return err
+		}
+		if err := a.st.StopPlayer(); err != nil {
+			monitoring.GetMetrics().RecordPlayerError()
+			return ErrActionFailed
+		}
+		a.st.SetTransportState(state.Stopped)
+		a.st.ReleaseSession(c.ID)
+		return nil
+	})
+}
+
+// Seek moves playback to seconds from the start of the current media.
+func (a *Actions) Seek(c Controller, seconds float64) *Error {
+	return a.seek(c, seekTarget{unit: "ABS_TIME", value: seconds})
+}
+
+// SeekUnit carries out an AVTransport Seek to target, read in unit.
+func (a *Actions) SeekUnit(c Controller, unit, target string) *Error {
+	t, err := parseSeek(unit, target)
+	if err != nil {
+		return err
+	}
+	return a.seek(c, t)
+}
+
+func (a *Actions) seek(c Controller, t seekTarget) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		if err := a.allow(state.ActionSeek); err != nil {
+			return err
+		}
+		if t.unit == "TRACK_NR" && a.st.PlaylistCurrent() != 0 {
+			tracks := a.st.PlaylistTracks()
+			if int(t.value) > len(tracks) {
+				return ErrIllegalSeekTarget
+			}
+			return a.skipTo(c, tracks[int(t.value)-1])
+		}
+		p := a.st.GetActivePlayer()
+		if p == nil {
+			return ErrTransitionNotAllowed
+		}
+		return seekPlayer(a.st.Context(), p, t)
+	})
+}
+
+// SetVolume applies a controller-domain volume, expanded by the controller's
+// quirk volume scale.
+func (a *Actions) SetVolume(c Controller, v int) *Error {
+	v = min(max(v, 0), 100)
+	scale := c.Quirk.Scale()
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		ctx := a.st.Context()
+		applied := a.st.PreviewVolumeRequest(c.ID, v, scale)
+		if p := a.st.GetActivePlayer(); p != nil {
+			if err := p.SetVolume(ctx, applied); err != nil {
+				log.CtxError(ctx, "iina set volume error: %v", err)
+				return ErrActionFailed
+			}
+		}
+		if a.st.Settings().LinkSystemOutputVolume {
+			if err := systemVolumeSink(applied); err != nil {
+				log.CtxWarn(ctx, "set system volume: %v", err)
+			}
+		}
+		a.st.CommitVolumeRequest(c.ID, v, scale)
+		if scale > 1 {
+			log.CtxDebug(ctx, "mapped controller volume raw=%d applied=%d controller=%s", v, applied, c.ID)
+		}
+		return nil
+	})
+}
+
+func (a *Actions) SetMute(c Controller, m bool) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		ctx := a.st.Context()
+		if p := a.st.GetActivePlayer(); p != nil {
+			if err := p.SetMute(ctx, m); err != nil {
+				return ErrActionFailed
+			}
+		}
+		if a.st.Settings().LinkSystemOutputVolume {
+			if err := systemMuteSink(m); err != nil {
+				log.CtxWarn(ctx, "set system mute: %v", err)
+			}
+		}
+		a.st.SetMute(m)
+		return nil
+	})
+}
@@ -0,0 +1,276 @@
+package upnp
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tr1v3r/rcast/internal/history"
+	"github.com/tr1v3r/rcast/internal/monitoring"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/quirk"
+	"github.com/tr1v3r/rcast/internal/session"
+	"github.com/tr1v3r/rcast/internal/state"
+)
+
+func TestCastMetadataCarriesEscapedTitle(t *testing.T) {
+	if got := castMetadata("https://example.test/v.mp4", ""); got != "" {
+		t.Fatalf("untitled cast metadata = %q, want empty", got)
+	}
+	meta := castMetadata("https://example.test/v.mp4?a=1&b=2", "Tom & Jerry <1>")
+	if got := XMLText([]byte(meta), "title"); got != "Tom & Jerry <1>" {
+		t.Fatalf("title = %q", got)
+	}
+	if got := XMLText([]byte(meta), "res"); got != "https://example.test/v.mp4?a=1&b=2" {
+		t.Fatalf("res = %q", got)
+	}
+}
+
+func TestActionsCastSetsURIAndPlaysAtomically(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	actions := NewActions(st)
+
+	if err := actions.Cast(Controller{ID: "10.0.0.1"}, "https://example.test/v.mp4", "Clip", nil); err != nil {
+		t.Fatalf("Cast: %v", err)
+	}
+	if uri, _ := st.GetURI(); uri != "https://example.test/v.mp4" || st.GetTransportState() != "PLAYING" {
+		t.Fatalf("uri=%q state=%q", uri, st.GetTransportState())
+	}
+	if len(fake.titles) != 1 || fake.titles[0] != "Clip" {
+		t.Fatalf("titles=%v", fake.titles)
+	}
+
+	if err := actions.Cast(Controller{ID: "10.0.0.2"}, "https://example.test/other.mp4", "", nil); err != ErrSessionInUse {
+		t.Fatalf("Cast from another controller = %v, want %v", err, ErrSessionInUse)
+	}
+	if err := actions.Cast(Controller{ID: "10.0.0.1"}, "", "", nil); err != ErrInvalidArgs {
+		t.Fatalf("Cast without uri = %v, want %v", err, ErrInvalidArgs)
+	}
+}
+
+func TestActionsFollowReloadedSettings(t *testing.T) {
+	st, cleanup := newAVTState(t, nil)
+	defer cleanup()
+	actions := NewActions(st)
+
+	if err := actions.SetURI(Controller{ID: "10.0.0.1"}, "https://example.test/one.mp4", ""); err != nil {
+		t.Fatalf("SetURI: %v", err)
+	}
+	if err := actions.SetURI(Controller{ID: "10.0.0.2"}, "https://example.test/two.mp4", ""); err != ErrSessionInUse {
+		t.Fatalf("SetURI without preemption = %v, want %v", err, ErrSessionInUse)
+	}
+
+	st.ApplySettings(state.Settings{AllowSessionPreempt: true})
+	if err := actions.SetURI(Controller{ID: "10.0.0.2"}, "https://example.test/two.mp4", ""); err != nil {
+		t.Fatalf("SetURI after enabling preemption: %v", err)
+	}
+	if owner := st.GetSessionOwner(); owner != "10.0.0.2" {
+		t.Fatalf("owner=%q, want 10.0.0.2", owner)
+	}
+}
+
+func TestActionsQuirkOverridesPreemption(t *testing.T) {
+	st, cleanup := newAVTState(t, nil)
+	defer cleanup()
+	actions := NewActions(st)
+	always := true
+	pushy := Controller{ID: "10.0.0.2", Quirk: &quirk.Profile{Name: "pushy", Preempt: &always}}
+
+	if err := actions.SetURI(Controller{ID: "10.0.0.1"}, "https://example.test/one.mp4", ""); err != nil {
+		t.Fatalf("SetURI: %v", err)
+	}
+	if err := actions.SetURI(pushy, "https://example.test/two.mp4", ""); err != nil {
+		t.Fatalf("SetURI from preempting controller: %v", err)
+	}
+	if owner := st.GetSessionOwner(); owner != "10.0.0.2" {
+		t.Fatalf("owner=%q, want 10.0.0.2", owner)
+	}
+}
+
+func TestActionsSessionPolicy(t *testing.T) {
+	st, cleanup := newAVTState(t, nil)
+	defer cleanup()
+	actions := NewActions(st)
+	st.ApplySettings(state.Settings{
+		AllowSessionPreempt: true,
+		Session: session.Policy{
+			Deny:              []string{"10.0.0.66"},
+			Trusted:           []string{"10.0.0.9"},
+			TrustedUserAgents: []string{"LivingRoomRemote/"},
+			LowPriority:       []string{"10.0.1.0/24"},
+			GraceSeconds:      60,
+		},
+	})
+	uri := "https://example.test/v.mp4"
+
+	if err := actions.SetURI(Controller{ID: "10.0.0.66"}, uri, ""); err != ErrSessionInUse {
+		t.Fatalf("denied controller on a free session = %v, want %v", err, ErrSessionInUse)
+	}
+	if err := actions.SetURI(Controller{ID: "10.0.0.1"}, uri, ""); err != nil {
+		t.Fatalf("SetURI: %v", err)
+	}
+	// The owner just acted, so an ordinary controller waits out the grace
+	// period and a low-priority one never preempts.
+	if err := actions.SetURI(Controller{ID: "10.0.0.2"}, uri, ""); err != ErrSessionInUse {
+		t.Fatalf("preempt within grace = %v, want %v", err, ErrSessionInUse)
+	}
+	if err := actions.SetURI(Controller{ID: "10.0.1.5"}, uri, ""); err != ErrSessionInUse {
+		t.Fatalf("low-priority preempt = %v, want %v", err, ErrSessionInUse)
+	}
+	if err := actions.SetURI(Controller{ID: "10.0.0.9"}, uri, ""); err != nil {
+		t.Fatalf("trusted preempt: %v", err)
+	}
+	if owner := st.GetSessionOwner(); owner != "10.0.0.9" {
+		t.Fatalf("owner=%q, want 10.0.0.9", owner)
+	}
+	// A controller trusted by name preempts from any address.
+	if err := actions.SetURI(Controller{ID: "10.0.0.3", UserAgent: "LivingRoomRemote/2.0"}, uri, ""); err != nil {
+		t.Fatalf("trusted-by-name preempt: %v", err)
+	}
+
+	text := monitoring.GetMetrics().RenderText()
+	for _, want := range []string{
+		`rcast_session_decisions_total{rule="deny",outcome="rejected"}`,
+		`rcast_session_decisions_total{rule="grace",outcome="rejected"}`,
+		`rcast_session_decisions_total{rule="low_priority",outcome="rejected"}`,
+		`rcast_session_decisions_total{rule="trusted",outcome="granted"}`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+func TestActionsCastResumesRememberedPosition(t *testing.T) {
+	defer func(poll time.Duration) { loadPoll = poll }(loadPoll)
+	loadPoll = time.Millisecond
+	fake := newFakePlayer()
+	fake.duration = 600
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	st.ApplySettings(state.Settings{ResumePositions: true, ResumeMargin: 30 * time.Second})
+	st.RestorePositions([]state.SavedPosition{
+		{Key: "https://example.test/long.mp4", Position: 240},
+		{Key: "https://example.test/short.mp4", Position: 10},
+		{Key: "https://example.test/edge.mp4", Position: 30},
+	})
+	actions := NewActions(st)
+	c := Controller{ID: "10.0.0.1"}
+	seeks := func() []float64 {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return append([]float64(nil), fake.seeks...)
+	}
+
+	// Within the margin of the start: plays from the beginning.
+	if err := actions.Cast(c, "https://example.test/short.mp4", "", nil); err != nil {
+		t.Fatalf("Cast short: %v", err)
+	}
+	// Exactly the margin is not more than it.
+	if err := actions.Cast(c, "https://example.test/edge.mp4", "", nil); err != nil {
+		t.Fatalf("Cast edge: %v", err)
+	}
+	// Overridden off: plays from the beginning despite the memory.
+	off := false
+	if err := actions.Cast(c, "https://example.test/long.mp4?sig=1", "", &off); err != nil {
+		t.Fatalf("Cast without resume: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := seeks(); len(got) != 0 {
+		t.Fatalf("seeks=%v, want none", got)
+	}
+
+	if err := actions.Cast(c, "https://example.test/long.mp4?sig=2", "", nil); err != nil {
+		t.Fatalf("Cast long: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for got := seeks(); len(got) != 1 || got[0] != 240; got = seeks() {
+		if time.Now().After(deadline) {
+			t.Fatalf("seeks=%v, want [240]", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestActionsRecordCastHistoryAndRecast(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	h, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"), history.DefaultMaxBytes, history.DefaultKeep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.SetHistory(h)
+	actions := NewActions(st)
+	c := Controller{ID: "10.0.0.1", UserAgent: "BubbleUPnP/3.0"}
+
+	if err := actions.Cast(c, "https://example.test/a.mp4", "Fish & Chips", nil); err != nil {
+		t.Fatalf("Cast: %v", err)
+	}
+	if err := actions.Stop(c); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	page, _, err := h.Page(0, 10)
+	if err != nil || len(page) != 3 {
+		t.Fatalf("history = %+v, %v", page, err)
+	}
+	stop, play, set := page[0], page[1], page[2]
+	if set.Event != history.EventSetURI || set.Controller != "10.0.0.1" || set.UserAgent != "BubbleUPnP/3.0" ||
+		set.Title != "Fish & Chips" || set.Class != "object.item.videoItem" || set.Metadata == "" {
+		t.Fatalf("SetAVTransportURI entry = %+v", set)
+	}
+	if play.Event != history.EventPlay || play.URI != "https://example.test/a.mp4" {
+		t.Fatalf("Play entry = %+v", play)
+	}
+	if stop.Event != history.EventStop || stop.Controller != "10.0.0.1" || stop.Played <= 0 {
+		t.Fatalf("Stop entry = %+v", stop)
+	}
+
+	if err := actions.Recast(Controller{ID: "10.0.0.2"}, 999); err != ErrInvalidArgs {
+		t.Fatalf("Recast of a missing entry = %v, want %v", err, ErrInvalidArgs)
+	}
+	if err := actions.Recast(Controller{ID: "10.0.0.2"}, set.ID); err != nil {
+		t.Fatalf("Recast: %v", err)
+	}
+	if uri, meta := st.GetURI(); uri != "https://example.test/a.mp4" || meta != set.Metadata || st.GetTransportState() != "PLAYING" {
+		t.Fatalf("after recast uri=%q meta=%q state=%q", uri, meta, st.GetTransportState())
+	}
+}
+
+func TestActionsResumeReplaysLastCastAndSeeks(t *testing.T) {
+	defer func(poll time.Duration) { loadPoll = poll }(loadPoll)
+	loadPoll = time.Millisecond
+	fake := newFakePlayer()
+	fake.duration = 600
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	actions := NewActions(st)
+
+	if err := actions.Resume(Controller{ID: "10.0.0.1"}); err != ErrNoContent {
+		t.Fatalf("Resume with nothing saved = %v, want %v", err, ErrNoContent)
+	}
+
+	st.Restore(state.Saved{Volume: 40, URI: "https://example.test/v.mp4", Position: 30})
+	if err := actions.Resume(Controller{ID: "10.0.0.1"}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if uri, _ := st.GetURI(); uri != "https://example.test/v.mp4" || st.GetTransportState() != "PLAYING" {
+		t.Fatalf("uri=%q state=%q", uri, st.GetTransportState())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		fake.mu.Lock()
+		seeks := append([]float64(nil), fake.seeks...)
+		fake.mu.Unlock()
+		if len(seeks) == 1 && seeks[0] == 30 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("seeks=%v, want [30]", seeks)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -1,16 +1,19 @@
 package upnp
 
 import (
+	"context"
 	"fmt"
 	"html"
 	"net/http"
-	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/tr1v3r/pkg/log"
 
 	"github.com/tr1v3r/rcast/internal/config"
 	"github.com/tr1v3r/rcast/internal/monitoring"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/quirk"
 	"github.com/tr1v3r/rcast/internal/state"
 )
 
@@ -24,27 +27,60 @@ func durationToTime(seconds float64) string {
 	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
 }
 
-func timeToSeconds(t string) (float64, error) {
-	parts := strings.Split(t, ":")
-	if len(parts) != 3 {
-		return 0, fmt.Errorf("invalid time format: %s", t)
+// trackNumbers returns the current track and the number of tracks for the
+// selected uri: its place in the playlist when it came from there, else a
+// single track, and none without media.
+func trackNumbers(uri string, pl state.PlaylistSnapshot) (track, nrTracks int) {
+	switch {
+	case uri == "":
+		return 0, 0
+	case pl.Index >= 0:
+		return pl.Index + 1, len(pl.IDs)
 	}
-	h, err := strconv.Atoi(parts[0])
-	if err != nil {
-		return 0, err
+	return 1, 1
+}
+
+// playerTrackInfo asks p what it has learnt about the media it plays.
+func playerTrackInfo(ctx context.Context, p player.Player) TrackInfo {
+	var info TrackInfo
+	if d, err := p.GetDuration(ctx); err == nil {
+		info.Duration = d
 	}
-	m, err := strconv.Atoi(parts[1])
-	if err != nil {
-		return 0, err
+	if m, err := p.GetMediaInfo(ctx); err == nil {
+		info.Title, info.Width, info.Height = m.Title, m.Width, m.Height
+	}
+	return info
+}
+
+// lastPosition remembers the last real position reading per URI, for
+// controllers that give up on a cast when they see a zero position while the
+// player is still loading or seeking.
+type lastPosition struct {
+	mu       sync.Mutex
+	uri      string
+	duration float64
+	position float64
+}
+
+// update records a real reading, or with fake set fills missing (zero)
+// values from the last reading of the same URI.
+func (l *lastPosition) update(uri string, duration, position float64, fake bool) (float64, float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.uri != uri {
+		l.uri, l.duration, l.position = uri, 0, 0
 	}
-	s, err := strconv.ParseFloat(parts[2], 64)
-	if err != nil {
-		return 0, err
+	if duration > 0 {
+		l.duration = duration
+	} else if fake {
+		duration = l.duration
 	}
-	if h < 0 || m < 0 || m >= 60 || s < 0 || s >= 60 {
-		return 0, fmt.Errorf("invalid time value: %s", t)
+	if position > 0 {
+		l.position = position
+	} else if fake {
+		position = l.position
 	}
-	return float64(h)*3600 + float64(m)*60 + s, nil
+	return duration, position
 }
 
 // CurrentURIMetaData:
@@ -60,28 +96,10 @@ func timeToSeconds(t string) (float64, error) {
 // 	</item>
 // </DIDL-Lite>
 
-// requireSession acquires (or, when preemption is enabled, preempts) the session
-// for a mutating transport action. On failure it records a UPnP error, writes a
-// SOAP 712 response, and returns false.
-func requireSession(w http.ResponseWriter, st *state.PlayerState, cfg config.Config, controller string) bool {
-	acquired, preempted := st.AcquireSession(controller, cfg.AllowSessionPreempt)
-	if !acquired {
-		monitoring.GetMetrics().RecordUPnPError()
-		WriteSOAPError(w, 712, "Session in use")
-		return false
-	}
-	if preempted {
-		if err := st.StopPlayer(); err != nil {
-			log.CtxError(st.Context(), "stop preempted player: %v", err)
-			monitoring.GetMetrics().RecordPlayerError()
-			WriteSOAPError(w, 501, "Action Failed")
-			return false
-		}
-	}
-	return true
-}
-
 func AVTransportHandler(st *state.PlayerState, cfg config.Config) http.HandlerFunc {
+	actions := NewActions(st)
+	quirks := quirk.NewRegistry(cfg.Quirks)
+	var last lastPosition
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := st.Context()
 		sa := ParseSOAPAction(r.Header.Get("SOAPACTION"))
@@ -89,7 +107,7 @@ func AVTransportHandler(st *state.PlayerState, cfg config.Config) http.HandlerFu
 		if !ok {
 			return
 		}
-		controller := ControllerID(r)
+		controller := NewController(r, quirks)
 
 		// Record UPnP action
 		monitoring.GetMetrics().RecordUPnPAction()
@@ -97,213 +115,122 @@ func AVTransportHandler(st *state.PlayerState, cfg config.Config) http.HandlerFu
 		log.CtxDebug(ctx, "get request header: %+v", r.Header)
 		log.CtxDebug(ctx, "get request body: %s", string(body))
 
-		switch sa {
-		case "SetAVTransportURI":
-			uri := XMLText(body, "CurrentURI")
-			if uri == "" {
-				WriteSOAPError(w, 402, "Invalid Args")
+		// respond writes the action's SOAP response or its UPnP fault.
+		respond := func(err *Error, respName string) {
+			if err != nil {
+				writeActionError(w, err)
 				return
 			}
-			meta := XMLText(body, "CurrentURIMetaData")
-			st.Serialize(func() {
-				if !requireSession(w, st, cfg, controller) {
-					return
-				}
-				if p := st.GetActivePlayer(); p != nil {
-					if err := p.StopPlayback(ctx); err != nil {
-						log.CtxWarn(ctx, "stop current playback before URI change: %v", err)
-						if err := st.StopPlayer(); err != nil {
-							monitoring.GetMetrics().RecordPlayerError()
-							WriteSOAPError(w, 501, "Action Failed")
-							return
-						}
-					}
-				}
-				st.SetURI(uri, meta)
-				WriteSOAPResponse(w, AVTransportType, "SetAVTransportURIResponse", "")
-			})
+			WriteSOAPResponse(w, AVTransportType, respName, "")
+		}
+
+		switch sa {
+		case "SetAVTransportURI":
+			respond(actions.SetURI(controller, XMLText(body, "CurrentURI"), XMLText(body, "CurrentURIMetaData")), "SetAVTransportURIResponse")
+
+		case "SetNextAVTransportURI":
+			// An empty NextURI is legal and clears the queued entry.
+			respond(actions.SetNextURI(controller, XMLText(body, "NextURI"), XMLText(body, "NextURIMetaData")), "SetNextAVTransportURIResponse")
 
 		case "Play":
-			st.Serialize(func() {
-				if !requireSession(w, st, cfg, controller) {
-					return
-				}
-				uri, meta := st.GetURI()
-				if uri == "" {
-					monitoring.GetMetrics().RecordUPnPError()
-					WriteSOAPError(w, 714, "No content selected")
-					return
-				}
-				st.SetTransportState("TRANSITIONING")
-				p := st.EnsurePlayer()
-				if err := p.Play(ctx, uri, st.GetVolume()); err != nil {
-					log.CtxError(ctx, "iina play error: %v", err)
-					monitoring.GetMetrics().RecordPlayerError()
-					st.SetTransportState("STOPPED")
-					WriteSOAPError(w, 501, "Action Failed")
-					return
-				}
-				if title := XMLText([]byte(meta), "title"); title != "" {
-					if err := p.SetTitle(ctx, title); err != nil {
-						log.CtxWarn(ctx, "set media title: %v", err)
-					}
-				}
-				if st.GetMute() {
-					if err := p.SetMute(ctx, true); err != nil {
-						log.CtxError(ctx, "apply initial mute: %v", err)
-						monitoring.GetMetrics().RecordPlayerError()
-						_ = st.StopPlayer()
-						st.SetTransportState("STOPPED")
-						WriteSOAPError(w, 501, "Action Failed")
-						return
-					}
-				}
-				st.SetTransportState("PLAYING")
-				WriteSOAPResponse(w, AVTransportType, "PlayResponse", "")
-			})
+			speed, err := parsePlaySpeed(XMLText(body, "Speed"))
+			if err != nil {
+				writeActionError(w, err)
+				return
+			}
+			respond(actions.Play(controller, speed, nil), "PlayResponse")
 
 		case "Pause":
-			st.Serialize(func() {
-				if !requireSession(w, st, cfg, controller) {
-					return
-				}
-				p := st.GetActivePlayer()
-				if p == nil {
-					WriteSOAPError(w, 701, "Transition not available")
-					return
-				}
-				if err := p.Pause(ctx); err != nil {
-					monitoring.GetMetrics().RecordPlayerError()
-					WriteSOAPError(w, 501, "Action Failed")
-					return
-				}
-				st.SetTransportState("PAUSED_PLAYBACK")
-				WriteSOAPResponse(w, AVTransportType, "PauseResponse", "")
-			})
+			respond(actions.Pause(controller), "PauseResponse")
 
 		case "Stop":
-			st.Serialize(func() {
-				if !requireSession(w, st, cfg, controller) {
-					return
-				}
-				if err := st.StopPlayer(); err != nil {
-					monitoring.GetMetrics().RecordPlayerError()
-					WriteSOAPError(w, 501, "Action Failed")
-					return
-				}
-				st.SetTransportState("STOPPED")
-				st.ReleaseSession(controller)
-				WriteSOAPResponse(w, AVTransportType, "StopResponse", "")
-			})
+			respond(actions.Stop(controller), "StopResponse")
 
 		case "Seek":
-			unit := XMLText(body, "Unit")
-			target := XMLText(body, "Target")
+			unit := controller.Quirk.ForcedSeekUnit(XMLText(body, "Unit"))
+			respond(actions.SeekUnit(controller, unit, XMLText(body, "Target")), "SeekResponse")
 
-			if unit != "REL_TIME" && unit != "ABS_TIME" {
-				// We mainly support REL_TIME/ABS_TIME which are time strings
-				// For now treat them same
-				WriteSOAPError(w, 710, "Seek mode not supported")
-				return
-			}
+		case "Next":
+			respond(actions.Next(controller), "NextResponse")
 
-			seconds, err := timeToSeconds(target)
-			if err != nil {
-				log.CtxError(ctx, "parse seek target error: %v target=%s", err, target)
-				WriteSOAPError(w, 711, "Illegal seek target")
-				return
-			}
+		case "Previous":
+			respond(actions.Previous(controller), "PreviousResponse")
 
-			st.Serialize(func() {
-				if !requireSession(w, st, cfg, controller) {
-					return
-				}
-				p := st.GetActivePlayer()
-				if p == nil {
-					WriteSOAPError(w, 701, "Transition not available")
-					return
-				}
-				if err := p.Seek(ctx, seconds); err != nil {
-					log.CtxError(ctx, "player seek error: %v", err)
-					monitoring.GetMetrics().RecordPlayerError()
-					WriteSOAPError(w, 501, "Action Failed")
-					return
-				}
-				WriteSOAPResponse(w, AVTransportType, "SeekResponse", "")
-			})
+		case "SetPlayMode":
+			respond(actions.SetPlayMode(controller, XMLText(body, "NewPlayMode")), "SetPlayModeResponse")
 
 		case "GetTransportInfo":
 			state := st.GetTransportState()
 			status := "OK"
-			speed := "1"
+			speed := formatPlaySpeed(st.GetSpeed())
 			resp := fmt.Sprintf("<CurrentTransportState>%s</CurrentTransportState><CurrentTransportStatus>%s</CurrentTransportStatus><CurrentSpeed>%s</CurrentSpeed>", state, status, speed)
 			WriteSOAPResponse(w, AVTransportType, "GetTransportInfoResponse", resp)
 
 		case "GetPositionInfo":
-			track := "0"
-			trackDur := "00:00:00"
-			relTime := "00:00:00"
-			absTime := "00:00:00"
-
-			// Try to get actual duration and position from active player
+			snap := st.Snapshot()
+			uri, meta := snap.URI, snap.Meta
+			var info TrackInfo
+			var pos float64
 			if p := st.GetActivePlayer(); p != nil {
-				if d, err := p.GetDuration(ctx); err == nil {
-					trackDur = durationToTime(d)
-				}
-				if pos, err := p.GetPosition(ctx); err == nil {
-					relTime = durationToTime(pos)
-					absTime = relTime
+				info = playerTrackInfo(ctx, p)
+				if v, err := p.GetPosition(ctx); err == nil {
+					pos = v
 				}
 			}
+			info.Duration, pos = last.update(uri, info.Duration, pos, controller.Quirk.FakesPosition())
+			track, _ := trackNumbers(uri, snap.Playlist)
+			trackDur := durationToTime(info.Duration)
+			relTime := durationToTime(pos)
+			absTime := relTime
 
-			uri, _ := st.GetURI()
-
-			// 暂时清空 MetaData，排除格式问题
-			// meta = ""
-
-			resp := fmt.Sprintf(`<Track>%s</Track>
+			resp := fmt.Sprintf(`<Track>%d</Track>
 <TrackDuration>%s</TrackDuration>
-<TrackMetaData></TrackMetaData>
+<TrackMetaData>%s</TrackMetaData>
 <TrackURI>%s</TrackURI>
 <RelTime>%s</RelTime>
 <AbsTime>%s</AbsTime>
 <RelCount>0</RelCount>
-<AbsCount>0</AbsCount>`, track, trackDur, html.EscapeString(uri), relTime, absTime)
+<AbsCount>0</AbsCount>`, track, trackDur, html.EscapeString(TrackMetadata(uri, meta, info)), html.EscapeString(uri), relTime, absTime)
 			log.CtxDebug(ctx, "GetPositionInfo response duration: %s position: %s", trackDur, relTime)
 			log.CtxDebug(ctx, "GetPositionInfo full response: %s", resp)
 			WriteSOAPResponse(w, AVTransportType, "GetPositionInfoResponse", resp)
 
 		case "GetMediaInfo":
-			uri, meta := st.GetURI()
-			nrTracks := "1"
-			mediaDur := "00:00:00"
+			snap := st.Snapshot()
+			uri, meta := snap.URI, snap.Meta
+			nextURI, nextMeta := snap.NextURI, snap.NextMeta
+			_, nrTracks := trackNumbers(uri, snap.Playlist)
+			var info TrackInfo
 			if p := st.GetActivePlayer(); p != nil {
-				if d, err := p.GetDuration(ctx); err == nil {
-					mediaDur = durationToTime(d)
-				}
+				info = playerTrackInfo(ctx, p)
 			}
 
-			resp := fmt.Sprintf(`<NrTracks>%s</NrTracks>
+			resp := fmt.Sprintf(`<NrTracks>%d</NrTracks>
 <MediaDuration>%s</MediaDuration>
 <CurrentURI>%s</CurrentURI>
 <CurrentURIMetaData>%s</CurrentURIMetaData>
-<NextURI></NextURI>
-<NextURIMetaData></NextURIMetaData>
+<NextURI>%s</NextURI>
+<NextURIMetaData>%s</NextURIMetaData>
 <PlayMedium>NETWORK</PlayMedium>
 <RecordMedium>NOT_IMPLEMENTED</RecordMedium>
-<WriteStatus>NOT_IMPLEMENTED</WriteStatus>`, nrTracks, mediaDur, html.EscapeString(uri), html.EscapeString(meta))
+<WriteStatus>NOT_IMPLEMENTED</WriteStatus>`, nrTracks, durationToTime(info.Duration), html.EscapeString(uri), html.EscapeString(TrackMetadata(uri, meta, info)),
+				html.EscapeString(nextURI), html.EscapeString(TrackMetadata(nextURI, nextMeta, TrackInfo{})))
 			WriteSOAPResponse(w, AVTransportType, "GetMediaInfoResponse", resp)
 
 		case "GetTransportSettings":
-			resp := `<PlayMode>NORMAL</PlayMode><RecQualityMode>NOT_IMPLEMENTED</RecQualityMode>`
+			resp := fmt.Sprintf(`<PlayMode>%s</PlayMode><RecQualityMode>NOT_IMPLEMENTED</RecQualityMode>`, st.PlayMode())
 			WriteSOAPResponse(w, AVTransportType, "GetTransportSettingsResponse", resp)
 
+		case "GetCurrentTransportActions":
+			resp := fmt.Sprintf("<Actions>%s</Actions>", strings.Join(st.TransportActions(), ","))
+			WriteSOAPResponse(w, AVTransportType, "GetCurrentTransportActionsResponse", resp)
+
 		case "GetDeviceCapabilities":
 			resp := `<PlayMedia>NETWORK</PlayMedia><RecMedia>NOT_IMPLEMENTED</RecMedia><RecQualityModes>NOT_IMPLEMENTED</RecQualityModes>`
 			WriteSOAPResponse(w, AVTransportType, "GetDeviceCapabilitiesResponse", resp)
 
 		default:
-			WriteSOAPError(w, 401, "Invalid Action")
+			writeActionError(w, ErrInvalidAction)
 		}
 	}
 }
@@ -3,12 +3,14 @@ package upnp
 import (
 	"context"
 	"errors"
+	"html"
 	"net/http"
 	"strings"
 	"testing"
 
 	"github.com/tr1v3r/rcast/internal/config"
 	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/quirk"
 	"github.com/tr1v3r/rcast/internal/state"
 )
 
@@ -97,8 +99,8 @@ func TestSetAVTransportURI_StopPlaybackAndStopPlayerBothFail(t *testing.T) {
 func TestSetAVTransportURI_SessionHeldByOtherControllerPreemptDisabled(t *testing.T) {
 	st, cleanup := newAVTState(t, nil)
 	defer cleanup()
-	cfg := config.Config{AllowSessionPreempt: false}
-	handler := AVTransportHandler(st, cfg)
+	st.ApplySettings(state.Settings{AllowSessionPreempt: false})
+	handler := AVTransportHandler(st, config.Config{})
 
 	// First controller acquires the session.
 	if rec := serveAction(handler, "SetAVTransportURI", soapBody(`<CurrentURI>https://example.test/one.mp4</CurrentURI>`), "10.0.0.1:1"); rec.Code != http.StatusOK {
@@ -120,8 +122,8 @@ func TestSetAVTransportURI_PreemptEnabledDisplacesOwner(t *testing.T) {
 		return p
 	})
 	defer cleanup()
-	cfg := config.Config{AllowSessionPreempt: true}
-	handler := AVTransportHandler(st, cfg)
+	st.ApplySettings(state.Settings{AllowSessionPreempt: true})
+	handler := AVTransportHandler(st, config.Config{})
 
 	setupAVT(t, st, handler, "10.0.0.1:1", "https://example.test/one.mp4")
 	rec := serveAction(handler, "SetAVTransportURI", soapBody(`<CurrentURI>https://example.test/two.mp4</CurrentURI>`), "10.0.0.2:1")
@@ -151,8 +153,8 @@ func TestSetAVTransportURI_PreemptStopPlayerFailureFails(t *testing.T) {
 	fake.errs["Stop"] = errors.New("process gone")
 	st, cleanup := newAVTState(t, func() player.Player { return fake })
 	defer cleanup()
-	cfg := config.Config{AllowSessionPreempt: true}
-	handler := AVTransportHandler(st, cfg)
+	st.ApplySettings(state.Settings{AllowSessionPreempt: true})
+	handler := AVTransportHandler(st, config.Config{})
 
 	// Controller A acquires the session and starts playback.
 	setupAVT(t, st, handler, "10.0.0.1:1", "https://example.test/one.mp4")
@@ -168,13 +170,85 @@ func TestSetAVTransportURI_PreemptStopPlayerFailureFails(t *testing.T) {
 	}
 }
 
+func TestSetNextAVTransportURI_PreloadsIntoActivePlayer(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+	setupAVT(t, st, handler, remote, "https://example.test/1.flac")
+
+	rec := serveAction(handler, "SetNextAVTransportURI", soapBody(`<NextURI>https://example.test/2.flac</NextURI><NextURIMetaData>&lt;DIDL-Lite/&gt;</NextURIMetaData>`), remote)
+	assertSOAPSuccess(t, rec, "SetNextAVTransportURIResponse")
+	if uri, meta := st.GetNextURI(); uri != "https://example.test/2.flac" || meta != "<DIDL-Lite/>" {
+		t.Fatalf("next=(%q,%q)", uri, meta)
+	}
+	if len(fake.nexts) != 1 || fake.nexts[0] != "https://example.test/2.flac" {
+		t.Fatalf("player nexts=%v", fake.nexts)
+	}
+
+	rec = serveAction(handler, "GetMediaInfo", soapBody(``), remote)
+	assertSOAPSuccess(t, rec, "GetMediaInfoResponse")
+	body := rec.Body.String()
+	if !strings.Contains(body, "<NextURI>https://example.test/2.flac</NextURI>") || !strings.Contains(body, "&lt;dc:title&gt;2.flac&lt;/dc:title&gt;") {
+		t.Fatalf("GetMediaInfo next fields missing; body=%s", body)
+	}
+}
+
+func TestSetNextAVTransportURI_StoredUntilPlay(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+
+	serveAction(handler, "SetAVTransportURI", soapBody(`<CurrentURI>https://example.test/1.flac</CurrentURI>`), remote)
+	rec := serveAction(handler, "SetNextAVTransportURI", soapBody(`<NextURI>https://example.test/2.flac</NextURI>`), remote)
+	assertSOAPSuccess(t, rec, "SetNextAVTransportURIResponse")
+	if len(fake.nexts) != 0 {
+		t.Fatalf("preloaded without a running player: %v", fake.nexts)
+	}
+
+	rec = serveAction(handler, "Play", soapBody(`<Speed>1</Speed>`), remote)
+	assertSOAPSuccess(t, rec, "PlayResponse")
+	if len(fake.nexts) != 1 || fake.nexts[0] != "https://example.test/2.flac" {
+		t.Fatalf("Play should queue the next uri; nexts=%v", fake.nexts)
+	}
+}
+
+func TestSetNextAVTransportURI_PlayerFailure(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+	setupAVT(t, st, handler, remote, "https://example.test/1.flac")
+	fake.errs["SetNext"] = errors.New("ipc gone")
+
+	rec := serveAction(handler, "SetNextAVTransportURI", soapBody(`<NextURI>https://example.test/2.flac</NextURI>`), remote)
+	assertUPnPError(t, rec, 501)
+	if uri, _ := st.GetNextURI(); uri != "" {
+		t.Fatalf("next uri stored despite failure: %q", uri)
+	}
+}
+
+func TestSetNextAVTransportURI_SessionHeldByOtherController(t *testing.T) {
+	st, cleanup := newAVTState(t, nil)
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	serveAction(handler, "SetAVTransportURI", soapBody(`<CurrentURI>https://example.test/1.flac</CurrentURI>`), "10.0.0.1:1")
+
+	rec := serveAction(handler, "SetNextAVTransportURI", soapBody(`<NextURI>https://example.test/2.flac</NextURI>`), "10.0.0.2:1")
+	assertUPnPError(t, rec, 712)
+}
+
 func TestPlay_NoURI(t *testing.T) {
 	st, cleanup := newAVTState(t, nil)
 	defer cleanup()
 	// Acquire the session without setting a URI.
 	serveAction(AVTransportHandler(st, config.Config{}), "SetAVTransportURI", soapBody(`<CurrentURI></CurrentURI>`), "10.0.0.1:1")
 	rec := serveAction(AVTransportHandler(st, config.Config{}), "Play", soapBody(`<Speed>1</Speed>`), "10.0.0.1:1")
-	assertUPnPError(t, rec, 714)
+	assertUPnPError(t, rec, 701)
 }
 
 func TestPlay_Success(t *testing.T) {
@@ -342,15 +416,19 @@ func TestSeek_RelTimeValid(t *testing.T) {
 	handler := AVTransportHandler(st, config.Config{})
 	const remote = "10.0.0.1:1"
 	setupAVT(t, st, handler, remote, "https://example.test/v.mp4")
+	fake.mu.Lock()
+	fake.position = 10
+	fake.mu.Unlock()
 
+	// REL_TIME counts from the current position.
 	rec := serveAction(handler, "Seek", soapBody(`<Unit>REL_TIME</Unit><Target>00:01:02</Target>`), remote)
 	assertSOAPSuccess(t, rec, "SeekResponse")
 
 	fake.mu.Lock()
 	seeks := append([]float64(nil), fake.seeks...)
 	fake.mu.Unlock()
-	if len(seeks) != 1 || seeks[0] != 62 {
-		t.Fatalf("seeks=%v, want [62]", seeks)
+	if len(seeks) != 1 || seeks[0] != 72 {
+		t.Fatalf("seeks=%v, want [72]", seeks)
 	}
 }
 
@@ -361,7 +439,11 @@ func TestSeek_ABSTimeValid(t *testing.T) {
 	handler := AVTransportHandler(st, config.Config{})
 	const remote = "10.0.0.1:1"
 	setupAVT(t, st, handler, remote, "https://example.test/v.mp4")
+	fake.mu.Lock()
+	fake.position = 10
+	fake.mu.Unlock()
 
+	// ABS_TIME counts from the start, whatever the position.
 	rec := serveAction(handler, "Seek", soapBody(`<Unit>ABS_TIME</Unit><Target>00:00:30.5</Target>`), remote)
 	assertSOAPSuccess(t, rec, "SeekResponse")
 
@@ -380,7 +462,7 @@ func TestSeek_InvalidUnit(t *testing.T) {
 	const remote = "10.0.0.1:1"
 	setupAVT(t, st, handler, remote, "https://example.test/v.mp4")
 
-	rec := serveAction(handler, "Seek", soapBody(`<Unit>TRACK_NR</Unit><Target>1</Target>`), remote)
+	rec := serveAction(handler, "Seek", soapBody(`<Unit>REL_COUNT</Unit><Target>1</Target>`), remote)
 	assertUPnPError(t, rec, 710)
 }
 
@@ -423,10 +505,10 @@ func TestGetTransportInfo_ReflectsState(t *testing.T) {
 	defer cleanup()
 	handler := AVTransportHandler(st, config.Config{})
 
-	// Default state is STOPPED.
+	// Without media the state is NO_MEDIA_PRESENT.
 	rec := serveAction(handler, "GetTransportInfo", soapBody(``), "10.0.0.1:1")
 	assertSOAPSuccess(t, rec, "GetTransportInfoResponse")
-	if !strings.Contains(rec.Body.String(), "<CurrentTransportState>STOPPED</CurrentTransportState>") {
+	if !strings.Contains(rec.Body.String(), "<CurrentTransportState>NO_MEDIA_PRESENT</CurrentTransportState>") {
 		t.Fatalf("body=%s", rec.Body.String())
 	}
 
@@ -438,6 +520,41 @@ func TestGetTransportInfo_ReflectsState(t *testing.T) {
 	}
 }
 
+func TestPlay_SpeedIsAppliedAndReported(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+	setupAVT(t, st, handler, remote, "https://example.test/v.mp4")
+
+	assertSOAPSuccess(t, serveAction(handler, "Play", soapBody(`<Speed>1/2</Speed>`), remote), "PlayResponse")
+	rec := serveAction(handler, "GetTransportInfo", soapBody(``), remote)
+	if !strings.Contains(rec.Body.String(), "<CurrentSpeed>1/2</CurrentSpeed>") {
+		t.Fatalf("body=%s", rec.Body.String())
+	}
+	if st.GetSpeed() != 0.5 {
+		t.Fatalf("state speed = %v", st.GetSpeed())
+	}
+
+	assertUPnPError(t, serveAction(handler, "Play", soapBody(`<Speed>-1</Speed>`), remote), 717)
+	assertUPnPError(t, serveAction(handler, "Play", soapBody(`<Speed>fast</Speed>`), remote), 402)
+	// Same speed again needs no player call.
+	assertSOAPSuccess(t, serveAction(handler, "Play", soapBody(`<Speed>0.5</Speed>`), remote), "PlayResponse")
+	fake.mu.Lock()
+	speeds := append([]float64(nil), fake.speeds...)
+	fake.mu.Unlock()
+	if len(speeds) != 1 || speeds[0] != 0.5 {
+		t.Fatalf("player speeds = %v, want [0.5]", speeds)
+	}
+
+	// A new player process starts at normal speed again.
+	assertSOAPSuccess(t, serveAction(handler, "Stop", soapBody(``), remote), "StopResponse")
+	if st.GetSpeed() != 1 {
+		t.Fatalf("speed after Stop = %v, want 1", st.GetSpeed())
+	}
+}
+
 func TestGetPositionInfo_FormatsFromSpy(t *testing.T) {
 	fake := newFakePlayer()
 	fake.position = 125.0
@@ -535,6 +652,84 @@ func TestGetTransportSettings(t *testing.T) {
 	}
 }
 
+func TestSetPlayModeIsReportedAndEvented(t *testing.T) {
+	st, cleanup := newAVTState(t, nil)
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+
+	assertSOAPSuccess(t, serveAction(handler, "SetPlayMode", soapBody(`<NewPlayMode>REPEAT_ONE</NewPlayMode>`), remote), "SetPlayModeResponse")
+	if st.Repeat() != state.RepeatOne {
+		t.Fatalf("repeat = %v", st.Repeat())
+	}
+	rec := serveAction(handler, "GetTransportSettings", soapBody(``), remote)
+	if XMLText(rec.Body.Bytes(), "PlayMode") != "REPEAT_ONE" {
+		t.Fatalf("body=%s", rec.Body.String())
+	}
+	vars := serviceVars(AVTransportType, st.Snapshot(), st.Settings())
+	for _, v := range vars {
+		if v.name == "CurrentPlayMode" && v.value != "REPEAT_ONE" {
+			t.Fatalf("CurrentPlayMode evented as %q", v.value)
+		}
+	}
+	// An unknown mode and another controller's change fail with codes of
+	// their own.
+	assertUPnPError(t, serveAction(handler, "SetPlayMode", soapBody(`<NewPlayMode>INTRO</NewPlayMode>`), remote), 402)
+	assertUPnPError(t, serveAction(handler, "SetPlayMode", soapBody(`<NewPlayMode>SHUFFLE</NewPlayMode>`), "10.0.0.9:1"), 712)
+}
+
+func TestNextPreviousAndTrackSeekStepThroughThePlaylist(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+	var ids []uint32
+	for _, uri := range []string{"http://example.test/1.flac", "http://example.test/2.flac", "http://example.test/3.flac"} {
+		id, _ := st.PlaylistAppend(uri, "")
+		ids = append(ids, id)
+	}
+
+	// Single media has no neighbours.
+	st.SetURI("http://example.test/v.mp4", "")
+	assertUPnPError(t, serveAction(handler, "Next", soapBody(``), remote), 701)
+
+	_ = st.SelectTrack(ids[0])
+	assertSOAPSuccess(t, serveAction(handler, "Play", soapBody(`<Speed>1</Speed>`), remote), "PlayResponse")
+	rec := serveAction(handler, "GetCurrentTransportActions", soapBody(``), remote)
+	if got := XMLText(rec.Body.Bytes(), "Actions"); got != "Play,Pause,Stop,Seek,Next" {
+		t.Fatalf("actions = %q", got)
+	}
+
+	assertSOAPSuccess(t, serveAction(handler, "Next", soapBody(``), remote), "NextResponse")
+	if st.PlaylistCurrent() != ids[1] || st.GetTransportState() != state.Playing {
+		t.Fatalf("after Next: id=%d state=%s", st.PlaylistCurrent(), st.GetTransportState())
+	}
+	rec = serveAction(handler, "GetMediaInfo", soapBody(``), remote)
+	if XMLText(rec.Body.Bytes(), "NrTracks") != "3" || XMLText(rec.Body.Bytes(), "NextURI") != "http://example.test/3.flac" {
+		t.Fatalf("GetMediaInfo: %s", rec.Body.String())
+	}
+	rec = serveAction(handler, "GetPositionInfo", soapBody(``), remote)
+	if XMLText(rec.Body.Bytes(), "Track") != "2" {
+		t.Fatalf("GetPositionInfo: %s", rec.Body.String())
+	}
+
+	assertSOAPSuccess(t, serveAction(handler, "Previous", soapBody(``), remote), "PreviousResponse")
+	assertUPnPError(t, serveAction(handler, "Previous", soapBody(``), remote), 701)
+
+	assertSOAPSuccess(t, serveAction(handler, "Seek", soapBody(`<Unit>TRACK_NR</Unit><Target>3</Target>`), remote), "SeekResponse")
+	if uri, _ := st.GetURI(); uri != "http://example.test/3.flac" || st.GetTransportState() != state.Playing {
+		t.Fatalf("after TRACK_NR 3: uri=%q state=%s", uri, st.GetTransportState())
+	}
+	assertUPnPError(t, serveAction(handler, "Seek", soapBody(`<Unit>TRACK_NR</Unit><Target>4</Target>`), remote), 711)
+	fake.mu.Lock()
+	plays := fake.plays
+	fake.mu.Unlock()
+	if plays != 4 {
+		t.Fatalf("plays = %d, want 4", plays)
+	}
+}
+
 func TestGetDeviceCapabilities(t *testing.T) {
 	st, cleanup := newAVTState(t, nil)
 	defer cleanup()
@@ -551,3 +746,141 @@ func TestAVTransport_UnknownAction(t *testing.T) {
 	rec := serveAction(AVTransportHandler(st, config.Config{}), "BogusAction", soapBody(``), "10.0.0.1:1")
 	assertUPnPError(t, rec, 401)
 }
+
+func TestAVTransport_ConfiguredQuirks(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	cfg := config.Config{Quirks: []quirk.Profile{{
+		Name:          "test-controller",
+		UserAgent:     []string{"testctl/"},
+		StripMetadata: true,
+		SeekUnit:      "REL_TIME",
+		FakePosition:  true,
+	}}}
+	handler := AVTransportHandler(st, cfg)
+	const remote = "10.0.0.1:1"
+	const ua = "TestCtl/1.0"
+
+	meta := `&lt;DIDL-Lite&gt;&lt;item&gt;&lt;dc:title&gt;Broken&lt;/dc:title&gt;&lt;/item&gt;&lt;/DIDL-Lite&gt;`
+	rec := serveActionWithUserAgent(handler, "SetAVTransportURI", soapBody(`<CurrentURI>https://example.test/v.mp4</CurrentURI><CurrentURIMetaData>`+meta+`</CurrentURIMetaData>`), remote, ua)
+	assertSOAPSuccess(t, rec, "SetAVTransportURIResponse")
+	if uri, got := st.GetURI(); uri != "https://example.test/v.mp4" || got != "" {
+		t.Fatalf("uri=%q meta=%q, want metadata stripped", uri, got)
+	}
+	assertSOAPSuccess(t, serveActionWithUserAgent(handler, "Play", soapBody(``), remote, ua), "PlayResponse")
+
+	// The controller's own seek unit is replaced by the forced one.
+	rec = serveActionWithUserAgent(handler, "Seek", soapBody(`<Unit>X_VENDOR_TIME</Unit><Target>00:00:30</Target>`), remote, ua)
+	assertSOAPSuccess(t, rec, "SeekResponse")
+
+	fake.mu.Lock()
+	fake.position, fake.duration = 30, 600
+	fake.mu.Unlock()
+	serveActionWithUserAgent(handler, "GetPositionInfo", soapBody(``), remote, ua)
+
+	// While the player reports nothing, the quirk repeats the last reading
+	// and other controllers see the zeros.
+	fake.mu.Lock()
+	fake.position, fake.duration = 0, 0
+	fake.mu.Unlock()
+	body := serveActionWithUserAgent(handler, "GetPositionInfo", soapBody(``), remote, ua).Body.String()
+	if !strings.Contains(body, "<RelTime>00:00:30</RelTime>") || !strings.Contains(body, "<TrackDuration>00:10:00</TrackDuration>") {
+		t.Fatalf("faked position body=%s", body)
+	}
+	body = serveAction(handler, "GetPositionInfo", soapBody(``), remote).Body.String()
+	if !strings.Contains(body, "<RelTime>00:00:00</RelTime>") {
+		t.Fatalf("unquirked position body=%s", body)
+	}
+}
+
+func TestSeek_UnitNotForcedWithoutQuirk(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+	setupAVT(t, st, handler, remote, "https://example.test/v.mp4")
+
+	rec := serveActionWithUserAgent(handler, "Seek", soapBody(`<Unit>X_VENDOR_TIME</Unit><Target>00:00:30</Target>`), remote, "StandardDLNA/1.0")
+	assertUPnPError(t, rec, 710)
+}
+
+func TestTransportActionsFollowTheStateMachine(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+	actions := func() string {
+		t.Helper()
+		rec := serveAction(handler, "GetCurrentTransportActions", soapBody(``), remote)
+		assertSOAPSuccess(t, rec, "GetCurrentTransportActionsResponse")
+		return XMLText(rec.Body.Bytes(), "Actions")
+	}
+
+	if got := actions(); got != "" {
+		t.Fatalf("actions without media = %q", got)
+	}
+	assertUPnPError(t, serveAction(handler, "Stop", soapBody(``), remote), 701)
+
+	setupAVT(t, st, handler, remote, "https://example.test/v.mp4")
+	if got := actions(); got != "Play,Pause,Stop,Seek" {
+		t.Fatalf("actions while playing = %q", got)
+	}
+
+	assertSOAPSuccess(t, serveAction(handler, "Pause", soapBody(``), remote), "PauseResponse")
+	if got := actions(); got != "Play,Stop,Seek" {
+		t.Fatalf("actions while paused = %q", got)
+	}
+	assertUPnPError(t, serveAction(handler, "Pause", soapBody(``), remote), 701)
+
+	assertSOAPSuccess(t, serveAction(handler, "Stop", soapBody(``), remote), "StopResponse")
+	if got := actions(); got != "Play,Stop" {
+		t.Fatalf("actions when stopped = %q", got)
+	}
+	assertUPnPError(t, serveAction(handler, "Seek", soapBody(`<Unit>REL_TIME</Unit><Target>00:00:10</Target>`), remote), 701)
+	assertUPnPError(t, serveAction(handler, "Pause", soapBody(``), remote), 701)
+}
+
+func TestPositionAndMediaInfoDescribeTheTrack(t *testing.T) {
+	fake := newFakePlayer()
+	fake.position, fake.duration = 5, 90
+	fake.info = player.MediaInfo{Title: "ignored", Width: 1280, Height: 720}
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+
+	body := serveAction(handler, "GetPositionInfo", soapBody(``), remote).Body.String()
+	if !strings.Contains(body, "<Track>0</Track>") || !strings.Contains(body, "<TrackMetaData></TrackMetaData>") {
+		t.Fatalf("position without media body=%s", body)
+	}
+
+	meta := html.EscapeString(`<DIDL-Lite xmlns:dc="http://purl.org/dc/elements/1.1/"><item id="1"><dc:title>R&amp;B</dc:title></item></DIDL-Lite>`)
+	serveAction(handler, "SetAVTransportURI", soapBody(`<CurrentURI>https://example.test/v.mp4</CurrentURI><CurrentURIMetaData>`+meta+`</CurrentURIMetaData>`), remote)
+	assertSOAPSuccess(t, serveAction(handler, "Play", soapBody(``), remote), "PlayResponse")
+
+	rec := serveAction(handler, "GetPositionInfo", soapBody(``), remote)
+	assertSOAPSuccess(t, rec, "GetPositionInfoResponse")
+	if got := XMLText(rec.Body.Bytes(), "Track"); got != "1" {
+		t.Fatalf("Track = %q", got)
+	}
+	trackMeta := XMLText(rec.Body.Bytes(), "TrackMetaData")
+	d, err := ParseDIDL(trackMeta)
+	if err != nil || len(d.Items) != 1 {
+		t.Fatalf("TrackMetaData %q: %v", trackMeta, err)
+	}
+	if it := d.Items[0]; it.Title != "R&B" || it.Resources[0].Duration != "0:01:30.000" || it.Resources[0].Resolution != "1280x720" {
+		t.Fatalf("track item = %+v", it)
+	}
+
+	rec = serveAction(handler, "GetMediaInfo", soapBody(``), remote)
+	assertSOAPSuccess(t, rec, "GetMediaInfoResponse")
+	if got := XMLText(rec.Body.Bytes(), "NrTracks"); got != "1" {
+		t.Fatalf("NrTracks = %q", got)
+	}
+	if got := XMLText(rec.Body.Bytes(), "CurrentURIMetaData"); got != trackMeta {
+		t.Fatalf("CurrentURIMetaData = %q, want the TrackMetaData %q", got, trackMeta)
+	}
+}
@@ -25,33 +25,8 @@ func ConnectionManagerHandler(st *state.PlayerState, cfg config.Config) http.Han
 
 		switch sa {
 		case "GetProtocolInfo":
-			// We support http-get for various types.
-			// Commonly supported types for a renderer.
-			// DLNA.ORG_OP=01 means range seek supported
-			// DLNA.ORG_FLAGS=01700000000000000000000000000000 means various support flags (streaming, etc)
-			dlnaParams := "DLNA.ORG_PN=AVC_MP4_BL_CIF15_AAC_520;DLNA.ORG_OP=01;DLNA.ORG_FLAGS=01700000000000000000000000000000"
-
-			// Construct sink string with DLNA params for common types
-			types := []string{
-				"video/mp4",
-				"video/mpeg",
-				"video/x-ms-wmv",
-				"video/x-ms-avi",
-				"video/mkv",
-				"audio/mpeg",
-				"application/x-mpegurl",
-				"application/vnd.apple.mpegurl",
-			}
-
-			var sinks []string
-			for _, t := range types {
-				sinks = append(sinks, fmt.Sprintf("http-get:*:%s:%s", t, dlnaParams))
-			}
-
-			sink := "http-get:*:*:*,http-get:*:video/*:*," + fmt.Sprint(strings.Join(sinks, ","))
 			source := "" // We are a renderer (sink), not a source.
-
-			resp := fmt.Sprintf("<Source>%s</Source><Sink>%s</Sink>", source, sink)
+			resp := fmt.Sprintf("<Source>%s</Source><Sink>%s</Sink>", source, sinkProtocolInfo())
 			WriteSOAPResponse(w, ConnectionManagerType, "GetProtocolInfoResponse", resp)
 
 		case "GetCurrentConnectionIDs":
@@ -77,7 +52,36 @@ func ConnectionManagerHandler(st *state.PlayerState, cfg config.Config) http.Han
 			WriteSOAPResponse(w, ConnectionManagerType, "GetCurrentConnectionInfoResponse", resp)
 
 		default:
-			WriteSOAPError(w, 401, "Invalid Action")
+			writeActionError(w, ErrInvalidAction)
 		}
 	}
 }
+
+// sinkProtocolInfo lists the protocols the renderer accepts, shared by
+// GetProtocolInfo and the ConnectionManager initial event.
+func sinkProtocolInfo() string {
+	// We support http-get for various types.
+	// Commonly supported types for a renderer.
+	// DLNA.ORG_OP=01 means range seek supported
+	// DLNA.ORG_FLAGS=01700000000000000000000000000000 means various support flags (streaming, etc)
+	dlnaParams := "DLNA.ORG_PN=AVC_MP4_BL_CIF15_AAC_520;DLNA.ORG_OP=01;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+
+	// Construct sink string with DLNA params for common types
+	types := []string{
+		"video/mp4",
+		"video/mpeg",
+		"video/x-ms-wmv",
+		"video/x-ms-avi",
+		"video/mkv",
+		"audio/mpeg",
+		"application/x-mpegurl",
+		"application/vnd.apple.mpegurl",
+	}
+
+	var sinks []string
+	for _, t := range types {
+		sinks = append(sinks, fmt.Sprintf("http-get:*:%s:%s", t, dlnaParams))
+	}
+
+	return "http-get:*:*:*,http-get:*:video/*:*," + strings.Join(sinks, ",")
+}
@@ -1,6 +1,13 @@
 package upnp
 
-import "fmt"
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/tr1v3r/rcast/internal/state"
+)
 
 const (
 	DeviceType            = "urn:schemas-upnp-org:device:MediaRenderer:1"
@@ -9,42 +16,148 @@ const (
 	ConnectionManagerType = "urn:schemas-upnp-org:service:ConnectionManager:1"
 )
 
-func DeviceDescriptionXML(base, deviceUUID string) string {
+// DeviceInfo is the identity a device description advertises.
+type DeviceInfo struct {
+	FriendlyName string
+	Manufacturer string
+	ModelName    string
+	ConfigID     int
+}
+
+// DeviceInfoFrom reads the identity from the renderer's live settings, so a
+// reloaded name shows up on the next description fetch.
+func DeviceInfoFrom(st *state.PlayerState) DeviceInfo {
+	set := st.Settings()
+	return DeviceInfo{
+		FriendlyName: set.FriendlyName,
+		Manufacturer: set.Manufacturer,
+		ModelName:    set.ModelName,
+		ConfigID:     st.ConfigID(),
+	}
+}
+
+// Icon is an entry in the device description's iconList.
+type Icon struct {
+	MimeType string
+	Width    int
+	Height   int
+	Depth    int
+	URL      string
+}
+
+// DeviceIcons lists the icons every device advertises, PNG first since most
+// control points take the first one they can decode. httpserver serves them
+// at these URLs.
+func DeviceIcons() []Icon {
+	var icons []Icon
+	for _, format := range []struct{ mime, ext string }{{"image/png", "png"}, {"image/jpeg", "jpg"}} {
+		for _, size := range []int{48, 120, 256} {
+			icons = append(icons, Icon{
+				MimeType: format.mime,
+				Width:    size,
+				Height:   size,
+				Depth:    24,
+				URL:      fmt.Sprintf("/icons/icon-%d.%s", size, format.ext),
+			})
+		}
+	}
+	return icons
+}
+
+func iconListXML(prefix string) string {
+	var b strings.Builder
+	b.WriteString("<iconList>")
+	for _, icon := range DeviceIcons() {
+		fmt.Fprintf(&b, `
+      <icon><mimetype>%s</mimetype><width>%d</width><height>%d</height><depth>%d</depth><url>%s</url></icon>`,
+			icon.MimeType, icon.Width, icon.Height, icon.Depth, prefix+icon.URL)
+	}
+	b.WriteString("\n    </iconList>")
+	return b.String()
+}
+
+// URLPrefix is the path of base, under which a renderer's routes are served
+// when several share the host; empty for one served at the root.
+func URLPrefix(base string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+func DeviceDescriptionXML(base, deviceUUID string, info DeviceInfo) string {
+	prefix := URLPrefix(base)
 	return fmt.Sprintf(`<?xml version="1.0"?>
-<root xmlns="urn:schemas-upnp-org:device-1-0">
+<root xmlns="urn:schemas-upnp-org:device-1-0" configId="%d">
   <specVersion><major>1</major><minor>0</minor></specVersion>
   <device>
     <deviceType>%s</deviceType>
-    <friendlyName>RCast</friendlyName>
-    <manufacturer>GoDLNA</manufacturer>
-    <modelName>GoDLNA-DMR</modelName>
+    <friendlyName>%s</friendlyName>
+    <manufacturer>%s</manufacturer>
+    <modelName>%s</modelName>
     <UDN>%s</UDN>
-    <serviceList>
-      <service>
-        <serviceType>%s</serviceType>
-        <serviceId>urn:upnp-org:serviceId:AVTransport</serviceId>
-        <SCPDURL>/upnp/service/avtransport.xml</SCPDURL>
-        <controlURL>/upnp/control/avtransport</controlURL>
-        <eventSubURL>/upnp/event/avtransport</eventSubURL>
-      </service>
-      <service>
-        <serviceType>%s</serviceType>
-        <serviceId>urn:upnp-org:serviceId:RenderingControl</serviceId>
-        <SCPDURL>/upnp/service/renderingcontrol.xml</SCPDURL>
-        <controlURL>/upnp/control/renderingcontrol</controlURL>
-        <eventSubURL>/upnp/event/renderingcontrol</eventSubURL>
-      </service>
-      <service>
-        <serviceType>%s</serviceType>
-        <serviceId>urn:upnp-org:serviceId:ConnectionManager</serviceId>
-        <SCPDURL>/upnp/service/connectionmanager.xml</SCPDURL>
-        <controlURL>/upnp/control/connectionmanager</controlURL>
-        <eventSubURL>/upnp/event/connectionmanager</eventSubURL>
-      </service>
+    %s
+    <serviceList>%s
     </serviceList>
     <presentationURL>%s/</presentationURL>
   </device>
-</root>`, DeviceType, deviceUUID, AVTransportType, RenderingType, ConnectionManagerType, base)
+</root>`, info.ConfigID, DeviceType,
+		html.EscapeString(info.FriendlyName), html.EscapeString(info.Manufacturer), html.EscapeString(info.ModelName),
+		deviceUUID, iconListXML(prefix), serviceListXML(prefix), base)
+}
+
+// openHomeServiceID is the service name inside an OpenHome service type,
+// such as "Playlist" for PlaylistType.
+func openHomeServiceID(serviceType string) string {
+	id := strings.TrimPrefix(serviceType, "urn:av-openhome-org:service:")
+	id, _, _ = strings.Cut(id, ":")
+	return id
+}
+
+// OpenHomeServiceName is the last part of an OpenHome service's SCPD,
+// control and event URLs, such as "playlist" for PlaylistType.
+func OpenHomeServiceName(serviceType string) string {
+	return strings.ToLower(openHomeServiceID(serviceType))
+}
+
+// serviceListXML renders the serviceList entries, with every URL under
+// prefix.
+func serviceListXML(prefix string) string {
+	var b strings.Builder
+	for _, s := range []struct{ serviceType, id, name string }{
+		{AVTransportType, "urn:upnp-org:serviceId:AVTransport", "avtransport"},
+		{RenderingType, "urn:upnp-org:serviceId:RenderingControl", "renderingcontrol"},
+		{ConnectionManagerType, "urn:upnp-org:serviceId:ConnectionManager", "connectionmanager"},
+	} {
+		writeServiceXML(&b, s.serviceType, s.id, prefix, s.name)
+	}
+	for _, t := range OpenHomeTypes {
+		writeServiceXML(&b, t, "urn:av-openhome-org:serviceId:"+openHomeServiceID(t), prefix, OpenHomeServiceName(t))
+	}
+	return b.String()
+}
+
+func writeServiceXML(b *strings.Builder, serviceType, serviceID, prefix, name string) {
+	fmt.Fprintf(b, `
+      <service>
+        <serviceType>%s</serviceType>
+        <serviceId>%s</serviceId>
+        <SCPDURL>%s/upnp/service/%s.xml</SCPDURL>
+        <controlURL>%s/upnp/control/%s</controlURL>
+        <eventSubURL>%s/upnp/event/%s</eventSubURL>
+      </service>`, serviceType, serviceID, prefix, name, prefix, name, prefix, name)
+}
+
+// allowedValueList renders values as an SCPD allowedValueList.
+func allowedValueList(values []string) string {
+	var b strings.Builder
+	b.WriteString("<allowedValueList>")
+	for _, v := range values {
+		b.WriteString("<allowedValue>" + html.EscapeString(v) + "</allowedValue>")
+	}
+	b.WriteString("</allowedValueList>")
+	return b.String()
 }
 
 func SCPDAVTransportXML() string {
@@ -60,6 +173,14 @@ func SCPDAVTransportXML() string {
         <argument><name>CurrentURIMetaData</name><direction>in</direction><relatedStateVariable>AVTransportURIMetaData</relatedStateVariable></argument>
       </argumentList>
     </action>
+    <action>
+      <name>SetNextAVTransportURI</name>
+      <argumentList>
+        <argument><name>InstanceID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_InstanceID</relatedStateVariable></argument>
+        <argument><name>NextURI</name><direction>in</direction><relatedStateVariable>NextAVTransportURI</relatedStateVariable></argument>
+        <argument><name>NextURIMetaData</name><direction>in</direction><relatedStateVariable>NextAVTransportURIMetaData</relatedStateVariable></argument>
+      </argumentList>
+    </action>
     <action>
       <name>Play</name>
       <argumentList>
@@ -87,6 +208,25 @@ func SCPDAVTransportXML() string {
         <argument><name>Target</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_SeekTarget</relatedStateVariable></argument>
       </argumentList>
     </action>
+    <action>
+      <name>Next</name>
+      <argumentList>
+        <argument><name>InstanceID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_InstanceID</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Previous</name>
+      <argumentList>
+        <argument><name>InstanceID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_InstanceID</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SetPlayMode</name>
+      <argumentList>
+        <argument><name>InstanceID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_InstanceID</relatedStateVariable></argument>
+        <argument><name>NewPlayMode</name><direction>in</direction><relatedStateVariable>CurrentPlayMode</relatedStateVariable></argument>
+      </argumentList>
+    </action>
     <action>
       <name>GetTransportInfo</name>
       <argumentList>
@@ -133,6 +273,13 @@ func SCPDAVTransportXML() string {
         <argument><name>RecQualityMode</name><direction>out</direction><relatedStateVariable>CurrentRecordQualityMode</relatedStateVariable></argument>
       </argumentList>
     </action>
+    <action>
+      <name>GetCurrentTransportActions</name>
+      <argumentList>
+        <argument><name>InstanceID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_InstanceID</relatedStateVariable></argument>
+        <argument><name>Actions</name><direction>out</direction><relatedStateVariable>CurrentTransportActions</relatedStateVariable></argument>
+      </argumentList>
+    </action>
     <action>
       <name>GetDeviceCapabilities</name>
       <argumentList>
@@ -144,14 +291,15 @@ func SCPDAVTransportXML() string {
     </action>
   </actionList>
   <serviceStateTable>
-    <stateVariable sendEvents="no"><name>TransportState</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>TransportState</name><dataType>string</dataType>` + allowedValueList(state.TransportStates) + `</stateVariable>
     <stateVariable sendEvents="no"><name>TransportStatus</name><dataType>string</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>PlaybackStorageMedium</name><dataType>string</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>RecordStorageMedium</name><dataType>string</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>PossiblePlaybackStorageMedia</name><dataType>string</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>PossibleRecordStorageMedia</name><dataType>string</dataType></stateVariable>
-    <stateVariable sendEvents="no"><name>CurrentPlayMode</name><dataType>string</dataType></stateVariable>
-    <stateVariable sendEvents="no"><name>TransportPlaySpeed</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>CurrentTransportActions</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>CurrentPlayMode</name><dataType>string</dataType>` + allowedValueList(state.PlayModes) + `</stateVariable>
+    <stateVariable sendEvents="no"><name>TransportPlaySpeed</name><dataType>string</dataType>` + allowedValueList(PlaySpeeds) + `</stateVariable>
     <stateVariable sendEvents="no"><name>RecordMediumWriteStatus</name><dataType>string</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>CurrentRecordQualityMode</name><dataType>string</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>PossibleRecordQualityModes</name><dataType>string</dataType></stateVariable>
@@ -170,8 +318,9 @@ func SCPDAVTransportXML() string {
     <stateVariable sendEvents="no"><name>RelativeCounterPosition</name><dataType>i4</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>AbsoluteCounterPosition</name><dataType>i4</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>A_ARG_TYPE_InstanceID</name><dataType>ui4</dataType></stateVariable>
-    <stateVariable sendEvents="no"><name>A_ARG_TYPE_SeekMode</name><dataType>string</dataType><allowedValueList><allowedValue>REL_TIME</allowedValue><allowedValue>ABS_TIME</allowedValue></allowedValueList></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_SeekMode</name><dataType>string</dataType>` + allowedValueList(SeekUnits) + `</stateVariable>
     <stateVariable sendEvents="no"><name>A_ARG_TYPE_SeekTarget</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>LastChange</name><dataType>string</dataType></stateVariable>
   </serviceStateTable>
 </scpd>`
 }
@@ -219,6 +368,7 @@ func SCPDRenderingXML() string {
     <stateVariable sendEvents="no"><name>Mute</name><dataType>boolean</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>A_ARG_TYPE_InstanceID</name><dataType>ui4</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>A_ARG_TYPE_Channel</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>LastChange</name><dataType>string</dataType></stateVariable>
   </serviceStateTable>
 </scpd>`
 }
@@ -256,9 +406,9 @@ func SCPDConnectionManagerXML() string {
     </action>
   </actionList>
   <serviceStateTable>
-    <stateVariable sendEvents="no"><name>SourceProtocolInfo</name><dataType>string</dataType></stateVariable>
-    <stateVariable sendEvents="no"><name>SinkProtocolInfo</name><dataType>string</dataType></stateVariable>
-    <stateVariable sendEvents="no"><name>CurrentConnectionIDs</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>SourceProtocolInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>SinkProtocolInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>CurrentConnectionIDs</name><dataType>string</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>A_ARG_TYPE_ConnectionID</name><dataType>i4</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>A_ARG_TYPE_RcsID</name><dataType>i4</dataType></stateVariable>
     <stateVariable sendEvents="no"><name>A_ARG_TYPE_AVTransportID</name><dataType>i4</dataType></stateVariable>
@@ -269,3 +419,418 @@ func SCPDConnectionManagerXML() string {
   </serviceStateTable>
 </scpd>`
 }
+
+func SCPDProductXML() string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <actionList>
+    <action>
+      <name>Manufacturer</name>
+      <argumentList>
+        <argument><name>Name</name><direction>out</direction><relatedStateVariable>ManufacturerName</relatedStateVariable></argument>
+        <argument><name>Info</name><direction>out</direction><relatedStateVariable>ManufacturerInfo</relatedStateVariable></argument>
+        <argument><name>Url</name><direction>out</direction><relatedStateVariable>ManufacturerUrl</relatedStateVariable></argument>
+        <argument><name>ImageUri</name><direction>out</direction><relatedStateVariable>ManufacturerImageUri</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Model</name>
+      <argumentList>
+        <argument><name>Name</name><direction>out</direction><relatedStateVariable>ModelName</relatedStateVariable></argument>
+        <argument><name>Info</name><direction>out</direction><relatedStateVariable>ModelInfo</relatedStateVariable></argument>
+        <argument><name>Url</name><direction>out</direction><relatedStateVariable>ModelUrl</relatedStateVariable></argument>
+        <argument><name>ImageUri</name><direction>out</direction><relatedStateVariable>ModelImageUri</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Product</name>
+      <argumentList>
+        <argument><name>Room</name><direction>out</direction><relatedStateVariable>ProductRoom</relatedStateVariable></argument>
+        <argument><name>Name</name><direction>out</direction><relatedStateVariable>ProductName</relatedStateVariable></argument>
+        <argument><name>Info</name><direction>out</direction><relatedStateVariable>ProductInfo</relatedStateVariable></argument>
+        <argument><name>Url</name><direction>out</direction><relatedStateVariable>ProductUrl</relatedStateVariable></argument>
+        <argument><name>ImageUri</name><direction>out</direction><relatedStateVariable>ProductImageUri</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Standby</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>Standby</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SetStandby</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>Standby</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SourceCount</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>SourceCount</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SourceXml</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>SourceXml</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SourceIndex</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>SourceIndex</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SetSourceIndex</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>SourceIndex</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SetSourceIndexByName</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_String</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Source</name>
+      <argumentList>
+        <argument><name>Index</name><direction>in</direction><relatedStateVariable>SourceIndex</relatedStateVariable></argument>
+        <argument><name>SystemName</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_String</relatedStateVariable></argument>
+        <argument><name>Type</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_String</relatedStateVariable></argument>
+        <argument><name>Name</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_String</relatedStateVariable></argument>
+        <argument><name>Visible</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Bool</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Attributes</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>Attributes</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SourceXmlChangeCount</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_UI4</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="yes"><name>ManufacturerName</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ManufacturerInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ManufacturerUrl</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ManufacturerImageUri</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ModelName</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ModelInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ModelUrl</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ModelImageUri</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ProductRoom</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ProductName</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ProductInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ProductUrl</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ProductImageUri</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Standby</name><dataType>boolean</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>SourceIndex</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>SourceCount</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>SourceXml</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Attributes</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_String</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Bool</name><dataType>boolean</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_UI4</name><dataType>ui4</dataType></stateVariable>
+  </serviceStateTable>
+</scpd>`
+}
+
+func SCPDPlaylistXML() string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <actionList>
+    <action><name>Play</name></action>
+    <action><name>Pause</name></action>
+    <action><name>Stop</name></action>
+    <action><name>Next</name></action>
+    <action><name>Previous</name></action>
+    <action>
+      <name>SetRepeat</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>Repeat</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Repeat</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>Repeat</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SetShuffle</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>Shuffle</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Shuffle</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>Shuffle</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SeekSecondAbsolute</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_UI4</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SeekSecondRelative</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_I4</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SeekId</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>Id</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SeekIndex</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_UI4</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>TransportState</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>TransportState</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Id</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>Id</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Read</name>
+      <argumentList>
+        <argument><name>Id</name><direction>in</direction><relatedStateVariable>Id</relatedStateVariable></argument>
+        <argument><name>Uri</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Uri</relatedStateVariable></argument>
+        <argument><name>Metadata</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Metadata</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>ReadList</name>
+      <argumentList>
+        <argument><name>IdList</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_IdList</relatedStateVariable></argument>
+        <argument><name>TrackList</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_TrackList</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Insert</name>
+      <argumentList>
+        <argument><name>AfterId</name><direction>in</direction><relatedStateVariable>Id</relatedStateVariable></argument>
+        <argument><name>Uri</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Uri</relatedStateVariable></argument>
+        <argument><name>Metadata</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Metadata</relatedStateVariable></argument>
+        <argument><name>NewId</name><direction>out</direction><relatedStateVariable>Id</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>DeleteId</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>Id</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action><name>DeleteAll</name></action>
+    <action>
+      <name>TracksMax</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>TracksMax</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>IdArray</name>
+      <argumentList>
+        <argument><name>Token</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_UI4</relatedStateVariable></argument>
+        <argument><name>Array</name><direction>out</direction><relatedStateVariable>IdArray</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>IdArrayChanged</name>
+      <argumentList>
+        <argument><name>Token</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_UI4</relatedStateVariable></argument>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Bool</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>ProtocolInfo</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>ProtocolInfo</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="yes"><name>TransportState</name><dataType>string</dataType>` + allowedValueList(ohTransportStates) + `</stateVariable>
+    <stateVariable sendEvents="yes"><name>Repeat</name><dataType>boolean</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Shuffle</name><dataType>boolean</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Id</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>IdArray</name><dataType>bin.base64</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>TracksMax</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>ProtocolInfo</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_UI4</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_I4</name><dataType>i4</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Bool</name><dataType>boolean</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Uri</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_Metadata</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_IdList</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="no"><name>A_ARG_TYPE_TrackList</name><dataType>string</dataType></stateVariable>
+  </serviceStateTable>
+</scpd>`
+}
+
+// SCPDVolumeXML describes the OpenHome Volume service. Balance and fade are
+// not adjustable, so BalanceMax and FadeMax are 0.
+func SCPDVolumeXML() string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <actionList>
+    <action>
+      <name>Characteristics</name>
+      <argumentList>
+        <argument><name>VolumeMax</name><direction>out</direction><relatedStateVariable>VolumeMax</relatedStateVariable></argument>
+        <argument><name>VolumeUnity</name><direction>out</direction><relatedStateVariable>VolumeUnity</relatedStateVariable></argument>
+        <argument><name>VolumeSteps</name><direction>out</direction><relatedStateVariable>VolumeSteps</relatedStateVariable></argument>
+        <argument><name>VolumeMilliDbPerStep</name><direction>out</direction><relatedStateVariable>VolumeMilliDbPerStep</relatedStateVariable></argument>
+        <argument><name>BalanceMax</name><direction>out</direction><relatedStateVariable>BalanceMax</relatedStateVariable></argument>
+        <argument><name>FadeMax</name><direction>out</direction><relatedStateVariable>FadeMax</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SetVolume</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>Volume</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action><name>VolumeInc</name></action>
+    <action><name>VolumeDec</name></action>
+    <action>
+      <name>Volume</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>Volume</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>SetMute</name>
+      <argumentList>
+        <argument><name>Value</name><direction>in</direction><relatedStateVariable>Mute</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Mute</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>Mute</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>VolumeLimit</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>VolumeLimit</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="yes"><name>Volume</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Mute</name><dataType>boolean</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Balance</name><dataType>i4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Fade</name><dataType>i4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>VolumeLimit</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>VolumeMax</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>VolumeUnity</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>VolumeSteps</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>VolumeMilliDbPerStep</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>BalanceMax</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>FadeMax</name><dataType>ui4</dataType></stateVariable>
+  </serviceStateTable>
+</scpd>`
+}
+
+func SCPDTimeXML() string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <actionList>
+    <action>
+      <name>Time</name>
+      <argumentList>
+        <argument><name>TrackCount</name><direction>out</direction><relatedStateVariable>TrackCount</relatedStateVariable></argument>
+        <argument><name>Duration</name><direction>out</direction><relatedStateVariable>Duration</relatedStateVariable></argument>
+        <argument><name>Seconds</name><direction>out</direction><relatedStateVariable>Seconds</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="yes"><name>TrackCount</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Duration</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Seconds</name><dataType>ui4</dataType></stateVariable>
+  </serviceStateTable>
+</scpd>`
+}
+
+func SCPDInfoXML() string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <actionList>
+    <action>
+      <name>Counters</name>
+      <argumentList>
+        <argument><name>TrackCount</name><direction>out</direction><relatedStateVariable>TrackCount</relatedStateVariable></argument>
+        <argument><name>DetailsCount</name><direction>out</direction><relatedStateVariable>DetailsCount</relatedStateVariable></argument>
+        <argument><name>MetatextCount</name><direction>out</direction><relatedStateVariable>MetatextCount</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Track</name>
+      <argumentList>
+        <argument><name>Uri</name><direction>out</direction><relatedStateVariable>Uri</relatedStateVariable></argument>
+        <argument><name>Metadata</name><direction>out</direction><relatedStateVariable>Metadata</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Details</name>
+      <argumentList>
+        <argument><name>Duration</name><direction>out</direction><relatedStateVariable>Duration</relatedStateVariable></argument>
+        <argument><name>BitRate</name><direction>out</direction><relatedStateVariable>BitRate</relatedStateVariable></argument>
+        <argument><name>BitDepth</name><direction>out</direction><relatedStateVariable>BitDepth</relatedStateVariable></argument>
+        <argument><name>SampleRate</name><direction>out</direction><relatedStateVariable>SampleRate</relatedStateVariable></argument>
+        <argument><name>Lossless</name><direction>out</direction><relatedStateVariable>Lossless</relatedStateVariable></argument>
+        <argument><name>CodecName</name><direction>out</direction><relatedStateVariable>CodecName</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+    <action>
+      <name>Metatext</name>
+      <argumentList>
+        <argument><name>Value</name><direction>out</direction><relatedStateVariable>Metatext</relatedStateVariable></argument>
+      </argumentList>
+    </action>
+  </actionList>
+  <serviceStateTable>
+    <stateVariable sendEvents="yes"><name>TrackCount</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>DetailsCount</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>MetatextCount</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Uri</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Metadata</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Duration</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>BitRate</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>BitDepth</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>SampleRate</name><dataType>ui4</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Lossless</name><dataType>boolean</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>CodecName</name><dataType>string</dataType></stateVariable>
+    <stateVariable sendEvents="yes"><name>Metatext</name><dataType>string</dataType></stateVariable>
+  </serviceStateTable>
+</scpd>`
+}
@@ -1,17 +1,24 @@
 package upnp
 
 import (
+	"context"
 	"encoding/xml"
+	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/state"
 )
 
 // Device description decode targets. Defined locally to avoid coupling to the
 // production xml.go types (which model DIDL, not the device description).
 
 type descRoot struct {
-	XMLName xml.Name   `xml:"root"`
-	Device  descDevice `xml:"device"`
+	XMLName  xml.Name   `xml:"root"`
+	ConfigID int        `xml:"configId,attr"`
+	Device   descDevice `xml:"device"`
 }
 
 type descDevice struct {
@@ -20,10 +27,19 @@ type descDevice struct {
 	Manufacturer string       `xml:"manufacturer"`
 	ModelName    string       `xml:"modelName"`
 	UDN          string       `xml:"UDN"`
+	Icons        []descIcon   `xml:"iconList>icon"`
 	ServiceList  descServices `xml:"serviceList"`
 	Presentation string       `xml:"presentationURL"`
 }
 
+type descIcon struct {
+	MimeType string `xml:"mimetype"`
+	Width    int    `xml:"width"`
+	Height   int    `xml:"height"`
+	Depth    int    `xml:"depth"`
+	URL      string `xml:"url"`
+}
+
 type descServices struct {
 	Services []descService `xml:"service"`
 }
@@ -45,10 +61,34 @@ func parseDevice(t *testing.T, xmlStr string) descRoot {
 	return r
 }
 
+func TestDeviceInfoFromFollowsSettings(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st := state.NewWithPlayerFactory(ctx, config.Config{
+		FriendlyName: "RCast (den)",
+		Manufacturer: config.DefaultManufacturer,
+		ModelName:    config.DefaultModelName,
+	}, func() player.Player { return newFakePlayer() })
+
+	want := DeviceInfo{FriendlyName: "RCast (den)", Manufacturer: "GoDLNA", ModelName: "GoDLNA-DMR", ConfigID: 1}
+	if got := DeviceInfoFrom(st); got != want {
+		t.Fatalf("info = %+v, want %+v", got, want)
+	}
+
+	set := st.Settings()
+	set.FriendlyName = "Office"
+	st.ApplySettings(set)
+	want.FriendlyName, want.ConfigID = "Office", 2
+	if got := DeviceInfoFrom(st); got != want {
+		t.Fatalf("info after rename = %+v, want %+v", got, want)
+	}
+}
+
 func TestDeviceDescriptionXML(t *testing.T) {
 	const base = "http://127.0.0.1:8200"
 	const uuid = "uuid:abcd-1234"
-	r := parseDevice(t, DeviceDescriptionXML(base, uuid))
+	info := DeviceInfo{FriendlyName: "Den & <Office>", Manufacturer: "GoDLNA", ModelName: "GoDLNA-DMR", ConfigID: 7}
+	r := parseDevice(t, DeviceDescriptionXML(base, uuid, info))
 
 	d := r.Device
 	if d.DeviceType != DeviceType {
@@ -57,16 +97,32 @@ func TestDeviceDescriptionXML(t *testing.T) {
 	if d.UDN != uuid {
 		t.Errorf("UDN=%q, want %q", d.UDN, uuid)
 	}
-	if d.FriendlyName != "RCast" {
-		t.Errorf("friendlyName=%q, want RCast", d.FriendlyName)
+	if d.FriendlyName != info.FriendlyName {
+		t.Errorf("friendlyName=%q, want %q", d.FriendlyName, info.FriendlyName)
+	}
+	if d.Manufacturer != info.Manufacturer || d.ModelName != info.ModelName {
+		t.Errorf("manufacturer=%q modelName=%q", d.Manufacturer, d.ModelName)
+	}
+	if r.ConfigID != 7 {
+		t.Errorf("configId=%d, want 7", r.ConfigID)
+	}
+	icons := DeviceIcons()
+	if len(d.Icons) != len(icons) {
+		t.Fatalf("len(icons)=%d, want %d", len(d.Icons), len(icons))
+	}
+	for i, icon := range icons {
+		got := d.Icons[i]
+		if got != (descIcon{icon.MimeType, icon.Width, icon.Height, icon.Depth, icon.URL}) {
+			t.Errorf("icon[%d]=%+v, want %+v", i, got, icon)
+		}
 	}
 	if !strings.Contains(d.Presentation, base+"/") {
 		t.Errorf("presentationURL=%q, want contains %s/", d.Presentation, base)
 	}
 
 	svcs := d.ServiceList.Services
-	if len(svcs) != 3 {
-		t.Fatalf("len(services)=%d, want 3", len(svcs))
+	if len(svcs) != 3+len(OpenHomeTypes) {
+		t.Fatalf("len(services)=%d, want %d", len(svcs), 3+len(OpenHomeTypes))
 	}
 
 	wantByType := map[string]descService{
@@ -85,6 +141,19 @@ func TestDeviceDescriptionXML(t *testing.T) {
 			ControlURL:  "/upnp/control/connectionmanager",
 			EventSubURL: "/upnp/event/connectionmanager",
 		},
+		PlaylistType: {
+			SCPDURL:     "/upnp/service/playlist.xml",
+			ControlURL:  "/upnp/control/playlist",
+			EventSubURL: "/upnp/event/playlist",
+		},
+	}
+	for _, typ := range []string{ProductType, VolumeType, TimeType, InfoType} {
+		name := OpenHomeServiceName(typ)
+		wantByType[typ] = descService{
+			SCPDURL:     "/upnp/service/" + name + ".xml",
+			ControlURL:  "/upnp/control/" + name,
+			EventSubURL: "/upnp/event/" + name,
+		}
 	}
 
 	gotTypes := map[string]bool{}
@@ -112,6 +181,24 @@ func TestDeviceDescriptionXML(t *testing.T) {
 	}
 }
 
+func TestDeviceDescriptionUnderAPrefix(t *testing.T) {
+	const base = "http://127.0.0.1:8200/devices/office"
+	d := parseDevice(t, DeviceDescriptionXML(base, "uuid:abcd-1234", DeviceInfo{FriendlyName: "Office"})).Device
+	for _, s := range d.ServiceList.Services {
+		if !strings.HasPrefix(s.SCPDURL, "/devices/office/upnp/service/") ||
+			!strings.HasPrefix(s.ControlURL, "/devices/office/upnp/control/") ||
+			!strings.HasPrefix(s.EventSubURL, "/devices/office/upnp/event/") {
+			t.Errorf("service %s not under the prefix: %+v", s.ServiceType, s)
+		}
+	}
+	if len(d.Icons) == 0 || !strings.HasPrefix(d.Icons[0].URL, "/devices/office/icons/") {
+		t.Errorf("icons not under the prefix: %+v", d.Icons)
+	}
+	if d.Presentation != base+"/" {
+		t.Errorf("presentationURL=%q", d.Presentation)
+	}
+}
+
 // SCPD decode targets.
 
 type scpdRoot struct {
@@ -182,32 +269,49 @@ func TestSCPDAVTransportXML(t *testing.T) {
 	r := parseSCPD(t, SCPDAVTransportXML())
 	assertActionsExact(t, r, []string{
 		"SetAVTransportURI",
+		"SetNextAVTransportURI",
 		"Play",
 		"Pause",
 		"Stop",
 		"Seek",
+		"Next",
+		"Previous",
+		"SetPlayMode",
 		"GetTransportInfo",
 		"GetPositionInfo",
 		"GetMediaInfo",
 		"GetTransportSettings",
+		"GetCurrentTransportActions",
 		"GetDeviceCapabilities",
 	})
 
-	// A_ARG_TYPE_SeekMode allowedValueList must be exactly {REL_TIME, ABS_TIME}.
+	// A_ARG_TYPE_SeekMode allowedValueList must be exactly the implemented units.
+	if vals := allowedValues(t, r, "A_ARG_TYPE_SeekMode"); strings.Join(vals, " ") != "REL_TIME ABS_TIME X_DLNA_REL_BYTE ABS_COUNT TRACK_NR" {
+		t.Errorf("A_ARG_TYPE_SeekMode allowed=%v, want [REL_TIME ABS_TIME X_DLNA_REL_BYTE ABS_COUNT TRACK_NR]", vals)
+	}
+	if vals := allowedValues(t, r, "TransportState"); strings.Join(vals, " ") != "STOPPED PLAYING PAUSED_PLAYBACK TRANSITIONING NO_MEDIA_PRESENT" {
+		t.Errorf("TransportState allowed=%v", vals)
+	}
+	if vals := allowedValues(t, r, "TransportPlaySpeed"); strings.Join(vals, " ") != strings.Join(PlaySpeeds, " ") {
+		t.Errorf("TransportPlaySpeed allowed=%v, want %v", vals, PlaySpeeds)
+	}
+}
+
+// allowedValues returns the allowedValueList of the named state variable.
+func allowedValues(t *testing.T, r scpdRoot, name string) []string {
+	t.Helper()
 	for _, sv := range r.StateTable.Vars {
-		if sv.Name != "A_ARG_TYPE_SeekMode" {
+		if sv.Name != name {
 			continue
 		}
 		var vals []string
 		for _, a := range sv.AllowedValueList {
 			vals = append(vals, strings.TrimSpace(a.Value))
 		}
-		if len(vals) != 2 || vals[0] != "REL_TIME" || vals[1] != "ABS_TIME" {
-			t.Errorf("A_ARG_TYPE_SeekMode allowed=%v, want [REL_TIME ABS_TIME]", vals)
-		}
-		return
+		return vals
 	}
-	t.Errorf("A_ARG_TYPE_SeekMode stateVariable not found")
+	t.Errorf("%s stateVariable not found", name)
+	return nil
 }
 
 func TestSCPDRenderingXML(t *testing.T) {
@@ -244,3 +348,27 @@ func TestSCPDConnectionManagerXML(t *testing.T) {
 	}
 	t.Errorf("A_ARG_TYPE_Direction stateVariable not found")
 }
+
+func TestDeviceIconsCoverStandardSizes(t *testing.T) {
+	seen := map[string]bool{}
+	for _, icon := range DeviceIcons() {
+		if icon.Width != icon.Height || icon.Depth != 24 {
+			t.Errorf("icon %+v is not a square 24-bit icon", icon)
+		}
+		ext := ".png"
+		if icon.MimeType == "image/jpeg" {
+			ext = ".jpg"
+		}
+		if !strings.HasPrefix(icon.URL, "/icons/") || !strings.HasSuffix(icon.URL, ext) {
+			t.Errorf("icon URL %q does not match %s", icon.URL, icon.MimeType)
+		}
+		seen[icon.MimeType+" "+strconv.Itoa(icon.Width)] = true
+	}
+	for _, mime := range []string{"image/png", "image/jpeg"} {
+		for _, size := range []string{"48", "120", "256"} {
+			if !seen[mime+" "+size] {
+				t.Errorf("missing %s %s icon", mime, size)
+			}
+		}
+	}
+}
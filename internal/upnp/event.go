@@ -1,22 +1,501 @@
 package upnp
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	googleuuid "github.com/google/uuid"
 	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/state"
+)
+
+const (
+	defaultSubscriptionTimeout = 1800 * time.Second
+	minSubscriptionTimeout     = 60 * time.Second
+	maxSubscriptionTimeout     = 24 * time.Hour
+
+	// eventQueueSize bounds the NOTIFY backlog of a single subscriber. A
+	// control point that falls this far behind is treated as gone.
+	eventQueueSize = 16
+	// maxDeliveryFailures is how many consecutive NOTIFY failures drop a
+	// subscription before its TIMEOUT would.
+	maxDeliveryFailures = 3
+)
+
+// Injectable runtime hooks. Every default reproduces production behavior.
+var (
+	// eventModeration limits LastChange to at most five events per second,
+	// as required by the AVTransport and RenderingControl specifications.
+	eventModeration = 200 * time.Millisecond
+	expiryInterval  = 30 * time.Second
+	notifyTimeout   = 5 * time.Second
 )
 
-func EventHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debug("Event request method=%s path=%s header=%v", r.Method, r.URL.Path, r.Header)
+// EventManager implements UPnP GENA eventing. It tracks SUBSCRIBE requests for
+// each service and pushes NOTIFY messages to the subscribers whenever the
+// PlayerState changes a value the service events.
+type EventManager struct {
+	st         *state.PlayerState
+	client     *http.Client
+	moderation time.Duration
+	expiry     time.Duration
+
+	mu   sync.Mutex
+	subs map[string]*subscription
+	last map[string][]eventVar // per service, the values of the last publish
+}
+
+type subscription struct {
+	sid       string
+	service   string
+	callbacks []string
+	expires   time.Time
+	seq       uint32
+	queue     chan notification
+}
+
+type notification struct {
+	seq  uint32
+	body []byte
+}
+
+// eventVar is one evented state variable. RenderingControl variables carry a
+// channel attribute inside LastChange.
+type eventVar struct {
+	name    string
+	value   string
+	channel string
+}
+
+// NewEventManager creates the subscription registry and starts the goroutine
+// that turns PlayerState changes into NOTIFY messages. It stops with the
+// state's context.
+func NewEventManager(st *state.PlayerState) *EventManager {
+	m := &EventManager{
+		st:         st,
+		client:     &http.Client{Timeout: notifyTimeout},
+		moderation: eventModeration,
+		expiry:     expiryInterval,
+		subs:       make(map[string]*subscription),
+		last:       make(map[string][]eventVar),
+	}
+	snap, set := st.Snapshot(), st.Settings()
+	for _, service := range changingServices {
+		m.last[service] = serviceVars(service, snap, set)
+	}
+	changes, unwatch := st.Watch()
+	go m.run(st.Context(), changes, unwatch)
+	return m
+}
+
+// Handler serves the eventSubURL of one service.
+func (m *EventManager) Handler(service string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debug("Event request method=%s path=%s header=%v", r.Method, r.URL.Path, r.Header)
+
+		switch r.Method {
+		case "SUBSCRIBE":
+			m.subscribe(w, r, service)
+		case "UNSUBSCRIBE":
+			m.unsubscribe(w, r, service)
+		default:
+			w.Header().Set("Allow", "SUBSCRIBE, UNSUBSCRIBE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (m *EventManager) subscribe(w http.ResponseWriter, r *http.Request, service string) {
+	sid := r.Header.Get("SID")
+	callback := r.Header.Get("CALLBACK")
+	nt := r.Header.Get("NT")
+	timeout := parseSubscriptionTimeout(r.Header.Get("TIMEOUT"))
+
+	if sid != "" {
+		if callback != "" || nt != "" {
+			http.Error(w, "SID cannot be combined with CALLBACK or NT", http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		sub, ok := m.subs[sid]
+		if ok && sub.service == service {
+			sub.expires = time.Now().Add(timeout)
+		}
+		m.mu.Unlock()
+		if !ok || sub.service != service {
+			http.Error(w, "unknown subscription", http.StatusPreconditionFailed)
+			return
+		}
+		log.Debug("renewed event subscription sid=%s timeout=%s", sid, timeout)
+		writeSubscribeResponse(w, sid, timeout)
+		return
+	}
+
+	if nt != "upnp:event" {
+		http.Error(w, "NT must be upnp:event", http.StatusPreconditionFailed)
+		return
+	}
+	callbacks := parseCallbacks(callback)
+	if len(callbacks) == 0 {
+		http.Error(w, "missing or invalid CALLBACK", http.StatusPreconditionFailed)
+		return
+	}
+
+	sub := &subscription{
+		sid:       "uuid:" + googleuuid.NewString(),
+		service:   service,
+		callbacks: callbacks,
+		expires:   time.Now().Add(timeout),
+		queue:     make(chan notification, eventQueueSize),
+	}
+	// Queue the initial event as the subscription is published, so every
+	// change publish queues after it takes SEQ 1 and on.
+	m.mu.Lock()
+	m.subs[sub.sid] = sub
+	m.enqueueLocked(sub, propertySet(service, serviceVars(service, m.st.Snapshot(), m.st.Settings())))
+	m.mu.Unlock()
+
+	log.Debug("new event subscription sid=%s service=%s callbacks=%v timeout=%s", sub.sid, service, callbacks, timeout)
+	writeSubscribeResponse(w, sub.sid, timeout)
+	// The initial event must follow the SUBSCRIBE response, so push the
+	// response out before delivering anything.
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	go m.deliver(sub)
+}
+
+func (m *EventManager) unsubscribe(w http.ResponseWriter, r *http.Request, service string) {
+	sid := r.Header.Get("SID")
+	if sid == "" {
+		http.Error(w, "missing SID", http.StatusPreconditionFailed)
+		return
+	}
+	if r.Header.Get("CALLBACK") != "" || r.Header.Get("NT") != "" {
+		http.Error(w, "SID cannot be combined with CALLBACK or NT", http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	sub, ok := m.subs[sid]
+	if ok && sub.service == service {
+		m.removeLocked(sub)
+	}
+	m.mu.Unlock()
+	if !ok || sub.service != service {
+		http.Error(w, "unknown subscription", http.StatusPreconditionFailed)
+		return
+	}
+	log.Debug("removed event subscription sid=%s", sid)
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeSubscribeResponse(w http.ResponseWriter, sid string, timeout time.Duration) {
+	w.Header().Set("SID", sid)
+	w.Header().Set("TIMEOUT", fmt.Sprintf("Second-%d", int(timeout.Seconds())))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *EventManager) run(ctx context.Context, changes <-chan struct{}, unwatch func()) {
+	defer unwatch()
+	ticker := time.NewTicker(m.expiry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			m.closeAll()
+			return
+		case <-ticker.C:
+			m.expire(time.Now())
+		case <-changes:
+			m.publish()
+			// Changes arriving during the pause coalesce into the next publish.
+			timer := time.NewTimer(m.moderation)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				m.closeAll()
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
 
-	switch r.Method {
-	case "SUBSCRIBE", "UNSUBSCRIBE":
-		// Do not hand out a SID unless callbacks are actually tracked and
-		// notified. A false successful subscription makes control points wait
-		// forever for state changes that will never arrive.
-		http.Error(w, "UPnP eventing is not implemented", http.StatusNotImplemented)
+// publish sends every value that changed since the previous publish to the
+// subscribers of the owning service.
+func (m *EventManager) publish() {
+	snap, set := m.st.Snapshot(), m.st.Settings()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, service := range changingServices {
+		vars := serviceVars(service, snap, set)
+		changed := changedVars(m.last[service], vars)
+		m.last[service] = vars
+		if len(changed) == 0 {
+			continue
+		}
+		body := propertySet(service, changed)
+		for _, sub := range m.subs {
+			if sub.service == service {
+				m.enqueueLocked(sub, body)
+			}
+		}
+	}
+}
+
+// enqueueLocked assigns the next SEQ and queues the message. A subscriber
+// whose queue is full is dropped rather than allowed to stall the others.
+// Caller must hold m.mu.
+func (m *EventManager) enqueueLocked(sub *subscription, body []byte) {
+	if m.subs[sub.sid] != sub {
+		return
+	}
+	select {
+	case sub.queue <- notification{seq: sub.seq, body: body}:
+		// SEQ wraps from 4294967295 to 1; 0 is reserved for the initial event.
+		sub.seq++
+		if sub.seq == 0 {
+			sub.seq = 1
+		}
 	default:
-		w.Header().Set("Allow", "SUBSCRIBE, UNSUBSCRIBE")
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		log.Warn("dropping event subscription sid=%s: notification backlog full", sub.sid)
+		m.removeLocked(sub)
+	}
+}
+
+// removeLocked forgets the subscription and stops its delivery goroutine.
+// Caller must hold m.mu.
+func (m *EventManager) removeLocked(sub *subscription) {
+	if m.subs[sub.sid] != sub {
+		return
+	}
+	delete(m.subs, sub.sid)
+	close(sub.queue)
+}
+
+func (m *EventManager) expire(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sub := range m.subs {
+		if now.After(sub.expires) {
+			log.Debug("event subscription expired sid=%s", sub.sid)
+			m.removeLocked(sub)
+		}
+	}
+}
+
+func (m *EventManager) closeAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sub := range m.subs {
+		m.removeLocked(sub)
+	}
+}
+
+// deliver sends the subscriber's notifications in SEQ order until the
+// subscription is removed or keeps failing.
+func (m *EventManager) deliver(sub *subscription) {
+	failures := 0
+	for n := range sub.queue {
+		if err := m.notify(sub, n); err != nil {
+			failures++
+			log.Warn("event NOTIFY sid=%s seq=%d failed (%d/%d): %v", sub.sid, n.seq, failures, maxDeliveryFailures, err)
+			if failures >= maxDeliveryFailures {
+				m.mu.Lock()
+				m.removeLocked(sub)
+				m.mu.Unlock()
+				return
+			}
+			continue
+		}
+		failures = 0
+	}
+}
+
+// notify tries each callback URL in order until one accepts the message.
+func (m *EventManager) notify(sub *subscription, n notification) error {
+	var lastErr error
+	for _, callback := range sub.callbacks {
+		req, err := http.NewRequestWithContext(m.st.Context(), "NOTIFY", callback, bytes.NewReader(n.body))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+		req.Header.Set("NT", "upnp:event")
+		req.Header.Set("NTS", "upnp:propchange")
+		req.Header.Set("SID", sub.sid)
+		req.Header.Set("SEQ", strconv.FormatUint(uint64(n.seq), 10))
+		resp, err := m.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			lastErr = fmt.Errorf("callback %s returned %s", callback, resp.Status)
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// parseCallbacks extracts the http URLs from a CALLBACK header such as
+// "<http://10.0.0.2:49152/evt><http://10.0.0.2:49153/evt>".
+func parseCallbacks(header string) []string {
+	var callbacks []string
+	for {
+		start := strings.IndexByte(header, '<')
+		if start < 0 {
+			return callbacks
+		}
+		end := strings.IndexByte(header[start:], '>')
+		if end < 0 {
+			return callbacks
+		}
+		raw := strings.TrimSpace(header[start+1 : start+end])
+		header = header[start+end+1:]
+		if u, err := url.Parse(raw); err == nil && u.Scheme == "http" && u.Host != "" {
+			callbacks = append(callbacks, raw)
+		}
+	}
+}
+
+// parseSubscriptionTimeout honors "Second-N" within sane bounds and falls back
+// to the default for "Second-infinite", missing or malformed values.
+func parseSubscriptionTimeout(header string) time.Duration {
+	v, ok := strings.CutPrefix(strings.TrimSpace(header), "Second-")
+	if !ok {
+		return defaultSubscriptionTimeout
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return defaultSubscriptionTimeout
+	}
+	return min(max(time.Duration(n)*time.Second, minSubscriptionTimeout), maxSubscriptionTimeout)
+}
+
+// changingServices are the services whose evented variables follow the
+// renderer state; ConnectionManager only sends its initial event.
+var changingServices = append([]string{AVTransportType, RenderingType}, OpenHomeTypes...)
+
+// serviceVars lists the evented variables of a service for the given state
+// and settings.
+func serviceVars(service string, snap state.Snapshot, set state.Settings) []eventVar {
+	switch service {
+	case AVTransportType:
+		track, nrTracks := trackNumbers(snap.URI, snap.Playlist)
+		meta := TrackMetadata(snap.URI, snap.Meta, TrackInfo{})
+		return []eventVar{
+			{name: "TransportState", value: snap.TransportState},
+			{name: "TransportStatus", value: "OK"},
+			{name: "TransportPlaySpeed", value: formatPlaySpeed(snap.Speed)},
+			{name: "CurrentTransportActions", value: strings.Join(snap.TransportActions(), ",")},
+			{name: "CurrentPlayMode", value: snap.Playlist.PlayMode()},
+			{name: "NumberOfTracks", value: strconv.Itoa(nrTracks)},
+			{name: "CurrentTrack", value: strconv.Itoa(track)},
+			{name: "AVTransportURI", value: snap.URI},
+			{name: "AVTransportURIMetaData", value: meta},
+			{name: "CurrentTrackURI", value: snap.URI},
+			{name: "CurrentTrackMetaData", value: meta},
+			{name: "NextAVTransportURI", value: snap.NextURI},
+			{name: "NextAVTransportURIMetaData", value: TrackMetadata(snap.NextURI, snap.NextMeta, TrackInfo{})},
+		}
+	case RenderingType:
+		mute := "0"
+		if snap.Mute {
+			mute = "1"
+		}
+		return []eventVar{
+			{name: "Volume", value: strconv.Itoa(snap.Volume), channel: "Master"},
+			{name: "Mute", value: mute, channel: "Master"},
+		}
+	case ConnectionManagerType:
+		return []eventVar{
+			{name: "SourceProtocolInfo", value: ""},
+			{name: "SinkProtocolInfo", value: sinkProtocolInfo()},
+			{name: "CurrentConnectionIDs", value: "0"},
+		}
+	}
+	return openHomeVars(service, snap, set)
+}
+
+// changedVars returns the entries of next whose value differs from prev.
+func changedVars(prev, next []eventVar) []eventVar {
+	old := make(map[string]string, len(prev))
+	for _, v := range prev {
+		old[v.name] = v.value
+	}
+	var changed []eventVar
+	for _, v := range next {
+		if value, ok := old[v.name]; !ok || value != v.value {
+			changed = append(changed, v)
+		}
+	}
+	return changed
+}
+
+// lastChangeNamespace returns the LastChange event schema of a service, or ""
+// for services that event their variables directly.
+func lastChangeNamespace(service string) string {
+	switch service {
+	case AVTransportType:
+		return "urn:schemas-upnp-org:metadata-1-0/AVT/"
+	case RenderingType:
+		return "urn:schemas-upnp-org:metadata-1-0/RCS/"
+	}
+	return ""
+}
+
+// propertySet renders a GENA NOTIFY body. AVTransport and RenderingControl
+// wrap their variables in a single escaped LastChange document.
+func propertySet(service string, vars []eventVar) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<e:propertyset xmlns:e="urn:schemas-upnp-org:event-1-0">`)
+	if ns := lastChangeNamespace(service); ns != "" {
+		b.WriteString("<e:property><LastChange>")
+		b.WriteString(html.EscapeString(lastChangeXML(ns, vars)))
+		b.WriteString("</LastChange></e:property>")
+	} else {
+		for _, v := range vars {
+			fmt.Fprintf(&b, "<e:property><%s>%s</%s></e:property>", v.name, html.EscapeString(v.value), v.name)
+		}
+	}
+	b.WriteString("</e:propertyset>")
+	return []byte(b.String())
+}
+
+func lastChangeXML(namespace string, vars []eventVar) string {
+	var b strings.Builder
+	b.WriteString(`<Event xmlns="`)
+	b.WriteString(namespace)
+	b.WriteString(`"><InstanceID val="0">`)
+	for _, v := range vars {
+		b.WriteString("<")
+		b.WriteString(v.name)
+		if v.channel != "" {
+			b.WriteString(` channel="`)
+			b.WriteString(v.channel)
+			b.WriteString(`"`)
+		}
+		b.WriteString(` val="`)
+		b.WriteString(html.EscapeString(v.value))
+		b.WriteString(`"/>`)
 	}
+	b.WriteString("</InstanceID></Event>")
+	return b.String()
 }
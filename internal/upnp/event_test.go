@@ -1,42 +1,352 @@
 package upnp
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/state"
 )
 
-// Note: TestEventHandlerDoesNotIssueFalseSubscription (SUBSCRIBE -> 501, empty
-// SID) already lives in handlers_test.go and is not duplicated here. These
-// cases cover the remaining methods.
+// receivedEvent is one NOTIFY captured by eventSink.
+type receivedEvent struct {
+	sid  string
+	seq  string
+	nt   string
+	nts  string
+	body string
+}
+
+// eventSink is a local HTTP callback server standing in for a control point.
+type eventSink struct {
+	srv    *httptest.Server
+	events chan receivedEvent
+
+	mu     sync.Mutex
+	status int
+}
+
+func newEventSink(t *testing.T) *eventSink {
+	t.Helper()
+	s := &eventSink{events: make(chan receivedEvent, 32), status: http.StatusOK}
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		status := s.status
+		s.mu.Unlock()
+		w.WriteHeader(status)
+		if r.Method != "NOTIFY" {
+			return
+		}
+		s.events <- receivedEvent{
+			sid:  r.Header.Get("SID"),
+			seq:  r.Header.Get("SEQ"),
+			nt:   r.Header.Get("NT"),
+			nts:  r.Header.Get("NTS"),
+			body: string(body),
+		}
+	}))
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func (s *eventSink) setStatus(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = code
+}
+
+func (s *eventSink) next(t *testing.T) receivedEvent {
+	t.Helper()
+	select {
+	case ev := <-s.events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for NOTIFY")
+		return receivedEvent{}
+	}
+}
+
+// newEventState builds a PlayerState plus EventManager with fast moderation.
+func newEventState(t *testing.T) (*state.PlayerState, *EventManager) {
+	t.Helper()
+	orig := eventModeration
+	eventModeration = time.Millisecond
+	t.Cleanup(func() { eventModeration = orig })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	st := state.NewWithPlayerFactory(ctx, config.Config{}, func() player.Player { return newFakePlayer() })
+	t.Cleanup(func() {
+		cancel()
+		st.Stop()
+	})
+	return st, NewEventManager(st)
+}
 
-func TestEventHandlerUnsubscribeNotImplemented(t *testing.T) {
-	req := httptest.NewRequest("UNSUBSCRIBE", "/upnp/event/avtransport", nil)
-	req.Header.Set("SID", "uuid:deadbeef")
+func subscribe(handler http.Handler, callback, timeout string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("SUBSCRIBE", "/upnp/event/avtransport", nil)
+	if callback != "" {
+		req.Header.Set("CALLBACK", "<"+callback+">")
+		req.Header.Set("NT", "upnp:event")
+	}
+	if timeout != "" {
+		req.Header.Set("TIMEOUT", timeout)
+	}
 	rec := httptest.NewRecorder()
-	EventHandler(rec, req)
-	if rec.Code != http.StatusNotImplemented {
-		t.Fatalf("UNSUBSCRIBE status=%d, want 501; body=%s", rec.Code, rec.Body.String())
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func withSID(method, sid string) *http.Request {
+	req := httptest.NewRequest(method, "/upnp/event/avtransport", nil)
+	req.Header.Set("SID", sid)
+	return req
+}
+
+func TestEventSubscribeSendsInitialLastChange(t *testing.T) {
+	st, m := newEventState(t)
+	sink := newEventSink(t)
+	st.SetURI("https://example.test/a.mp4", "")
+
+	rec := subscribe(m.Handler(AVTransportType), sink.srv.URL+"/evt", "Second-300")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SUBSCRIBE status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	sid := rec.Header().Get("SID")
+	if !strings.HasPrefix(sid, "uuid:") {
+		t.Fatalf("SID=%q, want uuid: prefix", sid)
+	}
+	if got := rec.Header().Get("TIMEOUT"); got != "Second-300" {
+		t.Fatalf("TIMEOUT=%q, want Second-300", got)
 	}
-	if sid := rec.Header().Get("SID"); sid != "" {
-		t.Fatalf("SID=%q, want empty (must not confirm unsubscription)", sid)
+
+	ev := sink.next(t)
+	if ev.sid != sid || ev.seq != "0" || ev.nt != "upnp:event" || ev.nts != "upnp:propchange" {
+		t.Fatalf("initial event headers sid=%q seq=%q nt=%q nts=%q", ev.sid, ev.seq, ev.nt, ev.nts)
+	}
+	lastChange := XMLText([]byte(ev.body), "LastChange")
+	for _, want := range []string{
+		`<Event xmlns="urn:schemas-upnp-org:metadata-1-0/AVT/">`,
+		`<TransportState val="STOPPED"/>`,
+		`<AVTransportURI val="https://example.test/a.mp4"/>`,
+	} {
+		if !strings.Contains(lastChange, want) {
+			t.Fatalf("LastChange missing %q: %s", want, lastChange)
+		}
+	}
+}
+
+func TestEventStateChangesNotifyWithIncreasingSEQ(t *testing.T) {
+	st, m := newEventState(t)
+	sink := newEventSink(t)
+	rec := subscribe(m.Handler(AVTransportType), sink.srv.URL, "")
+	if got := rec.Header().Get("TIMEOUT"); got != "Second-1800" {
+		t.Fatalf("default TIMEOUT=%q, want Second-1800", got)
+	}
+	_ = sink.next(t) // initial event
+
+	st.SetTransportState("PLAYING")
+	ev := sink.next(t)
+	if ev.seq != "1" {
+		t.Fatalf("SEQ=%q, want 1", ev.seq)
+	}
+	lastChange := XMLText([]byte(ev.body), "LastChange")
+	if !strings.Contains(lastChange, `<TransportState val="PLAYING"/>`) {
+		t.Fatalf("LastChange=%s", lastChange)
+	}
+	if strings.Contains(lastChange, "AVTransportURI") {
+		t.Fatalf("unchanged variables were evented: %s", lastChange)
+	}
+
+	st.SetTransportState("PAUSED_PLAYBACK")
+	if ev := sink.next(t); ev.seq != "2" {
+		t.Fatalf("SEQ=%q, want 2", ev.seq)
+	}
+}
+
+// flushHook runs onFlush when the SUBSCRIBE response is pushed out, the
+// moment a concurrent change would race the initial event.
+type flushHook struct {
+	*httptest.ResponseRecorder
+	onFlush func()
+}
+
+func (f flushHook) Flush() {
+	f.ResponseRecorder.Flush()
+	f.onFlush()
+}
+
+func TestEventInitialEventPrecedesConcurrentChanges(t *testing.T) {
+	st, m := newEventState(t)
+	sink := newEventSink(t)
+	st.SetURI("https://example.test/a.mp4", "")
+	m.publish() // so the racing change below is a delta without the URI
+
+	req := httptest.NewRequest("SUBSCRIBE", "/upnp/event/avtransport", nil)
+	req.Header.Set("CALLBACK", "<"+sink.srv.URL+">")
+	req.Header.Set("NT", "upnp:event")
+	rec := flushHook{httptest.NewRecorder(), func() {
+		st.SetTransportState("PLAYING")
+		m.publish()
+	}}
+	m.Handler(AVTransportType).ServeHTTP(rec, req)
+
+	ev := sink.next(t)
+	if ev.seq != "0" || !strings.Contains(XMLText([]byte(ev.body), "LastChange"), "AVTransportURI") {
+		t.Fatalf("first event seq=%q body=%s, want the full initial event as SEQ 0", ev.seq, ev.body)
+	}
+	ev = sink.next(t)
+	lastChange := XMLText([]byte(ev.body), "LastChange")
+	if ev.seq != "1" || !strings.Contains(lastChange, `<TransportState val="PLAYING"/>`) || strings.Contains(lastChange, "AVTransportURI") {
+		t.Fatalf("second event seq=%q body=%s, want the change as SEQ 1", ev.seq, ev.body)
 	}
 }
 
-func TestEventHandlerSubscribeNoCallbacksStill501(t *testing.T) {
-	// Even without CALLBACK/NT the handler must not pretend to subscribe.
+func TestEventRenderingControlVolumeAndMute(t *testing.T) {
+	st, m := newEventState(t)
+	sink := newEventSink(t)
 	req := httptest.NewRequest("SUBSCRIBE", "/upnp/event/renderingcontrol", nil)
+	req.Header.Set("CALLBACK", "<"+sink.srv.URL+">")
+	req.Header.Set("NT", "upnp:event")
+	m.Handler(RenderingType).ServeHTTP(httptest.NewRecorder(), req)
+
+	initial := XMLText([]byte(sink.next(t).body), "LastChange")
+	if !strings.Contains(initial, `<Volume channel="Master" val="50"/>`) || !strings.Contains(initial, `<Mute channel="Master" val="0"/>`) {
+		t.Fatalf("initial LastChange=%s", initial)
+	}
+
+	st.SetVolume(80)
+	if lc := XMLText([]byte(sink.next(t).body), "LastChange"); !strings.Contains(lc, `<Volume channel="Master" val="80"/>`) {
+		t.Fatalf("volume LastChange=%s", lc)
+	}
+	st.SetMute(true)
+	if lc := XMLText([]byte(sink.next(t).body), "LastChange"); !strings.Contains(lc, `<Mute channel="Master" val="1"/>`) {
+		t.Fatalf("mute LastChange=%s", lc)
+	}
+}
+
+func TestEventConnectionManagerInitialProperties(t *testing.T) {
+	_, m := newEventState(t)
+	sink := newEventSink(t)
+	req := httptest.NewRequest("SUBSCRIBE", "/upnp/event/connectionmanager", nil)
+	req.Header.Set("CALLBACK", "<"+sink.srv.URL+">")
+	req.Header.Set("NT", "upnp:event")
+	m.Handler(ConnectionManagerType).ServeHTTP(httptest.NewRecorder(), req)
+
+	body := []byte(sink.next(t).body)
+	if got := XMLText(body, "CurrentConnectionIDs"); got != "0" {
+		t.Fatalf("CurrentConnectionIDs=%q, want 0", got)
+	}
+	if got := XMLText(body, "SinkProtocolInfo"); !strings.Contains(got, "http-get:*:video/mp4:") {
+		t.Fatalf("SinkProtocolInfo=%q", got)
+	}
+}
+
+func TestEventOpenHomePlaylistProperties(t *testing.T) {
+	st, m := newEventState(t)
+	sink := newEventSink(t)
+	req := httptest.NewRequest("SUBSCRIBE", "/upnp/event/playlist", nil)
+	req.Header.Set("CALLBACK", "<"+sink.srv.URL+">")
+	req.Header.Set("NT", "upnp:event")
+	m.Handler(PlaylistType).ServeHTTP(httptest.NewRecorder(), req)
+
+	body := []byte(sink.next(t).body)
+	if XMLText(body, "LastChange") != "" || XMLText(body, "TransportState") != "Stopped" || XMLText(body, "TracksMax") != "1000" {
+		t.Fatalf("initial playlist event=%s", body)
+	}
+
+	id, _ := st.PlaylistInsert(0, "http://example.test/1.flac", "")
+	body = []byte(sink.next(t).body)
+	if XMLText(body, "IdArray") != idArray([]uint32{id}) || XMLText(body, "TracksMax") != "" {
+		t.Fatalf("insert event=%s", body)
+	}
+}
+
+func TestEventRenewAndUnsubscribe(t *testing.T) {
+	_, m := newEventState(t)
+	sink := newEventSink(t)
+	handler := m.Handler(AVTransportType)
+	sid := subscribe(handler, sink.srv.URL, "").Header().Get("SID")
+	_ = sink.next(t)
+
+	renew := withSID("SUBSCRIBE", sid)
+	renew.Header.Set("TIMEOUT", "Second-7200")
 	rec := httptest.NewRecorder()
-	EventHandler(rec, req)
-	if rec.Code != http.StatusNotImplemented {
-		t.Fatalf("SUBSCRIBE status=%d, want 501; body=%s", rec.Code, rec.Body.String())
+	handler.ServeHTTP(rec, renew)
+	if rec.Code != http.StatusOK || rec.Header().Get("SID") != sid || rec.Header().Get("TIMEOUT") != "Second-7200" {
+		t.Fatalf("renew status=%d SID=%q TIMEOUT=%q", rec.Code, rec.Header().Get("SID"), rec.Header().Get("TIMEOUT"))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, withSID("UNSUBSCRIBE", sid))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("UNSUBSCRIBE status=%d", rec.Code)
 	}
-	if sid := rec.Header().Get("SID"); sid != "" {
-		t.Fatalf("SID=%q, want empty", sid)
+
+	for _, method := range []string{"SUBSCRIBE", "UNSUBSCRIBE"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, withSID(method, sid))
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Fatalf("%s after unsubscribe status=%d, want 412", method, rec.Code)
+		}
 	}
 }
 
+func TestEventSubscribeRejectsInvalidRequests(t *testing.T) {
+	_, m := newEventState(t)
+	handler := m.Handler(AVTransportType)
+
+	t.Run("missing callback", func(t *testing.T) {
+		req := httptest.NewRequest("SUBSCRIBE", "/upnp/event/avtransport", nil)
+		req.Header.Set("NT", "upnp:event")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusPreconditionFailed || rec.Header().Get("SID") != "" {
+			t.Fatalf("status=%d SID=%q", rec.Code, rec.Header().Get("SID"))
+		}
+	})
+
+	t.Run("wrong NT", func(t *testing.T) {
+		req := httptest.NewRequest("SUBSCRIBE", "/upnp/event/avtransport", nil)
+		req.Header.Set("CALLBACK", "<http://127.0.0.1/cb>")
+		req.Header.Set("NT", "upnp:other")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Fatalf("status=%d, want 412", rec.Code)
+		}
+	})
+
+	t.Run("SID with CALLBACK", func(t *testing.T) {
+		req := withSID("SUBSCRIBE", "uuid:x")
+		req.Header.Set("CALLBACK", "<http://127.0.0.1/cb>")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("status=%d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("SID from another service", func(t *testing.T) {
+		sink := newEventSink(t)
+		sid := subscribe(handler, sink.srv.URL, "").Header().Get("SID")
+		rec := httptest.NewRecorder()
+		m.Handler(RenderingType).ServeHTTP(rec, withSID("UNSUBSCRIBE", sid))
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Fatalf("status=%d, want 412", rec.Code)
+		}
+	})
+}
+
 func TestEventHandlerDisallowedMethods(t *testing.T) {
+	_, m := newEventState(t)
 	// GET/POST/PUT/DELETE/PATCH/etc. must all return 405 + Allow header.
 	disallowed := []string{
 		http.MethodGet,
@@ -50,7 +360,7 @@ func TestEventHandlerDisallowedMethods(t *testing.T) {
 		t.Run(method, func(t *testing.T) {
 			req := httptest.NewRequest(method, "/upnp/event/avtransport", nil)
 			rec := httptest.NewRecorder()
-			EventHandler(rec, req)
+			m.Handler(AVTransportType).ServeHTTP(rec, req)
 			if rec.Code != http.StatusMethodNotAllowed {
 				t.Fatalf("status=%d, want 405; body=%s", rec.Code, rec.Body.String())
 			}
@@ -60,3 +370,85 @@ func TestEventHandlerDisallowedMethods(t *testing.T) {
 		})
 	}
 }
+
+func TestEventExpiredSubscriptionIsRemoved(t *testing.T) {
+	_, m := newEventState(t)
+	sink := newEventSink(t)
+	handler := m.Handler(AVTransportType)
+	sid := subscribe(handler, sink.srv.URL, "Second-60").Header().Get("SID")
+	_ = sink.next(t)
+
+	m.expire(time.Now().Add(61 * time.Second))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, withSID("SUBSCRIBE", sid))
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("renew after expiry status=%d, want 412", rec.Code)
+	}
+}
+
+func TestEventFailingCallbackIsDropped(t *testing.T) {
+	st, m := newEventState(t)
+	sink := newEventSink(t)
+	sink.setStatus(http.StatusInternalServerError)
+	sid := subscribe(m.Handler(AVTransportType), sink.srv.URL, "").Header().Get("SID")
+
+	states := []string{"PLAYING", "PAUSED_PLAYBACK", "PLAYING"}
+	for i := 0; i < maxDeliveryFailures; i++ {
+		_ = sink.next(t)
+		st.SetTransportState(states[i%len(states)])
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.mu.Lock()
+		_, ok := m.subs[sid]
+		m.mu.Unlock()
+		if !ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscription with a failing callback was not dropped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestParseSubscriptionTimeout(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", defaultSubscriptionTimeout},
+		{"Second-infinite", defaultSubscriptionTimeout},
+		{"Second-abc", defaultSubscriptionTimeout},
+		{"Second-300", 300 * time.Second},
+		{"Second-5", minSubscriptionTimeout},
+		{"Second-999999999", maxSubscriptionTimeout},
+	}
+	for _, tt := range tests {
+		if got := parseSubscriptionTimeout(tt.header); got != tt.want {
+			t.Errorf("parseSubscriptionTimeout(%q)=%v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestParseCallbacks(t *testing.T) {
+	got := parseCallbacks("<http://10.0.0.2:49152/evt> <ftp://x/y><http://10.0.0.2:49153/evt>")
+	want := []string{"http://10.0.0.2:49152/evt", "http://10.0.0.2:49153/evt"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("parseCallbacks=%q, want %q", got, want)
+	}
+	if got := parseCallbacks("http://no-brackets/"); len(got) != 0 {
+		t.Fatalf("unbracketed callback accepted: %q", got)
+	}
+}
+
+func TestLastChangeIsEscapedOnce(t *testing.T) {
+	body := propertySet(AVTransportType, []eventVar{{name: "AVTransportURIMetaData", value: `<DIDL-Lite><item/></DIDL-Lite>`}})
+	lastChange := XMLText(body, "LastChange")
+	want := `<AVTransportURIMetaData val="&lt;DIDL-Lite&gt;&lt;item/&gt;&lt;/DIDL-Lite&gt;"/>`
+	if !strings.Contains(lastChange, want) {
+		t.Fatalf("LastChange=%s, want contains %s", lastChange, want)
+	}
+}
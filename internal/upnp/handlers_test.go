@@ -11,6 +11,7 @@ import (
 
 	"github.com/tr1v3r/rcast/internal/config"
 	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/quirk"
 	"github.com/tr1v3r/rcast/internal/state"
 )
 
@@ -69,7 +70,7 @@ func TestAwemeIOSVolumeStepsCoverFullPlayerRange(t *testing.T) {
 	if got := st.GetVolume(); got != 0 {
 		t.Fatalf("player volume after eight down steps=%d, want 0", got)
 	}
-	if got := st.GetReportedVolume("10.0.0.1", awemeIOSVolumeScale); got != 60 {
+	if got := st.GetReportedVolume("10.0.0.1", 2.5); got != 60 {
 		t.Fatalf("Aweme reported volume=%d, want raw 60", got)
 	}
 	awemeVolume := serveActionWithUserAgent(handler, "GetVolume", soapBody(``), "10.0.0.1:1", userAgent)
@@ -92,7 +93,8 @@ func TestAwemeIOSVolumeStepsCoverFullPlayerRange(t *testing.T) {
 	}
 }
 
-func TestVolumeScaleOnlyMatchesAwemeIOS(t *testing.T) {
+func TestVolumeQuirkOnlyMatchesAwemeIOS(t *testing.T) {
+	quirks := quirk.NewRegistry(nil)
 	tests := []struct {
 		userAgent string
 		want      float64
@@ -102,8 +104,10 @@ func TestVolumeScaleOnlyMatchesAwemeIOS(t *testing.T) {
 		{"Other/1 CFNetwork/3860.300.31 Darwin/25.2.0", 1},
 	}
 	for _, tt := range tests {
-		if got := volumeScaleForUserAgent(tt.userAgent); got != tt.want {
-			t.Errorf("volumeScaleForUserAgent(%q)=%v, want %v", tt.userAgent, got, tt.want)
+		r := httptest.NewRequest(http.MethodPost, "/upnp/control/rendering", nil)
+		r.Header.Set("User-Agent", tt.userAgent)
+		if got := NewController(r, quirks).Quirk.Scale(); got != tt.want {
+			t.Errorf("volume scale for %q=%v, want %v", tt.userAgent, got, tt.want)
 		}
 	}
 }
@@ -118,8 +122,8 @@ func TestAVTransportPreemptionStopsOldPlayer(t *testing.T) {
 		return p
 	})
 	defer st.Stop()
-	cfg := config.Config{AllowSessionPreempt: true}
-	handler := AVTransportHandler(st, cfg)
+	st.ApplySettings(state.Settings{AllowSessionPreempt: true})
+	handler := AVTransportHandler(st, config.Config{})
 
 	set := serveAction(handler, "SetAVTransportURI", soapBody(`<CurrentURI>https://example.test/one.mp4</CurrentURI>`), "10.0.0.1:1")
 	if set.Code != http.StatusOK {
@@ -243,25 +247,3 @@ func TestSOAPHandlerRejectsOversizedBody(t *testing.T) {
 		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
 	}
 }
-
-func TestEventHandlerDoesNotIssueFalseSubscription(t *testing.T) {
-	req := httptest.NewRequest("SUBSCRIBE", "/upnp/event/avtransport", nil)
-	req.Header.Set("CALLBACK", "<http://127.0.0.1/callback>")
-	req.Header.Set("NT", "upnp:event")
-	rec := httptest.NewRecorder()
-	EventHandler(rec, req)
-	if rec.Code != http.StatusNotImplemented || rec.Header().Get("SID") != "" {
-		t.Fatalf("status=%d SID=%q", rec.Code, rec.Header().Get("SID"))
-	}
-}
-
-func TestTimeToSecondsValidation(t *testing.T) {
-	if got, err := timeToSeconds("01:02:03.5"); err != nil || got != 3723.5 {
-		t.Fatalf("valid time=(%v, %v)", got, err)
-	}
-	for _, invalid := range []string{"1:60:00", "1:00:60", "-1:00:00", "garbage"} {
-		if _, err := timeToSeconds(invalid); err == nil {
-			t.Errorf("timeToSeconds(%q) unexpectedly succeeded", invalid)
-		}
-	}
-}
@@ -0,0 +1,504 @@
+package upnp
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/monitoring"
+	"github.com/tr1v3r/rcast/internal/quirk"
+	"github.com/tr1v3r/rcast/internal/state"
+)
+
+// OpenHome services, offered next to AVTransport for control points such as
+// Kazoo, Lumin or BubbleUPnP's OpenHome mode that expect the renderer to own
+// the playlist.
+const (
+	ProductType  = "urn:av-openhome-org:service:Product:1"
+	PlaylistType = "urn:av-openhome-org:service:Playlist:1"
+	VolumeType   = "urn:av-openhome-org:service:Volume:1"
+	TimeType     = "urn:av-openhome-org:service:Time:1"
+	InfoType     = "urn:av-openhome-org:service:Info:1"
+)
+
+// OpenHomeTypes lists the OpenHome services in device description order.
+var OpenHomeTypes = []string{ProductType, PlaylistType, VolumeType, TimeType, InfoType}
+
+// ohSource is a Product source. Both drive the same player: Playlist plays
+// the renderer-owned playlist, UpnpAv whatever AVTransport was given.
+type ohSource struct {
+	name, kind string
+	visible    bool
+}
+
+var ohSources = []ohSource{
+	{"Playlist", "Playlist", true},
+	{"UPnP AV", "UpnpAv", false},
+}
+
+// ohTransportStates are the Playlist service's transport states.
+var ohTransportStates = []string{"Playing", "Paused", "Stopped", "Buffering"}
+
+// Volume characteristics: the player's 0-100 scale, one step per point.
+const (
+	ohVolumeMax            = 100
+	ohVolumeMilliDbPerStep = 1024
+)
+
+// ohCall is one OpenHome action request.
+type ohCall struct {
+	w          http.ResponseWriter
+	service    string
+	action     string
+	body       []byte
+	controller Controller
+}
+
+func (c ohCall) arg(name string) string { return XMLText(c.body, name) }
+
+// reply answers with err as a fault, or with out, alternating argument
+// names and values, as the action response.
+func (c ohCall) reply(err *Error, out ...string) {
+	if err != nil {
+		writeActionError(c.w, err)
+		return
+	}
+	var b strings.Builder
+	for i := 0; i+1 < len(out); i += 2 {
+		fmt.Fprintf(&b, "<%s>%s</%s>", out[i], html.EscapeString(out[i+1]), out[i])
+	}
+	WriteSOAPResponse(c.w, c.service, c.action+"Response", b.String())
+}
+
+// openHomeHandler reads the SOAP request of an OpenHome service and hands it
+// to serve.
+func openHomeHandler(st *state.PlayerState, cfg config.Config, service string, serve func(ohCall)) http.HandlerFunc {
+	quirks := quirk.NewRegistry(cfg.Quirks)
+	return func(w http.ResponseWriter, r *http.Request) {
+		sa := ParseSOAPAction(r.Header.Get("SOAPACTION"))
+		body, ok := ReadSOAPBody(w, r)
+		if !ok {
+			return
+		}
+		monitoring.GetMetrics().RecordUPnPAction()
+		log.CtxDebug(st.Context(), "openhome request action=%s body: %s", sa, string(body))
+		serve(ohCall{w: w, service: service, action: sa, body: body, controller: NewController(r, quirks)})
+	}
+}
+
+func ProductHandler(st *state.PlayerState, cfg config.Config) http.HandlerFunc {
+	actions := NewActions(st)
+	return openHomeHandler(st, cfg, ProductType, func(call ohCall) {
+		set := st.Settings()
+		switch call.action {
+		case "Manufacturer":
+			call.reply(nil, "Name", set.Manufacturer, "Info", "", "Url", "", "ImageUri", "")
+		case "Model":
+			call.reply(nil, "Name", set.ModelName, "Info", "", "Url", "", "ImageUri", "")
+		case "Product":
+			call.reply(nil, "Room", set.FriendlyName, "Name", set.FriendlyName, "Info", "", "Url", "", "ImageUri", "")
+		case "Standby":
+			call.reply(nil, "Value", ohBool(st.Standby()))
+		case "SetStandby":
+			on, err := parseOHBool(call.arg("Value"))
+			if err == nil {
+				err = actions.SetStandby(call.controller, on)
+			}
+			call.reply(err)
+		case "SourceCount":
+			call.reply(nil, "Value", strconv.Itoa(len(ohSources)))
+		case "SourceXml":
+			call.reply(nil, "Value", sourceXML())
+		case "SourceIndex":
+			call.reply(nil, "Value", strconv.Itoa(sourceIndex(st.Snapshot())))
+		case "SetSourceIndex":
+			// Both sources share the player, so there is nothing to switch
+			// until one of them plays.
+			i, err := parseOHUint(call.arg("Value"))
+			if err == nil && int(i) >= len(ohSources) {
+				err = ErrSourceNotFound
+			}
+			call.reply(err)
+		case "SetSourceIndexByName":
+			err := ErrSourceNotFound
+			for _, s := range ohSources {
+				if s.name == call.arg("Value") {
+					err = nil
+				}
+			}
+			call.reply(err)
+		case "Source":
+			i, err := parseOHUint(call.arg("Index"))
+			if err != nil || int(i) >= len(ohSources) {
+				call.reply(ErrSourceNotFound)
+				return
+			}
+			s := ohSources[i]
+			call.reply(nil, "SystemName", s.name, "Type", s.kind, "Name", s.name, "Visible", ohBool(s.visible))
+		case "Attributes":
+			call.reply(nil, "Value", ohAttributes)
+		case "SourceXmlChangeCount":
+			call.reply(nil, "Value", "0")
+		default:
+			call.reply(ErrInvalidAction)
+		}
+	})
+}
+
+func PlaylistHandler(st *state.PlayerState, cfg config.Config) http.HandlerFunc {
+	actions := NewActions(st)
+	return openHomeHandler(st, cfg, PlaylistType, func(call ohCall) {
+		c := call.controller
+		switch call.action {
+		case "Play":
+			call.reply(actions.PlayPlaylist(c))
+		case "Pause":
+			call.reply(actions.Pause(c))
+		case "Stop":
+			call.reply(actions.Stop(c))
+		case "Next":
+			call.reply(actions.StepTrack(c, 1))
+		case "Previous":
+			call.reply(actions.StepTrack(c, -1))
+		case "SetRepeat", "SetShuffle":
+			on, err := parseOHBool(call.arg("Value"))
+			switch {
+			case err != nil:
+			case call.action == "SetRepeat":
+				mode := state.RepeatOff
+				if on {
+					mode = state.RepeatAll
+				}
+				err = actions.SetRepeat(c, mode)
+			default:
+				err = actions.SetShuffle(c, on)
+			}
+			call.reply(err)
+		case "Repeat":
+			call.reply(nil, "Value", ohBool(st.Repeat() != state.RepeatOff))
+		case "Shuffle":
+			call.reply(nil, "Value", ohBool(st.Shuffle()))
+		case "SeekSecondAbsolute":
+			secs, err := parseOHUint(call.arg("Value"))
+			if err == nil {
+				err = actions.Seek(c, float64(secs))
+			}
+			call.reply(err)
+		case "SeekSecondRelative":
+			secs, perr := strconv.ParseInt(call.arg("Value"), 10, 32)
+			if perr != nil {
+				call.reply(ErrInvalidArgs)
+				return
+			}
+			call.reply(actions.seek(c, seekTarget{unit: "REL_TIME", value: float64(secs)}))
+		case "SeekId":
+			id, err := parseOHUint(call.arg("Value"))
+			if err == nil {
+				err = actions.PlayTrack(c, id)
+			}
+			call.reply(err)
+		case "SeekIndex":
+			i, err := parseOHUint(call.arg("Value"))
+			if err == nil {
+				err = actions.PlayIndex(c, int(i))
+			}
+			call.reply(err)
+		case "TransportState":
+			call.reply(nil, "Value", ohTransportState(st.GetTransportState()))
+		case "Id":
+			call.reply(nil, "Value", strconv.FormatUint(uint64(st.PlaylistCurrent()), 10))
+		case "Read":
+			id, err := parseOHUint(call.arg("Id"))
+			if err != nil {
+				call.reply(err)
+				return
+			}
+			t, ok := st.PlaylistTrack(id)
+			if !ok {
+				call.reply(ErrTrackNotFound)
+				return
+			}
+			call.reply(nil, "Uri", t.URI, "Metadata", TrackMetadata(t.URI, t.Meta, TrackInfo{}))
+		case "ReadList":
+			list, err := trackListXML(st, call.arg("IdList"))
+			call.reply(err, "TrackList", list)
+		case "Insert":
+			after, err := parseOHUint(call.arg("AfterId"))
+			if err != nil {
+				call.reply(err)
+				return
+			}
+			id, err := actions.Insert(c, after, call.arg("Uri"), call.arg("Metadata"))
+			call.reply(err, "NewId", strconv.FormatUint(uint64(id), 10))
+		case "DeleteId":
+			id, err := parseOHUint(call.arg("Value"))
+			if err == nil {
+				err = actions.DeleteTrack(c, id)
+			}
+			call.reply(err)
+		case "DeleteAll":
+			call.reply(actions.DeleteAllTracks(c))
+		case "TracksMax":
+			call.reply(nil, "Value", strconv.Itoa(state.TracksMax))
+		case "IdArray":
+			pl := st.Snapshot().Playlist
+			call.reply(nil, "Token", strconv.FormatUint(uint64(pl.Token), 10), "Array", idArray(pl.IDs))
+		case "IdArrayChanged":
+			token, err := parseOHUint(call.arg("Token"))
+			call.reply(err, "Value", ohBool(token != st.Snapshot().Playlist.Token))
+		case "ProtocolInfo":
+			call.reply(nil, "Value", sinkProtocolInfo())
+		default:
+			call.reply(ErrInvalidAction)
+		}
+	})
+}
+
+func VolumeHandler(st *state.PlayerState, cfg config.Config) http.HandlerFunc {
+	actions := NewActions(st)
+	return openHomeHandler(st, cfg, VolumeType, func(call ohCall) {
+		c := call.controller
+		current := st.GetReportedVolume(c.ID, c.Quirk.Scale())
+		switch call.action {
+		case "Characteristics":
+			call.reply(nil, "VolumeMax", strconv.Itoa(ohVolumeMax), "VolumeUnity", strconv.Itoa(ohVolumeMax),
+				"VolumeSteps", strconv.Itoa(ohVolumeMax), "VolumeMilliDbPerStep", strconv.Itoa(ohVolumeMilliDbPerStep),
+				"BalanceMax", "0", "FadeMax", "0")
+		case "SetVolume":
+			v, err := parseOHUint(call.arg("Value"))
+			if err == nil {
+				err = actions.SetVolume(c, int(min(v, ohVolumeMax)))
+			}
+			call.reply(err)
+		case "VolumeInc":
+			call.reply(actions.SetVolume(c, current+1))
+		case "VolumeDec":
+			call.reply(actions.SetVolume(c, current-1))
+		case "Volume":
+			call.reply(nil, "Value", strconv.Itoa(current))
+		case "SetMute":
+			m, err := parseOHBool(call.arg("Value"))
+			if err == nil {
+				err = actions.SetMute(c, m)
+			}
+			call.reply(err)
+		case "Mute":
+			call.reply(nil, "Value", ohBool(st.GetMute()))
+		case "VolumeLimit":
+			call.reply(nil, "Value", strconv.Itoa(ohVolumeMax))
+		default:
+			call.reply(ErrInvalidAction)
+		}
+	})
+}
+
+func TimeHandler(st *state.PlayerState, cfg config.Config) http.HandlerFunc {
+	return openHomeHandler(st, cfg, TimeType, func(call ohCall) {
+		switch call.action {
+		case "Time":
+			snap := st.Snapshot()
+			call.reply(nil, "TrackCount", strconv.FormatUint(uint64(snap.TrackCount), 10),
+				"Duration", strconv.Itoa(int(snap.Duration)), "Seconds", strconv.Itoa(int(snap.Position)))
+		default:
+			call.reply(ErrInvalidAction)
+		}
+	})
+}
+
+func InfoHandler(st *state.PlayerState, cfg config.Config) http.HandlerFunc {
+	return openHomeHandler(st, cfg, InfoType, func(call ohCall) {
+		snap := st.Snapshot()
+		count := strconv.FormatUint(uint64(snap.TrackCount), 10)
+		switch call.action {
+		case "Counters":
+			call.reply(nil, "TrackCount", count, "DetailsCount", count, "MetatextCount", "0")
+		case "Track":
+			call.reply(nil, "Uri", snap.URI, "Metadata", TrackMetadata(snap.URI, snap.Meta, TrackInfo{Duration: snap.Duration}))
+		case "Details":
+			call.reply(nil, "Duration", strconv.Itoa(int(snap.Duration)), "BitRate", "0", "BitDepth", "0",
+				"SampleRate", "0", "Lossless", "false", "CodecName", "")
+		case "Metatext":
+			call.reply(nil, "Value", "")
+		default:
+			call.reply(ErrInvalidAction)
+		}
+	})
+}
+
+// ohAttributes names the services besides Product and Playlist that
+// control points may look for.
+const ohAttributes = "Info Time Volume"
+
+// sourceIndex is the source the current media came from.
+func sourceIndex(snap state.Snapshot) int {
+	if snap.URI != "" && snap.Playlist.Current == 0 {
+		return 1
+	}
+	return 0
+}
+
+func sourceXML() string {
+	var b strings.Builder
+	b.WriteString("<SourceList>")
+	for _, s := range ohSources {
+		fmt.Fprintf(&b, "<Source><Name>%s</Name><Type>%s</Type><Visible>%s</Visible></Source>",
+			html.EscapeString(s.name), s.kind, ohBool(s.visible))
+	}
+	b.WriteString("</SourceList>")
+	return b.String()
+}
+
+// ohTransportState maps an AVTransport state to its Playlist counterpart.
+func ohTransportState(ts string) string {
+	switch ts {
+	case state.Playing:
+		return "Playing"
+	case state.PausedPlayback:
+		return "Paused"
+	case state.Transitioning:
+		return "Buffering"
+	}
+	return "Stopped"
+}
+
+// idArray encodes playlist IDs as OpenHome's IdArray: base64 of big-endian
+// 32-bit integers.
+func idArray(ids []uint32) string {
+	buf := make([]byte, 4*len(ids))
+	for i, id := range ids {
+		binary.BigEndian.PutUint32(buf[4*i:], id)
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// trackListXML answers ReadList for a space-separated list of IDs, skipping
+// IDs no longer in the playlist.
+func trackListXML(st *state.PlayerState, idList string) (string, *Error) {
+	var b strings.Builder
+	b.WriteString("<TrackList>")
+	for _, field := range strings.Fields(idList) {
+		id, err := parseOHUint(field)
+		if err != nil {
+			return "", err
+		}
+		t, ok := st.PlaylistTrack(id)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "<Entry><Id>%d</Id><Uri>%s</Uri><Metadata>%s</Metadata></Entry>",
+			t.ID, html.EscapeString(t.URI), html.EscapeString(TrackMetadata(t.URI, t.Meta, TrackInfo{})))
+	}
+	b.WriteString("</TrackList>")
+	return b.String(), nil
+}
+
+// parseOHBool reads an OpenHome boolean argument.
+func parseOHBool(s string) (bool, *Error) {
+	switch strings.ToLower(s) {
+	case "1", "true", "yes":
+		return true, nil
+	case "0", "false", "no":
+		return false, nil
+	}
+	return false, ErrInvalidArgs
+}
+
+// parseOHUint reads an OpenHome ui4 argument.
+func parseOHUint(s string) (uint32, *Error) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, ErrInvalidArgs
+	}
+	return uint32(n), nil
+}
+
+func ohBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// openHomeVars lists the evented variables of an OpenHome service. Product
+// names come from set.
+func openHomeVars(service string, snap state.Snapshot, set state.Settings) []eventVar {
+	count := strconv.FormatUint(uint64(snap.TrackCount), 10)
+	duration := strconv.Itoa(int(snap.Duration))
+	switch service {
+	case ProductType:
+		return []eventVar{
+			{name: "ManufacturerName", value: set.Manufacturer},
+			{name: "ManufacturerInfo"},
+			{name: "ManufacturerUrl"},
+			{name: "ManufacturerImageUri"},
+			{name: "ModelName", value: set.ModelName},
+			{name: "ModelInfo"},
+			{name: "ModelUrl"},
+			{name: "ModelImageUri"},
+			{name: "ProductRoom", value: set.FriendlyName},
+			{name: "ProductName", value: set.FriendlyName},
+			{name: "ProductInfo"},
+			{name: "ProductUrl"},
+			{name: "ProductImageUri"},
+			{name: "Standby", value: ohBool(snap.Standby)},
+			{name: "SourceIndex", value: strconv.Itoa(sourceIndex(snap))},
+			{name: "SourceCount", value: strconv.Itoa(len(ohSources))},
+			{name: "SourceXml", value: sourceXML()},
+			{name: "Attributes", value: ohAttributes},
+		}
+	case PlaylistType:
+		return []eventVar{
+			{name: "TransportState", value: ohTransportState(snap.TransportState)},
+			{name: "Repeat", value: ohBool(snap.Playlist.Repeat != state.RepeatOff)},
+			{name: "Shuffle", value: ohBool(snap.Playlist.Shuffle)},
+			{name: "Id", value: strconv.FormatUint(uint64(snap.Playlist.Current), 10)},
+			{name: "IdArray", value: idArray(snap.Playlist.IDs)},
+			{name: "TracksMax", value: strconv.Itoa(state.TracksMax)},
+			{name: "ProtocolInfo", value: sinkProtocolInfo()},
+		}
+	case VolumeType:
+		mute := ohBool(snap.Mute)
+		return []eventVar{
+			{name: "Volume", value: strconv.Itoa(snap.Volume)},
+			{name: "Mute", value: mute},
+			{name: "Balance", value: "0"},
+			{name: "Fade", value: "0"},
+			{name: "VolumeLimit", value: strconv.Itoa(ohVolumeMax)},
+			{name: "VolumeMax", value: strconv.Itoa(ohVolumeMax)},
+			{name: "VolumeUnity", value: strconv.Itoa(ohVolumeMax)},
+			{name: "VolumeSteps", value: strconv.Itoa(ohVolumeMax)},
+			{name: "VolumeMilliDbPerStep", value: strconv.Itoa(ohVolumeMilliDbPerStep)},
+			{name: "BalanceMax", value: "0"},
+			{name: "FadeMax", value: "0"},
+		}
+	case TimeType:
+		return []eventVar{
+			{name: "TrackCount", value: count},
+			{name: "Duration", value: duration},
+			{name: "Seconds", value: strconv.Itoa(int(snap.Position))},
+		}
+	case InfoType:
+		return []eventVar{
+			{name: "TrackCount", value: count},
+			{name: "DetailsCount", value: count},
+			{name: "MetatextCount", value: "0"},
+			{name: "Uri", value: snap.URI},
+			{name: "Metadata", value: TrackMetadata(snap.URI, snap.Meta, TrackInfo{Duration: snap.Duration})},
+			{name: "Duration", value: duration},
+			{name: "BitRate", value: "0"},
+			{name: "BitDepth", value: "0"},
+			{name: "SampleRate", value: "0"},
+			{name: "Lossless", value: "false"},
+			{name: "CodecName"},
+			{name: "Metatext"},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package upnp
+
+import (
+	"encoding/xml"
+	"html"
+	"strings"
+	"testing"
+
+	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/state"
+)
+
+func TestOpenHomeSCPDsMatchEventedVars(t *testing.T) {
+	type argument struct {
+		Name     string `xml:"name"`
+		Variable string `xml:"relatedStateVariable"`
+	}
+	type stateVar struct {
+		Name   string `xml:"name"`
+		Events string `xml:"sendEvents,attr"`
+	}
+	type scpd struct {
+		Args []argument `xml:"actionList>action>argumentList>argument"`
+		Vars []stateVar `xml:"serviceStateTable>stateVariable"`
+	}
+	docs := map[string]func() string{
+		ProductType:  SCPDProductXML,
+		PlaylistType: SCPDPlaylistXML,
+		VolumeType:   SCPDVolumeXML,
+		TimeType:     SCPDTimeXML,
+		InfoType:     SCPDInfoXML,
+	}
+	for _, service := range OpenHomeTypes {
+		var doc scpd
+		if err := xml.Unmarshal([]byte(docs[service]()), &doc); err != nil {
+			t.Fatalf("%s: %v", service, err)
+		}
+		declared := map[string]bool{}
+		evented := map[string]bool{}
+		for _, v := range doc.Vars {
+			declared[v.Name] = true
+			evented[v.Name] = v.Events == "yes"
+		}
+		for _, a := range doc.Args {
+			if !declared[a.Variable] {
+				t.Errorf("%s: argument %s refers to undeclared %s", service, a.Name, a.Variable)
+			}
+		}
+		vars := serviceVars(service, state.Snapshot{}, state.Settings{})
+		for _, v := range vars {
+			if !evented[v.name] {
+				t.Errorf("%s: %s is evented but not declared sendEvents=yes", service, v.name)
+			}
+			delete(evented, v.name)
+		}
+		for name, yes := range evented {
+			if yes {
+				t.Errorf("%s: %s declared evented but never sent", service, name)
+			}
+		}
+	}
+}
+
+func TestIDArray(t *testing.T) {
+	if got := idArray([]uint32{1, 258}); got != "AAAAAQAAAQI=" {
+		t.Fatalf("idArray = %q", got)
+	}
+	if got := idArray(nil); got != "" {
+		t.Fatalf("empty idArray = %q", got)
+	}
+}
+
+func TestPlaylistEditAndRead(t *testing.T) {
+	st, cleanup := newAVTState(t, nil)
+	defer cleanup()
+	handler := PlaylistHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+
+	rec := serveAction(handler, "Insert", soapBody(`<AfterId>0</AfterId><Uri>http://example.test/1.flac</Uri><Metadata></Metadata>`), remote)
+	assertSOAPSuccess(t, rec, "InsertResponse")
+	if XMLText(rec.Body.Bytes(), "NewId") != "1" {
+		t.Fatalf("NewId: %s", rec.Body.String())
+	}
+	serveAction(handler, "Insert", soapBody(`<AfterId>1</AfterId><Uri>http://example.test/2.flac</Uri><Metadata></Metadata>`), remote)
+	assertUPnPError(t, serveAction(handler, "Insert", soapBody(`<AfterId>9</AfterId><Uri>http://example.test/x.flac</Uri>`), remote), 800)
+
+	rec = serveAction(handler, "IdArray", soapBody(""), remote)
+	if XMLText(rec.Body.Bytes(), "Array") != idArray([]uint32{1, 2}) {
+		t.Fatalf("IdArray: %s", rec.Body.String())
+	}
+	token := XMLText(rec.Body.Bytes(), "Token")
+	rec = serveAction(handler, "IdArrayChanged", soapBody(`<Token>`+token+`</Token>`), remote)
+	if XMLText(rec.Body.Bytes(), "Value") != "false" {
+		t.Fatalf("IdArrayChanged: %s", rec.Body.String())
+	}
+
+	rec = serveAction(handler, "ReadList", soapBody(`<IdList>2 1 7</IdList>`), remote)
+	list := XMLText(rec.Body.Bytes(), "TrackList")
+	if strings.Count(list, "<Entry>") != 2 || !strings.Contains(list, "<Uri>http://example.test/2.flac</Uri>") ||
+		!strings.Contains(list, html.EscapeString("<dc:title>2.flac</dc:title>")) {
+		t.Fatalf("TrackList: %s", list)
+	}
+	rec = serveAction(handler, "Read", soapBody(`<Id>1</Id>`), remote)
+	if XMLText(rec.Body.Bytes(), "Uri") != "http://example.test/1.flac" {
+		t.Fatalf("Read: %s", rec.Body.String())
+	}
+
+	assertSOAPSuccess(t, serveAction(handler, "DeleteId", soapBody(`<Value>1</Value>`), remote), "DeleteIdResponse")
+	assertUPnPError(t, serveAction(handler, "Read", soapBody(`<Id>1</Id>`), remote), 800)
+	rec = serveAction(handler, "IdArrayChanged", soapBody(`<Token>`+token+`</Token>`), remote)
+	if XMLText(rec.Body.Bytes(), "Value") != "true" {
+		t.Fatalf("IdArrayChanged after delete: %s", rec.Body.String())
+	}
+	assertSOAPSuccess(t, serveAction(handler, "DeleteAll", soapBody(""), remote), "DeleteAllResponse")
+	if len(st.PlaylistTracks()) != 0 {
+		t.Fatal("DeleteAll left tracks")
+	}
+}
+
+func TestPlaylistPlaysAndStepsThroughTracks(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := PlaylistHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+	for i, uri := range []string{"http://example.test/1.flac", "http://example.test/2.flac"} {
+		after := itoa(i)
+		serveAction(handler, "Insert", soapBody(`<AfterId>`+after+`</AfterId><Uri>`+uri+`</Uri>`), remote)
+	}
+
+	assertSOAPSuccess(t, serveAction(handler, "Play", soapBody(""), remote), "PlayResponse")
+	snap := st.Snapshot()
+	if snap.URI != "http://example.test/1.flac" || snap.TransportState != state.Playing || snap.Playlist.Current != 1 {
+		t.Fatalf("after Play: uri=%q state=%q id=%d", snap.URI, snap.TransportState, snap.Playlist.Current)
+	}
+	fake.mu.Lock()
+	nexts := append([]string(nil), fake.nexts...)
+	fake.mu.Unlock()
+	if len(nexts) == 0 || nexts[len(nexts)-1] != "http://example.test/2.flac" {
+		t.Fatalf("player next = %v, want the second track", nexts)
+	}
+	rec := serveAction(handler, "TransportState", soapBody(""), remote)
+	if XMLText(rec.Body.Bytes(), "Value") != "Playing" {
+		t.Fatalf("TransportState: %s", rec.Body.String())
+	}
+
+	assertSOAPSuccess(t, serveAction(handler, "Next", soapBody(""), remote), "NextResponse")
+	if id := st.PlaylistCurrent(); id != 2 || st.GetTransportState() != state.Playing {
+		t.Fatalf("after Next: id=%d state=%q", id, st.GetTransportState())
+	}
+	// Without repeat there is nothing past the last track.
+	assertSOAPSuccess(t, serveAction(handler, "Next", soapBody(""), remote), "NextResponse")
+	if id := st.PlaylistCurrent(); id != 2 {
+		t.Fatalf("Next past the end moved to %d", id)
+	}
+	serveAction(handler, "SetRepeat", soapBody(`<Value>true</Value>`), remote)
+	if next, _ := st.GetNextURI(); next != "http://example.test/1.flac" {
+		t.Fatalf("next with repeat = %q", next)
+	}
+
+	assertSOAPSuccess(t, serveAction(handler, "SeekIndex", soapBody(`<Value>0</Value>`), remote), "SeekIndexResponse")
+	if id := st.PlaylistCurrent(); id != 1 {
+		t.Fatalf("after SeekIndex 0: id=%d", id)
+	}
+	assertUPnPError(t, serveAction(handler, "SeekIndex", soapBody(`<Value>5</Value>`), remote), 802)
+	assertUPnPError(t, serveAction(handler, "SeekId", soapBody(`<Value>9</Value>`), remote), 800)
+
+	// Deleting the playing track stops it.
+	assertSOAPSuccess(t, serveAction(handler, "DeleteId", soapBody(`<Value>1</Value>`), remote), "DeleteIdResponse")
+	if snap := st.Snapshot(); snap.URI != "" || snap.TransportState != state.NoMediaPresent {
+		t.Fatalf("after deleting the playing track: uri=%q state=%q", snap.URI, snap.TransportState)
+	}
+}
+
+func TestPlaylistRespectsTheSession(t *testing.T) {
+	st, cleanup := newAVTState(t, nil)
+	defer cleanup()
+	handler := PlaylistHandler(st, config.Config{})
+	serveAction(handler, "Insert", soapBody(`<AfterId>0</AfterId><Uri>http://example.test/1.flac</Uri>`), "10.0.0.1:1")
+	rec := serveAction(handler, "Insert", soapBody(`<AfterId>0</AfterId><Uri>http://example.test/2.flac</Uri>`), "10.0.0.2:1")
+	assertUPnPError(t, rec, 712)
+}
+
+func TestProductVolumeTimeAndInfo(t *testing.T) {
+	st, cleanup := newAVTState(t, nil)
+	defer cleanup()
+	st.ApplySettings(state.Settings{FriendlyName: "Den", Manufacturer: "rcast", ModelName: "rcast renderer"})
+	const remote = "10.0.0.1:1"
+
+	product := ProductHandler(st, config.Config{})
+	rec := serveAction(product, "Product", soapBody(""), remote)
+	if XMLText(rec.Body.Bytes(), "Room") != "Den" {
+		t.Fatalf("Product: %s", rec.Body.String())
+	}
+	rec = serveAction(product, "Source", soapBody(`<Index>0</Index>`), remote)
+	if XMLText(rec.Body.Bytes(), "Type") != "Playlist" {
+		t.Fatalf("Source 0: %s", rec.Body.String())
+	}
+	assertUPnPError(t, serveAction(product, "Source", soapBody(`<Index>2</Index>`), remote), 803)
+	assertSOAPSuccess(t, serveAction(product, "SetStandby", soapBody(`<Value>1</Value>`), remote), "SetStandbyResponse")
+	if !st.Standby() {
+		t.Fatal("SetStandby did not enter standby")
+	}
+
+	volume := VolumeHandler(st, config.Config{})
+	serveAction(volume, "SetVolume", soapBody(`<Value>40</Value>`), remote)
+	serveAction(volume, "VolumeInc", soapBody(""), remote)
+	rec = serveAction(volume, "Volume", soapBody(""), remote)
+	if XMLText(rec.Body.Bytes(), "Value") != "41" {
+		t.Fatalf("Volume: %s", rec.Body.String())
+	}
+	assertUPnPError(t, serveAction(volume, "SetMute", soapBody(`<Value>maybe</Value>`), remote), 402)
+
+	st.SetURI("http://example.test/v.mp4", "")
+	rec = serveAction(TimeHandler(st, config.Config{}), "Time", soapBody(""), remote)
+	if XMLText(rec.Body.Bytes(), "TrackCount") != "1" || XMLText(rec.Body.Bytes(), "Seconds") != "0" {
+		t.Fatalf("Time: %s", rec.Body.String())
+	}
+	rec = serveAction(InfoHandler(st, config.Config{}), "Track", soapBody(""), remote)
+	if XMLText(rec.Body.Bytes(), "Uri") != "http://example.test/v.mp4" || !strings.Contains(XMLText(rec.Body.Bytes(), "Metadata"), "<dc:title>v.mp4</dc:title>") {
+		t.Fatalf("Info Track: %s", rec.Body.String())
+	}
+	assertUPnPError(t, serveAction(InfoHandler(st, config.Config{}), "Bogus", soapBody(""), remote), 401)
+}
@@ -0,0 +1,329 @@
+package upnp
+
+import (
+	"errors"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/history"
+	"github.com/tr1v3r/rcast/internal/monitoring"
+	"github.com/tr1v3r/rcast/internal/state"
+)
+
+// OpenHome Playlist faults.
+var (
+	ErrTrackNotFound  = &Error{800, "Id not found"}
+	ErrPlaylistFull   = &Error{801, "Playlist full"}
+	ErrIndexNotFound  = &Error{802, "Index out of range"}
+	ErrSourceNotFound = &Error{803, "Source not found"}
+)
+
+func playlistError(err error) *Error {
+	switch {
+	case errors.Is(err, state.ErrNoSuchTrack):
+		return ErrTrackNotFound
+	case errors.Is(err, state.ErrPlaylistFull):
+		return ErrPlaylistFull
+	}
+	return ErrActionFailed
+}
+
+// Insert adds uri to the playlist after the track afterID, or first when
+// afterID is 0, and returns the new track's ID.
+func (a *Actions) Insert(c Controller, afterID uint32, uri, meta string) (uint32, *Error) {
+	if uri == "" {
+		return 0, ErrInvalidArgs
+	}
+	if c.Quirk.StripsMetadata() {
+		meta = ""
+	}
+	var id uint32
+	err := a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		newID, err := a.st.PlaylistInsert(afterID, uri, meta)
+		if err != nil {
+			return playlistError(err)
+		}
+		id = newID
+		a.preloadNext()
+		return nil
+	})
+	return id, err
+}
+
+// Append adds uri at the end of the playlist and returns the new track's ID.
+func (a *Actions) Append(c Controller, uri, meta string) (uint32, *Error) {
+	if uri == "" {
+		return 0, ErrInvalidArgs
+	}
+	if c.Quirk.StripsMetadata() {
+		meta = ""
+	}
+	var id uint32
+	err := a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		newID, err := a.st.PlaylistAppend(uri, meta)
+		if err != nil {
+			return playlistError(err)
+		}
+		id = newID
+		a.preloadNext()
+		return nil
+	})
+	return id, err
+}
+
+// Enqueue adds uri to the playlist, titled title when non-empty: after the
+// track afterID when one is given, else at the end.
+func (a *Actions) Enqueue(c Controller, uri, title string, afterID *uint32) (uint32, *Error) {
+	meta := castMetadata(uri, title)
+	if afterID != nil {
+		return a.Insert(c, *afterID, uri, meta)
+	}
+	return a.Append(c, uri, meta)
+}
+
+// MoveTrack puts a track after the track afterID, or first when afterID is
+// 0.
+func (a *Actions) MoveTrack(c Controller, id, afterID uint32) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		if err := a.st.PlaylistMove(id, afterID); err != nil {
+			return playlistError(err)
+		}
+		a.preloadNext()
+		return nil
+	})
+}
+
+// DeleteTrack removes a track from the playlist. Deleting the track being
+// played stops it.
+func (a *Actions) DeleteTrack(c Controller, id uint32) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		current := a.st.PlaylistCurrent() == id
+		if err := a.st.PlaylistDelete(id); err != nil {
+			return playlistError(err)
+		}
+		if current {
+			return a.clearMedia()
+		}
+		a.preloadNext()
+		return nil
+	})
+}
+
+// DeleteAllTracks empties the playlist, stopping its track if one plays.
+func (a *Actions) DeleteAllTracks(c Controller) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		current := a.st.PlaylistCurrent() != 0
+		a.st.PlaylistClear()
+		if current {
+			return a.clearMedia()
+		}
+		return nil
+	})
+}
+
+// clearMedia stops the player and leaves no media selected, after the
+// playlist lost the track it was playing.
+func (a *Actions) clearMedia() *Error {
+	if err := a.st.StopPlayer(); err != nil {
+		monitoring.GetMetrics().RecordPlayerError()
+		return ErrActionFailed
+	}
+	a.st.SetURI("", "")
+	return nil
+}
+
+// PlayTrack selects a playlist track and plays it from the start.
+func (a *Actions) PlayTrack(c Controller, id uint32) *Error {
+	return a.serialize(func() *Error {
+		if err := a.selectTrack(c, id); err != nil {
+			return err
+		}
+		return a.play(c, a.resumePoint(nil))
+	})
+}
+
+// PlayPlaylist plays the selected playlist track, or the first one when
+// the current media is not from the playlist. An empty playlist plays the
+// current media like AVTransport Play.
+func (a *Actions) PlayPlaylist(c Controller) *Error {
+	return a.serialize(func() *Error {
+		if a.st.PlaylistCurrent() == 0 {
+			if t, ok := a.st.PlaylistStep(1); ok {
+				if err := a.selectTrack(c, t.ID); err != nil {
+					return err
+				}
+			}
+		}
+		return a.play(c, a.resumePoint(nil))
+	})
+}
+
+// PlayIndex plays the playlist track at index i, counting from 0.
+func (a *Actions) PlayIndex(c Controller, i int) *Error {
+	tracks := a.st.PlaylistTracks()
+	if i < 0 || i >= len(tracks) {
+		return ErrIndexNotFound
+	}
+	return a.PlayTrack(c, tracks[i].ID)
+}
+
+// StepTrack moves delta tracks through the playlist, playing the new track
+// when the old one was playing or paused. Stepping off either end does
+// nothing unless repeat is on.
+func (a *Actions) StepTrack(c Controller, delta int) *Error {
+	return a.serialize(func() *Error { return a.step(c, delta) })
+}
+
+// Next is AVTransport Next: the following playlist track, which the state
+// machine only offers while one exists.
+func (a *Actions) Next(c Controller) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		if err := a.allow(state.ActionNext); err != nil {
+			return err
+		}
+		return a.step(c, 1)
+	})
+}
+
+// Previous is AVTransport Previous, the counterpart of Next.
+func (a *Actions) Previous(c Controller) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		if err := a.allow(state.ActionPrevious); err != nil {
+			return err
+		}
+		return a.step(c, -1)
+	})
+}
+
+func (a *Actions) step(c Controller, delta int) *Error {
+	t, ok := a.st.PlaylistStep(delta)
+	if !ok {
+		return a.acquireSession(c)
+	}
+	return a.skipTo(c, t)
+}
+
+// skipTo selects playlist track t, carrying on playing when the previous
+// track was playing or paused.
+func (a *Actions) skipTo(c Controller, t state.Track) *Error {
+	ts := a.st.GetTransportState()
+	if err := a.selectTrack(c, t.ID); err != nil {
+		return err
+	}
+	if ts != state.Playing && ts != state.PausedPlayback {
+		return nil
+	}
+	return a.play(c, a.resumePoint(nil))
+}
+
+func (a *Actions) selectTrack(c Controller, id uint32) *Error {
+	if err := a.acquireSession(c); err != nil {
+		return err
+	}
+	if _, ok := a.st.PlaylistTrack(id); !ok {
+		return ErrTrackNotFound
+	}
+	if err := a.stopPlayback(); err != nil {
+		return err
+	}
+	if err := a.st.SelectTrack(id); err != nil {
+		return playlistError(err)
+	}
+	uri, meta := a.st.GetURI()
+	a.record(c, history.EventSetURI, uri, meta)
+	return nil
+}
+
+// SetRepeat changes what the playlist does at the end of a track.
+func (a *Actions) SetRepeat(c Controller, mode state.Repeat) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		a.st.SetRepeat(mode)
+		a.preloadNext()
+		return nil
+	})
+}
+
+// SetShuffle turns playlist shuffle on or off.
+func (a *Actions) SetShuffle(c Controller, on bool) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		a.st.SetShuffle(on)
+		a.preloadNext()
+		return nil
+	})
+}
+
+// SetPlayMode sets the playlist modes from an AVTransport play mode. A mode
+// outside state.PlayModes is an invalid argument, keeping 712 for a session
+// held by another controller.
+func (a *Actions) SetPlayMode(c Controller, mode string) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		if !a.st.SetPlayMode(mode) {
+			return ErrInvalidArgs
+		}
+		a.preloadNext()
+		return nil
+	})
+}
+
+// SetStandby puts the renderer in or out of standby. Entering standby stops
+// playback; the next play leaves it.
+func (a *Actions) SetStandby(c Controller, on bool) *Error {
+	return a.serialize(func() *Error {
+		if err := a.acquireSession(c); err != nil {
+			return err
+		}
+		if on && a.st.GetTransportState() != state.NoMediaPresent {
+			if err := a.st.StopPlayer(); err != nil {
+				monitoring.GetMetrics().RecordPlayerError()
+				return ErrActionFailed
+			}
+			a.st.SetTransportState(state.Stopped)
+		}
+		a.st.SetStandby(on)
+		return nil
+	})
+}
+
+// preloadNext hands the player the next URI after a playlist edit changed
+// which track follows the one playing.
+func (a *Actions) preloadNext() {
+	p := a.st.GetActivePlayer()
+	if p == nil || a.st.PlaylistCurrent() == 0 {
+		return
+	}
+	ctx := a.st.Context()
+	next, _ := a.st.GetNextURI()
+	if err := p.SetNext(ctx, next); err != nil {
+		log.CtxWarn(ctx, "preload next playlist track: %v", err)
+	}
+}
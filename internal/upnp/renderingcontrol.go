@@ -10,14 +10,10 @@ import (
 
 	"github.com/tr1v3r/rcast/internal/config"
 	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/quirk"
 	"github.com/tr1v3r/rcast/internal/state"
 )
 
-// Aweme on iOS exposes eight system volume steps but changes the UPnP value by
-// five points per step. 100 / (8 * 5) expands that 40-point logical range to
-// the player's full 0-100 range.
-const awemeIOSVolumeScale = 2.5
-
 // systemVolumeSink/systemMuteSink are injectable so tests can exercise the
 // LinkSystemOutputVolume branches without changing the host's real volume.
 var (
@@ -26,6 +22,8 @@ var (
 )
 
 func RenderingControlHandler(st *state.PlayerState, cfg config.Config) http.HandlerFunc {
+	actions := NewActions(st)
+	quirks := quirk.NewRegistry(cfg.Quirks)
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := st.Context()
 		sa := ParseSOAPAction(r.Header.Get("SOAPACTION"))
@@ -33,79 +31,39 @@ func RenderingControlHandler(st *state.PlayerState, cfg config.Config) http.Hand
 		if !ok {
 			return
 		}
-		controller := ControllerID(r)
-		volumeScale := volumeScaleForUserAgent(r.UserAgent())
+		controller := NewController(r, quirks)
 
 		log.CtxDebug(ctx, "get request header: %+v", r.Header)
 		log.CtxDebug(ctx, "get request body: %s", string(body))
 
 		switch sa {
 		case "SetVolume":
-			vStr := XMLText(body, "DesiredVolume")
-			v, err := strconv.Atoi(vStr)
+			v, err := strconv.Atoi(XMLText(body, "DesiredVolume"))
 			if err != nil {
-				WriteSOAPError(w, 402, "Invalid Args")
+				writeActionError(w, ErrInvalidArgs)
 				return
 			}
-			if v < 0 {
-				v = 0
-			}
-			if v > 100 {
-				v = 100
+			if err := actions.SetVolume(controller, v); err != nil {
+				writeActionError(w, err)
+				return
 			}
-			st.Serialize(func() {
-				if !requireSession(w, st, cfg, controller) {
-					return
-				}
-				appliedVolume := st.PreviewVolumeRequest(controller, v, volumeScale)
-				if p := st.GetActivePlayer(); p != nil {
-					if err := p.SetVolume(ctx, appliedVolume); err != nil {
-						WriteSOAPError(w, 501, "Action Failed")
-						log.CtxError(ctx, "iina set volume error: %v", err)
-						return
-					}
-				}
-				if cfg.LinkSystemOutputVolume {
-					if err := systemVolumeSink(appliedVolume); err != nil {
-						log.CtxWarn(ctx, "set system volume: %v", err)
-					}
-				}
-				st.CommitVolumeRequest(controller, v, volumeScale)
-				if volumeScale > 1 {
-					log.CtxDebug(ctx, "mapped controller volume raw=%d applied=%d user_agent=%s", v, appliedVolume, r.UserAgent())
-				}
-				WriteSOAPResponse(w, RenderingType, "SetVolumeResponse", "")
-			})
+			WriteSOAPResponse(w, RenderingType, "SetVolumeResponse", "")
 
 		case "GetVolume":
-			v := st.GetReportedVolume(controller, volumeScale)
+			v := st.GetReportedVolume(controller.ID, controller.Quirk.Scale())
 			WriteSOAPResponse(w, RenderingType, "GetVolumeResponse", fmt.Sprintf("<CurrentVolume>%d</CurrentVolume>", v))
 
 		case "SetMute":
 			mStr := strings.ToLower(XMLText(body, "DesiredMute"))
 			if mStr != "0" && mStr != "1" && mStr != "false" && mStr != "true" {
-				WriteSOAPError(w, 402, "Invalid Args")
+				writeActionError(w, ErrInvalidArgs)
+				return
+			}
+			if err := actions.SetMute(controller, mStr == "1" || mStr == "true"); err != nil {
+				writeActionError(w, err)
 				return
 			}
-			m := mStr == "1" || mStr == "true"
-			st.Serialize(func() {
-				if !requireSession(w, st, cfg, controller) {
-					return
-				}
-				if p := st.GetActivePlayer(); p != nil {
-					if err := p.SetMute(ctx, m); err != nil {
-						WriteSOAPError(w, 501, "Action Failed")
-						return
-					}
-				}
-				if cfg.LinkSystemOutputVolume {
-					if err := systemMuteSink(m); err != nil {
-						log.CtxWarn(ctx, "set system mute: %v", err)
-					}
-				}
-				st.SetMute(m)
-				WriteSOAPResponse(w, RenderingType, "SetMuteResponse", "")
-			})
+			WriteSOAPResponse(w, RenderingType, "SetMuteResponse", "")
 
 		case "GetMute":
 			m := st.GetMute()
@@ -116,15 +74,7 @@ func RenderingControlHandler(st *state.PlayerState, cfg config.Config) http.Hand
 			WriteSOAPResponse(w, RenderingType, "GetMuteResponse", fmt.Sprintf("<CurrentMute>%s</CurrentMute>", val))
 
 		default:
-			WriteSOAPError(w, 401, "Invalid Action")
+			writeActionError(w, ErrInvalidAction)
 		}
 	}
 }
-
-func volumeScaleForUserAgent(userAgent string) float64 {
-	ua := strings.ToLower(userAgent)
-	if strings.HasPrefix(ua, "aweme/") && strings.Contains(ua, "cfnetwork/") && strings.Contains(ua, "darwin/") {
-		return awemeIOSVolumeScale
-	}
-	return 1
-}
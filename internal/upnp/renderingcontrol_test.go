@@ -14,7 +14,7 @@ import (
 
 // overrideSystemSinks replaces the host-volume sinks with no-op stubs and
 // restores the originals (and LinkSystemOutputVolume default) on cleanup.
-// RenderingControl tests that touch cfg.LinkSystemOutputVolume MUST call this so
+// RenderingControl tests that enable LinkSystemOutputVolume MUST call this so
 // the host's real volume is never altered.
 func overrideSystemSinks(t *testing.T) (volumeCalls *[]int, muteCalls *[]bool) {
 	t.Helper()
@@ -134,8 +134,8 @@ func TestSetVolume_NoPlayerStillUpdatesState(t *testing.T) {
 func TestSetVolume_AnotherControllerOwnsSessionPreemptDisabled(t *testing.T) {
 	st, cleanup := newRCState(t, nil)
 	defer cleanup()
-	cfg := config.Config{AllowSessionPreempt: false}
-	handler := RenderingControlHandler(st, cfg)
+	st.ApplySettings(state.Settings{AllowSessionPreempt: false})
+	handler := RenderingControlHandler(st, config.Config{})
 
 	// First controller acquires the session and sets volume.
 	if rec := serveAction(handler, "SetVolume", soapBody(`<DesiredVolume>30</DesiredVolume>`), "10.0.0.1:1"); rec.Code != http.StatusOK {
@@ -154,8 +154,8 @@ func TestSetVolume_ControllerSwitchResetsVolumeMapping(t *testing.T) {
 	defer cleanup()
 	// Preemption is required for a different controller to take over the
 	// session; without it the second SetVolume would be refused with 712.
-	cfg := config.Config{AllowSessionPreempt: true}
-	handler := RenderingControlHandler(st, cfg)
+	st.ApplySettings(state.Settings{AllowSessionPreempt: true})
+	handler := RenderingControlHandler(st, config.Config{})
 	const awemeUA = "Aweme/390012 CFNetwork/3860.300.31 Darwin/25.2.0"
 
 	// Aweme iOS controller sets a volume that establishes a compatibility mapping.
@@ -163,7 +163,7 @@ func TestSetVolume_ControllerSwitchResetsVolumeMapping(t *testing.T) {
 		t.Fatalf("aweme SetVolume status=%d body=%s", rec.Code, rec.Body.String())
 	}
 	// The mapping for controller 1 must report back the raw value.
-	if got := st.GetReportedVolume("10.0.0.1", awemeIOSVolumeScale); got != 60 {
+	if got := st.GetReportedVolume("10.0.0.1", 2.5); got != 60 {
 		t.Fatalf("aweme reported=%d, want 60", got)
 	}
 	// A different controller takes over (preempt); the mapping must reset so its
@@ -175,7 +175,7 @@ func TestSetVolume_ControllerSwitchResetsVolumeMapping(t *testing.T) {
 		t.Fatalf("volume after controller switch=%d, want 50", got)
 	}
 	// New controller has no special mapping.
-	if got := st.GetReportedVolume("10.0.0.2", awemeIOSVolumeScale); got != 50 {
+	if got := st.GetReportedVolume("10.0.0.2", 2.5); got != 50 {
 		t.Fatalf("controller 2 reported=%d, want 50", got)
 	}
 }
@@ -276,8 +276,8 @@ func TestLinkSystemOutputVolume_SetVolumeSuccess(t *testing.T) {
 	volCalls, _ := overrideSystemSinks(t)
 	st, cleanup := newRCState(t, nil)
 	defer cleanup()
-	cfg := config.Config{LinkSystemOutputVolume: true}
-	handler := RenderingControlHandler(st, cfg)
+	st.ApplySettings(state.Settings{LinkSystemOutputVolume: true})
+	handler := RenderingControlHandler(st, config.Config{})
 
 	rec := serveAction(handler, "SetVolume", soapBody(`<DesiredVolume>55</DesiredVolume>`), "10.0.0.1:1")
 	assertSOAPSuccess(t, rec, "SetVolumeResponse")
@@ -303,8 +303,8 @@ func TestLinkSystemOutputVolume_SetVolumeSinkErrorIsWarnOnly(t *testing.T) {
 
 	st, cleanup := newRCState(t, nil)
 	defer cleanup()
-	cfg := config.Config{LinkSystemOutputVolume: true}
-	handler := RenderingControlHandler(st, cfg)
+	st.ApplySettings(state.Settings{LinkSystemOutputVolume: true})
+	handler := RenderingControlHandler(st, config.Config{})
 
 	// Sink error must NOT fail the SOAP response — it is warn-only.
 	rec := serveAction(handler, "SetVolume", soapBody(`<DesiredVolume>60</DesiredVolume>`), "10.0.0.1:1")
@@ -319,8 +319,8 @@ func TestLinkSystemOutputVolume_SetMuteSuccess(t *testing.T) {
 	_, muteCalls := overrideSystemSinks(t)
 	st, cleanup := newRCState(t, nil)
 	defer cleanup()
-	cfg := config.Config{LinkSystemOutputVolume: true}
-	handler := RenderingControlHandler(st, cfg)
+	st.ApplySettings(state.Settings{LinkSystemOutputVolume: true})
+	handler := RenderingControlHandler(st, config.Config{})
 
 	rec := serveAction(handler, "SetMute", soapBody(`<DesiredMute>true</DesiredMute>`), "10.0.0.1:1")
 	assertSOAPSuccess(t, rec, "SetMuteResponse")
@@ -344,8 +344,8 @@ func TestLinkSystemOutputVolume_SetMuteSinkErrorIsWarnOnly(t *testing.T) {
 
 	st, cleanup := newRCState(t, nil)
 	defer cleanup()
-	cfg := config.Config{LinkSystemOutputVolume: true}
-	handler := RenderingControlHandler(st, cfg)
+	st.ApplySettings(state.Settings{LinkSystemOutputVolume: true})
+	handler := RenderingControlHandler(st, config.Config{})
 
 	rec := serveAction(handler, "SetMute", soapBody(`<DesiredMute>1</DesiredMute>`), "10.0.0.1:1")
 	assertSOAPSuccess(t, rec, "SetMuteResponse")
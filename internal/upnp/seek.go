@@ -0,0 +1,181 @@
+package upnp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/monitoring"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/quirk"
+)
+
+// SeekUnits are the AVTransport seek units Seek implements, as listed in the
+// SCPD, and so the ones a quirk profile may force.
+var SeekUnits = []string{"REL_TIME", "ABS_TIME", "X_DLNA_REL_BYTE", "ABS_COUNT", "TRACK_NR"}
+
+// ValidateQuirks reports configured quirk profiles forcing a seek unit Seek
+// does not implement, in the same form as config validation problems.
+func ValidateQuirks(profiles []quirk.Profile) error {
+	var problems []string
+	for i, p := range profiles {
+		if p.SeekUnit != "" && !slices.Contains(SeekUnits, p.SeekUnit) {
+			problems = append(problems, fmt.Sprintf("quirks[%d] %q: seek_unit %q is not one of %s",
+				i, p.Name, p.SeekUnit, strings.Join(SeekUnits, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// seekTarget is a Seek request read from its Unit and Target arguments.
+type seekTarget struct {
+	unit  string
+	value float64 // seconds, bytes or a track number, depending on unit
+}
+
+// parseSeek reads a Seek request. Units outside SeekUnits are not supported
+// (710); targets that do not fit their unit are illegal (711).
+func parseSeek(unit, target string) (seekTarget, *Error) {
+	if !slices.Contains(SeekUnits, unit) {
+		return seekTarget{}, ErrSeekModeNotSupported
+	}
+	target = strings.TrimSpace(target)
+	t := seekTarget{unit: unit}
+	switch unit {
+	case "REL_TIME", "ABS_TIME":
+		seconds, err := timeToSeconds(target)
+		if err != nil || (unit == "ABS_TIME" && seconds < 0) {
+			return seekTarget{}, ErrIllegalSeekTarget
+		}
+		t.value = seconds
+	default: // X_DLNA_REL_BYTE, ABS_COUNT, TRACK_NR
+		n, err := strconv.ParseUint(target, 10, 63)
+		if err != nil || (unit == "TRACK_NR" && n == 0) {
+			return seekTarget{}, ErrIllegalSeekTarget
+		}
+		t.value = float64(n)
+	}
+	return t, nil
+}
+
+// timeToSeconds reads an AVTransport time, "H+:MM:SS" with an optional
+// decimal ".F+" or fractional ".F0/F1" part, as seconds. It may carry a
+// leading sign; "-" makes it negative.
+func timeToSeconds(t string) (float64, error) {
+	sign := 1.0
+	body := t
+	if rest, ok := strings.CutPrefix(body, "-"); ok {
+		sign, body = -1, rest
+	} else {
+		body = strings.TrimPrefix(body, "+")
+	}
+	parts := strings.Split(body, ":")
+	if len(parts) != 3 || !digits(parts[0]) || len(parts[1]) != 2 || !digits(parts[1]) {
+		return 0, fmt.Errorf("invalid time format: %s", t)
+	}
+	h, _ := strconv.Atoi(parts[0])
+	m, _ := strconv.Atoi(parts[1])
+	secs, frac, hasFrac := strings.Cut(parts[2], ".")
+	if len(secs) != 2 || !digits(secs) || (hasFrac && frac == "") {
+		return 0, fmt.Errorf("invalid time format: %s", t)
+	}
+	s, _ := strconv.Atoi(secs)
+	if m >= 60 || s >= 60 {
+		return 0, fmt.Errorf("invalid time value: %s", t)
+	}
+	f, err := fraction(frac)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time fraction: %s", t)
+	}
+	return sign * (float64(h)*3600 + float64(m)*60 + float64(s) + f), nil
+}
+
+// fraction evaluates the part after the seconds' dot: decimal digits, or
+// F0/F1 with F0 < F1.
+func fraction(f string) (float64, error) {
+	if f == "" {
+		return 0, nil
+	}
+	num, den, ok := strings.Cut(f, "/")
+	if !ok {
+		if !digits(f) {
+			return 0, fmt.Errorf("invalid fraction %q", f)
+		}
+		return strconv.ParseFloat("0."+f, 64)
+	}
+	if !digits(num) || !digits(den) {
+		return 0, fmt.Errorf("invalid fraction %q", f)
+	}
+	n, _ := strconv.ParseFloat(num, 64)
+	d, _ := strconv.ParseFloat(den, 64)
+	if n >= d {
+		return 0, fmt.Errorf("invalid fraction %q", f)
+	}
+	return n / d, nil
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// seekPlayer carries out t on p. REL_TIME is an offset from the current
+// position, clamped to the media, and ABS_TIME a position from its start.
+// Outside the playlist the current media is the only track, so TRACK_NR 1
+// rewinds it.
+// Byte targets become a percentage of the player's file size, since mpv
+// seeks by time or percent only.
+func seekPlayer(ctx context.Context, p player.Player, t seekTarget) *Error {
+	failed := func(err error) *Error {
+		if err == nil {
+			return nil
+		}
+		log.CtxError(ctx, "player seek error: %v", err)
+		monitoring.GetMetrics().RecordPlayerError()
+		return ErrActionFailed
+	}
+	switch t.unit {
+	case "X_DLNA_REL_BYTE", "ABS_COUNT":
+		size, err := p.GetFileSize(ctx)
+		if err != nil || size <= 0 || t.value > float64(size) {
+			return ErrIllegalSeekTarget
+		}
+		return failed(p.SeekPercent(ctx, 100*t.value/float64(size)))
+	case "TRACK_NR":
+		if t.value != 1 {
+			return ErrIllegalSeekTarget
+		}
+		return failed(p.Seek(ctx, 0))
+	}
+
+	seconds := t.value
+	duration, _ := p.GetDuration(ctx)
+	if t.unit == "REL_TIME" {
+		pos, err := p.GetPosition(ctx)
+		if err != nil {
+			return failed(err)
+		}
+		seconds = max(pos+seconds, 0)
+		if duration > 0 {
+			seconds = min(seconds, duration)
+		}
+	} else if duration > 0 && seconds > duration {
+		return ErrIllegalSeekTarget
+	}
+	return failed(p.Seek(ctx, seconds))
+}
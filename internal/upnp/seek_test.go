@@ -0,0 +1,126 @@
+package upnp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/quirk"
+)
+
+func TestTimeToSeconds(t *testing.T) {
+	for in, want := range map[string]float64{
+		"01:02:03.5":     3723.5,
+		"100:00:00":      360000,
+		"0:00:01.25":     1.25,
+		"00:00:10.1/4":   10.25,
+		"+0:00:10":       10,
+		"-00:00:05.1/2":  -5.5,
+		"+12:34:56.0/10": 45296,
+	} {
+		if got, err := timeToSeconds(in); err != nil || got != want {
+			t.Errorf("timeToSeconds(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, invalid := range []string{"1:60:00", "1:00:60", "garbage", "0:0:01", "0:00:1", "0:00:01.", "0:00:01.3/2", "0:00:01.1/0", "+-0:00:01", " 0:00:01"} {
+		if _, err := timeToSeconds(invalid); err == nil {
+			t.Errorf("timeToSeconds(%q) unexpectedly succeeded", invalid)
+		}
+	}
+}
+
+func TestParseSeek(t *testing.T) {
+	cases := []struct {
+		unit, target string
+		want         seekTarget
+		err          *Error
+	}{
+		{"REL_TIME", "00:01:00", seekTarget{unit: "REL_TIME", value: 60}, nil},
+		{"REL_TIME", "-00:00:10", seekTarget{unit: "REL_TIME", value: -10}, nil},
+		{"ABS_TIME", "+00:00:10", seekTarget{unit: "ABS_TIME", value: 10}, nil},
+		{"ABS_TIME", "-00:00:10", seekTarget{}, ErrIllegalSeekTarget},
+		{"X_DLNA_REL_BYTE", "1048576", seekTarget{unit: "X_DLNA_REL_BYTE", value: 1 << 20}, nil},
+		{"ABS_COUNT", "0", seekTarget{unit: "ABS_COUNT"}, nil},
+		{"TRACK_NR", "1", seekTarget{unit: "TRACK_NR", value: 1}, nil},
+		{"TRACK_NR", "0", seekTarget{}, ErrIllegalSeekTarget},
+		{"X_DLNA_REL_BYTE", "-5", seekTarget{}, ErrIllegalSeekTarget},
+		{"REL_COUNT", "5", seekTarget{}, ErrSeekModeNotSupported},
+		{"", "00:00:01", seekTarget{}, ErrSeekModeNotSupported},
+	}
+	for _, c := range cases {
+		got, err := parseSeek(c.unit, c.target)
+		if got != c.want || err != c.err {
+			t.Errorf("parseSeek(%q, %q) = %+v, %v; want %+v, %v", c.unit, c.target, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestValidateQuirks(t *testing.T) {
+	if err := ValidateQuirks(append(quirk.Builtin(), quirk.Profile{Name: "ok", SeekUnit: "REL_TIME"})); err != nil {
+		t.Fatalf("ValidateQuirks = %v", err)
+	}
+	err := ValidateQuirks([]quirk.Profile{{Name: "ok"}, {Name: "bad", SeekUnit: "REL_COUNT"}})
+	if err == nil || !strings.Contains(err.Error(), `quirks[1] "bad": seek_unit "REL_COUNT"`) {
+		t.Fatalf("ValidateQuirks = %v, want the unknown unit reported", err)
+	}
+}
+
+func TestSeek_UnitsMapToPlayer(t *testing.T) {
+	fake := newFakePlayer()
+	fake.position, fake.duration, fake.fileSize = 100, 600, 4000
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+	setupAVT(t, st, handler, remote, "https://example.test/v.mp4")
+
+	for _, body := range []string{
+		`<Unit>REL_TIME</Unit><Target>00:00:20</Target>`,     // 120, from the position
+		`<Unit>REL_TIME</Unit><Target>+00:00:30</Target>`,    // 130
+		`<Unit>REL_TIME</Unit><Target>-00:05:00</Target>`,    // clamped to 0
+		`<Unit>REL_TIME</Unit><Target>+01:00:00</Target>`,    // clamped to 600
+		`<Unit>ABS_TIME</Unit><Target>00:02:00.1/2</Target>`, // 120.5
+		`<Unit>ABS_TIME</Unit><Target>+00:00:20</Target>`,    // 20, from the start
+		`<Unit>TRACK_NR</Unit><Target>1</Target>`,            // 0
+		`<Unit>X_DLNA_REL_BYTE</Unit><Target>1000</Target>`,  // 25%
+		`<Unit>ABS_COUNT</Unit><Target>2000</Target>`,        // 50%
+	} {
+		assertSOAPSuccess(t, serveAction(handler, "Seek", soapBody(body), remote), "SeekResponse")
+	}
+	for _, body := range []string{
+		`<Unit>ABS_TIME</Unit><Target>00:10:01</Target>`, // past the end
+		`<Unit>ABS_TIME</Unit><Target>-00:00:05</Target>`,
+		`<Unit>TRACK_NR</Unit><Target>2</Target>`,
+		`<Unit>X_DLNA_REL_BYTE</Unit><Target>4001</Target>`,
+	} {
+		assertUPnPError(t, serveAction(handler, "Seek", soapBody(body), remote), 711)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	wantSeeks := []float64{120, 130, 0, 600, 120.5, 20, 0}
+	if len(fake.seeks) != len(wantSeeks) {
+		t.Fatalf("seeks=%v, want %v", fake.seeks, wantSeeks)
+	}
+	for i, s := range wantSeeks {
+		if fake.seeks[i] != s {
+			t.Fatalf("seeks=%v, want %v", fake.seeks, wantSeeks)
+		}
+	}
+	if len(fake.percents) != 2 || fake.percents[0] != 25 || fake.percents[1] != 50 {
+		t.Fatalf("percents=%v, want [25 50]", fake.percents)
+	}
+}
+
+func TestSeek_BytesNeedAFileSize(t *testing.T) {
+	fake := newFakePlayer()
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	handler := AVTransportHandler(st, config.Config{})
+	const remote = "10.0.0.1:1"
+	setupAVT(t, st, handler, remote, "https://example.test/live.ts")
+
+	rec := serveAction(handler, "Seek", soapBody(`<Unit>X_DLNA_REL_BYTE</Unit><Target>1000</Target>`), remote)
+	assertUPnPError(t, rec, 711)
+}
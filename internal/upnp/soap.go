@@ -79,6 +79,11 @@ func WriteSOAPError(w http.ResponseWriter, code int, desc string) {
 	_, _ = w.Write([]byte(builder.String()))
 }
 
+// writeActionError renders a failed action as a SOAP fault.
+func writeActionError(w http.ResponseWriter, err *Error) {
+	WriteSOAPError(w, err.Code, err.Description)
+}
+
 func XMLText(b []byte, tag string) string {
 	decoder := xml.NewDecoder(bytes.NewReader(b))
 	for {
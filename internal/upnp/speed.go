@@ -0,0 +1,61 @@
+package upnp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PlaySpeeds are the TransportPlaySpeed values Play accepts, as listed in
+// the AVTransport SCPD. mpv cannot play backwards, so there are no negative
+// speeds.
+var PlaySpeeds = []string{"1/16", "1/8", "1/4", "1/2", "3/4", "1", "5/4", "3/2", "2", "4", "8", "16"}
+
+// parsePlaySpeed reads a TransportPlaySpeed such as "1/2" or "2". An empty
+// value means normal speed, since some controllers leave Speed out. Values
+// that parse but are not in PlaySpeeds, like "-1", are unsupported (717)
+// rather than invalid.
+func parsePlaySpeed(s string) (float64, *Error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 1, nil
+	}
+	speed, err := speedValue(s)
+	if err != nil {
+		return 0, ErrInvalidArgs
+	}
+	for _, allowed := range PlaySpeeds {
+		if v, _ := speedValue(allowed); v == speed {
+			return speed, nil
+		}
+	}
+	return 0, ErrPlaySpeedNotSupported
+}
+
+// speedValue evaluates a fraction "n/d" or a plain number.
+func speedValue(s string) (float64, error) {
+	num, den, fraction := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, err
+	}
+	if !fraction {
+		return n, nil
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0, fmt.Errorf("invalid play speed %q", s)
+	}
+	return n / d, nil
+}
+
+// formatPlaySpeed renders speed the way PlaySpeeds spells it, falling back
+// to a decimal for speeds set outside UPnP.
+func formatPlaySpeed(speed float64) string {
+	for _, allowed := range PlaySpeeds {
+		if v, _ := speedValue(allowed); v == speed {
+			return allowed
+		}
+	}
+	return strconv.FormatFloat(speed, 'f', -1, 64)
+}
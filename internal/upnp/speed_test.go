@@ -0,0 +1,36 @@
+package upnp
+
+import "testing"
+
+func TestParsePlaySpeed(t *testing.T) {
+	cases := []struct {
+		in   string
+		want float64
+		err  *Error
+	}{
+		{"", 1, nil},
+		{"1", 1, nil},
+		{"1/2", 0.5, nil},
+		{" 2 ", 2, nil},
+		{"0.25", 0.25, nil},
+		{"-1", 0, ErrPlaySpeedNotSupported},
+		{"0", 0, ErrPlaySpeedNotSupported},
+		{"3", 0, ErrPlaySpeedNotSupported},
+		{"1/0", 0, ErrInvalidArgs},
+		{"x", 0, ErrInvalidArgs},
+	}
+	for _, c := range cases {
+		got, err := parsePlaySpeed(c.in)
+		if got != c.want || err != c.err {
+			t.Errorf("parsePlaySpeed(%q) = %v, %v; want %v, %v", c.in, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestFormatPlaySpeedUsesListedSpelling(t *testing.T) {
+	for speed, want := range map[float64]string{1: "1", 0.5: "1/2", 1.25: "5/4", 1.1: "1.1"} {
+		if got := formatPlaySpeed(speed); got != want {
+			t.Errorf("formatPlaySpeed(%v) = %q, want %q", speed, got, want)
+		}
+	}
+}
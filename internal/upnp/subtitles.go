@@ -0,0 +1,65 @@
+package upnp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tr1v3r/pkg/log"
+
+	"github.com/tr1v3r/rcast/internal/player"
+)
+
+// captionClient asks media servers for the CaptionInfo.sec header; a var so
+// tests can point it elsewhere.
+var captionClient = &http.Client{Timeout: 3 * time.Second}
+
+// loadSubtitles adds the subtitles of the media just started once the player
+// has opened it. They come from the DIDL-Lite metadata or, when that names
+// none, from the media server's CaptionInfo.sec header.
+func (a *Actions) loadSubtitles(uri, meta string) {
+	ctx := a.st.Context()
+	var subs []string
+	if d, err := ParseDIDL(meta); err == nil && len(d.Items) > 0 {
+		subs = d.Items[0].Subtitles
+	}
+	if len(subs) == 0 {
+		if sub := captionHeader(ctx, uri); sub != "" {
+			subs = []string{sub}
+		}
+	}
+	if len(subs) == 0 {
+		return
+	}
+	a.whenLoaded(uri, "loading subtitles", func(p player.Player, _ float64) {
+		if err := p.AddSubtitles(ctx, subs); err != nil {
+			log.CtxWarn(ctx, "load subtitles %v: %v", subs, err)
+			return
+		}
+		log.CtxInfo(ctx, "loaded %d subtitle track(s) for %s", len(subs), uri)
+	})
+}
+
+// captionHeader asks the server of an HTTP media URI for its subtitle the
+// way Samsung TVs do: a request with getCaptionInfo.sec: 1 is answered with
+// the subtitle URL in the CaptionInfo.sec header. Servers without the
+// extension simply omit it.
+func captionHeader(ctx context.Context, uri string) string {
+	if !strings.HasPrefix(uri, "http://") && !strings.HasPrefix(uri, "https://") {
+		return ""
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, uri, nil)
+	if err != nil {
+		return ""
+	}
+	// Sent in the TVs' spelling; some servers compare it case-sensitively.
+	req.Header["getCaptionInfo.sec"] = []string{"1"}
+	resp, err := captionClient.Do(req)
+	if err != nil {
+		log.CtxDebug(ctx, "caption header probe for %s: %v", uri, err)
+		return ""
+	}
+	resp.Body.Close()
+	return strings.TrimSpace(resp.Header.Get("CaptionInfo.sec"))
+}
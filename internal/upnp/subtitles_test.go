@@ -0,0 +1,75 @@
+package upnp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tr1v3r/rcast/internal/player"
+)
+
+func TestCaptionHeaderAsksLikeSamsungTVs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && r.Header.Get("getCaptionInfo.sec") == "1" {
+			w.Header().Set("CaptionInfo.sec", "http://srv/film.srt")
+		}
+	}))
+	defer srv.Close()
+
+	if got := captionHeader(context.Background(), srv.URL+"/film.mp4"); got != "http://srv/film.srt" {
+		t.Fatalf("captionHeader = %q", got)
+	}
+	if got := captionHeader(context.Background(), "file:///film.mp4"); got != "" {
+		t.Fatalf("captionHeader for a local file = %q", got)
+	}
+}
+
+func TestPlayLoadsSubtitlesOnceLoaded(t *testing.T) {
+	defer func(poll time.Duration) { loadPoll = poll }(loadPoll)
+	loadPoll = time.Millisecond
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("CaptionInfo.sec", "http://srv/header.srt")
+	}))
+	defer srv.Close()
+
+	fake := newFakePlayer()
+	fake.duration = 600
+	st, cleanup := newAVTState(t, func() player.Player { return fake })
+	defer cleanup()
+	actions := NewActions(st)
+	c := Controller{ID: "10.0.0.1"}
+	subs := func() [][]string {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return append([][]string(nil), fake.subs...)
+	}
+	waitSubs := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for got := subs(); len(got) == 0 || got[len(got)-1][0] != want; got = subs() {
+			if time.Now().After(deadline) {
+				t.Fatalf("subtitles = %v, want %s last", got, want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The DIDL-Lite names a subtitle: no need to ask the server.
+	meta := `<DIDL-Lite xmlns:dc="http://purl.org/dc/elements/1.1/"><item><dc:title>Film</dc:title>` +
+		`<res protocolInfo="http-get:*:text/srt:*">http://srv/didl.srt</res></item></DIDL-Lite>`
+	if err := actions.SetURI(c, srv.URL+"/a.mp4", meta); err != nil {
+		t.Fatalf("SetURI: %v", err)
+	}
+	if err := actions.Play(c, 0, nil); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	waitSubs("http://srv/didl.srt")
+
+	// Bare URL: the server's CaptionInfo.sec header supplies it.
+	if err := actions.Cast(c, srv.URL+"/b.mp4", "", nil); err != nil {
+		t.Fatalf("Cast: %v", err)
+	}
+	waitSubs("http://srv/header.srt")
+}
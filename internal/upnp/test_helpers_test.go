@@ -28,10 +28,16 @@ type handlerFakePlayer struct {
 	errs     map[string]error // per-method error injection keyed by method name
 	calls    []string         // ordered log of method names
 	seeks    []float64
+	percents []float64
 	mutes    []bool
 	speeds   []float64
+	nexts    []string
+	subs     [][]string
+	path     string
 	position float64
 	duration float64
+	fileSize int64
+	info     player.MediaInfo
 	posErr   error
 	durErr   error
 }
@@ -131,6 +137,14 @@ func (p *handlerFakePlayer) Seek(_ context.Context, seconds float64) error {
 	return p.errs["Seek"]
 }
 
+func (p *handlerFakePlayer) SeekPercent(_ context.Context, percent float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.percents = append(p.percents, percent)
+	p.calls = append(p.calls, "SeekPercent")
+	return p.errs["SeekPercent"]
+}
+
 func (p *handlerFakePlayer) GetPosition(context.Context) (float64, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -143,6 +157,42 @@ func (p *handlerFakePlayer) GetDuration(context.Context) (float64, error) {
 	return p.duration, p.durErr
 }
 
+func (p *handlerFakePlayer) GetMediaInfo(context.Context) (player.MediaInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.info, p.errs["GetMediaInfo"]
+}
+
+func (p *handlerFakePlayer) GetFileSize(context.Context) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fileSize, p.errs["GetFileSize"]
+}
+
+func (p *handlerFakePlayer) SetNext(_ context.Context, uri string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nexts = append(p.nexts, uri)
+	p.calls = append(p.calls, "SetNext")
+	return p.errs["SetNext"]
+}
+
+func (p *handlerFakePlayer) GetPath(context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.path, p.errs["GetPath"]
+}
+
+func (p *handlerFakePlayer) AddSubtitles(_ context.Context, uris []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subs = append(p.subs, uris)
+	p.calls = append(p.calls, "AddSubtitles")
+	return p.errs["AddSubtitles"]
+}
+
+func (p *handlerFakePlayer) Events() <-chan player.Event { return nil }
+
 // Compile-time guard: the spy must satisfy the Player interface.
 var _ player.Player = (*handlerFakePlayer)(nil)
 
@@ -2,7 +2,11 @@ package upnp
 
 import (
 	"encoding/xml"
+	"fmt"
 	"html"
+	"net/url"
+	"path"
+	"strings"
 )
 
 type DIDL struct {
@@ -15,23 +19,196 @@ type Item struct {
 	ParentID   string `xml:"parentID,attr"`
 	Restricted int    `xml:"restricted,attr"`
 	Title      string `xml:"http://purl.org/dc/elements/1.1/ title"`
+	Creator    string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Artist     string `xml:"urn:schemas-upnp-org:metadata-1-0/upnp/ artist"`
+	Album      string `xml:"urn:schemas-upnp-org:metadata-1-0/upnp/ album"`
+	AlbumArt   string `xml:"urn:schemas-upnp-org:metadata-1-0/upnp/ albumArtURI"`
 	Class      string `xml:"urn:schemas-upnp-org:metadata-1-0/upnp/ class"`
 	Resources  []Res  `xml:"res"`
+
+	// Subtitle sources in vendor extensions. They match by local name only,
+	// since some servers send the sec: and pv: prefixes undeclared.
+	CaptionInfoEx   []Caption `xml:"CaptionInfoEx"`
+	CaptionInfo     []Caption `xml:"CaptionInfo"`
+	SubtitleFileURI []Caption `xml:"subtitleFileUri"`
+
+	// Subtitles are the subtitle URLs gathered from all of the above and the
+	// subtitle-typed res entries, in that order and without duplicates.
+	Subtitles []string `xml:"-"`
 }
 
 type Res struct {
 	ProtocolInfo string `xml:"protocolInfo,attr"`
+	Duration     string `xml:"duration,attr"`
+	Resolution   string `xml:"resolution,attr"`
+	Size         string `xml:"size,attr"`
 	URL          string `xml:",chardata"`
 }
 
+// Caption is a subtitle reference such as
+// <sec:CaptionInfoEx sec:type="srt">http://…/a.srt</sec:CaptionInfoEx>.
+type Caption struct {
+	Type string `xml:"type,attr"`
+	URL  string `xml:",chardata"`
+}
+
+// subtitleMIMETypes are the res protocolInfo content types carrying
+// subtitles rather than media.
+var subtitleMIMETypes = map[string]bool{
+	"text/srt":             true,
+	"application/x-subrip": true,
+	"text/vtt":             true,
+	"text/x-ssa":           true,
+	"text/x-ass":           true,
+	"smi/caption":          true,
+	"text/smi":             true,
+}
+
+// IsSubtitle reports whether the resource is a subtitle file, judged by the
+// content type in its protocolInfo.
+func (r Res) IsSubtitle() bool {
+	parts := strings.Split(r.ProtocolInfo, ":")
+	return len(parts) == 4 && subtitleMIMETypes[strings.ToLower(parts[2])]
+}
+
 func ParseCurrentURIMetaData(metaEscaped string) (*DIDL, error) {
 	// 1) 去除外层标签时的空白可选（如果需要）
 	// 2) 反转义实体：&lt; -> <, &quot; -> "
-	meta := html.UnescapeString(metaEscaped)
+	return ParseDIDL(html.UnescapeString(metaEscaped))
+}
 
+// ParseDIDL decodes DIDL-Lite that is already unescaped, as the renderer
+// state keeps it, and collects each item's subtitles.
+func ParseDIDL(meta string) (*DIDL, error) {
 	var d DIDL
 	if err := xml.Unmarshal([]byte(meta), &d); err != nil {
 		return nil, err
 	}
+	for i := range d.Items {
+		d.Items[i].Subtitles = d.Items[i].subtitles()
+	}
 	return &d, nil
 }
+
+func (it Item) subtitles() []string {
+	var urls []string
+	seen := make(map[string]bool)
+	add := func(u string) {
+		if u = strings.TrimSpace(u); u != "" && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	for _, captions := range [][]Caption{it.CaptionInfoEx, it.CaptionInfo, it.SubtitleFileURI} {
+		for _, c := range captions {
+			add(c.URL)
+		}
+	}
+	for _, r := range it.Resources {
+		if r.IsSubtitle() {
+			add(r.URL)
+		}
+	}
+	return urls
+}
+
+// TrackInfo is what the player learnt about the media it opened, used where
+// the controller's metadata is silent.
+type TrackInfo struct {
+	Title         string  // mpv media-title
+	Duration      float64 // seconds, 0 when unknown
+	Width, Height int     // 0 for audio or when unknown
+}
+
+// TrackMetadata describes uri as DIDL-Lite for GetPositionInfo, GetMediaInfo
+// and LastChange: the item of meta when it parses, completed by info, or a
+// plain item for uri otherwise. It is "" when there is no uri.
+func TrackMetadata(uri, meta string, info TrackInfo) string {
+	if uri == "" {
+		return ""
+	}
+	it := Item{ID: "0", ParentID: "-1", Restricted: 1}
+	if d, err := ParseDIDL(meta); err == nil && len(d.Items) > 0 {
+		it = d.Items[0]
+	}
+	if it.Title == "" {
+		it.Title = info.Title
+	}
+	if it.Title == "" {
+		it.Title = uriName(uri)
+	}
+	if it.Class == "" {
+		it.Class = "object.item.videoItem"
+	}
+
+	// Only the resource being played is described, with what the player
+	// found out about it.
+	res := Res{ProtocolInfo: "http-get:*:*:*", URL: uri}
+	for _, r := range it.Resources {
+		if strings.TrimSpace(r.URL) == uri {
+			res = r
+			break
+		}
+	}
+	res.URL = uri
+	if res.Duration == "" && info.Duration > 0 {
+		res.Duration = didlDuration(info.Duration)
+	}
+	if res.Resolution == "" && info.Width > 0 && info.Height > 0 {
+		res.Resolution = fmt.Sprintf("%dx%d", info.Width, info.Height)
+	}
+	it.Resources = []Res{res}
+	return WriteDIDL(it)
+}
+
+// WriteDIDL renders it as a DIDL-Lite document. Text and attribute values
+// are escaped for XML here, once; SOAP responses and LastChange escape the
+// whole document again as the string value they carry.
+func WriteDIDL(it Item) string {
+	var b strings.Builder
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`)
+	fmt.Fprintf(&b, `<item id="%s" parentID="%s" restricted="%d">`, html.EscapeString(it.ID), html.EscapeString(it.ParentID), it.Restricted)
+	for _, e := range []struct{ name, value string }{
+		{"dc:title", it.Title},
+		{"dc:creator", it.Creator},
+		{"upnp:artist", it.Artist},
+		{"upnp:album", it.Album},
+		{"upnp:albumArtURI", it.AlbumArt},
+		{"upnp:class", it.Class},
+	} {
+		if e.value != "" {
+			b.WriteString("<" + e.name + ">" + html.EscapeString(e.value) + "</" + e.name + ">")
+		}
+	}
+	for _, r := range it.Resources {
+		b.WriteString(`<res protocolInfo="` + html.EscapeString(r.ProtocolInfo) + `"`)
+		for _, a := range []struct{ name, value string }{
+			{"duration", r.Duration},
+			{"resolution", r.Resolution},
+			{"size", r.Size},
+		} {
+			if a.value != "" {
+				b.WriteString(" " + a.name + `="` + html.EscapeString(a.value) + `"`)
+			}
+		}
+		b.WriteString(">" + html.EscapeString(r.URL) + "</res>")
+	}
+	b.WriteString("</item></DIDL-Lite>")
+	return b.String()
+}
+
+// didlDuration formats seconds as a res duration, H+:MM:SS.FFF.
+func didlDuration(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// uriName is the unescaped last path element of uri, the title of last
+// resort.
+func uriName(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Path == "" || u.Path == "/" {
+		return uri
+	}
+	return path.Base(u.Path)
+}
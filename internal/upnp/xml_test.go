@@ -70,3 +70,72 @@ func TestParseCurrentURIMetaData_EmptyReturnsError(t *testing.T) {
 		t.Fatal("expected error for empty input, got nil")
 	}
 }
+
+func TestParseDIDLCollectsSubtitles(t *testing.T) {
+	// sec: is left undeclared, as some servers send it.
+	const meta = `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:pv="http://www.pv.com/pvns/">` +
+		`<item id="1" parentID="0" restricted="1"><dc:title>Film</dc:title>` +
+		`<res protocolInfo="http-get:*:video/mp4:*">http://srv/film.mp4</res>` +
+		`<res protocolInfo="http-get:*:text/srt:*">http://srv/film.en.srt</res>` +
+		`<sec:CaptionInfoEx sec:type="srt">http://srv/film.srt</sec:CaptionInfoEx>` +
+		`<sec:CaptionInfo sec:type="srt">http://srv/film.srt</sec:CaptionInfo>` +
+		`<pv:subtitleFileUri pv:subtitleFileType="SRT">http://srv/film.pv.srt</pv:subtitleFileUri>` +
+		`</item></DIDL-Lite>`
+	d, err := ParseDIDL(meta)
+	if err != nil {
+		t.Fatalf("ParseDIDL: %v", err)
+	}
+	it := d.Items[0]
+	want := []string{"http://srv/film.srt", "http://srv/film.pv.srt", "http://srv/film.en.srt"}
+	if strings.Join(it.Subtitles, " ") != strings.Join(want, " ") {
+		t.Fatalf("subtitles = %v, want %v", it.Subtitles, want)
+	}
+	if it.CaptionInfoEx[0].Type != "srt" || it.Resources[0].IsSubtitle() || !it.Resources[1].IsSubtitle() {
+		t.Fatalf("item = %+v", it)
+	}
+}
+
+func TestTrackMetadataCompletesControllerDIDL(t *testing.T) {
+	const meta = `<DIDL-Lite xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/"><item id="7" parentID="3" restricted="1"><dc:title>Tom &amp; Jerry</dc:title><upnp:artist>Hanna</upnp:artist><upnp:class>object.item.videoItem.movie</upnp:class><res protocolInfo="http-get:*:video/mp4:*" size="42">http://example.test/a.mp4?x=1&amp;y=2</res><res protocolInfo="http-get:*:text/srt:*">http://example.test/a.srt</res></item></DIDL-Lite>`
+	out := TrackMetadata("http://example.test/a.mp4?x=1&y=2", meta, TrackInfo{Title: "a.mp4", Duration: 3723.25, Width: 1920, Height: 1080})
+
+	d, err := ParseDIDL(out)
+	if err != nil || len(d.Items) != 1 {
+		t.Fatalf("written DIDL does not parse: %v\n%s", err, out)
+	}
+	it := d.Items[0]
+	if it.ID != "7" || it.ParentID != "3" || it.Title != "Tom & Jerry" || it.Artist != "Hanna" || it.Class != "object.item.videoItem.movie" {
+		t.Fatalf("item = %+v", it)
+	}
+	if len(it.Resources) != 1 {
+		t.Fatalf("resources = %+v, want only the played one", it.Resources)
+	}
+	res := it.Resources[0]
+	if res.URL != "http://example.test/a.mp4?x=1&y=2" || res.ProtocolInfo != "http-get:*:video/mp4:*" || res.Size != "42" ||
+		res.Duration != "1:02:03.250" || res.Resolution != "1920x1080" {
+		t.Fatalf("res = %+v", res)
+	}
+	// Escaped once: the ampersand is an entity, never a double-escaped one.
+	if !strings.Contains(out, "Tom &amp; Jerry") || strings.Contains(out, "&amp;amp;") {
+		t.Fatalf("escaping in %s", out)
+	}
+}
+
+func TestTrackMetadataWithoutControllerDIDL(t *testing.T) {
+	if got := TrackMetadata("", "<DIDL-Lite/>", TrackInfo{}); got != "" {
+		t.Fatalf("metadata without a uri = %q", got)
+	}
+	for _, c := range []struct{ meta, title, want string }{
+		{"", "Player Title", "Player Title"},
+		{"not xml <", "", "my clip.mp4"},
+	} {
+		out := TrackMetadata("http://example.test/media/my%20clip.mp4", c.meta, TrackInfo{Title: c.title})
+		d, err := ParseDIDL(out)
+		if err != nil || len(d.Items) != 1 {
+			t.Fatalf("written DIDL does not parse: %v\n%s", err, out)
+		}
+		if it := d.Items[0]; it.Title != c.want || it.Class != "object.item.videoItem" || len(it.Resources) != 1 {
+			t.Fatalf("item = %+v, want title %q", it, c.want)
+		}
+	}
+}
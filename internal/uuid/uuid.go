@@ -3,10 +3,11 @@ package uuid
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	googleuuid "github.com/google/uuid"
+
+	"github.com/tr1v3r/rcast/internal/fileutil"
 )
 
 const legacyDefaultUUID = "uuid:0199ffd9-6856-74cc-a2f2-4c74af0161b1"
@@ -22,39 +23,24 @@ func LoadOrCreate(path string) (string, error) {
 		return "", fmt.Errorf("reading UUID file: %w", err)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return "", fmt.Errorf("creating UUID directory: %w", err)
-	}
-
 	id := "uuid:" + googleuuid.NewString()
-	tmp, err := os.CreateTemp(filepath.Dir(path), ".dmr_uuid-*")
-	if err != nil {
-		return "", fmt.Errorf("creating temporary UUID file: %w", err)
-	}
-	tmpName := tmp.Name()
-	defer func() { _ = os.Remove(tmpName) }()
-
-	if err := tmp.Chmod(0o644); err != nil {
-		_ = tmp.Close()
-		return "", fmt.Errorf("setting UUID file permissions: %w", err)
-	}
-	if _, err := tmp.WriteString(id + "\n"); err != nil {
-		_ = tmp.Close()
+	if err := fileutil.WriteAtomic(path, []byte(id+"\n"), 0o644); err != nil {
 		return "", fmt.Errorf("writing UUID file: %w", err)
 	}
-	if err := tmp.Sync(); err != nil {
-		_ = tmp.Close()
-		return "", fmt.Errorf("syncing UUID file: %w", err)
-	}
-	if err := tmp.Close(); err != nil {
-		return "", fmt.Errorf("closing UUID file: %w", err)
-	}
-	if err := os.Rename(tmpName, path); err != nil {
-		return "", fmt.Errorf("installing UUID file: %w", err)
-	}
 	return id, nil
 }
 
+// Derive returns the UUID of the renderer named name on an installation
+// whose UUID is base. It is a name-based UUID in base's namespace, so each
+// renderer keeps its identity across runs without a file of its own.
+func Derive(base, name string) (string, error) {
+	namespace, err := googleuuid.Parse(strings.TrimPrefix(base, "uuid:"))
+	if err != nil {
+		return "", fmt.Errorf("parsing base UUID %q: %w", base, err)
+	}
+	return "uuid:" + googleuuid.NewSHA1(namespace, []byte(name)).String(), nil
+}
+
 func normalize(b []byte) (string, bool) {
 	s := strings.TrimSpace(string(b))
 	s = strings.TrimPrefix(s, "uuid:")
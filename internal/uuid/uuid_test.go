@@ -183,3 +183,26 @@ func TestNormalize(t *testing.T) {
 		})
 	}
 }
+
+func TestDeriveIsStableAndDistinct(t *testing.T) {
+	const base = "uuid:11112222-3333-4444-5555-666677778888"
+	living, err := Derive(base, "living-room")
+	if err != nil {
+		t.Fatalf("Derive: %v", err)
+	}
+	again, _ := Derive(base, "living-room")
+	office, _ := Derive(base, "office")
+	other, _ := Derive("uuid:99992222-3333-4444-5555-666677778888", "living-room")
+	if living != again {
+		t.Fatalf("derived UUID changed: %q != %q", living, again)
+	}
+	if living == office || living == other || living == base {
+		t.Fatalf("derived UUIDs collide: %q %q %q", living, office, other)
+	}
+	if _, ok := normalize([]byte(living)); !ok {
+		t.Fatalf("derived invalid UUID %q", living)
+	}
+	if _, err := Derive("garbage", "office"); err == nil {
+		t.Fatal("Derive accepted an invalid base")
+	}
+}
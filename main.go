@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"sync"
 	"syscall"
 	"time"
 
@@ -14,10 +17,12 @@ import (
 	"github.com/urfave/cli/v3"
 
 	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/history"
 	"github.com/tr1v3r/rcast/internal/httpserver"
 	"github.com/tr1v3r/rcast/internal/netutil"
 	"github.com/tr1v3r/rcast/internal/ssdp"
 	"github.com/tr1v3r/rcast/internal/state"
+	"github.com/tr1v3r/rcast/internal/upnp"
 	"github.com/tr1v3r/rcast/internal/uuid"
 )
 
@@ -33,8 +38,6 @@ var (
 func main() {
 	defer log.Close()
 
-	cfg := config.Load()
-
 	cmd := &cli.Command{
 		Name:    "rcast",
 		Usage:   "RCast DMR",
@@ -47,17 +50,42 @@ func main() {
 			&cli.BoolFlag{
 				Name:    "fullscreen",
 				Aliases: []string{"fs"},
-				Usage:   "open iina in fullscreen",
-				Value:   cfg.IINAFullscreen,
+				Usage:   "open the player in fullscreen",
+			},
+			&cli.StringFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "JSON config file (default $XDG_CONFIG_HOME/rcast/config.json)",
 			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			if cmd.Bool("debug") {
+			// Flags win over the file and environment, on reload too.
+			loadConfig := func() (config.Config, error) {
+				cfg, err := config.Load(cmd.String("config"))
+				if err != nil {
+					return cfg, err
+				}
+				if err := upnp.ValidateQuirks(cfg.Quirks); err != nil {
+					return cfg, err
+				}
+				if cmd.IsSet("fullscreen") {
+					cfg.IINAFullscreen = cmd.Bool("fullscreen")
+				}
+				return cfg, nil
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if cmd.Bool("debug") || cfg.Debug {
 				log.SetLevel(log.DebugLevel)
 			}
-			cfg.IINAFullscreen = cmd.Bool("fullscreen")
+			if cfg.Path != "" {
+				log.Info("config loaded from %s", cfg.Path)
+			}
 
-			return runServer(ctx, cfg)
+			return runServer(ctx, cfg, loadConfig)
 		},
 	}
 
@@ -73,17 +101,19 @@ type serverDeps struct {
 	uuidLoader func(path string) (string, error)
 	resolveIP  func() (string, error)
 	listen     func(network, addr string) (net.Listener, error)
-	announce   func(ctx context.Context, baseURL, deviceUUID, serverName string)
-	search     func(ctx context.Context, baseURL, deviceUUID, serverName string)
+	announce   func(ctx context.Context, baseURL, deviceUUID, serverName string, config ssdp.ConfigSource)
+	search     func(ctx context.Context, baseURL, deviceUUID, serverName string, config ssdp.ConfigSource)
+	loadConfig func() (config.Config, error)
 }
 
-func runServer(ctx context.Context, cfg config.Config) error {
+func runServer(ctx context.Context, cfg config.Config, loadConfig func() (config.Config, error)) error {
 	return runServerWithRuntime(ctx, cfg, serverDeps{
 		uuidLoader: uuid.LoadOrCreate,
 		resolveIP:  netutil.FirstUsableIPv4,
 		listen:     net.Listen,
 		announce:   ssdp.Announce,
 		search:     ssdp.SearchResponder,
+		loadConfig: loadConfig,
 	})
 }
 
@@ -94,7 +124,7 @@ func runServerWithRuntime(ctx context.Context, cfg config.Config, deps serverDep
 	defer cancel()
 
 	// 设备 UUID
-	deviceUUID, err := deps.uuidLoader(cfg.UUIDPath)
+	baseUUID, err := deps.uuidLoader(cfg.UUIDPath)
 	if err != nil {
 		return fmt.Errorf("load device UUID: %w", err)
 	}
@@ -128,13 +158,34 @@ func runServerWithRuntime(ctx context.Context, cfg config.Config, deps serverDep
 	}
 	baseURL := fmt.Sprintf("http://%s:%d", ip, port)
 
-	// 状态
-	st := state.New(ctx, cfg)
-	defer st.Stop()
+	// 渲染器
+	mux := httpserver.NewMux()
+	httpserver.RegisterMetrics(mux)
+	var persisting sync.WaitGroup
+	var states []*state.PlayerState
+	defer func() {
+		for _, st := range states {
+			st.Stop()
+		}
+	}()
+	for _, rcfg := range cfg.Renderers() {
+		st, err := startRenderer(ctx, rcfg, baseUUID, baseURL, mux, deps, &persisting)
+		if err != nil {
+			_ = ln.Close()
+			cancel()
+			persisting.Wait()
+			return err
+		}
+		states = append(states, st)
+	}
+
+	// 配置热加载
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go reloadOnSignal(ctx, hup, cfg, deps.loadConfig, states)
 
 	// HTTP
-	mux := httpserver.NewMux()
-	httpserver.RegisterHTTP(mux, baseURL, deviceUUID, st, cfg)
 	srv := &http.Server{
 		Addr:              fmt.Sprintf(":%d", cfg.HTTPPort),
 		Handler:           httpserver.LogMiddleware(mux),
@@ -144,10 +195,6 @@ func runServerWithRuntime(ctx context.Context, cfg config.Config, deps serverDep
 		IdleTimeout:       60 * time.Second,
 	}
 
-	// SSDP
-	go deps.announce(ctx, baseURL, deviceUUID, serverName)
-	go deps.search(ctx, baseURL, deviceUUID, serverName)
-
 	// 启动 HTTP
 	serverErr := make(chan error, 1)
 	go func() {
@@ -170,7 +217,165 @@ func runServerWithRuntime(ctx context.Context, cfg config.Config, deps serverDep
 	if err := srv.Shutdown(ctxShutdown); err != nil && runErr == nil {
 		runErr = fmt.Errorf("shutting down HTTP server: %w", err)
 	}
+	persisting.Wait()
 	log.Info("bye")
 
 	return runErr
 }
+
+// startRenderer sets up the renderer rcfg describes: its state and the
+// files it persists to, its HTTP routes on mux and its SSDP announcements.
+// When several renderers share the host, each derives its UUID from
+// baseUUID and serves under /devices/<id>.
+func startRenderer(ctx context.Context, rcfg config.Config, baseUUID, baseURL string, mux *http.ServeMux, deps serverDeps, persisting *sync.WaitGroup) (*state.PlayerState, error) {
+	deviceUUID := baseUUID
+	if rcfg.Device != "" {
+		var err error
+		if deviceUUID, err = uuid.Derive(baseUUID, rcfg.Device); err != nil {
+			return nil, fmt.Errorf("derive UUID of %s: %w", rcfg.Device, err)
+		}
+		baseURL += "/devices/" + rcfg.Device
+	}
+
+	// 状态
+	st := state.New(ctx, rcfg)
+
+	// 播放历史
+	if rcfg.History {
+		h, err := history.Open(rcfg.HistoryPath(), history.DefaultMaxBytes, history.DefaultKeep)
+		if err != nil {
+			st.Stop()
+			return nil, fmt.Errorf("open cast history: %w", err)
+		}
+		st.SetHistory(h)
+	}
+
+	// 状态持久化
+	if rcfg.PersistState {
+		restoreState(st, rcfg.StatePath())
+		persisting.Go(func() { st.Persist(ctx, rcfg.StatePath(), persistDebounce) })
+	}
+	restorePositions(st, rcfg.PositionsPath())
+	persisting.Go(func() { st.PersistPositions(ctx, rcfg.PositionsPath(), persistDebounce) })
+
+	httpserver.RegisterHTTP(mux, baseURL, deviceUUID, st, rcfg)
+
+	// SSDP
+	go deps.announce(ctx, baseURL, deviceUUID, serverName, st)
+	go deps.search(ctx, baseURL, deviceUUID, serverName, st)
+
+	log.Info("renderer %q (%s) described at %s/device.xml", rcfg.FriendlyName, deviceUUID, baseURL)
+	return st, nil
+}
+
+// persistDebounce is the shortest interval between two state file writes.
+const persistDebounce = 2 * time.Second
+
+// restoreState applies the state saved by a previous run. A missing file is
+// normal on first start; a damaged one is logged and ignored.
+func restoreState(st *state.PlayerState, path string) {
+	saved, err := state.LoadSaved(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Warn("restore renderer state: %v", err)
+		return
+	}
+	st.Restore(saved)
+	log.Info("restored renderer state from %s (volume %d, mute %v)", path, saved.Volume, saved.Mute)
+}
+
+// restorePositions reloads the resume memory of a previous run.
+func restorePositions(st *state.PlayerState, path string) {
+	saved, err := state.LoadPositions(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Warn("restore resume positions: %v", err)
+		return
+	}
+	st.RestorePositions(saved)
+}
+
+// reloadOnSignal re-reads the configuration on every signal and applies the
+// settings that can change at runtime to each renderer in states, in the
+// order of running.Renderers. A file that fails to load is logged and leaves
+// the running settings untouched.
+func reloadOnSignal(ctx context.Context, sig <-chan os.Signal, running config.Config, load func() (config.Config, error), states []*state.PlayerState) {
+	started := running.Renderers()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+		}
+		cfg, err := load()
+		if err != nil {
+			log.Error("reload config: %v", err)
+			continue
+		}
+		renderers := cfg.Renderers()
+		for i, st := range states {
+			// A renderer added, removed or renamed only takes effect on restart.
+			if i < len(renderers) && renderers[i].Device == started[i].Device {
+				st.ApplySettings(state.SettingsFrom(renderers[i]))
+			}
+		}
+		for _, key := range restartOnlyChanges(running, cfg) {
+			log.Warn("config %s changed; restart rcast to apply it", key)
+		}
+		log.Info("config reloaded")
+	}
+}
+
+// restartOnlyChanges names the changed options that a reload cannot apply.
+func restartOnlyChanges(running, next config.Config) []string {
+	var keys []string
+	if running.UUIDPath != next.UUIDPath {
+		keys = append(keys, "uuid_path")
+	}
+	if running.HTTPPort != next.HTTPPort {
+		keys = append(keys, "http_port")
+	}
+	if running.AdvertiseIP != next.AdvertiseIP {
+		keys = append(keys, "advertise_ip")
+	}
+	if running.Player != next.Player {
+		keys = append(keys, "player")
+	}
+	if running.PersistState != next.PersistState {
+		keys = append(keys, "persist_state")
+	}
+	if running.History != next.History {
+		keys = append(keys, "history")
+	}
+	if running.AudioDevice != next.AudioDevice {
+		keys = append(keys, "audio_device")
+	}
+	if !reflect.DeepEqual(running.Quirks, next.Quirks) {
+		keys = append(keys, "quirks")
+	}
+	if !reflect.DeepEqual(running.DIALApps, next.DIALApps) {
+		keys = append(keys, "dial_apps")
+	}
+	if !sameRenderers(running.Devices, next.Devices) {
+		keys = append(keys, "devices")
+	}
+	return keys
+}
+
+// sameRenderers reports whether next keeps the renderers of running and
+// their audio devices; names and fullscreen settings apply on reload.
+func sameRenderers(running, next []config.Device) bool {
+	if len(running) != len(next) {
+		return false
+	}
+	for i := range running {
+		if running[i].ID != next[i].ID || running[i].AudioDevice != next[i].AudioDevice {
+			return false
+		}
+	}
+	return true
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"net"
+	"net/http"
+	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/tr1v3r/rcast/internal/config"
+	"github.com/tr1v3r/rcast/internal/player"
+	"github.com/tr1v3r/rcast/internal/quirk"
+	"github.com/tr1v3r/rcast/internal/ssdp"
+	"github.com/tr1v3r/rcast/internal/state"
 	"github.com/tr1v3r/rcast/internal/uuid"
 )
 
@@ -37,7 +48,7 @@ func newRecordedSSDP() *recordedSSDP {
 	}
 }
 
-func (r *recordedSSDP) announceFn(ctx context.Context, baseURL, deviceUUID, serverName string) {
+func (r *recordedSSDP) announceFn(ctx context.Context, baseURL, deviceUUID, serverName string, _ ssdp.ConfigSource) {
 	r.mu.Lock()
 	r.announce = append(r.announce, callArgs{baseURL, deviceUUID, serverName})
 	r.mu.Unlock()
@@ -47,7 +58,7 @@ func (r *recordedSSDP) announceFn(ctx context.Context, baseURL, deviceUUID, serv
 	}
 }
 
-func (r *recordedSSDP) searchFn(ctx context.Context, baseURL, deviceUUID, serverName string) {
+func (r *recordedSSDP) searchFn(ctx context.Context, baseURL, deviceUUID, serverName string, _ ssdp.ConfigSource) {
 	r.mu.Lock()
 	r.search = append(r.search, callArgs{baseURL, deviceUUID, serverName})
 	r.mu.Unlock()
@@ -100,13 +111,29 @@ func newBaseDeps(t *testing.T) (serverDeps, *recordedSSDP) {
 		listen:    net.Listen,
 		announce:  r.announceFn,
 		search:    r.searchFn,
+		loadConfig: func() (config.Config, error) {
+			return newBaseConfig(t), nil
+		},
 	}, r
 }
 
+// writeTestConfig writes body to a config file in a fresh directory.
+func writeTestConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
 // newBaseConfig returns a config that uses a temp UUID path and port 0.
 func newBaseConfig(t *testing.T) config.Config {
 	t.Helper()
-	cfg := config.Load()
+	cfg, err := config.Load(writeTestConfig(t, "{}"))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
 	cfg.UUIDPath = filepath.Join(t.TempDir(), "dmr_uuid.txt")
 	cfg.HTTPPort = 0
 	return cfg
@@ -276,6 +303,232 @@ func TestRunServer_ServeFailsAfterStart(t *testing.T) {
 	}
 }
 
+func TestRunServer_SIGHUPReloadsConfig(t *testing.T) {
+	cfg := newBaseConfig(t)
+	deps, r := newBaseDeps(t)
+	loaded := make(chan struct{}, 1)
+	deps.loadConfig = func() (config.Config, error) {
+		select {
+		case loaded <- struct{}{}:
+		default:
+		}
+		return cfg, nil
+	}
+
+	done, cancel := runWithCancel(context.Background(), cfg, deps)
+	defer cancel()
+	// The SIGHUP handler is installed before SSDP starts.
+	waitFor(t, r.annCh, "announce")
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("send SIGHUP: %v", err)
+	}
+	waitFor(t, loaded, "config reload")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runServer: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for runServer to shut down")
+	}
+}
+
+func TestRunServer_PersistsStateAcrossRuns(t *testing.T) {
+	cfg := newBaseConfig(t)
+	cfg.PersistState = true
+	if err := os.WriteFile(cfg.StatePath(), []byte(`{"volume": 33, "uri": "https://example.test/v.mp4"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deps, r := newBaseDeps(t)
+	addrs := make(chan string, 1)
+	deps.listen = func(network, addr string) (net.Listener, error) {
+		ln, err := net.Listen(network, "127.0.0.1:0")
+		if err == nil {
+			addrs <- ln.Addr().String()
+		}
+		return ln, err
+	}
+
+	done, cancel := runWithCancel(context.Background(), cfg, deps)
+	defer cancel()
+	waitFor(t, r.annCh, "announce")
+	base := "http://" + <-addrs
+
+	resp, err := http.Get(base + "/api/v1/status")
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	var status struct {
+		Volume   int    `json:"volume"`
+		LastCast string `json:"last_cast"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	_ = resp.Body.Close()
+	if err != nil || status.Volume != 33 || status.LastCast != "https://example.test/v.mp4" {
+		t.Fatalf("restored status = %+v, %v", status, err)
+	}
+
+	resp, err = http.Post(base+"/api/v1/mute", "application/json", bytes.NewBufferString(`{"mute": true}`))
+	if err != nil {
+		t.Fatalf("mute: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runServer: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for runServer to shut down")
+	}
+	saved, err := state.LoadSaved(cfg.StatePath())
+	if err != nil || !saved.Mute || saved.Volume != 33 || saved.URI != "https://example.test/v.mp4" {
+		t.Fatalf("saved after shutdown = %+v, %v", saved, err)
+	}
+}
+
+func TestRestoreStateIgnoresMissingAndDamagedFiles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st := state.NewWithPlayerFactory(ctx, config.Config{}, func() player.Player { return nil })
+	dir := t.TempDir()
+
+	restoreState(st, filepath.Join(dir, "missing.json"))
+	damaged := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(damaged, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	restoreState(st, damaged)
+	if st.GetVolume() != 50 {
+		t.Fatalf("volume = %d, want the default 50", st.GetVolume())
+	}
+	restorePositions(st, filepath.Join(dir, "positions-missing.json"))
+	restorePositions(st, damaged)
+	if st.ResumePosition("https://example.test/v.mp4", "") != 0 {
+		t.Fatal("damaged positions file restored an entry")
+	}
+}
+
+func TestReloadOnSignalAppliesSettings(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	running := config.Config{AllowSessionPreempt: true}
+	st := state.NewWithPlayerFactory(ctx, running, func() player.Player { return nil })
+
+	sig := make(chan os.Signal)
+	results := make(chan error)
+	next := config.Config{LinkSystemOutputVolume: true, IINAFullscreen: true, FriendlyName: "Den"}
+	load := func() (config.Config, error) {
+		err := <-results
+		return next, err
+	}
+	go reloadOnSignal(ctx, sig, running, load, []*state.PlayerState{st})
+
+	// A broken file leaves the running settings alone.
+	sig <- syscall.SIGHUP
+	results <- errors.New("parse config: unexpected EOF")
+	sig <- syscall.SIGHUP // handled only after the failed reload finished
+	if got := st.Settings(); !got.AllowSessionPreempt || got.LinkSystemOutputVolume {
+		t.Fatalf("settings after failed reload = %+v", got)
+	}
+
+	results <- nil
+	sig <- syscall.SIGHUP
+	want := state.Settings{LinkSystemOutputVolume: true, Fullscreen: true, FriendlyName: "Den"}
+	if got := st.Settings(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("settings = %+v, want %+v", got, want)
+	}
+	results <- nil
+}
+
+func TestRestartOnlyChanges(t *testing.T) {
+	running := config.Config{UUIDPath: "/a", HTTPPort: 8200, Player: config.PlayerMPV}
+	next := running
+	next.AllowSessionPreempt = true
+	next.FriendlyName = "Den"
+	if keys := restartOnlyChanges(running, next); len(keys) != 0 {
+		t.Fatalf("hot settings reported as restart-only: %v", keys)
+	}
+	next.HTTPPort = 9000
+	next.Player = config.PlayerIINA
+	next.Quirks = []quirk.Profile{{Name: "tv", UserAgent: []string{"tv/"}, FakePosition: true}}
+	keys := restartOnlyChanges(running, next)
+	if len(keys) != 3 || keys[0] != "http_port" || keys[1] != "player" || keys[2] != "quirks" {
+		t.Fatalf("keys = %v, want [http_port player quirks]", keys)
+	}
+
+	running.Devices = []config.Device{{ID: "tv", Name: "TV"}}
+	next = running
+	next.Devices = []config.Device{{ID: "tv", Name: "Living Room TV", Fullscreen: new(bool)}}
+	if keys := restartOnlyChanges(running, next); len(keys) != 0 {
+		t.Fatalf("renaming a renderer reported as restart-only: %v", keys)
+	}
+	next.Devices = append(next.Devices, config.Device{ID: "office", Name: "Office"})
+	if keys := restartOnlyChanges(running, next); len(keys) != 1 || keys[0] != "devices" {
+		t.Fatalf("keys = %v, want [devices]", keys)
+	}
+}
+
+func TestRunServer_SeveralRenderers(t *testing.T) {
+	cfg := newBaseConfig(t)
+	cfg.Devices = []config.Device{{ID: "living-room", Name: "Living Room (HDMI)"}, {ID: "office", Name: "Office (audio only)"}}
+	deps, r := newBaseDeps(t)
+	baseUUID, err := uuid.LoadOrCreate(cfg.UUIDPath)
+	if err != nil {
+		t.Fatalf("preload uuid: %v", err)
+	}
+
+	done, cancel := runWithCancel(context.Background(), cfg, deps)
+	defer cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mu.Lock()
+		calls := append([]callArgs(nil), r.announce...)
+		r.mu.Unlock()
+		if len(calls) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("announced %d renderers, want 2", len(calls))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	r.mu.Lock()
+	calls := append([]callArgs(nil), r.announce...)
+	r.mu.Unlock()
+	seen := map[string]callArgs{}
+	for _, c := range calls {
+		seen[c.deviceUUID] = c
+	}
+	for _, id := range []string{"living-room", "office"} {
+		want, _ := uuid.Derive(baseUUID, id)
+		c, ok := seen[want]
+		if !ok || !contains(c.baseURL, "/devices/"+id) {
+			t.Fatalf("%s not announced with its derived UUID %s: %+v", id, want, calls)
+		}
+		resp, err := http.Get(c.baseURL + "/device.xml")
+		if err != nil {
+			t.Fatalf("GET %s device.xml: %v", id, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !contains(string(body), "<UDN>"+want+"</UDN>") {
+			t.Fatalf("%s device.xml: %d\n%s", id, resp.StatusCode, body)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runServer: %v", err)
+	}
+}
+
 // contains is a tiny local helper to avoid pulling in strings (and keeps the
 // test file dependency-free).
 func contains(s, sub string) bool {